@@ -4,9 +4,14 @@ import (
 	"emcsrw/internal/bot/events"
 	"emcsrw/internal/bot/scheduler"
 	"emcsrw/internal/database"
+	"emcsrw/internal/health"
 	"emcsrw/internal/shared"
+	"emcsrw/pkg/utils/config"
 	"emcsrw/pkg/utils/logutil"
+	"emcsrw/pkg/utils/metrics"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"runtime"
@@ -76,6 +81,16 @@ func Start(s *discordgo.Session) {
 	// Init a scheduler that we can use to schedule tasks (ie. in OnReady)
 	scheduler.Instance = scheduler.New()
 
+	// Opt-in since the bot doesn't listen on any port otherwise.
+	var statusServer *http.Server
+	if v, err := config.GetEnviroVar("METRICS_PORT"); err == nil {
+		if port, err := config.ParseEnviroVar[uint](v); err == nil {
+			statusServer = ServeStatus(s, activeMapDB, port)
+		} else {
+			logutil.Printf(logutil.YELLOW, "\nWARN | Invalid METRICS_PORT. Metrics and health checks will not be served.\n")
+		}
+	}
+
 	logutil.Logln(logutil.BLUE, "Connecting to Discord gateway...")
 	Connect(s)
 
@@ -94,6 +109,10 @@ func Start(s *discordgo.Session) {
 
 	logutil.Printf(logutil.YELLOW, "\n\nShutting down bot with signal: %s\n", strings.ToUpper(sig.String()))
 	events.ShuttingDown.Store(true)
+	if statusServer != nil {
+		statusServer.Close()
+	}
+
 	Shutdown(s, activeMapDB)
 	//#endregion
 }
@@ -117,3 +136,32 @@ func Shutdown(s *discordgo.Session, activeMapDB *database.Database) {
 		logutil.Logf(logutil.RED, "error flushing DB: %v", err)
 	}
 }
+
+// Starts a listener on port serving Prometheus metrics at /metrics and health checks at /healthz and /readyz.
+func ServeStatus(s *discordgo.Session, activeMapDB *database.Database, port uint) *http.Server {
+	checker := &health.Checker{
+		Process:   "bot",
+		StartedAt: events.StartedAt,
+		MaxAge:    health.MaxAgeFromEnv(),
+		Maps:      []*database.Database{activeMapDB},
+		Bot:       func() database.BotStatus { return events.BotStatus(s) },
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	checker.Serve(mux)
+
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%d", port),
+		Handler: mux,
+	}
+
+	go func() {
+		logutil.Printf(logutil.BLUE, "Serving metrics and health checks on :%d\n", port)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logutil.Printf(logutil.RED, "Status server error: %v\n", err)
+		}
+	}()
+
+	return server
+}
@@ -17,6 +17,7 @@ import (
 	"time"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/samber/lo"
 )
 
 var bannedIds sets.Set[string]
@@ -46,8 +47,10 @@ func OnApplicationCommandInteractionCreate(s *discordgo.Session, i *discordgo.In
 	start := time.Now()
 	err := cmd.Execute(s, i)
 	elapsed := utils.FormatElapsed(time.Since(start))
+	commandDuration.With(cmdName).ObserveSince(start)
 
 	success := err == nil
+	commandsTotal.With(cmdName, lo.Ternary(success, "ok", "error")).Inc()
 	fmt.Println()
 	if success {
 		logutil.Printf(logutil.GREEN, "'%s' successfully executed command /%s (took: %s)\n", author.Username, cmdName, elapsed)
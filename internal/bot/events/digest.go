@@ -0,0 +1,156 @@
+package events
+
+import (
+	"errors"
+	"time"
+
+	"emcsrw/internal/database"
+	"emcsrw/internal/shared"
+	"emcsrw/pkg/utils/discordutil"
+	"emcsrw/pkg/utils/logutil"
+	"emcsrw/pkg/utils/sets"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/samber/lo"
+)
+
+// How long after the new day digests are posted, late enough for the new day's ruins and deletions to be logged.
+// Every digest covers the period up to this long after the new day, so each one picks up where the last left off.
+const DIGEST_DELAY = 15 * time.Minute
+
+// Later attempts at posting the digest if DataUpdate hadn't succeeded by DIGEST_DELAY, or some channels couldn't be posted to.
+var DIGEST_RETRY_DELAYS = []time.Duration{30 * time.Minute, 45 * time.Minute}
+
+// Channels that already got the digest of a new day (Unix ms), so retrying after a failed post doesn't repeat it elsewhere.
+// Only touched by the Digest task, which never overlaps itself.
+var digestDelivered = map[int64]sets.Set[string]{}
+
+func digestSpec() newDaySpecs {
+	specs := newDaySpecs{newDaySpec(DIGEST_DELAY)}
+	for _, delay := range DIGEST_RETRY_DELAYS {
+		specs = append(specs, newDaySpec(delay))
+	}
+
+	return specs
+}
+
+// Weekly digests are posted at the first new day of this weekday (UTC), covering the 7 days before it.
+const DIGEST_WEEKLY_DAY = time.Monday
+
+// Adds the towns created, deleted and ruined since the last DataUpdate to the log that digests are computed from.
+func logTownFlow(mdb *database.Database, events []TownEvent, now time.Time) {
+	logStore, err := database.GetStore(mdb, database.TOWN_FLOW_LOG_STORE)
+	if err != nil {
+		logutil.Printf(logutil.RED, "\nERR | cannot log town flow:\n\t%s", err)
+		return
+	}
+
+	digestTowns := func(eventType TownEventType) []database.DigestTown {
+		return lo.FilterMap(events, func(e TownEvent, _ int) (database.DigestTown, bool) {
+			// Ruined towns have already been removed from their nation.
+			nation := lo.FromPtrOr(e.Prev.Nation.Name, lo.FromPtr(e.Town.Nation.Name))
+			return database.DigestTown{Entity: e.Town.Entity, Nation: nation, At: now.UnixMilli()}, e.Type == eventType
+		})
+	}
+
+	database.AppendTownFlowLog(logStore, now, digestTowns(TownCreated), digestTowns(TownDeleted), digestTowns(TownRuined))
+	if err := logStore.WriteSnapshot(); err != nil {
+		logutil.Printf(logutil.RED, "\nERR | town flow log store failed to write snapshot:\n\t%s", err)
+	}
+}
+
+// Posts the daily digest shortly after every new day, along with the weekly one on DIGEST_WEEKLY_DAY.
+func digestTask(s *discordgo.Session, mdb *database.Database) error {
+	now := time.Now()
+	if !database.NewDayClockKnown() {
+		return nil // not due yet, see newDaySpec
+	}
+
+	newDay := database.LastNewDay(now)
+	if now.Sub(newDay) > time.Hour {
+		return nil // ran by hand or the clock changed
+	}
+
+	digestStore, err := database.GetStore(mdb, database.DIGESTS_STORE)
+	if err != nil {
+		logutil.Printf(logutil.RED, "\nERR | cannot run Digest task:\n\t%s", err)
+		return err
+	}
+
+	periods := []database.DigestPeriod{database.DigestDaily}
+	if newDay.UTC().Weekday() == DIGEST_WEEKLY_DAY {
+		periods = append(periods, database.DigestWeekly)
+	}
+
+	periods = lo.Reject(periods, func(p database.DigestPeriod, _ int) bool {
+		return digestStore.HasKey(database.DigestKey(p, newDay)) // already posted by an earlier attempt
+	})
+	if len(periods) == 0 {
+		return nil
+	}
+
+	runStore, err := database.GetStore(mdb, database.TASK_RUNS_STORE)
+	if err != nil {
+		logutil.Printf(logutil.RED, "\nERR | cannot run Digest task:\n\t%s", err)
+		return err
+	}
+
+	if run, err := runStore.Get("DataUpdate"); err != nil || run.LastSuccessSince(newDay) == nil {
+		return errors.New("DataUpdate has not succeeded since the new day yet")
+	}
+
+	src, err := database.GetDigestSources(mdb)
+	if err != nil {
+		logutil.Printf(logutil.RED, "\nERR | cannot run Digest task:\n\t%s", err)
+		return err
+	}
+
+	// Fixed to the new day rather than now, so every attempt covers the same period.
+	to := newDay.Add(DIGEST_DELAY)
+
+	digests := make([]database.Digest, 0, len(periods))
+	embeds := make([]*discordgo.MessageEmbed, 0, len(periods))
+	for _, period := range periods {
+		digest := database.ComputeDigest(src, period, to)
+		digests = append(digests, digest)
+		embeds = append(embeds, shared.NewDigestEmbed(digest))
+	}
+
+	// Anything from an earlier new day is done with, whether it was fully delivered or not.
+	delivered, ok := digestDelivered[newDay.UnixMilli()]
+	if !ok {
+		delivered = sets.New[string]()
+		clear(digestDelivered)
+		digestDelivered[newDay.UnixMilli()] = delivered
+	}
+
+	err = deliverFeed(mdb, database.FeedDigest, "DIGEST_CHANNEL_ID", func(d feedDelivery) error {
+		if delivered.Has(d.ChannelID) {
+			return nil
+		}
+
+		for _, batch := range discordutil.BatchEmbeds(embeds) {
+			if _, err := s.ChannelMessageSendEmbeds(d.ChannelID, batch); err != nil {
+				return err
+			}
+		}
+
+		delivered.Add(d.ChannelID)
+		return nil
+	})
+	if err != nil {
+		return err // not recorded, so the next attempt posts to whichever channels failed
+	}
+
+	for _, digest := range digests {
+		digestStore.Set(database.DigestKey(digest.Period, newDay), digest)
+	}
+
+	database.PruneDigests(digestStore, now)
+	if err := digestStore.WriteSnapshot(); err != nil {
+		logutil.Printf(logutil.RED, "\nERR | digests store failed to write snapshot:\n\t%s", err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,116 @@
+package events
+
+import (
+	"errors"
+	"slices"
+
+	"emcsrw/internal/database"
+	"emcsrw/pkg/utils/config"
+	"emcsrw/pkg/utils/logutil"
+	"emcsrw/pkg/utils/sets"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/samber/lo"
+)
+
+// A channel to deliver a feed to, and the nations to narrow it down to.
+type feedDelivery struct {
+	GuildID   string // Empty for the channel set via env var, which is never removed.
+	ChannelID string
+	Nations   sets.Set[string] // Nil to deliver everything.
+}
+
+// Whether anything involving any of the given nations should be delivered. Empty UUIDs (no nation) are ignored.
+func (d feedDelivery) matches(nationUUIDs ...string) bool {
+	if d.Nations == nil {
+		return true
+	}
+
+	return slices.ContainsFunc(nationUUIDs, func(uuid string) bool {
+		return uuid != "" && d.Nations.Has(uuid)
+	})
+}
+
+// Every channel that should receive feed: the global one set via envVar (if any), then every guild subscribed to it
+// with /settings notifications. A channel only receives the feed once, even if set in multiple places.
+func feedDeliveries(mdb *database.Database, feed database.NotificationFeed, envVar string) []feedDelivery {
+	deliveries := []feedDelivery{}
+	if cid, err := config.GetEnviroVar(envVar); err == nil {
+		deliveries = append(deliveries, feedDelivery{ChannelID: cid})
+	}
+
+	settingsStore, err := database.GetStore(mdb, database.GUILD_SETTINGS_STORE)
+	if err != nil {
+		logutil.Printf(logutil.RED, "\nERR | cannot get %s subscribers:\n\t%s", feed, err)
+		return deliveries
+	}
+	allianceStore, err := database.GetStore(mdb, database.ALLIANCES_STORE)
+	if err != nil {
+		logutil.Printf(logutil.RED, "\nERR | cannot get %s subscribers:\n\t%s", feed, err)
+		return deliveries
+	}
+
+	for _, target := range database.FeedTargets(settingsStore, feed) {
+		if slices.ContainsFunc(deliveries, func(d feedDelivery) bool { return d.ChannelID == target.ChannelID }) {
+			continue
+		}
+
+		deliveries = append(deliveries, feedDelivery{
+			GuildID:   target.GuildID,
+			ChannelID: target.ChannelID,
+			Nations:   lo.Ternary(feed.Filterable(), target.Filter.NationSet(allianceStore), nil),
+		})
+	}
+
+	return deliveries
+}
+
+// Calls send for every delivery of feed. A guild whose channel was deleted or that the bot can no longer
+// see (like after being kicked) is unsubscribed, so it doesn't keep failing on every update.
+// Returns the errors of any other deliveries that failed, which may be worth retrying.
+func deliverFeed(mdb *database.Database, feed database.NotificationFeed, envVar string, send func(d feedDelivery) error) error {
+	unreachable := []feedDelivery{}
+	var failed []error
+	for _, d := range feedDeliveries(mdb, feed, envVar) {
+		err := send(d)
+		if err == nil {
+			continue
+		}
+
+		logutil.Logf(logutil.RED, "error sending %s notification(s) to channel %s:\n\t%v", feed, d.ChannelID, err)
+		if d.GuildID != "" && isUnreachableChannel(err) {
+			unreachable = append(unreachable, d)
+		} else {
+			failed = append(failed, err)
+		}
+	}
+
+	if len(unreachable) == 0 {
+		return errors.Join(failed...)
+	}
+
+	settingsStore, err := database.GetStore(mdb, database.GUILD_SETTINGS_STORE)
+	if err != nil {
+		return errors.Join(failed...)
+	}
+
+	for _, d := range unreachable {
+		database.RemoveFeedSubscription(settingsStore, d.GuildID, feed)
+		logutil.Printf(logutil.YELLOW, "\nWARN | Unsubscribed guild %s from %s, channel %s is unreachable.\n", d.GuildID, feed, d.ChannelID)
+	}
+
+	if err := settingsStore.WriteSnapshot(); err != nil {
+		logutil.Printf(logutil.RED, "\nERR | guild settings store failed to write snapshot:\n\t%s", err)
+	}
+
+	return errors.Join(failed...)
+}
+
+func isUnreachableChannel(err error) bool {
+	var restErr *discordgo.RESTError
+	if !errors.As(err, &restErr) || restErr.Message == nil {
+		return false
+	}
+
+	return restErr.Message.Code == discordgo.ErrCodeUnknownChannel || restErr.Message.Code == discordgo.ErrCodeMissingAccess
+}
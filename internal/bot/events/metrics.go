@@ -0,0 +1,14 @@
+package events
+
+import "emcsrw/pkg/utils/metrics"
+
+var (
+	commandDuration = metrics.NewHistogramVec(
+		"emcs_command_duration_seconds", "How long slash commands took to execute.",
+		nil, "command",
+	)
+	commandsTotal = metrics.NewCounterVec(
+		"emcs_commands_total", "Slash commands executed by result (ok, error).",
+		"command", "result",
+	)
+)
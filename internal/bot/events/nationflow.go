@@ -0,0 +1,280 @@
+package events
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"emcsrw/internal/shared"
+	"emcsrw/pkg/api/oapi"
+	"emcsrw/pkg/utils/discordutil"
+	"emcsrw/pkg/utils/logutil"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/samber/lo"
+)
+
+type NationEventType string
+
+const (
+	NationCreated        NationEventType = "created"
+	NationRenamed        NationEventType = "renamed"
+	NationKingChanged    NationEventType = "king-changed"
+	NationCapitalChanged NationEventType = "capital-changed"
+	NationTownJoined     NationEventType = "town-joined"
+	NationTownLeft       NationEventType = "town-left"
+	NationMerged         NationEventType = "merged"
+	NationDeleted        NationEventType = "deleted"
+)
+
+// Every type of nation event, in the order they are posted.
+var NATION_EVENT_TYPES = []NationEventType{
+	NationCreated, NationRenamed, NationKingChanged, NationCapitalChanged,
+	NationTownJoined, NationTownLeft, NationMerged, NationDeleted,
+}
+
+// A single change to a nation between two DataUpdate runs.
+type NationEvent struct {
+	Type   NationEventType
+	Nation oapi.NationInfo // Current state of the nation, or its last known state if deleted/merged.
+	Prev   oapi.NationInfo // State of the nation before the change. Zero value if created.
+
+	Town       oapi.Entity // The town that joined or left. Only set for town-joined and town-left.
+	MergedInto oapi.Entity // The nation most of its towns moved to. Only set for merged.
+	MovedTowns []string    // Names of the towns that moved to MergedInto. Only set for merged.
+}
+
+// Classifies every change between the stale and fresh nations into typed events, sorted by NATION_EVENT_TYPES then nation name.
+//
+// Whether a nation exists is decided by the towns rather than the nation store, since nations are queried individually and
+// any of them failing would otherwise look like a deletion (then a creation on the next run). A nation with no fresh data but
+// still referenced by a town is simply skipped.
+//
+// A deleted nation is reported as merged if most of its towns that still exist moved to the same nation.
+// Towns leaving a deleted nation, or moving to the nation it merged into, aren't reported on their own.
+func DiffNations(nations, staleNations map[string]oapi.NationInfo, towns, staleTowns map[string]oapi.TownInfo) []NationEvent {
+	events := []NationEvent{}
+
+	// Nation UUID -> UUIDs of its towns.
+	nationTowns := func(towns map[string]oapi.TownInfo) map[string][]string {
+		m := make(map[string][]string)
+		for uuid, t := range towns {
+			if nation := townNationUUID(t); nation != "" {
+				m[nation] = append(m[nation], uuid)
+			}
+		}
+
+		return m
+	}
+	curTowns, prevTowns := nationTowns(towns), nationTowns(staleTowns)
+
+	// Towns that moved between two nations as part of a merge, so they're skipped below.
+	merged := make(map[string]bool)
+
+	for uuid, prev := range staleNations {
+		if _, exists := curTowns[uuid]; exists {
+			continue
+		}
+
+		// Work out where the towns that still exist went.
+		destinations := make(map[string][]oapi.TownInfo)
+		surviving := 0
+		for _, townUUID := range prevTowns[uuid] {
+			t, ok := towns[townUUID]
+			if !ok {
+				continue
+			}
+
+			surviving++
+			if nation := townNationUUID(t); nation != "" {
+				destinations[nation] = append(destinations[nation], t)
+			}
+		}
+
+		into, moved := "", []oapi.TownInfo{}
+		for nation, ts := range destinations {
+			if len(ts) > len(moved) || (len(ts) == len(moved) && nation < into) {
+				into, moved = nation, ts
+			}
+		}
+
+		if surviving > 0 && len(moved)*2 > surviving {
+			for _, t := range moved {
+				merged[t.UUID] = true
+			}
+
+			slices.SortFunc(moved, func(a, b oapi.TownInfo) int { return cmp.Compare(a.Name, b.Name) })
+			events = append(events, NationEvent{
+				Type: NationMerged, Nation: prev, Prev: prev,
+				MergedInto: oapi.Entity{UUID: into, Name: lo.FromPtr(moved[0].Nation.Name)},
+				MovedTowns: lo.Map(moved, func(t oapi.TownInfo, _ int) string { return t.Name }),
+			})
+
+			continue
+		}
+
+		events = append(events, NationEvent{Type: NationDeleted, Nation: prev, Prev: prev})
+	}
+
+	for uuid, cur := range nations {
+		if _, existed := prevTowns[uuid]; !existed {
+			events = append(events, NationEvent{Type: NationCreated, Nation: cur})
+			continue
+		}
+
+		prev, ok := staleNations[uuid]
+		if !ok {
+			continue // no data from last time to compare with
+		}
+
+		if cur.Name != prev.Name {
+			events = append(events, NationEvent{Type: NationRenamed, Nation: cur, Prev: prev})
+		}
+		if cur.King.UUID != prev.King.UUID {
+			events = append(events, NationEvent{Type: NationKingChanged, Nation: cur, Prev: prev})
+		}
+		if cur.Capital.UUID != prev.Capital.UUID {
+			events = append(events, NationEvent{Type: NationCapitalChanged, Nation: cur, Prev: prev})
+		}
+	}
+
+	for uuid, cur := range towns {
+		prev, ok := staleTowns[uuid]
+		if !ok || merged[uuid] {
+			continue
+		}
+
+		curNation, prevNation := townNationUUID(cur), townNationUUID(prev)
+		if curNation == prevNation {
+			continue
+		}
+
+		// Leaving a nation that no longer exists is covered by it being deleted.
+		if _, exists := curTowns[prevNation]; prevNation != "" && exists {
+			if n, ok := nations[prevNation]; ok {
+				events = append(events, NationEvent{Type: NationTownLeft, Nation: n, Prev: n, Town: cur.Entity})
+			}
+		}
+
+		// The capital "joining" a brand new nation is covered by it being created.
+		if n, ok := nations[curNation]; ok && !(n.Capital.UUID == uuid && len(prevTowns[curNation]) == 0) {
+			events = append(events, NationEvent{Type: NationTownJoined, Nation: n, Prev: n, Town: cur.Entity})
+		}
+	}
+
+	slices.SortFunc(events, func(a, b NationEvent) int {
+		return cmp.Or(
+			cmp.Compare(slices.Index(NATION_EVENT_TYPES, a.Type), slices.Index(NATION_EVENT_TYPES, b.Type)),
+			cmp.Compare(a.Nation.Name, b.Nation.Name),
+			cmp.Compare(a.Town.Name, b.Town.Name),
+		)
+	})
+
+	return events
+}
+
+// Posts every nation event to channelID, one or more embeds per type. See TrySendTownFlowNotifs.
+func TrySendNationFlowNotifs(s *discordgo.Session, channelID string, events []NationEvent) error {
+	grouped := lo.GroupBy(events, func(e NationEvent) NationEventType { return e.Type })
+
+	embeds := []*discordgo.MessageEmbed{}
+	for _, eventType := range NATION_EVENT_TYPES {
+		group := grouped[eventType]
+		if len(group) == 0 {
+			continue
+		}
+
+		lines := lo.Map(group, func(e NationEvent, _ int) string { return nationEventLine(e) })
+		title := fmt.Sprintf("Nation Flow | %s Events [%d]", nationEventTitle(eventType), len(group))
+
+		embeds = append(embeds, discordutil.PaginatedEmbeds(title, nationEventColour(eventType), lines, "\n\n")...)
+	}
+
+	for _, batch := range discordutil.BatchEmbeds(embeds) {
+		if _, err := s.ChannelMessageSendEmbeds(channelID, batch); err != nil {
+			return err // the rest would most likely fail the same way
+		}
+	}
+
+	return nil
+}
+
+func nationEventTitle(eventType NationEventType) string {
+	switch eventType {
+	case NationCreated:
+		return "Creation"
+	case NationRenamed:
+		return "Rename"
+	case NationKingChanged:
+		return "King Change"
+	case NationCapitalChanged:
+		return "Capital Change"
+	case NationTownJoined:
+		return "Town Join"
+	case NationTownLeft:
+		return "Town Leave"
+	case NationMerged:
+		return "Merge"
+	case NationDeleted:
+		return "Deletion"
+	}
+
+	return string(eventType)
+}
+
+func nationEventColour(eventType NationEventType) int {
+	switch eventType {
+	case NationCreated:
+		return discordutil.GREEN
+	case NationRenamed:
+		return discordutil.AQUA
+	case NationKingChanged:
+		return discordutil.BLURPLE
+	case NationCapitalChanged:
+		return discordutil.GOLD
+	case NationTownJoined:
+		return discordutil.BLUE
+	case NationTownLeft:
+		return discordutil.DARK_BLUE
+	case NationMerged:
+		return discordutil.PURPLE
+	case NationDeleted:
+		return discordutil.RED
+	}
+
+	return discordutil.DEFAULT
+}
+
+func nationEventLine(e NationEvent) string {
+	n := e.Nation
+	stats := logutil.HumanizedSprintf(
+		"Towns: `%d`, Residents: `%d` %s `%d`",
+		n.Stats.NumTowns, n.Stats.NumResidents, shared.EMOJIS.CHUNK, n.Stats.NumTownBlocks,
+	)
+
+	switch e.Type {
+	case NationCreated:
+		return fmt.Sprintf("**%s** was created.\nKing: `%s`, Capital: `%s`", n.Name, n.King.Name, n.Capital.Name)
+	case NationRenamed:
+		return fmt.Sprintf("**%s** was renamed to **%s**.\nKing: `%s`, %s", e.Prev.Name, n.Name, n.King.Name, stats)
+	case NationKingChanged:
+		return fmt.Sprintf("**%s** changed king from `%s` to `%s`.\n%s", n.Name, e.Prev.King.Name, n.King.Name, stats)
+	case NationCapitalChanged:
+		return fmt.Sprintf("**%s** moved its capital from `%s` to `%s`.\n%s", n.Name, e.Prev.Capital.Name, n.Capital.Name, stats)
+	case NationTownJoined:
+		return fmt.Sprintf("`%s` joined **%s**.\n%s", e.Town.Name, n.Name, stats)
+	case NationTownLeft:
+		return fmt.Sprintf("`%s` left **%s**.\n%s", e.Town.Name, n.Name, stats)
+	case NationMerged:
+		towns := strings.Join(lo.Map(e.MovedTowns, func(name string, _ int) string { return "`" + name + "`" }), ", ")
+		return fmt.Sprintf(
+			"**%s** merged into **%s**.\nKing: `%s`, %d town(s) moved: %s",
+			n.Name, e.MergedInto.Name, n.King.Name, len(e.MovedTowns), lo.Ellipsis(towns, 500),
+		)
+	case NationDeleted:
+		return fmt.Sprintf("**%s** was deleted.\nKing: `%s`, Capital: `%s`, %s", n.Name, n.King.Name, n.Capital.Name, stats)
+	}
+
+	return fmt.Sprintf("**%s**: %s", n.Name, e.Type)
+}
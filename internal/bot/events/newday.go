@@ -0,0 +1,266 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"emcsrw/internal/database"
+	"emcsrw/internal/database/store"
+	"emcsrw/internal/shared"
+	"emcsrw/pkg/api/oapi"
+	"emcsrw/pkg/utils/discordutil"
+	"emcsrw/pkg/utils/logutil"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/samber/lo"
+)
+
+// How long before the new day the "pre" snapshot is taken. DataUpdate runs every minute,
+// so this only needs to be long enough that a slow update doesn't push it past the new day.
+const NEW_DAY_PRE_LEAD = 5 * time.Minute
+
+// When the report is attempted after the new day. Later attempts only matter if DataUpdate
+// hadn't succeeded since the new day in time for the earlier ones.
+var NEW_DAY_REPORT_DELAYS = []time.Duration{2 * time.Minute, 5 * time.Minute, 10 * time.Minute}
+
+// A "pre" snapshot older than this (relative to the new day) is from some earlier day and can't be compared.
+const NEW_DAY_MAX_PRE_AGE = time.Hour
+
+// Max amount of lines in each field of the report before the rest are summarised as "...and X more".
+const NEW_DAY_FIELD_LINES = 15
+
+// Fires at an offset from every new day, negative offsets being before it.
+//
+// The new day clock is only known once ServerInfo has run, so until then this fires every minute
+// instead. The tasks using it check they're actually near the new day before doing anything.
+type newDaySpec time.Duration
+
+func (d newDaySpec) Next(after time.Time) time.Time {
+	if !database.NewDayClockKnown() {
+		return after.Add(time.Minute)
+	}
+
+	offset := time.Duration(d)
+	return database.NextNewDay(after.Add(-offset)).Add(offset)
+}
+
+func (d newDaySpec) String() string {
+	if d < 0 {
+		return fmt.Sprintf("%s before the new day", -time.Duration(d))
+	}
+
+	return fmt.Sprintf("%s after the new day", time.Duration(d))
+}
+
+func newDayReportSpec() newDaySpecs {
+	specs := make(newDaySpecs, len(NEW_DAY_REPORT_DELAYS))
+	for i, delay := range NEW_DAY_REPORT_DELAYS {
+		specs[i] = newDaySpec(delay)
+	}
+
+	return specs
+}
+
+// Fires at every one of its offsets, like scheduler.Earliest but with a readable description.
+type newDaySpecs []newDaySpec
+
+func (specs newDaySpecs) Next(after time.Time) time.Time {
+	var next time.Time
+	for _, spec := range specs {
+		if t := spec.Next(after); next.IsZero() || t.Before(next) {
+			next = t
+		}
+	}
+
+	return next
+}
+
+func (specs newDaySpecs) String() string {
+	offsets := make([]string, len(specs))
+	for i, spec := range specs {
+		offsets[i] = time.Duration(spec).String()
+	}
+
+	return strings.Join(offsets, ", ") + " after the new day"
+}
+
+// Snapshots towns and nations just before the new day so the report can tell what changed over it.
+func newDayPreTask(mdb *database.Database) error {
+	now := time.Now()
+	if !database.NewDayClockKnown() || database.NextNewDay(now).Sub(now) > NEW_DAY_PRE_LEAD+time.Minute {
+		return nil // not due yet, see newDaySpec
+	}
+
+	townStore, nationStore, snapshotStore, err := newDayStores(mdb)
+	if err != nil {
+		logutil.Printf(logutil.RED, "\nERR | cannot run NewDayPre task:\n\t%s", err)
+		return err
+	}
+
+	snapshot := database.TakeNewDaySnapshot(townStore, nationStore, now)
+	snapshotStore.Set(database.NEW_DAY_PRE_KEY, snapshot)
+
+	logutil.Printf(logutil.HIDDEN, "\nDEBUG | Took pre new day snapshot. Towns: %d, Nations: %d", len(snapshot.Towns), len(snapshot.Nations))
+	return snapshotStore.WriteSnapshot()
+}
+
+// Once DataUpdate has picked up the new day, compares against the "pre" snapshot and posts a report of
+// what fell over it to NEWDAY_CHANNEL_ID and every guild subscribed to the newday feed.
+// Only ever reports each new day once.
+func newDayTask(s *discordgo.Session, mdb *database.Database) error {
+	now := time.Now()
+	if !database.NewDayClockKnown() {
+		return nil // not due yet, see newDaySpec
+	}
+
+	newDay := database.LastNewDay(now)
+	if now.Sub(newDay) > NEW_DAY_MAX_PRE_AGE {
+		return nil // ran by hand or the clock changed, nothing to report on
+	}
+
+	reportStore, err := database.GetStore(mdb, database.NEW_DAY_REPORTS_STORE)
+	if err != nil {
+		logutil.Printf(logutil.RED, "\nERR | cannot run NewDay task:\n\t%s", err)
+		return err
+	}
+
+	reportKey := newDay.Format(database.NEW_DAY_REPORT_KEY_FORMAT)
+	if reportStore.HasKey(reportKey) {
+		return nil // already reported by an earlier attempt
+	}
+
+	runStore, err := database.GetStore(mdb, database.TASK_RUNS_STORE)
+	if err != nil {
+		logutil.Printf(logutil.RED, "\nERR | cannot run NewDay task:\n\t%s", err)
+		return err
+	}
+
+	// The towns store needs to reflect the new day before there's anything to compare. The next attempt will try again.
+	if run, err := runStore.Get("DataUpdate"); err != nil || run.LastSuccessSince(newDay) == nil {
+		return errors.New("DataUpdate has not succeeded since the new day yet")
+	}
+
+	townStore, nationStore, snapshotStore, err := newDayStores(mdb)
+	if err != nil {
+		logutil.Printf(logutil.RED, "\nERR | cannot run NewDay task:\n\t%s", err)
+		return err
+	}
+
+	post := database.TakeNewDaySnapshot(townStore, nationStore, now)
+	snapshotStore.Set(database.NEW_DAY_POST_KEY, post)
+	if err := snapshotStore.WriteSnapshot(); err != nil {
+		logutil.Printf(logutil.RED, "\nERR | new day snapshot store failed to write snapshot:\n\t%s", err)
+	}
+
+	pre, err := snapshotStore.Get(database.NEW_DAY_PRE_KEY)
+	if err != nil || newDay.Sub(time.UnixMilli(pre.TakenAt)) > NEW_DAY_MAX_PRE_AGE || pre.TakenAt > newDay.UnixMilli() {
+		// Most likely the bot wasn't running before the new day. Not an error, there just isn't a report this time.
+		logutil.Printf(logutil.YELLOW, "\nWARN | No snapshot from before the new day of %s. Skipping new day report.\n", reportKey)
+		return nil
+	}
+
+	report := database.ComputeNewDayReport(newDay, *pre, post)
+	reportStore.Set(reportKey, report)
+	if err := reportStore.WriteSnapshot(); err != nil {
+		logutil.Printf(logutil.RED, "\nERR | new day report store failed to write snapshot:\n\t%s", err)
+		return err
+	}
+
+	logutil.Printf(logutil.GREEN, "\n[NewDay]: Ruined: %d, Deleted: %d, Nations dissolved: %d\n",
+		len(report.Ruined), len(report.Deleted), len(report.Dissolved),
+	)
+
+	// Not falling back to TFLOW_CHANNEL_ID, town flow already posts each deletion there as it happens.
+	deliverFeed(mdb, database.FeedNewDay, "NEWDAY_CHANNEL_ID", func(d feedDelivery) error {
+		filtered := filterNewDayReport(report, d)
+		if filtered.Empty() && d.Nations != nil {
+			return nil // nothing they care about, not worth a "nothing happened" message
+		}
+
+		_, err := s.ChannelMessageSendEmbed(d.ChannelID, NewDayReportEmbed(filtered))
+		return err
+	})
+
+	return nil
+}
+
+// Only keeps what the delivery cares about, see feedDelivery.matches.
+func filterNewDayReport(report database.NewDayReport, d feedDelivery) database.NewDayReport {
+	if d.Nations == nil {
+		return report
+	}
+
+	byNation := func(t database.NewDayTown, _ int) bool { return d.matches(t.Nation.UUID) }
+	report.Ruined = lo.Filter(report.Ruined, byNation)
+	report.Deleted = lo.Filter(report.Deleted, byNation)
+	report.Dissolved = lo.Filter(report.Dissolved, func(n database.NewDayNation, _ int) bool { return d.matches(n.UUID) })
+
+	return report
+}
+
+func newDayStores(mdb *database.Database) (
+	townStore *store.Store[oapi.TownInfo], nationStore *store.Store[oapi.NationInfo],
+	snapshotStore *store.Store[database.NewDaySnapshot], err error,
+) {
+	if townStore, err = database.GetStore(mdb, database.TOWNS_STORE); err != nil {
+		return
+	}
+	if nationStore, err = database.GetStore(mdb, database.NATIONS_STORE); err != nil {
+		return
+	}
+
+	snapshotStore, err = database.GetStore(mdb, database.NEW_DAY_SNAPSHOTS_STORE)
+	return
+}
+
+func NewDayReportEmbed(report database.NewDayReport) *discordgo.MessageEmbed {
+	newDay := time.UnixMilli(report.NewDay)
+
+	title := fmt.Sprintf("New Day | %s", newDay.UTC().Format("Mon, Jan 2 2006"))
+	desc := fmt.Sprintf("The new day occurred <t:%d:R>.", newDay.Unix())
+	if report.Empty() {
+		desc += "\nNothing fell this time, how boring."
+	}
+
+	ruined := make([]string, len(report.Ruined))
+	for i, t := range report.Ruined {
+		ruined[i] = newDayTownLine(t)
+	}
+
+	deleted := make([]string, len(report.Deleted))
+	for i, t := range report.Deleted {
+		deleted[i] = newDayTownLine(t)
+	}
+
+	dissolved := make([]string, len(report.Dissolved))
+	for i, n := range report.Dissolved {
+		dissolved[i] = logutil.HumanizedSprintf(
+			"`%s` - King: `%s`, Capital: `%s` (%d towns, %d residents)",
+			n.Name, n.King, n.Capital, n.Towns, n.Residents,
+		)
+	}
+
+	embed := discordutil.NewEmbedBuilder(&discordutil.DARK_PURPLE, &title, &desc, nil)
+	if len(ruined) > 0 {
+		embed.AddField(fmt.Sprintf("%s Fell into ruin [%d]", shared.EMOJIS.CIRCLE_CROSS, len(ruined)), discordutil.JoinLimited(ruined, NEW_DAY_FIELD_LINES, "\n"), false)
+	}
+	if len(deleted) > 0 {
+		embed.AddField(fmt.Sprintf("Deleted [%d]", len(deleted)), discordutil.JoinLimited(deleted, NEW_DAY_FIELD_LINES, "\n"), false)
+	}
+	if len(dissolved) > 0 {
+		embed.AddField(fmt.Sprintf("Nations dissolved [%d]", len(dissolved)), discordutil.JoinLimited(dissolved, NEW_DAY_FIELD_LINES, "\n"), false)
+	}
+
+	return embed.Build()
+}
+
+func newDayTownLine(t database.NewDayTown) string {
+	nation := "No Nation"
+	if t.Nation.Name != "" {
+		nation = t.Nation.Name
+	}
+
+	return logutil.HumanizedSprintf("`%s` (**%s**) - Mayor: `%s`, %s `%d`", t.Name, nation, t.Mayor, shared.EMOJIS.CHUNK, t.Chunks)
+}
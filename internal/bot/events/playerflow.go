@@ -0,0 +1,111 @@
+package events
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	"emcsrw/internal/shared"
+	"emcsrw/pkg/api/oapi"
+	"emcsrw/pkg/utils/discordutil"
+	"emcsrw/pkg/utils/logutil"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/samber/lo"
+)
+
+// A player joining or leaving a town between two DataUpdate runs.
+type PlayerFlowEvent struct {
+	Joined bool // Became a resident if true, otherwise became a nomad.
+	Player oapi.Entity
+	Town   oapi.TownInfo // The town they joined, or the last known state of the town they left.
+}
+
+// Works out who joined and left a town, sorted with leaves first then by player name.
+// Players that left a town without becoming townless (likely purged) aren't included.
+func DiffPlayers(towns, staleTowns []oapi.TownInfo, townless, residents oapi.EntityList) []PlayerFlowEvent {
+	// For resident -> town lookup
+	residentTowns := func(towns []oapi.TownInfo) map[string]oapi.TownInfo {
+		m := make(map[string]oapi.TownInfo)
+		for _, t := range towns {
+			for _, r := range t.Residents {
+				m[r.UUID] = t
+			}
+		}
+
+		return m
+	}
+
+	staleResMap, resMap := residentTowns(staleTowns), residentTowns(towns)
+
+	events := []PlayerFlowEvent{}
+	for uuid, town := range staleResMap {
+		if _, ok := resMap[uuid]; ok {
+			continue
+		}
+
+		name, ok := townless[uuid]
+		if !ok {
+			continue // Left a town but not townless. Likely purged?
+		}
+
+		events = append(events, PlayerFlowEvent{Player: oapi.Entity{UUID: uuid, Name: name}, Town: town})
+	}
+
+	for uuid, town := range resMap {
+		if _, ok := staleResMap[uuid]; ok {
+			continue
+		}
+
+		name, ok := residents[uuid]
+		if !ok {
+			r, _ := lo.Find(town.Residents, func(r oapi.Entity) bool { return r.UUID == uuid })
+			name = r.Name
+		}
+
+		events = append(events, PlayerFlowEvent{Joined: true, Player: oapi.Entity{UUID: uuid, Name: name}, Town: town})
+	}
+
+	slices.SortFunc(events, func(a, b PlayerFlowEvent) int {
+		return cmp.Or(
+			lo.Ternary(a.Joined == b.Joined, 0, lo.Ternary(a.Joined, 1, -1)),
+			cmp.Compare(a.Player.Name, b.Player.Name),
+		)
+	})
+
+	return events
+}
+
+func TrySendPlayerFlowNotifs(s *discordgo.Session, channelID string, events []PlayerFlowEvent) error {
+	if len(events) < 1 {
+		return nil
+	}
+
+	left, joined := []string{}, []string{}
+	for _, e := range events {
+		line := logutil.HumanizedSprintf(
+			"`%s` %s %s (**%s**)\nMayor: `%s`, Balance: `%.0f` %s",
+			e.Player.Name, lo.Ternary(e.Joined, "joined", "left"), e.Town.Name, townNationName(e.Town),
+			e.Town.Mayor.Name, e.Town.Bal(), shared.EMOJIS.GOLD_INGOT,
+		)
+
+		if e.Joined {
+			joined = append(joined, line)
+		} else {
+			left = append(left, line)
+		}
+	}
+
+	leftField := fmt.Sprintf("%s Became a nomad [%d]", shared.EMOJIS.EXIT, len(left))
+	joinedField := fmt.Sprintf("%s Became a resident [%d]", shared.EMOJIS.ENTRY, len(joined))
+
+	title := "Player Flow | Town Join/Leave Events"
+	embed := discordutil.NewEmbedBuilder(&discordutil.DARK_GREEN, &title, nil, nil)
+	embed.SetFields(
+		discordutil.NewEmbedField(leftField, discordutil.JoinLimited(left, len(left), "\n\n"), true),
+		discordutil.NewEmbedField(joinedField, discordutil.JoinLimited(joined, len(joined), "\n\n"), true),
+	)
+
+	_, err := s.ChannelMessageSendEmbed(channelID, embed.Build())
+	return err
+}
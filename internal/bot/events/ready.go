@@ -1,8 +1,6 @@
 package events
 
 import (
-	"fmt"
-	"strings"
 	"sync"
 	"time"
 
@@ -10,6 +8,7 @@ import (
 	"emcsrw/internal/database"
 	"emcsrw/internal/shared"
 	"emcsrw/pkg/api"
+	"emcsrw/pkg/api/mapi"
 	"emcsrw/pkg/api/oapi"
 	"emcsrw/pkg/utils"
 	"emcsrw/pkg/utils/config"
@@ -18,18 +17,14 @@ import (
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/samber/lo"
-	"github.com/samber/lo/parallel"
 )
 
 // Max amount of messages to fetch from news channel during its scheduled task.
 // This should usually be set to a high number, enough to cover at least a few days/weeks of news depending on activity.
 const NEWS_CHANNEL_MAX_FETCH = 500
 
-// VoteParty notification tracking.
-var vpThresholds = [...]int{500, 300, 150, 50}
-var vpNotified = make(map[int]bool) // Key is each threshold, value is whether notified or not.
-var vpLastRemaining int
-var vpLastCheck time.Time
+// How often the map is polled for visible players when tracking is enabled via TRACK_PLAYERS.
+const PLAYER_TRACKING_INTERVAL = 20 * time.Second
 
 // Prevents running tasks more than once if OnReady is *somehow* called multiple times.
 var readyOnce sync.Once
@@ -43,16 +38,54 @@ func OnReady(s *discordgo.Session, r *discordgo.Ready) {
 			return
 		}
 
-		scheduler.Instance.Schedule("DataUpdate", func() { dataUpdateTask(s, mdb) }, true, 1*time.Minute)
-		scheduler.Instance.Schedule("ServerInfo", func() { serverInfoTask(s, mdb) }, true, 30*time.Second)
-		scheduler.Instance.Schedule("FallingTowns", func() { fallingTownsTask(mdb) }, true, 90*time.Second)
+		scheduler.Instance.OnRun = recordTaskRun(mdb)
+		scheduler.Instance.Schedule("Heartbeat", func() error { return heartbeatTask(s, mdb) }, true, HEARTBEAT_INTERVAL)
+		// A slow DataUpdate (the OAPI can take a while) shouldn't start piling up runs of itself.
+		scheduler.Instance.ScheduleSpec("DataUpdate", func() error { return dataUpdateTask(s, mdb) }, scheduler.Every(1*time.Minute), scheduler.Options{
+			RunInitial: true, Overlap: scheduler.SkipIfRunning,
+		})
+		scheduler.Instance.ScheduleSpec("ServerInfo", func() error { return serverInfoTask(s, mdb) }, scheduler.Every(30*time.Second), scheduler.Options{
+			RunInitial: true, Jitter: 5 * time.Second,
+		})
+
+		// Falling towns only really change at the new day, so make sure they're recomputed shortly after it.
+		fallingSpec := scheduler.Earliest(scheduler.Every(90*time.Second), newDaySpec(2*time.Minute))
+		scheduler.Instance.ScheduleSpec("FallingTowns", func() error { return fallingTownsTask(s, mdb) }, fallingSpec, scheduler.Options{
+			RunInitial: true, Overlap: scheduler.QueueIfRunning, Jitter: 5 * time.Second,
+		})
+
+		// Snapshot either side of the new day and report what fell over it.
+		scheduler.Instance.ScheduleSpec("NewDayPre", func() error { return newDayPreTask(mdb) }, newDaySpec(-NEW_DAY_PRE_LEAD), scheduler.Options{})
+		scheduler.Instance.ScheduleSpec("NewDay", func() error { return newDayTask(s, mdb) }, newDayReportSpec(), scheduler.Options{
+			Overlap: scheduler.QueueIfRunning,
+		})
+
+		scheduler.Instance.ScheduleSpec("Webhooks", func() error { return webhookTask(mdb) }, scheduler.Every(WEBHOOK_DELIVERY_INTERVAL), scheduler.Options{
+			RunInitial: true, Overlap: scheduler.SkipIfRunning,
+		})
+
+		scheduler.Instance.ScheduleSpec("Digest", func() error { return digestTask(s, mdb) }, digestSpec(), scheduler.Options{
+			Overlap: scheduler.QueueIfRunning,
+		})
+
+		scheduler.Instance.Schedule("StatsHistory", func() error { return statsHistoryTask(mdb) }, true, database.HISTORY_SAMPLE_INTERVAL)
 
 		if cid, err := config.GetEnviroVar("NEWS_CHANNEL_ID"); err == nil {
-			scheduler.Instance.Schedule("NewsEntries", func() { newsTask(s, cid, mdb) }, true, 2*time.Minute)
+			scheduler.Instance.ScheduleSpec("NewsEntries", func() error { return newsTask(s, cid, mdb) }, scheduler.Every(2*time.Minute), scheduler.Options{
+				RunInitial: true, Jitter: 10 * time.Second,
+			})
 		} else {
 			logutil.Printf(logutil.YELLOW, "\nWARN | NEWS_CHANNEL_ID not set. Skipped scheduling of news retrieval task.\n")
 		}
 
+		// Opt-in since this polls the map much more frequently than other tasks.
+		if v, err := config.GetEnviroVar("TRACK_PLAYERS"); err == nil {
+			if enabled, _ := config.ParseEnviroVar[bool](v); enabled {
+				retention := shared.PlayerTrailRetention()
+				scheduler.Instance.Schedule("PlayerTracking", func() error { return playerTrackingTask(mdb, retention) }, true, PLAYER_TRACKING_INTERVAL)
+			}
+		}
+
 		// TODO: Create a scheduled task that loops through alliances, removing nations that no longer exist.
 	})
 }
@@ -180,15 +213,22 @@ func UpdateData(mdb *database.Database) (
 }
 
 // #region DB store update tasks
-func dataUpdateTask(s *discordgo.Session, mdb *database.Database) {
+func dataUpdateTask(s *discordgo.Session, mdb *database.Database) error {
 	logutil.Space()
 	logutil.Logln(logutil.BLUEBG, "[OnReady]: Running DataUpdate task...")
 
+	// Kept for nation flow since UpdateData overwrites the store.
+	var staleNations map[string]oapi.NationInfo
+	nationStore, err := database.GetStore(mdb, database.NATIONS_STORE)
+	if err == nil {
+		staleNations = nationStore.Entries()
+	}
+
 	start := time.Now()
-	townList, staleTownList, townless, residents, err := UpdateData(mdb)
+	townList, staleTownList, townless, residents, updateErr := UpdateData(mdb)
 
 	logutil.Space() // use \n without log.Printf messing up date/time
-	if err != nil {
+	if err := updateErr; err != nil {
 		logutil.Logln(logutil.REDBG, "[OnReady]: Failed DataUpdate task:")
 		logutil.Printf(logutil.RED, "%s\n", err)
 	} else {
@@ -196,41 +236,80 @@ func dataUpdateTask(s *discordgo.Session, mdb *database.Database) {
 		logutil.Logf(logutil.GREEN, "[OnReady]: Finished DataUpdate task. Took: %s\n", elapsed)
 	}
 
-	//#region Send town and player flow events
+	//#region Send town, nation and player flow events
 	towns := lo.MapToSlice(townList, func(_ string, t oapi.TownInfo) oapi.TownInfo { return t })
 	staleTowns := lo.MapToSlice(staleTownList, func(_ string, t oapi.TownInfo) oapi.TownInfo { return t })
 
-	cid, err := config.GetEnviroVar("TFLOW_CHANNEL_ID")
-	if err == nil {
-		// TODO: ADD SOME SORT OF CHECK SO THEY CANT USE EMCS TO SPAM RANDOM CHANNELS!!!
-		// Town flow event notifications sent to channel TFLOW_CHANNEL_ID.
-		TrySendCreatedNotif(s, cid, towns, staleTowns)
-		TrySendRenamedNotif(s, cid, townList, staleTowns)
-		//TrySendRuinedNotif(s, cid, townList, staleTowns)
-		TrySendDeletedNotif(s, cid, towns, staleTowns)
-	} else {
-		logutil.Printf(logutil.YELLOW, "\nWARN | TFLOW_CHANNEL_ID not set. Skipping town flow event notifications.\n")
+	// Nothing to compare against on the first run, and a failed update could make every town look deleted.
+	// Everything is diffed once here, then filtered for each channel it's delivered to.
+	var townEvents []TownEvent
+	var playerEvents []PlayerFlowEvent
+	if updateErr == nil && len(staleTowns) > 0 {
+		townEvents = DiffTowns(townList, staleTownList)
+		playerEvents = DiffPlayers(towns, staleTowns, townless, residents)
+
+		// Published regardless of the channels below so Custom API stream clients always receive them.
+		publishTownFlow(mdb, townEvents)
+		publishPlayerFlow(mdb, playerEvents)
+		logTownFlow(mdb, townEvents, start)
 	}
 
-	cid, err = config.GetEnviroVar("PFLOW_CHANNEL_ID")
-	if err == nil {
-		// Player flow event notifications sent to channel PFLOW_CHANNEL_ID.
-		TrySendLeftJoinedNotif(s, cid, towns, staleTowns, townless, residents)
-	} else {
-		logutil.Printf(logutil.YELLOW, "\nWARN | PFLOW_CHANNEL_ID not set. Skipping player flow event notifications.\n")
+	var nationEvents []NationEvent
+	if updateErr == nil && len(staleTowns) > 0 && len(staleNations) > 0 {
+		nationEvents = DiffNations(nationStore.Entries(), staleNations, townList, staleTownList)
+		publishNationFlow(mdb, nationEvents)
+	}
+
+	if len(townEvents) > 0 {
+		deliverFeed(mdb, database.FeedTownFlow, "TFLOW_CHANNEL_ID", func(d feedDelivery) error {
+			return TrySendTownFlowNotifs(s, d.ChannelID, lo.Filter(townEvents, func(e TownEvent, _ int) bool {
+				return d.matches(townNationUUID(e.Town), townNationUUID(e.Prev))
+			}))
+		})
+	}
+
+	if len(nationEvents) > 0 {
+		deliverFeed(mdb, database.FeedNationFlow, "NFLOW_CHANNEL_ID", func(d feedDelivery) error {
+			return TrySendNationFlowNotifs(s, d.ChannelID, lo.Filter(nationEvents, func(e NationEvent, _ int) bool {
+				return d.matches(e.Nation.UUID, e.MergedInto.UUID)
+			}))
+		})
+	}
+
+	if len(playerEvents) > 0 {
+		deliverFeed(mdb, database.FeedPlayerFlow, "PFLOW_CHANNEL_ID", func(d feedDelivery) error {
+			return TrySendPlayerFlowNotifs(s, d.ChannelID, lo.Filter(playerEvents, func(e PlayerFlowEvent, _ int) bool {
+				return d.matches(townNationUUID(e.Town))
+			}))
+		})
+	}
+	//#endregion
+
+	//#region Send watchlist alerts
+	if updateErr == nil && len(staleTowns) > 0 {
+		online, staleOnline := updateOnlineList(mdb)
+
+		alerts := townWatchAlerts(townEvents)
+		alerts = append(alerts, nationWatchAlerts(nationEvents)...)
+		alerts = append(alerts, playerWatchAlerts(playerEvents, online, staleOnline)...)
+		sendWatchAlerts(s, mdb, alerts)
 	}
 	//#endregion
+
+	return updateErr
 }
 
-func fallingTownsTask(mdb *database.Database) {
+func fallingTownsTask(s *discordgo.Session, mdb *database.Database) error {
 	logutil.Space()
 	logutil.Logln(logutil.BLUEBG, "[OnReady]: Running FallingTowns task...")
 
 	start := time.Now()
 
+	var falling, staleFalling map[string]database.FallingTown
 	fallingTownsStore, err := database.GetStore(mdb, database.FALLING_TOWNS_STORE)
 	if err == nil {
-		_, err = fallingTownsStore.OverwriteFunc(true, true, func() (map[database.MayorUUID]database.FallingTown, error) {
+		staleFalling = fallingTownsStore.Entries()
+		falling, err = fallingTownsStore.OverwriteFunc(true, true, func() (map[database.MayorUUID]database.FallingTown, error) {
 			fallingTownsMap, err := database.ComputeFallingTowns(mdb, database.FALLING_TFRAME)
 			if err != nil {
 				return fallingTownsMap, err
@@ -247,46 +326,94 @@ func fallingTownsTask(mdb *database.Database) {
 	} else {
 		elapsed := utils.FormatElapsed(time.Since(start))
 		logutil.Logf(logutil.GREEN, "[OnReady]: Finished FallingTowns task. Took: %s\n", elapsed)
+
+		// An empty store means this is the first run, so every falling town would look new.
+		if len(staleFalling) > 0 {
+			sendWatchAlerts(s, mdb, fallingWatchAlerts(falling, staleFalling))
+		}
 	}
+
+	return err
 }
 
-func serverInfoTask(s *discordgo.Session, mdb *database.Database) {
+// Replaces the stored list of online players, returning it along with the previous one.
+// The previous list is nil if there wasn't one, and the new one is nil if it couldn't be queried.
+func updateOnlineList(mdb *database.Database) (online, staleOnline oapi.EntityList) {
+	entityStore, err := database.GetStore(mdb, database.ENTITIES_STORE)
+	if err != nil {
+		return nil, nil
+	}
+
+	if prev, err := entityStore.Get("onlinelist"); err == nil {
+		staleOnline = *prev
+	}
+
+	online, err = entityStore.SetKeyFunc("onlinelist", func() (oapi.EntityList, error) {
+		players, err := oapi.QueryList(oapi.ENDPOINT_ONLINE).Execute()
+		if err != nil {
+			return nil, err
+		}
+
+		return lo.SliceToMap(players, func(p oapi.Entity) (string, string) {
+			return p.UUID, p.Name
+		}), nil
+	})
+	if err != nil {
+		logutil.Printf(logutil.RED, "\nERR | failed to query online players:\n\t%s", err)
+		return nil, staleOnline
+	}
+
+	return online, staleOnline
+}
+
+func serverInfoTask(s *discordgo.Session, mdb *database.Database) error {
 	serverStore, err := database.GetStore(mdb, database.SERVER_STORE)
 	if err != nil {
 		logutil.Printf(logutil.RED, "\nERR | cannot schedule ServerInfo task:\n\t%s", err)
-		return
+		return err
+	}
+	var prevVP *oapi.ServerVoteParty
+	if prev, err := serverStore.Get("info"); err == nil {
+		prevVP = &prev.VoteParty
 	}
-	if info, err := serverStore.SetKeyFunc("info", func() (oapi.ServerInfo, error) {
+
+	info, err := serverStore.SetKeyFunc("info", func() (oapi.ServerInfo, error) {
 		info, err := oapi.QueryServer().Execute()
 		return info, err
-	}); err == nil {
-		cid, err := config.GetEnviroVar("VP_CHANNEL_ID")
-		if err != nil {
-			logutil.Printf(logutil.YELLOW, "\nWARN | VP_CHANNEL_ID not set. Skipping VoteParty notifications.\n")
-		} else {
-			TrySendVotePartyNotif(s, cid, info.VoteParty)
-		}
+	})
+	if err != nil {
+		logutil.Printf(logutil.RED, "\nERR | ServerInfo task failed to query server info:\n\t%s", err)
+		return err
+	}
 
-		if err := serverStore.WriteSnapshot(); err != nil {
-			logutil.Printf(logutil.RED, "\nERR | server store failed to write snapshot:\n\t%s", err)
-		}
+	database.SetNewDayClock(database.NewDayClock(info, time.Now()))
+	publishVoteParty(mdb, prevVP, info.VoteParty)
+
+	trackVoteParty(s, mdb, info.VoteParty)
+
+	if err := serverStore.WriteSnapshot(); err != nil {
+		logutil.Printf(logutil.RED, "\nERR | server store failed to write snapshot:\n\t%s", err)
+		return err
 	}
+
+	return nil
 }
 
-func newsTask(s *discordgo.Session, channelID string, mdb *database.Database) {
+func newsTask(s *discordgo.Session, channelID string, mdb *database.Database) error {
 	newsStore, err := database.GetStore(mdb, database.NEWS_STORE)
 	if err != nil {
 		logutil.Printf(logutil.RED, "\nERR | cannot schedule NewsEntries task:\n\t%s", err)
-		return
+		return err
 	}
 
 	newsMsgs, err := discordutil.FetchMessages(s, channelID, NEWS_CHANNEL_MAX_FETCH)
 	if err != nil {
 		logutil.Printf(logutil.RED, "\nERR | news task failed to fetch messages:\n\t%s", err)
-		return
+		return err
 	}
 
 	entries := database.MessagesToNewsEntries(s, newsMsgs) // removes duplicate headlines
+	published := []database.StreamNews{}
 	if mdb.Name() == shared.SUPPORTED_MAPS.NOSTRA {
 		for id, entry := range entries {
 			// We don't want to include news from before Nostra release.
@@ -295,292 +422,80 @@ func newsTask(s *discordgo.Session, channelID string, mdb *database.Database) {
 				continue
 			}
 
+			// Only stream entries we haven't seen, otherwise the initial run would publish everything.
+			if newsStore.Count() > 0 && !newsStore.HasKey(id) {
+				published = append(published, database.StreamNews{NewsEntry: entry, ID: id})
+			}
+
 			newsStore.Set(id, entry)
 		}
 	}
 
+	publishStreamEvents(mdb, database.StreamTopicNews, "published", published...)
+
 	if err := newsStore.WriteSnapshot(); err != nil {
 		logutil.Printf(logutil.RED, "\nERR | news store failed to write snapshot:\n\t%s", err)
-	}
-}
-
-//#endregion
-
-// #region Channel notifs
-// TODO: Increase sample size from 2 (last check and current) with a sliding window for better rate/ETA accuracy.
-//
-// For example, recording the last 15 minutes would be done using 15 samples, each sample at 60 second intervals.
-func TrySendVotePartyNotif(s *discordgo.Session, channelID string, vp oapi.ServerVoteParty) {
-	remaining := vp.NumRemaining
-
-	var rate float64
-	var eta float64
-	if !vpLastCheck.IsZero() {
-		deltaVotes := vpLastRemaining - remaining
-		deltaMinutes := time.Since(vpLastCheck).Minutes()
-		if deltaVotes > 0 && deltaMinutes > 0 {
-			rate = float64(deltaVotes) / deltaMinutes
-			eta = float64(remaining) / rate
-		}
-	}
-
-	for _, threshold := range vpThresholds {
-		if remaining <= threshold && !vpNotified[threshold] {
-			content := fmt.Sprintf("VoteParty has less than `%d` votes remaining! Currently at `%d`.", threshold, remaining)
-			if rate > 0 && eta > 0 {
-				etaValue, etaUnit := utils.HumanizeDuration(eta)
-				content += fmt.Sprintf(
-					"\n\n:chart_with_upwards_trend: **Rate**: ~%.2f votes/min,\n:timer: **ETA**: %.1f %s",
-					rate, etaValue, etaUnit,
-				)
-			}
-
-			// Send notif to toolkit #voteparty channel and publish to followers.
-			if msg, err := s.ChannelMessageSend(channelID, content); err == nil {
-				s.ChannelMessageCrosspost(channelID, msg.ID)
-			}
-
-			vpNotified[threshold] = true
-		}
-	}
-
-	// finished, reset notification statuses by emptying map.
-	if remaining == 0 {
-		vpNotified = make(map[int]bool)
+		return err
 	}
 
-	vpLastRemaining = remaining
-	vpLastCheck = time.Now()
+	return nil
 }
 
-func TrySendRenamedNotif(s *discordgo.Session, channelID string, towns map[string]oapi.TownInfo, staleTowns []oapi.TownInfo) {
-	desc := make([]string, 0)
-	for _, old := range staleTowns {
-		cur, ok := towns[old.UUID]
-		if !ok || cur.Name == old.Name {
-			continue // skip if deleted or same name
-		}
-
-		spawn := cur.Coordinates.Spawn
-		locationLink := fmt.Sprintf(
-			"[%.0f, %.0f, %.0f](https://map.earthmc.net?x=%f&z=%f&zoom=5)",
-			spawn.X, spawn.Y, spawn.Z, spawn.X, spawn.Z,
-		)
-
-		chunks := logutil.HumanizedSprintf("%s `%d`", shared.EMOJIS.CHUNK, cur.Size())
-		balance := logutil.HumanizedSprintf("%s `%.0f`", shared.EMOJIS.GOLD_INGOT, cur.Bal())
-		desc = append(desc, fmt.Sprintf(
-			"`%s` was renamed to `%s`.\nLocated at %s.\nFounder: `%s` %sG %s Chunks",
-			old.Name, cur.Name, locationLink, cur.Founder, balance, chunks,
-		))
-	}
-
-	if len(desc) > 0 {
-		_, err := s.ChannelMessageSendEmbed(channelID, &discordgo.MessageEmbed{
-			Title:       fmt.Sprintf("Town Flow | Rename Events [%d]", len(desc)),
-			Description: strings.Join(desc, "\n\n"),
-			Color:       discordutil.AQUA,
-		})
-		if err != nil {
-			logutil.Logf(logutil.RED, "error sending town flow rename event:\n\t%v", err)
-		}
+func statsHistoryTask(mdb *database.Database) error {
+	historyStore, err := database.GetStore(mdb, database.STATS_HISTORY_STORE)
+	if err != nil {
+		logutil.Printf(logutil.RED, "\nERR | cannot run StatsHistory task:\n\t%s", err)
+		return err
 	}
-}
-
-func TrySendCreatedNotif(s *discordgo.Session, channelID string, towns []oapi.TownInfo, staleTowns []oapi.TownInfo) {
-	diff, _ := utils.DifferenceBy(towns, staleTowns, func(t oapi.TownInfo) string {
-		return t.UUID
-	})
-
-	count := len(diff)
-	if count > 0 {
-		desc := parallel.Map(diff, func(t oapi.TownInfo, _ int) string {
-			spawn := t.Coordinates.Spawn
-			locationLink := fmt.Sprintf("[%.0f, %.0f, %.0f](https://map.earthmc.net?x=%f&z=%f&zoom=5)", spawn.X, spawn.Y, spawn.Z, spawn.X, spawn.Z)
-
-			chunks := logutil.HumanizedSprintf("%s `%d`", shared.EMOJIS.CHUNK, t.Size())
-			balance := logutil.HumanizedSprintf("%s `%.0f`", shared.EMOJIS.GOLD_INGOT, t.Bal())
-
-			openEmoji := lo.Ternary(t.Status.Open, shared.EMOJIS.CIRCLE_CHECK, shared.EMOJIS.CIRCLE_CROSS)
-			outsidersEmoji := lo.Ternary(t.Status.CanOutsidersSpawn, shared.EMOJIS.CIRCLE_CHECK, shared.EMOJIS.CIRCLE_CROSS)
-
-			return fmt.Sprintf(
-				"`%s` was created. Located at %s.\nFounder: `%s` %sG %s Chunks %s Open %s Outsiders Can Spawn",
-				t.Name, locationLink, t.Founder, balance, chunks, openEmoji, outsidersEmoji,
-			)
-		})
-
-		_, err := s.ChannelMessageSendEmbed(channelID, &discordgo.MessageEmbed{
-			Title:       fmt.Sprintf("Town Flow | Creation Events [%d]", count),
-			Description: strings.Join(desc, "\n\n"),
-			Color:       discordutil.GREEN,
-		})
-		if err != nil {
-			logutil.Logf(logutil.RED, "error sending town flow creation event:\n\t%v", err)
-		}
+	townStore, err := database.GetStore(mdb, database.TOWNS_STORE)
+	if err != nil {
+		logutil.Printf(logutil.RED, "\nERR | cannot run StatsHistory task:\n\t%s", err)
+		return err
 	}
-}
-
-// func TrySendRuinedNotif(s *discordgo.Session, channelID string, towns map[string]oapi.TownInfo, staleTowns []oapi.TownInfo) {
-// 	staleRuined := lo.FilterSliceToMap(staleTowns, func(t oapi.TownInfo) (string, oapi.TownInfo, bool) {
-// 		return t.UUID, t, t.Status.Ruined
-// 	})
-
-// 	ruined := lo.FilterMapToSlice(towns, func(_ string, t oapi.TownInfo) (oapi.TownInfo, bool) {
-// 		_, wasRuined := staleRuined[t.UUID]
-// 		return t, !wasRuined && t.Status.Ruined
-// 	})
-
-// 	// Sort by oldest RuinedAt (aka least amount of time until deletion)
-// 	slices.SortFunc(ruined, func(a, b oapi.TownInfo) int {
-// 		return cmp.Compare(*a.Timestamps.RuinedAt, *b.Timestamps.RuinedAt)
-// 	})
-
-// 	count := len(ruined)
-// 	if count > 0 {
-// 		desc := parallel.Map(ruined, func(t oapi.TownInfo, _ int) string {
-// 			chunks := logutil.HumanizedSprintf("%s `%d`", shared.EMOJIS.CHUNK, t.Size())
-// 			balance := logutil.HumanizedSprintf("%s `%.0f`", shared.EMOJIS.GOLD_INGOT, t.Bal())
-
-// 			ruinedTs := *t.Timestamps.RuinedAt
-// 			ruinedTime := time.UnixMilli(int64(*t.Timestamps.RuinedAt))
-// 			after72h := ruinedTime.Add(72 * time.Hour)
-
-// 			nextNewDay := time.Date(after72h.Year(), after72h.Month(), after72h.Day(), 11, 0, 0, 0, time.UTC)
-// 			if !nextNewDay.After(after72h) {
-// 				nextNewDay = nextNewDay.Add(24 * time.Hour)
-// 			}
-
-// 			spawn := t.Coordinates.Spawn
-// 			locationLink := fmt.Sprintf(
-// 				"[%.0f, %.0f, %.0f](https://map.earthmc.net?x=%f&z=%f&zoom=5)",
-// 				spawn.X, spawn.Y, spawn.Z, spawn.X, spawn.Z,
-// 			)
-
-// 			return fmt.Sprintf(
-// 				"`%s` fell into ruin <t:%d:R> at %s. %s %s\nDeletion on `%s` (<t:%d:R>).",
-// 				t.Name, ruinedTs/1000, locationLink, balance, chunks,
-// 				utils.FormatTime(nextNewDay), nextNewDay.Unix(),
-// 			)
-// 		})
-
-// 		_, err := s.ChannelMessageSendEmbed(channelID, &discordgo.MessageEmbed{
-// 			Title:       fmt.Sprintf("Town Flow | Ruin Events [%d]", count),
-// 			Description: strings.Join(desc, "\n\n"),
-// 			Color:       discordutil.DARK_GOLD,
-// 		})
-// 		if err != nil {
-// 			logutil.Logf(logutil.RED, "error sending town flow ruin event:\n\t%v", err)
-// 		}
-// 	}
-// }
-
-func TrySendDeletedNotif(s *discordgo.Session, channelID string, towns []oapi.TownInfo, staleTowns []oapi.TownInfo) {
-	diff, _ := utils.DifferenceBy(staleTowns, towns, func(t oapi.TownInfo) string {
-		return t.UUID
-	})
-
-	count := len(diff)
-	if count > 0 {
-		desc := parallel.Map(diff, func(t oapi.TownInfo, _ int) string {
-			spawn := t.Coordinates.Spawn
-			locationLink := fmt.Sprintf("[%.0f, %.0f, %.0f](https://map.earthmc.net?x=%f&z=%f&zoom=5)", spawn.X, spawn.Y, spawn.Z, spawn.X, spawn.Z)
-
-			chunks := logutil.HumanizedSprintf("%s `%d`", shared.EMOJIS.CHUNK, t.Size())
-			balance := logutil.HumanizedSprintf("%s `%.0f`", shared.EMOJIS.GOLD_INGOT, t.Bal())
-			return fmt.Sprintf(
-				"`%s` was deleted. Located at %s.\nFounder: `%s` %s %s",
-				t.Name, locationLink, t.Founder, balance, chunks,
-			)
-		})
-
-		_, err := s.ChannelMessageSendEmbed(channelID, &discordgo.MessageEmbed{
-			Title:       fmt.Sprintf("Town Flow | Deletion Events [%d]", count),
-			Description: strings.Join(desc, "\n\n"),
-			Color:       discordutil.RED,
-		})
-		if err != nil {
-			logutil.Logf(logutil.RED, "error sending town flow fall event(s):\n\t%v", err)
-		}
+	nationStore, err := database.GetStore(mdb, database.NATIONS_STORE)
+	if err != nil {
+		logutil.Printf(logutil.RED, "\nERR | cannot run StatsHistory task:\n\t%s", err)
+		return err
 	}
-}
-
-func TrySendLeftJoinedNotif(
-	s *discordgo.Session, channelID string,
-	towns, staleTowns []oapi.TownInfo,
-	townless, residents oapi.EntityList,
-) {
-	left, joined := CalcLeftJoined(towns, staleTowns, townless, residents)
-	if (len(left) + len(joined)) < 1 {
-		return
+	allianceStore, err := database.GetStore(mdb, database.ALLIANCES_STORE)
+	if err != nil {
+		logutil.Printf(logutil.RED, "\nERR | cannot run StatsHistory task:\n\t%s", err)
+		return err
 	}
 
-	leftField := fmt.Sprintf("%s Became a nomad [%d]", shared.EMOJIS.EXIT, len(left))
-	joinedField := fmt.Sprintf("%s Became a resident [%d]", shared.EMOJIS.ENTRY, len(joined))
+	recorded := database.RecordStatsHistory(historyStore, townStore, nationStore, allianceStore, time.Now())
+	logutil.Printf(logutil.HIDDEN, "\nDEBUG | Stats history samples recorded: %d", recorded)
 
-	title := "Player Flow | Town Join/Leave Events"
-	embed := discordutil.NewEmbedBuilder(&discordutil.DARK_GREEN, &title, nil, nil)
-	embed.SetFields(
-		discordutil.NewEmbedField(leftField, strings.Join(left, "\n\n"), true),
-		discordutil.NewEmbedField(joinedField, strings.Join(joined, "\n\n"), true),
-	)
+	if err := historyStore.WriteSnapshot(); err != nil {
+		logutil.Printf(logutil.RED, "\nERR | stats history store failed to write snapshot:\n\t%s", err)
+		return err
+	}
 
-	s.ChannelMessageSendEmbed(channelID, embed.Build())
+	return nil
 }
 
-//#endregion
-
-func CalcLeftJoined(towns, staleTowns []oapi.TownInfo, townless, residents oapi.EntityList) (left, joined []string) {
-	// For resident -> town lookup (stale)
-	staleResMap := make(map[string]oapi.TownInfo)
-	for _, t := range staleTowns {
-		for _, r := range t.Residents {
-			staleResMap[r.UUID] = t
-		}
-	}
-
-	// For resident -> town lookup (fresh not stale)
-	resMap := make(map[string]oapi.TownInfo)
-	for _, t := range towns {
-		for _, r := range t.Residents {
-			resMap[r.UUID] = t
-		}
+func playerTrackingTask(mdb *database.Database, retention time.Duration) error {
+	trailStore, err := database.GetStore(mdb, database.PLAYER_TRAILS_STORE)
+	if err != nil {
+		logutil.Printf(logutil.RED, "\nERR | cannot schedule PlayerTracking task:\n\t%s", err)
+		return err
 	}
 
-	nationName := func(t oapi.TownInfo) string {
-		if t.Nation.Name != nil {
-			return *t.Nation.Name
-		}
-		return "No Nation"
+	visible, err := mapi.GetVisiblePlayers()
+	if err != nil {
+		logutil.Printf(logutil.RED, "\nERR | player tracking task failed to fetch visible players:\n\t%s", err)
+		return err
 	}
 
-	// who left
-	for uuid, town := range staleResMap {
-		if _, ok := resMap[uuid]; !ok {
-			name, ok := townless[uuid]
-			if !ok {
-				continue // Left a town but not townless. Likely purged?
-			}
-
-			left = append(left, logutil.HumanizedSprintf(
-				"`%s` left %s (**%s**)\nMayor: `%s`, Balance: `%.0f` %s",
-				name, town.Name, nationName(town),
-				town.Mayor.Name, town.Bal(), shared.EMOJIS.GOLD_INGOT,
-			))
-		}
-	}
+	updated, removed := database.UpdatePlayerTrails(trailStore, visible, time.Now(), retention)
+	logutil.Printf(logutil.HIDDEN, "\nDEBUG | Player trails updated: %d, removed: %d", updated, removed)
 
-	// who joined
-	for uuid, town := range resMap {
-		if _, ok := staleResMap[uuid]; !ok {
-			name := residents[uuid]
-			joined = append(joined, logutil.HumanizedSprintf(
-				"`%s` joined %s (**%s**)\nMayor: `%s`, Balance: `%.0f` %s",
-				name, town.Name, nationName(town),
-				town.Mayor.Name, town.Bal(), shared.EMOJIS.GOLD_INGOT,
-			))
-		}
+	if err := trailStore.WriteSnapshot(); err != nil {
+		logutil.Printf(logutil.RED, "\nERR | player trails store failed to write snapshot:\n\t%s", err)
+		return err
 	}
 
-	return
+	return nil
 }
+
+//#endregion
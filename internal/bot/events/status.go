@@ -0,0 +1,90 @@
+package events
+
+import (
+	"emcsrw/internal/bot/scheduler"
+	"emcsrw/internal/database"
+	"emcsrw/pkg/api/oapi"
+	"emcsrw/pkg/utils/logutil"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// How often the bot writes its status for other processes to read.
+const HEARTBEAT_INTERVAL = 15 * time.Second
+
+// Close enough to when the process started, used to report uptime.
+var StartedAt = time.Now()
+
+// The current status of this bot, see [database.BotStatus].
+func BotStatus(s *discordgo.Session) database.BotStatus {
+	s.RLock()
+	gateway := database.GatewayStatus{
+		Connected: s.DataReady,
+		LatencyMs: s.LastHeartbeatAck.Sub(s.LastHeartbeatSent).Milliseconds(),
+	}
+	s.RUnlock()
+
+	return database.BotStatus{
+		UpdatedAt: time.Now().UnixMilli(),
+		StartedAt: StartedAt.UnixMilli(),
+		Gateway:   gateway,
+		OAPI:      oapi.Circuit.Status(),
+		Tasks:     scheduledTasks(),
+	}
+}
+
+// The state of every task in the scheduler, for processes (like the CLI) that can't ask it directly.
+func scheduledTasks() []database.ScheduledTask {
+	if scheduler.Instance == nil {
+		return nil
+	}
+
+	states := scheduler.Instance.Tasks()
+	tasks := make([]database.ScheduledTask, len(states))
+	for i, state := range states {
+		tasks[i] = database.ScheduledTask{
+			Name:        state.Name,
+			Schedule:    state.Schedule,
+			Overlap:     state.Overlap.String(),
+			Paused:      state.Paused,
+			Running:     state.Running,
+			Runs:        state.Runs,
+			Failures:    state.Failures,
+			AvgDuration: state.AvgDuration.Milliseconds(),
+		}
+		if !state.NextRun.IsZero() {
+			tasks[i].NextRun = state.NextRun.UnixMilli()
+		}
+	}
+
+	return tasks
+}
+
+// Records every scheduled task run to the task runs store so the Custom API can tell how fresh its data is,
+// and so tasks can look back at when they (or others) last ran.
+func recordTaskRun(mdb *database.Database) func(taskName string, start time.Time, elapsed time.Duration, err error) {
+	return func(taskName string, start time.Time, elapsed time.Duration, err error) {
+		runStore, storeErr := database.GetStore(mdb, database.TASK_RUNS_STORE)
+		if storeErr != nil {
+			logutil.Printf(logutil.RED, "\nERR | cannot record run of task '%s':\n\t%s", taskName, storeErr)
+			return
+		}
+
+		database.RecordTaskRun(runStore, taskName, start, elapsed, err)
+		if err := runStore.WriteSnapshot(); err != nil {
+			logutil.Printf(logutil.RED, "\nERR | task runs store failed to write snapshot:\n\t%s", err)
+		}
+	}
+}
+
+func heartbeatTask(s *discordgo.Session, mdb *database.Database) error {
+	statusStore, err := database.GetStore(mdb, database.BOT_STATUS_STORE)
+	if err != nil {
+		logutil.Printf(logutil.RED, "\nERR | cannot run Heartbeat task:\n\t%s", err)
+		return err
+	}
+
+	statusStore.Set(database.BOT_STATUS_KEY, BotStatus(s))
+	return statusStore.WriteSnapshot()
+}
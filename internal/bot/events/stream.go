@@ -0,0 +1,108 @@
+package events
+
+import (
+	"slices"
+
+	"emcsrw/internal/database"
+	"emcsrw/pkg/api/oapi"
+	"emcsrw/pkg/utils/logutil"
+
+	"github.com/samber/lo"
+)
+
+// Publishes events to the Custom API stream and queues them for any webhooks subscribed to them, logging rather
+// than returning any error since failing to publish should never stop a task from doing its actual job.
+func publishStreamEvents[T any](mdb *database.Database, topic database.StreamTopic, eventType string, data ...T) {
+	events, err := database.PublishStreamEvents(mdb, topic, eventType, data...)
+	if err != nil {
+		logutil.Printf(logutil.RED, "\nERR | failed to publish %s/%s stream events:\n\t%s", topic, eventType, err)
+	}
+
+	if !slices.Contains(database.WEBHOOK_TOPICS, topic) {
+		return
+	}
+
+	if err := database.QueueWebhookDeliveries(mdb, events); err != nil {
+		logutil.Printf(logutil.RED, "\nERR | failed to queue %s/%s webhook deliveries:\n\t%s", topic, eventType, err)
+	}
+}
+
+func publishTownFlow(mdb *database.Database, events []TownEvent) {
+	grouped := lo.GroupBy(events, func(e TownEvent) TownEventType { return e.Type })
+	for _, eventType := range TOWN_EVENT_TYPES {
+		data := lo.Map(grouped[eventType], func(e TownEvent, _ int) database.StreamTown {
+			st := database.NewStreamTown(e.Town)
+			switch e.Type {
+			case TownRenamed:
+				st.OldName = &e.Prev.Name
+			case TownMayorChanged:
+				st.OldMayor = &e.Prev.Mayor.Name
+			case TownLeftNation:
+				st.OldNation = e.Prev.Nation.Name
+			}
+
+			return st
+		})
+
+		publishStreamEvents(mdb, database.StreamTopicTownFlow, string(eventType), data...)
+	}
+}
+
+func publishNationFlow(mdb *database.Database, events []NationEvent) {
+	grouped := lo.GroupBy(events, func(e NationEvent) NationEventType { return e.Type })
+	for _, eventType := range NATION_EVENT_TYPES {
+		data := lo.Map(grouped[eventType], func(e NationEvent, _ int) database.StreamNation {
+			sn := database.NewStreamNation(e.Nation)
+			switch e.Type {
+			case NationRenamed:
+				sn.OldName = &e.Prev.Name
+			case NationKingChanged:
+				sn.OldKing = &e.Prev.King.Name
+			case NationCapitalChanged:
+				sn.OldCapital = &e.Prev.Capital.Name
+			case NationTownJoined, NationTownLeft:
+				sn.Town = &e.Town.Name
+			case NationMerged:
+				sn.MergedInto = &e.MergedInto.Name
+				sn.MovedTowns = e.MovedTowns
+			}
+
+			return sn
+		})
+
+		publishStreamEvents(mdb, database.StreamTopicNationFlow, string(eventType), data...)
+	}
+}
+
+func publishPlayerFlow(mdb *database.Database, events []PlayerFlowEvent) {
+	left, joined := []database.StreamPlayerFlow{}, []database.StreamPlayerFlow{}
+	for _, e := range events {
+		data := database.StreamPlayerFlow{
+			UUID: e.Player.UUID, Name: e.Player.Name,
+			Town: e.Town.Name, TownUUID: e.Town.UUID, Nation: e.Town.Nation.Name,
+		}
+
+		if e.Joined {
+			joined = append(joined, data)
+		} else {
+			left = append(left, data)
+		}
+	}
+
+	publishStreamEvents(mdb, database.StreamTopicPlayerFlow, "left", left...)
+	publishStreamEvents(mdb, database.StreamTopicPlayerFlow, "joined", joined...)
+}
+
+func publishVoteParty(mdb *database.Database, prev *oapi.ServerVoteParty, vp oapi.ServerVoteParty) {
+	if prev != nil && prev.NumRemaining == vp.NumRemaining {
+		return
+	}
+
+	event := database.StreamVoteParty{Target: vp.Target, Remaining: vp.NumRemaining}
+	if vp.NumRemaining == 0 {
+		publishStreamEvents(mdb, database.StreamTopicVoteParty, "completed", event)
+		return
+	}
+
+	publishStreamEvents(mdb, database.StreamTopicVoteParty, "progress", event)
+}
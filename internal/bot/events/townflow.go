@@ -0,0 +1,270 @@
+package events
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+
+	"emcsrw/internal/database"
+	"emcsrw/internal/shared"
+	"emcsrw/pkg/api/oapi"
+	"emcsrw/pkg/utils"
+	"emcsrw/pkg/utils/discordutil"
+	"emcsrw/pkg/utils/logutil"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/samber/lo"
+)
+
+// How long a town stays ruined before it is deleted at the following new day.
+const RUIN_DURATION = 72 * time.Hour
+
+type TownEventType string
+
+const (
+	TownCreated        TownEventType = "created"
+	TownRenamed        TownEventType = "renamed"
+	TownMayorChanged   TownEventType = "mayor-changed"
+	TownJoinedNation   TownEventType = "joined-nation"
+	TownLeftNation     TownEventType = "left-nation"
+	TownCapitalChanged TownEventType = "capital-changed" // The town became the capital of its nation.
+	TownRuined         TownEventType = "ruined"
+	TownReclaimed      TownEventType = "reclaimed"
+	TownDeleted        TownEventType = "deleted"
+)
+
+// Every type of town event, in the order they are posted.
+var TOWN_EVENT_TYPES = []TownEventType{
+	TownCreated, TownRenamed, TownMayorChanged, TownJoinedNation, TownLeftNation,
+	TownCapitalChanged, TownRuined, TownReclaimed, TownDeleted,
+}
+
+// A single change to a town between two DataUpdate runs.
+type TownEvent struct {
+	Type TownEventType
+	Town oapi.TownInfo // Current state of the town, or its last known state if deleted.
+	Prev oapi.TownInfo // State of the town before the change. Zero value if created.
+}
+
+func townNationUUID(t oapi.TownInfo) string {
+	return lo.FromPtr(t.Nation.UUID)
+}
+
+func townNationName(t oapi.TownInfo) string {
+	return lo.FromPtrOr(t.Nation.Name, "No Nation")
+}
+
+// Classifies every change between the stale and fresh towns into typed events, sorted by
+// TOWN_EVENT_TYPES then town name. A single town can produce multiple events (renamed and mayor changed etc).
+//
+// Ruining/reclaiming a town also changes its mayor and removes it from its nation, those are part of
+// the ruin/reclaim rather than being reported on their own.
+func DiffTowns(towns, staleTowns map[string]oapi.TownInfo) []TownEvent {
+	events := []TownEvent{}
+	add := func(eventType TownEventType, cur, prev oapi.TownInfo) {
+		events = append(events, TownEvent{Type: eventType, Town: cur, Prev: prev})
+	}
+
+	for uuid, cur := range towns {
+		if _, ok := staleTowns[uuid]; !ok {
+			add(TownCreated, cur, oapi.TownInfo{})
+		}
+	}
+
+	for uuid, prev := range staleTowns {
+		cur, ok := towns[uuid]
+		if !ok {
+			add(TownDeleted, prev, prev)
+			continue
+		}
+
+		if cur.Name != prev.Name {
+			add(TownRenamed, cur, prev)
+		}
+
+		if cur.Status.Ruined != prev.Status.Ruined {
+			add(lo.Ternary(cur.Status.Ruined, TownRuined, TownReclaimed), cur, prev)
+			continue
+		}
+
+		if cur.Mayor.UUID != prev.Mayor.UUID {
+			add(TownMayorChanged, cur, prev)
+		}
+
+		curNation, prevNation := townNationUUID(cur), townNationUUID(prev)
+		if curNation != prevNation {
+			if prevNation != "" {
+				add(TownLeftNation, cur, prev)
+			}
+			if curNation != "" {
+				add(TownJoinedNation, cur, prev)
+			}
+
+			continue // new nations start with a capital, that's for nation flow to report
+		}
+
+		if curNation != "" && cur.Status.Capital && !prev.Status.Capital {
+			add(TownCapitalChanged, cur, prev)
+		}
+	}
+
+	slices.SortFunc(events, func(a, b TownEvent) int {
+		return cmp.Or(
+			cmp.Compare(slices.Index(TOWN_EVENT_TYPES, a.Type), slices.Index(TOWN_EVENT_TYPES, b.Type)),
+			cmp.Compare(a.Town.Name, b.Town.Name),
+		)
+	})
+
+	return events
+}
+
+// Posts every town event to channelID, one or more embeds per type. Bursts too big for a
+// single embed are split into pages, and pages are sent in as few messages as possible.
+func TrySendTownFlowNotifs(s *discordgo.Session, channelID string, events []TownEvent) error {
+	grouped := lo.GroupBy(events, func(e TownEvent) TownEventType { return e.Type })
+
+	embeds := []*discordgo.MessageEmbed{}
+	for _, eventType := range TOWN_EVENT_TYPES {
+		group := grouped[eventType]
+		if len(group) == 0 {
+			continue
+		}
+
+		lines := lo.Map(group, func(e TownEvent, _ int) string { return townEventLine(e) })
+		title := fmt.Sprintf("Town Flow | %s Events [%d]", townEventTitle(eventType), len(group))
+
+		embeds = append(embeds, discordutil.PaginatedEmbeds(title, townEventColour(eventType), lines, "\n\n")...)
+	}
+
+	for _, batch := range discordutil.BatchEmbeds(embeds) {
+		if _, err := s.ChannelMessageSendEmbeds(channelID, batch); err != nil {
+			return err // the rest would most likely fail the same way
+		}
+	}
+
+	return nil
+}
+
+func townEventTitle(eventType TownEventType) string {
+	switch eventType {
+	case TownCreated:
+		return "Creation"
+	case TownRenamed:
+		return "Rename"
+	case TownMayorChanged:
+		return "Mayor Change"
+	case TownJoinedNation:
+		return "Nation Join"
+	case TownLeftNation:
+		return "Nation Leave"
+	case TownCapitalChanged:
+		return "Capital Change"
+	case TownRuined:
+		return "Ruin"
+	case TownReclaimed:
+		return "Reclaim"
+	case TownDeleted:
+		return "Deletion"
+	}
+
+	return string(eventType)
+}
+
+func townEventColour(eventType TownEventType) int {
+	switch eventType {
+	case TownCreated:
+		return discordutil.GREEN
+	case TownRenamed:
+		return discordutil.AQUA
+	case TownMayorChanged:
+		return discordutil.BLURPLE
+	case TownJoinedNation:
+		return discordutil.BLUE
+	case TownLeftNation:
+		return discordutil.DARK_BLUE
+	case TownCapitalChanged:
+		return discordutil.GOLD
+	case TownRuined:
+		return discordutil.DARK_GOLD
+	case TownReclaimed:
+		return discordutil.DARK_GREEN
+	case TownDeleted:
+		return discordutil.RED
+	}
+
+	return discordutil.DEFAULT
+}
+
+func townLocationLink(t oapi.TownInfo) string {
+	spawn := t.Coordinates.Spawn
+	return fmt.Sprintf("[%.0f, %.0f, %.0f](https://map.earthmc.net?x=%f&z=%f&zoom=5)", spawn.X, spawn.Y, spawn.Z, spawn.X, spawn.Z)
+}
+
+func townEventLine(e TownEvent) string {
+	t := e.Town
+
+	chunks := logutil.HumanizedSprintf("%s `%d`", shared.EMOJIS.CHUNK, t.Size())
+	balance := logutil.HumanizedSprintf("%s `%.0f`", shared.EMOJIS.GOLD_INGOT, t.Bal())
+
+	switch e.Type {
+	case TownCreated:
+		openEmoji := lo.Ternary(t.Status.Open, shared.EMOJIS.CIRCLE_CHECK, shared.EMOJIS.CIRCLE_CROSS)
+		outsidersEmoji := lo.Ternary(t.Status.CanOutsidersSpawn, shared.EMOJIS.CIRCLE_CHECK, shared.EMOJIS.CIRCLE_CROSS)
+
+		return fmt.Sprintf(
+			"`%s` was created. Located at %s.\nFounder: `%s` %sG %s Chunks %s Open %s Outsiders Can Spawn",
+			t.Name, townLocationLink(t), t.Founder, balance, chunks, openEmoji, outsidersEmoji,
+		)
+	case TownRenamed:
+		return fmt.Sprintf(
+			"`%s` was renamed to `%s`.\nLocated at %s.\nFounder: `%s` %sG %s Chunks",
+			e.Prev.Name, t.Name, townLocationLink(t), t.Founder, balance, chunks,
+		)
+	case TownMayorChanged:
+		return fmt.Sprintf(
+			"`%s` (**%s**) changed mayor from `%s` to `%s`.\nLocated at %s. %s %s",
+			t.Name, townNationName(t), e.Prev.Mayor.Name, t.Mayor.Name, townLocationLink(t), balance, chunks,
+		)
+	case TownJoinedNation:
+		return fmt.Sprintf(
+			"`%s` joined **%s**.\nMayor: `%s`, Residents: `%d` %s",
+			t.Name, townNationName(t), t.Mayor.Name, t.NumResidents(), chunks,
+		)
+	case TownLeftNation:
+		return fmt.Sprintf(
+			"`%s` left **%s**.\nMayor: `%s`, Residents: `%d` %s",
+			t.Name, townNationName(e.Prev), t.Mayor.Name, t.NumResidents(), chunks,
+		)
+	case TownCapitalChanged:
+		return fmt.Sprintf(
+			"`%s` is now the capital of **%s**.\nMayor: `%s`, Residents: `%d` %s",
+			t.Name, townNationName(t), t.Mayor.Name, t.NumResidents(), chunks,
+		)
+	case TownRuined:
+		ruinedAt := time.Now()
+		if t.Timestamps.RuinedAt != nil {
+			ruinedAt = time.UnixMilli(int64(*t.Timestamps.RuinedAt))
+		}
+
+		// Deleted at the first new day once it's been ruined long enough.
+		deletion := database.NextNewDay(ruinedAt.Add(RUIN_DURATION))
+		return fmt.Sprintf(
+			"`%s` (**%s**) fell into ruin <t:%d:R> at %s. %s %s\nDeletion on `%s` (<t:%d:R>).",
+			t.Name, townNationName(e.Prev), ruinedAt.Unix(), townLocationLink(t), balance, chunks,
+			utils.FormatTime(deletion), deletion.Unix(),
+		)
+	case TownReclaimed:
+		return fmt.Sprintf(
+			"`%s` was reclaimed by `%s`. Located at %s. %s %s",
+			t.Name, t.Mayor.Name, townLocationLink(t), balance, chunks,
+		)
+	case TownDeleted:
+		return fmt.Sprintf(
+			"`%s` was deleted. Located at %s.\nFounder: `%s` %s %s",
+			t.Name, townLocationLink(t), t.Founder, balance, chunks,
+		)
+	}
+
+	return fmt.Sprintf("`%s`: %s", t.Name, e.Type)
+}
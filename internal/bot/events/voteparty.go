@@ -0,0 +1,74 @@
+package events
+
+import (
+	"fmt"
+	"time"
+
+	"emcsrw/internal/database"
+	"emcsrw/pkg/api/oapi"
+	"emcsrw/pkg/utils"
+	"emcsrw/pkg/utils/logutil"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Records a VoteParty sample and notifies every channel whose thresholds the remaining votes just went below.
+// Since the previous sample is persisted, nothing is sent again after a restart unless a threshold was actually crossed.
+func trackVoteParty(s *discordgo.Session, mdb *database.Database, vp oapi.ServerVoteParty) {
+	vpStore, err := database.GetStore(mdb, database.VOTEPARTY_STORE)
+	if err != nil {
+		logutil.Printf(logutil.RED, "\nERR | cannot track VoteParty:\n\t%s", err)
+		return
+	}
+
+	state := database.VotePartyState{}
+	if existing, err := vpStore.Get(database.VOTEPARTY_KEY); err == nil {
+		state = *existing
+	}
+
+	now := time.Now()
+	prev, _ := state.Record(vp, now)
+	vpStore.Set(database.VOTEPARTY_KEY, state)
+
+	if prev != nil && vp.NumRemaining < prev.Remaining {
+		settingsStore, _ := database.GetStore(mdb, database.GUILD_SETTINGS_STORE)
+		deliverFeed(mdb, database.FeedVoteParty, "VP_CHANNEL_ID", func(d feedDelivery) error {
+			thresholds := database.VP_DEFAULT_THRESHOLDS
+			if settingsStore != nil {
+				thresholds = database.GuildVotePartyThresholds(settingsStore, d.GuildID)
+			}
+
+			threshold, crossed := database.CrossedVotePartyThreshold(thresholds, prev.Remaining, vp.NumRemaining)
+			if !crossed {
+				return nil
+			}
+
+			msg, err := s.ChannelMessageSend(d.ChannelID, votePartyNotifContent(state, threshold, now))
+			if err == nil && d.GuildID == "" {
+				s.ChannelMessageCrosspost(d.ChannelID, msg.ID) // publish to followers of the toolkit #voteparty channel
+			}
+
+			return err
+		})
+	}
+
+	if err := vpStore.WriteSnapshot(); err != nil {
+		logutil.Printf(logutil.RED, "\nERR | voteparty store failed to write snapshot:\n\t%s", err)
+	}
+}
+
+func votePartyNotifContent(state database.VotePartyState, threshold int, now time.Time) string {
+	latest, _ := state.Latest()
+	content := fmt.Sprintf("VoteParty has less than `%d` votes remaining! Currently at `%d`.", threshold, latest.Remaining)
+
+	rate := state.Rate(now)
+	if eta := state.ETA(now); rate > 0 && eta > 0 {
+		etaValue, etaUnit := utils.HumanizeDuration(eta.Minutes())
+		content += fmt.Sprintf(
+			"\n\n:chart_with_upwards_trend: **Rate**: ~%.2f votes/min (last %.0f mins),\n:timer: **ETA**: %.1f %s (<t:%d:t>)",
+			rate, database.VP_RATE_WINDOW.Minutes(), etaValue, etaUnit, now.Add(eta).Unix(),
+		)
+	}
+
+	return content
+}
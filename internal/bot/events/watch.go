@@ -0,0 +1,181 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"emcsrw/internal/database"
+	"emcsrw/pkg/api/oapi"
+	"emcsrw/pkg/utils/discordutil"
+	"emcsrw/pkg/utils/logutil"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/samber/lo"
+)
+
+// Max amount of alerts listed in a single DM, the rest are summarised.
+const WATCH_ALERT_MAX_LINES = 10
+
+// Something that happened to a watched town, nation or player. DMed to everyone watching it.
+type WatchAlert struct {
+	Kind database.WatchKind
+	UUID string
+	Line string
+}
+
+// Watched towns that ruined or changed mayor.
+func townWatchAlerts(events []TownEvent) []WatchAlert {
+	alerts := []WatchAlert{}
+	for _, e := range events {
+		if e.Type == TownRuined || e.Type == TownMayorChanged {
+			alerts = append(alerts, WatchAlert{Kind: database.WatchTown, UUID: e.Town.UUID, Line: townEventLine(e)})
+		}
+	}
+
+	return alerts
+}
+
+// Watched nations that gained or lost towns, including by merging.
+func nationWatchAlerts(events []NationEvent) []WatchAlert {
+	alerts := []WatchAlert{}
+	for _, e := range events {
+		switch e.Type {
+		case NationTownJoined, NationTownLeft:
+			alerts = append(alerts, WatchAlert{Kind: database.WatchNation, UUID: e.Nation.UUID, Line: nationEventLine(e)})
+		case NationMerged:
+			line := nationEventLine(e)
+			alerts = append(alerts,
+				WatchAlert{Kind: database.WatchNation, UUID: e.Nation.UUID, Line: line},
+				WatchAlert{Kind: database.WatchNation, UUID: e.MergedInto.UUID, Line: line},
+			)
+		}
+	}
+
+	return alerts
+}
+
+// Watched players that joined or left a town, or came online since the last update.
+func playerWatchAlerts(events []PlayerFlowEvent, online, staleOnline oapi.EntityList) []WatchAlert {
+	alerts := []WatchAlert{}
+	for _, e := range events {
+		alerts = append(alerts, WatchAlert{
+			Kind: database.WatchPlayer, UUID: e.Player.UUID,
+			Line: fmt.Sprintf(
+				"`%s` %s `%s` (**%s**).",
+				e.Player.Name, lo.Ternary(e.Joined, "joined", "left"), e.Town.Name, townNationName(e.Town),
+			),
+		})
+	}
+
+	// Without a previous list, everyone online would look like they just came online.
+	if staleOnline == nil {
+		return alerts
+	}
+
+	for uuid, name := range online {
+		if _, ok := staleOnline[uuid]; !ok {
+			alerts = append(alerts, WatchAlert{Kind: database.WatchPlayer, UUID: uuid, Line: fmt.Sprintf("`%s` came online.", name)})
+		}
+	}
+
+	return alerts
+}
+
+// Watched towns that are now within FALLING_TFRAME of falling into ruin.
+func fallingWatchAlerts(falling, staleFalling map[string]database.FallingTown) []WatchAlert {
+	alerts := []WatchAlert{}
+	for uuid, ft := range falling {
+		if _, ok := staleFalling[uuid]; ok {
+			continue
+		}
+
+		alerts = append(alerts, WatchAlert{
+			Kind: database.WatchTown, UUID: uuid,
+			Line: fmt.Sprintf(
+				"`%s` (**%s**) will fall into ruin <t:%d:R>.\nMayor `%s` was last online <t:%d:R>.",
+				ft.Name, townNationName(ft.TownInfo), ft.RuinAt.Unix(), ft.Mayor.Name, ft.MayorLastOnline.Unix(),
+			),
+		})
+	}
+
+	return alerts
+}
+
+// DMs every user watching something that alerts are about, one DM per user. Users over their rate limit are skipped,
+// and anyone that can't be DMed (blocked the bot, closed DMs etc) has their alerts disabled.
+func sendWatchAlerts(s *discordgo.Session, mdb *database.Database, alerts []WatchAlert) {
+	if len(alerts) == 0 {
+		return
+	}
+
+	watchStore, err := database.GetStore(mdb, database.WATCHLISTS_STORE)
+	if err != nil {
+		logutil.Printf(logutil.RED, "\nERR | cannot send watchlist alerts:\n\t%s", err)
+		return
+	}
+
+	index := database.WatchersIndex(watchStore)
+	userAlerts := make(map[string][]string)
+	for _, a := range alerts {
+		for _, userID := range index[a.Kind][a.UUID] {
+			if !lo.Contains(userAlerts[userID], a.Line) { // a town and its nation could both be watched
+				userAlerts[userID] = append(userAlerts[userID], a.Line)
+			}
+		}
+	}
+
+	if len(userAlerts) == 0 {
+		return
+	}
+
+	// The watchlist is only changed under the store lock before and after each DM, so anything the user
+	// changes while it's being sent (like turning alerts off) isn't overwritten by a stale copy.
+	now := time.Now()
+	for userID, lines := range userAlerts {
+		allowed, suppressed := database.ReserveWatchAlert(watchStore, userID, now, len(lines))
+		if !allowed {
+			continue
+		}
+
+		err := sendWatchAlertDM(s, userID, lines, suppressed)
+		if err != nil {
+			logutil.Logf(logutil.RED, "error sending watchlist alerts to user %s:\n\t%v", userID, err)
+		}
+
+		database.FinishWatchAlert(watchStore, userID, err == nil, cannotDM(err), len(lines), suppressed)
+	}
+
+	if err := watchStore.WriteSnapshot(); err != nil {
+		logutil.Printf(logutil.RED, "\nERR | watchlists store failed to write snapshot:\n\t%s", err)
+	}
+}
+
+func sendWatchAlertDM(s *discordgo.Session, userID string, lines []string, suppressed int) error {
+	ch, err := s.UserChannelCreate(userID)
+	if err != nil {
+		return err
+	}
+
+	title := "Watchlist Alerts"
+	desc := discordutil.JoinLimited(lines, WATCH_ALERT_MAX_LINES, "\n\n")
+	embed := discordutil.NewEmbedBuilder(&discordutil.BLURPLE, &title, &desc, nil)
+
+	footer := "Use /watch alerts to turn these off."
+	if suppressed > 0 {
+		footer = fmt.Sprintf("%d alert(s) were skipped since your last DM to avoid spam. %s", suppressed, footer)
+	}
+	embed.SetFooter(footer, nil)
+
+	_, err = s.ChannelMessageSendEmbed(ch.ID, embed.Build())
+	return err
+}
+
+func cannotDM(err error) bool {
+	var restErr *discordgo.RESTError
+	if !errors.As(err, &restErr) || restErr.Message == nil {
+		return false
+	}
+
+	return restErr.Message.Code == discordgo.ErrCodeCannotSendMessagesToThisUser
+}
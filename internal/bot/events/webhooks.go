@@ -0,0 +1,140 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"syscall"
+	"time"
+
+	"emcsrw/internal/database"
+	"emcsrw/pkg/utils/logutil"
+)
+
+// How often due webhook deliveries are attempted.
+const WEBHOOK_DELIVERY_INTERVAL = 15 * time.Second
+
+// Max amount of deliveries attempted in a single run, the rest are left for the next one.
+const WEBHOOK_MAX_PER_RUN = 100
+
+var webhookClient = &http.Client{
+	Timeout:   10 * time.Second,
+	Transport: webhookTransport(),
+	// A redirect would send the signed payload somewhere nobody registered.
+	CheckRedirect: func(req *http.Request, via []*http.Request) error { return http.ErrUseLastResponse },
+}
+
+// Refuses to connect to non-public addresses. The URL is already checked when a webhook is created,
+// but its hostname can resolve to anything by the time a delivery is made.
+func webhookTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, c syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !database.WebhookAddrAllowed(addrPort.Addr()) {
+				return fmt.Errorf("refusing to deliver to non-public address %s", addrPort.Addr())
+			}
+
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil // would connect to the proxy instead, skipping the check
+	transport.DialContext = dialer.DialContext
+
+	return transport
+}
+
+// Sends every due webhook delivery. A webhook that fails is skipped for the rest of the run, since its later
+// deliveries have to wait for the failed one to be retried first (see DueWebhookDeliveries).
+func webhookTask(mdb *database.Database) error {
+	hookStore, err := database.OpenStore(mdb, database.WEBHOOKS_STORE)
+	if err != nil {
+		return err
+	}
+	deliveryStore, err := database.OpenStore(mdb, database.WEBHOOK_DELIVERIES_STORE)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	due := database.DueWebhookDeliveries(deliveryStore, now)
+	if len(due) == 0 {
+		return nil
+	}
+
+	delivered := []string{}
+	failed := make(map[string]string)
+	failing := make(map[string]bool) // webhook IDs that already failed this run
+
+	for i, d := range due {
+		if i >= WEBHOOK_MAX_PER_RUN {
+			break
+		}
+		if failing[d.WebhookID] {
+			continue
+		}
+
+		hook, err := hookStore.Get(d.WebhookID)
+		if err != nil {
+			continue // deleted, dropped when applying results
+		}
+
+		if err := sendWebhook(*hook, d); err != nil {
+			failed[d.ID] = err.Error()
+			failing[d.WebhookID] = true
+			continue
+		}
+
+		delivered = append(delivered, d.ID)
+	}
+
+	if len(failed) > 0 {
+		logutil.Printf(logutil.YELLOW, "\nWARN | %d webhook deliveries failed and will be retried\n", len(failed))
+	}
+
+	return database.ApplyWebhookDeliveryResults(mdb, delivered, failed, time.Now())
+}
+
+// Posts the event of a delivery to the webhook as signed JSON. Anything other than a 2xx response is a failure.
+func sendWebhook(hook database.Webhook, d database.WebhookDelivery) error {
+	body, err := json.Marshal(d.Event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	ts := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "EMCS-Webhooks")
+	req.Header.Set(database.WEBHOOK_EVENT_HEADER, string(d.Event.Topic)+"."+d.Event.Type)
+	req.Header.Set(database.WEBHOOK_DELIVERY_HEADER, d.ID)
+	req.Header.Set(database.WEBHOOK_TIMESTAMP_HEADER, strconv.FormatInt(ts, 10))
+	req.Header.Set(database.WEBHOOK_SIGNATURE_HEADER, database.SignWebhookPayload(hook.Secret, ts, body))
+
+	res, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 4096)) // let the connection be reused
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("received status %s", res.Status)
+	}
+
+	return nil
+}
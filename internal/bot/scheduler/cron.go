@@ -0,0 +1,195 @@
+package scheduler
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// How far ahead Cron.Next will look before giving up on expressions that can never match, like "0 0 31 2 *".
+const CRON_MAX_LOOKAHEAD = 5 * 366 * 24 * time.Hour
+
+type cronField struct {
+	name     string
+	min, max uint
+}
+
+// In the same order as they appear in an expression.
+var cronFields = [5]cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 6},
+}
+
+// A Spec parsed from a standard 5 field cron expression (minute, hour, day of month, month, day of week), evaluated in UTC.
+//
+// Each field accepts *, single values, ranges (1-5), steps (*/15, 0-30/10) and comma separated lists of those.
+// Like most crons, a task runs if EITHER the day of month or day of week matches when both are restricted,
+// and 7 is accepted as Sunday. Names (JAN, MON), descriptors (@daily) and timezones are not supported.
+type Cron struct {
+	expr string
+
+	minute, hour, dom, month, dow uint64 // bitsets of allowed values
+	domStar, dowStar              bool
+}
+
+// Parses a cron expression like "0 11 * * *" (every day at 11:00 UTC).
+func ParseCron(expr string) (*Cron, error) {
+	c := &Cron{expr: expr}
+
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("cron expression '%s' must have %d fields, got %d", c.expr, len(cronFields), len(fields))
+	}
+
+	sets := [5]*uint64{&c.minute, &c.hour, &c.dom, &c.month, &c.dow}
+	for i, field := range fields {
+		set, err := parseCronField(field, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("cron expression '%s' has an invalid %s: %w", c.expr, cronFields[i].name, err)
+		}
+
+		*sets[i] = set
+	}
+
+	// Sunday can be 0 or 7. 7 is outside the field's max so it's handled while parsing, this just folds it back.
+	if c.dow&(1<<7) != 0 {
+		c.dow = (c.dow | 1) &^ (1 << 7)
+	}
+
+	c.domStar = fields[2] == "*"
+	c.dowStar = fields[4] == "*"
+
+	return c, nil
+}
+
+// Same as ParseCron, but panics if the expression is invalid. Meant for expressions that are constants.
+func MustParseCron(expr string) *Cron {
+	c, err := ParseCron(expr)
+	if err != nil {
+		panic(err)
+	}
+
+	return c
+}
+
+func (c *Cron) String() string {
+	return c.expr
+}
+
+func parseCronField(field string, f cronField) (uint64, error) {
+	upper := f.max
+	if f.name == "day of week" {
+		upper = 7 // allow 7 as Sunday
+	}
+
+	var set uint64
+	for part := range strings.SplitSeq(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+
+		step := uint64(1)
+		if hasStep {
+			s, err := strconv.ParseUint(stepPart, 10, 8)
+			if err != nil || s == 0 {
+				return 0, fmt.Errorf("invalid step '%s'", stepPart)
+			}
+
+			step = s
+		}
+
+		var lo, hi uint64
+		switch {
+		case rangePart == "*":
+			lo, hi = uint64(f.min), uint64(f.max)
+		case strings.Contains(rangePart, "-"):
+			a, b, _ := strings.Cut(rangePart, "-")
+
+			var err error
+			if lo, err = strconv.ParseUint(a, 10, 8); err != nil {
+				return 0, fmt.Errorf("invalid value '%s'", a)
+			}
+			if hi, err = strconv.ParseUint(b, 10, 8); err != nil {
+				return 0, fmt.Errorf("invalid value '%s'", b)
+			}
+		default:
+			v, err := strconv.ParseUint(rangePart, 10, 8)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value '%s'", rangePart)
+			}
+
+			// "5/15" means every 15 starting at 5, like "5-59/15".
+			lo, hi = v, v
+			if hasStep {
+				hi = uint64(upper)
+			}
+		}
+
+		if lo < uint64(f.min) || hi > uint64(upper) || lo > hi {
+			return 0, fmt.Errorf("'%s' is out of range %d-%d", rangePart, f.min, upper)
+		}
+
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+
+	return set, nil
+}
+
+func (c *Cron) dayMatches(t time.Time) bool {
+	domMatch := c.dom&(1<<uint(t.Day())) != 0
+	dowMatch := c.dow&(1<<uint(t.Weekday())) != 0
+
+	switch {
+	case c.domStar && c.dowStar:
+		return true
+	case c.domStar:
+		return dowMatch
+	case c.dowStar:
+		return domMatch
+	}
+
+	return domMatch || dowMatch
+}
+
+// Returns the first minute after the given time that matches the expression,
+// or a zero time if there isn't one within CRON_MAX_LOOKAHEAD.
+func (c *Cron) Next(after time.Time) time.Time {
+	t := after.In(time.UTC).Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(CRON_MAX_LOOKAHEAD)
+
+	// Rather than checking every minute, skip ahead by the largest unit that doesn't match.
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, time.UTC)
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			// Jump straight to the next allowed minute in this hour, if any.
+			rest := c.minute >> uint(t.Minute())
+			if rest == 0 {
+				t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, time.UTC)
+			} else {
+				t = t.Add(time.Duration(bits.TrailingZeros64(rest)) * time.Minute)
+			}
+
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
@@ -1,57 +1,187 @@
 package scheduler
 
 import (
+	"context"
 	"emcsrw/pkg/utils/logutil"
+	"emcsrw/pkg/utils/metrics"
 	"fmt"
+	"runtime/debug"
 	"sync"
 	"time"
 )
 
+// A task should log its own errors as it sees fit, the returned error is only used to record the failure.
+type Task func() error
+
+var (
+	taskDuration = metrics.NewHistogramVec(
+		"emcs_scheduler_task_duration_seconds", "How long each run of a scheduled task took.",
+		nil, "task",
+	)
+	taskRuns = metrics.NewCounterVec(
+		"emcs_scheduler_task_runs_total", "Runs of each scheduled task by result (ok, error, panic).",
+		"task", "result",
+	)
+	taskOverlaps = metrics.NewCounterVec(
+		"emcs_scheduler_task_overlaps_total", "Times a task was due while still running, by what was done about it (skip, queue).",
+		"task", "policy",
+	)
+)
+
+// A task along with how and when it should run.
+type scheduledTask struct {
+	name string
+	task Task
+	spec Spec
+	opts Options
+
+	mu      sync.Mutex
+	running bool
+	queued  bool
+	paused  bool
+	nextRun time.Time
+
+	// Outcome of runs since the scheduler started, see TaskState.
+	runs, failures int
+	lastRun        time.Time
+	lastErr        error
+	durations      []time.Duration // most recent AVG_DURATION_WINDOW runs
+}
+
 type Scheduler struct {
-	wg       sync.WaitGroup
-	tasks    map[string]func() // task name -> task func
-	doneCh   chan string       // channel for logging task completions
-	stopping bool
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu    sync.Mutex
+	tasks map[string]*scheduledTask // task name -> task
+
+	// Called after every run of every task, err being non-nil if it failed or panicked.
+	// Must be set before scheduling any tasks.
+	OnRun func(taskName string, start time.Time, elapsed time.Duration, err error)
 }
 
 var Instance *Scheduler
 
 func New() *Scheduler {
-	//ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Scheduler{
-		wg:     sync.WaitGroup{},
-		tasks:  make(map[string]func()),
-		doneCh: make(chan string, 32),
+		ctx:    ctx,
+		cancel: cancel,
+		tasks:  make(map[string]*scheduledTask),
 	}
 }
 
-func (s *Scheduler) Schedule(taskName string, task func(), runInitial bool, interval time.Duration) {
-	s.wg.Go(func() {
-		ticker := time.NewTicker(interval)
-		defer ticker.Stop()
+// Runs task every interval, skipping a run if the previous one still hasn't finished.
+// Shorthand for ScheduleSpec with an [Every] spec.
+func (s *Scheduler) Schedule(taskName string, task Task, runInitial bool, interval time.Duration) {
+	s.ScheduleSpec(taskName, task, Every(interval), Options{RunInitial: runInitial})
+}
+
+// Runs task whenever spec says so, until the scheduler is shut down or spec returns a zero time.
+// Task names must be unique, scheduling a name that already exists does nothing.
+func (s *Scheduler) ScheduleSpec(taskName string, task Task, spec Spec, opts Options) {
+	t := &scheduledTask{name: taskName, task: task, spec: spec, opts: opts}
 
-		if runInitial && !s.stopping {
-			task()
+	s.mu.Lock()
+	if _, exists := s.tasks[taskName]; exists {
+		s.mu.Unlock()
+		logutil.Printf(logutil.YELLOW, "\n[Scheduler]: Task '%s' is already scheduled, ignoring.\n", taskName)
+		return
+	}
+	s.tasks[taskName] = t
+	s.mu.Unlock()
+
+	s.wg.Go(func() {
+		if opts.RunInitial {
+			s.trigger(t, false)
 		}
 
-		for range ticker.C {
-			if s.stopping {
-				return // prevent new ticks
+		next := spec.Next(time.Now())
+		for !next.IsZero() {
+			due := next.Add(opts.jitter())
+			t.setNextRun(due)
+
+			timer := time.NewTimer(time.Until(due))
+			select {
+			case <-s.ctx.Done():
+				timer.Stop()
+				return // prevent new runs
+			case <-timer.C:
+			}
+
+			s.trigger(t, false)
+
+			// Work out the next run from when this one was due rather than now, otherwise fixed intervals
+			// would slowly drift by however long the timer and jitter took. If we somehow fell behind (like the
+			// machine sleeping), skip the runs we missed instead of firing them all back to back.
+			now := time.Now()
+			if next = spec.Next(next); !next.IsZero() && next.Before(now) {
+				next = spec.Next(now)
 			}
+		}
+
+		t.setNextRun(time.Time{})
+	})
+}
 
-			task()
-			if s.stopping {
+// Starts a run of t in the background, unless it is already running in which case its overlap policy decides.
+// Scheduled runs of a paused task are dropped, but manual ones (see RunNow) still go ahead.
+func (s *Scheduler) trigger(t *scheduledTask, manual bool) triggerResult {
+	if s.ctx.Err() != nil {
+		return triggerStopped
+	}
+
+	t.mu.Lock()
+	if t.paused && !manual {
+		t.mu.Unlock()
+		return triggerPaused
+	}
+	if t.running {
+		result := triggerSkipped
+		if t.opts.Overlap == QueueIfRunning {
+			t.queued = true
+			result = triggerQueued
+		}
+		t.mu.Unlock()
+
+		taskOverlaps.With(t.name, t.opts.Overlap.String()).Inc()
+		logutil.Printf(logutil.YELLOW, "\n[Scheduler]: Task '%s' is still running. Policy: %s\n", t.name, t.opts.Overlap)
+		return result
+	}
+	t.running = true
+	t.mu.Unlock()
+
+	s.wg.Go(func() {
+		for {
+			start := time.Now()
+			err := s.run(t.name, t.task)
+			t.recordRun(start, time.Since(start), err)
+
+			if s.ctx.Err() != nil {
 				fmt.Println()
-				logutil.Logf(logutil.BLUE, "[Scheduler]: Task '%s' finished during shutdown.\n", taskName)
+				logutil.Logf(logutil.BLUE, "[Scheduler]: Task '%s' finished during shutdown.\n", t.name)
+			}
+
+			t.mu.Lock()
+			if !t.queued || s.ctx.Err() != nil {
+				t.running, t.queued = false, false
+				t.mu.Unlock()
+				return
 			}
+
+			t.queued = false
+			t.mu.Unlock()
 		}
 	})
+
+	return triggerStarted
 }
 
 // Shutdown stops this scheduler from running new tasks and waits up to timeoutDuration for all tasks to finish.
 // Returns a status string indicating success or timeout.
 func (s *Scheduler) Shutdown(timeoutDuration time.Duration) string {
-	s.stopping = true // prevent new ticks
+	s.cancel() // prevent new runs
 
 	done := make(chan struct{})
 	go func() {
@@ -66,3 +196,32 @@ func (s *Scheduler) Shutdown(timeoutDuration time.Duration) string {
 		return "Timeout reached, exiting.."
 	}
 }
+
+// Runs the task, recording how long it took and whether it failed.
+// A panicking task counts as a failure rather than taking the whole scheduler (and bot) down with it.
+func (s *Scheduler) run(taskName string, task Task) (err error) {
+	start := time.Now()
+	result := "ok"
+
+	defer func() {
+		if r := recover(); r != nil {
+			result = "panic"
+			err = fmt.Errorf("panic: %v", r)
+			logutil.Printf(logutil.RED, "\n[Scheduler]: Task '%s' panicked:\n%v\n%s", taskName, r, debug.Stack())
+		}
+
+		elapsed := time.Since(start)
+		taskDuration.With(taskName).Observe(elapsed.Seconds())
+		taskRuns.With(taskName, result).Inc()
+
+		if s.OnRun != nil {
+			s.OnRun(taskName, start, elapsed, err)
+		}
+	}()
+
+	if err = task(); err != nil {
+		result = "error"
+	}
+
+	return err
+}
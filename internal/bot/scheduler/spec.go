@@ -0,0 +1,82 @@
+package scheduler
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// Decides when a task runs next.
+type Spec interface {
+	// Returns the next time the task should run, which must be after the given time.
+	// A zero time means the task should never run again.
+	Next(after time.Time) time.Time
+}
+
+// Runs a task at a fixed interval, like a [time.Ticker] would.
+type Every time.Duration
+
+func (e Every) Next(after time.Time) time.Time {
+	return after.Add(time.Duration(e))
+}
+
+// Lets a plain func be used as a Spec, handy when the next run depends on something only known at runtime.
+type SpecFunc func(after time.Time) time.Time
+
+func (f SpecFunc) Next(after time.Time) time.Time {
+	return f(after)
+}
+
+type earliest []Spec
+
+// Runs a task whenever any of the given specs would, for example every 90 seconds AND right after the new day.
+func Earliest(specs ...Spec) Spec {
+	return earliest(specs)
+}
+
+func (specs earliest) Next(after time.Time) time.Time {
+	var next time.Time
+	for _, spec := range specs {
+		t := spec.Next(after)
+		if t.IsZero() {
+			continue
+		}
+		if next.IsZero() || t.Before(next) {
+			next = t
+		}
+	}
+
+	return next
+}
+
+// What to do when a task is due while its previous run still hasn't finished.
+type Overlap int
+
+const (
+	SkipIfRunning  Overlap = iota // Drop the run entirely. The default, since most of our tasks just refresh data.
+	QueueIfRunning                // Run again as soon as the current run finishes. Multiple runs due in the meantime are collapsed into one.
+)
+
+func (o Overlap) String() string {
+	if o == QueueIfRunning {
+		return "queue"
+	}
+
+	return "skip"
+}
+
+type Options struct {
+	RunInitial bool // Whether to run straight away instead of waiting until the first time the spec is due.
+	Overlap    Overlap
+
+	// Delays every run by a random amount up to this, so tasks due at the same time
+	// (like every task with a 30s and 1m interval at startup) don't all hit the Official API at once.
+	Jitter time.Duration
+}
+
+func (o Options) jitter() time.Duration {
+	if o.Jitter <= 0 {
+		return 0
+	}
+
+	return rand.N(o.Jitter)
+}
@@ -0,0 +1,222 @@
+package scheduler
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// How many of the most recent runs the average duration of a task is taken over.
+const AVG_DURATION_WINDOW = 20
+
+var (
+	ErrTaskNotFound = errors.New("no task is scheduled with that name")
+	ErrTaskRunning  = errors.New("task is already running")
+)
+
+type triggerResult int
+
+const (
+	triggerStarted triggerResult = iota
+	triggerQueued                // already running, will run again once it finishes
+	triggerSkipped               // already running, dropped
+	triggerPaused
+	triggerStopped // scheduler is shutting down
+)
+
+// A snapshot of a scheduled task. Only covers runs since the scheduler was created, see
+// database.TaskRun for what persists between restarts.
+type TaskState struct {
+	Name     string
+	Schedule string // Human readable spec, like "every 1m0s" or "every 1m30s or 2m0s after the new day".
+	Overlap  Overlap
+	Jitter   time.Duration
+
+	Paused  bool
+	Running bool
+	Queued  bool
+	NextRun time.Time // Zero if the task won't run again by itself, or is paused.
+
+	Runs         int
+	Failures     int
+	LastRun      time.Time // When the last run started, zero if it never ran.
+	LastDuration time.Duration
+	AvgDuration  time.Duration // Over the most recent AVG_DURATION_WINDOW runs.
+	LastError    error         // Nil if the last run succeeded.
+}
+
+func (e Every) String() string {
+	return "every " + time.Duration(e).String()
+}
+
+func (f SpecFunc) String() string {
+	return "custom"
+}
+
+func (specs earliest) String() string {
+	parts := make([]string, len(specs))
+	for i, spec := range specs {
+		parts[i] = describeSpec(spec)
+	}
+
+	return strings.Join(parts, " or ")
+}
+
+func describeSpec(spec Spec) string {
+	if s, ok := spec.(fmt.Stringer); ok {
+		return s.String()
+	}
+
+	return fmt.Sprintf("%T", spec)
+}
+
+func (t *scheduledTask) setNextRun(next time.Time) {
+	t.mu.Lock()
+	t.nextRun = next
+	t.mu.Unlock()
+}
+
+func (t *scheduledTask) recordRun(start time.Time, elapsed time.Duration, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.runs++
+	if err != nil {
+		t.failures++
+	}
+
+	t.lastRun = start
+	t.lastErr = err
+
+	t.durations = append(t.durations, elapsed)
+	if over := len(t.durations) - AVG_DURATION_WINDOW; over > 0 {
+		t.durations = t.durations[over:]
+	}
+}
+
+func (t *scheduledTask) state() TaskState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state := TaskState{
+		Name:      t.name,
+		Schedule:  describeSpec(t.spec),
+		Overlap:   t.opts.Overlap,
+		Jitter:    t.opts.Jitter,
+		Paused:    t.paused,
+		Running:   t.running,
+		Queued:    t.queued,
+		Runs:      t.runs,
+		Failures:  t.failures,
+		LastRun:   t.lastRun,
+		LastError: t.lastErr,
+	}
+
+	if !t.paused {
+		state.NextRun = t.nextRun
+	}
+
+	if len(t.durations) > 0 {
+		state.LastDuration = t.durations[len(t.durations)-1]
+
+		var total time.Duration
+		for _, d := range t.durations {
+			total += d
+		}
+
+		state.AvgDuration = total / time.Duration(len(t.durations))
+	}
+
+	return state
+}
+
+func (s *Scheduler) task(name string) (*scheduledTask, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tasks[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTaskNotFound, name)
+	}
+
+	return t, nil
+}
+
+// The state of every scheduled task, sorted by name.
+func (s *Scheduler) Tasks() []TaskState {
+	s.mu.Lock()
+	tasks := make([]*scheduledTask, 0, len(s.tasks))
+	for _, t := range s.tasks {
+		tasks = append(tasks, t)
+	}
+	s.mu.Unlock()
+
+	states := make([]TaskState, len(tasks))
+	for i, t := range tasks {
+		states[i] = t.state()
+	}
+
+	slices.SortFunc(states, func(a, b TaskState) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+
+	return states
+}
+
+// The state of the task with the given name.
+func (s *Scheduler) Task(name string) (TaskState, error) {
+	t, err := s.task(name)
+	if err != nil {
+		return TaskState{}, err
+	}
+
+	return t.state(), nil
+}
+
+// Stops the task from running on its schedule until resumed. A run that is already in progress is left to finish.
+// Only lasts until the bot restarts, since tasks are scheduled from scratch on startup.
+func (s *Scheduler) Pause(name string) error {
+	return s.setPaused(name, true)
+}
+
+// Lets a paused task run on its schedule again, starting from its next due time.
+func (s *Scheduler) Resume(name string) error {
+	return s.setPaused(name, false)
+}
+
+func (s *Scheduler) setPaused(name string, paused bool) error {
+	t, err := s.task(name)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	t.paused = paused
+	t.mu.Unlock()
+
+	return nil
+}
+
+// Runs the task straight away in the background, even if it is paused. Doesn't affect when it is next due.
+// If it's already running, a task with the QueueIfRunning policy runs again once it finishes (queued is true),
+// otherwise ErrTaskRunning is returned.
+func (s *Scheduler) RunNow(name string) (queued bool, err error) {
+	t, err := s.task(name)
+	if err != nil {
+		return false, err
+	}
+
+	switch s.trigger(t, true) {
+	case triggerQueued:
+		return true, nil
+	case triggerSkipped:
+		return false, ErrTaskRunning
+	case triggerStopped:
+		return false, errors.New("scheduler is shutting down")
+	}
+
+	return false, nil
+}
@@ -292,10 +292,22 @@ func queryAlliance(s *discordgo.Session, i *discordgo.Interaction, cdata discord
 	}
 
 	embed, components := shared.NewAllianceEmbed(s, mdb, *alliance, rankInfo)
-	_, err = discordutil.Followup(s, i, &discordgo.WebhookParams{
+	params := &discordgo.WebhookParams{
 		Embeds:     []*discordgo.MessageEmbed{embed},
 		Components: components,
-	})
+	}
+
+	townStore, _ := database.GetStore(mdb, database.TOWNS_STORE)
+	if nationStore != nil && townStore != nil {
+		claimsFile, err := shared.NewAllianceClaimsFile(embed, *alliance, allianceStore.Values(), nationStore, townStore)
+		if err != nil {
+			logutil.Printf(logutil.YELLOW, "\nWARN | %v\n", err)
+		} else if claimsFile != nil {
+			params.Files = []*discordgo.File{claimsFile}
+		}
+	}
+
+	_, err = discordutil.Followup(s, i, params)
 
 	return err
 }
@@ -554,6 +566,19 @@ func listAlliances(s *discordgo.Session, i *discordgo.Interaction) error {
 	return paginator.Start()
 }
 
+// Lets Custom API stream clients know about alliance changes. Errors are only logged since the change itself already succeeded.
+func publishAllianceEvent(eventType string, alliances ...database.Alliance) {
+	mdb, err := database.Get(shared.ACTIVE_MAP)
+	if err == nil {
+		_, err = database.PublishStreamEvents(mdb, database.StreamTopicAlliances, eventType, lo.Map(alliances, func(a database.Alliance, _ int) database.StreamAlliance {
+			return database.NewStreamAlliance(a)
+		})...)
+	}
+	if err != nil {
+		logutil.Printf(logutil.RED, "\nERR | failed to publish alliance %s stream event:\n\t%s", eventType, err)
+	}
+}
+
 func sendAllianceBackup(s *discordgo.Session, i *discordgo.Interaction, a *database.Alliance, reason string) {
 	allianceJSON, err := json.MarshalIndent(a, "", "  ")
 	if err != nil {
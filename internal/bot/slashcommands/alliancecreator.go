@@ -118,6 +118,8 @@ func handleAllianceCreatorModal(s *discordgo.Session, i *discordgo.Interaction)
 		return fmt.Errorf("error saving edited alliance '%s'. failed to write snapshot\n%v", alliance.Identifier, err)
 	}
 
+	publishAllianceEvent("created", alliance)
+
 	embed, components := shared.NewAllianceEmbed(s, mdb, alliance, nil)
 	content := "Successfully created alliance:"
 	if len(missingNations) > 0 {
@@ -222,6 +224,8 @@ func disbandAlliance(s *discordgo.Session, i *discordgo.Interaction, cdata disco
 		return fmt.Errorf("error saving edited alliance '%s'. failed to write snapshot\n%v", a.Identifier, err)
 	}
 
+	publishAllianceEvent("disbanded", *a)
+
 	_, err = discordutil.EditReply(s, i, &discordgo.InteractionResponseData{
 		Content: fmt.Sprintf("Successfully disbanded alliance `%s` aka `%s`.", a.Label, a.Identifier),
 	})
@@ -317,6 +317,13 @@ func handleAllianceEditorModalMultiUpdate(
 
 			return fmt.Errorf("error writing alliances after multi update. failed to write snapshot\n%v", err)
 		}
+
+		updated := allianceStore.FindAll(func(a database.Alliance) bool {
+			_, added := result.AddedTo[a.Identifier]
+			_, removed := result.RemovedFrom[a.Identifier]
+			return added || removed
+		})
+		publishAllianceEvent("updated", updated...)
 	}
 
 	//#region Build info output messages
@@ -411,6 +418,8 @@ func handleAllianceEditorModalNationsUpdate(
 
 			return fmt.Errorf("error writing changes to DB after an alliance update. failed to write snapshot\n%v", err)
 		}
+
+		publishAllianceEvent("updated", *alliance)
 	}
 
 	messages := []string{}
@@ -506,6 +515,8 @@ func handleAllianceEditorModalLeadersUpdate(
 		return fmt.Errorf("error saving edited alliance '%s'. failed to write snapshot\n%v", alliance.Identifier, err)
 	}
 
+	publishAllianceEvent("updated", *alliance)
+
 	content := "Successfully edited alliance. Result:"
 	embed, components := shared.NewAllianceEmbed(s, mdb, *alliance, nil)
 	discordutil.EditReply(s, i, &discordgo.InteractionResponseData{
@@ -636,6 +647,8 @@ func handleAllianceEditorModalFunctional(
 		return fmt.Errorf("error saving edited alliance '%s'. failed to write snapshot\n%v", alliance.Identifier, err)
 	}
 
+	publishAllianceEvent("updated", *alliance)
+
 	embed, components := shared.NewAllianceEmbed(s, mdb, *alliance, nil)
 	content := "Successfully edited alliance. Result:"
 	if len(missingNations) > 0 {
@@ -825,6 +838,8 @@ func handleAllianceEditorModalOptional(
 		return fmt.Errorf("error saving edited alliance '%s'. failed to write snapshot\n%v", alliance.Identifier, err)
 	}
 
+	publishAllianceEvent("updated", *alliance)
+
 	embed, components := shared.NewAllianceEmbed(s, mdb, *alliance, nil)
 	discordutil.EditReply(s, i, &discordgo.InteractionResponseData{
 		Content:    "Successfully edited alliance. Result:",
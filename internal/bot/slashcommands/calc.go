@@ -0,0 +1,194 @@
+package slashcommands
+
+import (
+	"emcsrw/internal/database"
+	"emcsrw/internal/shared"
+	"emcsrw/pkg/api/oapi"
+	"emcsrw/pkg/utils/discordutil"
+	"emcsrw/pkg/utils/logutil"
+	"emcsrw/pkg/utils/sets"
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/samber/lo"
+)
+
+type CalcCommand struct{}
+
+func (cmd CalcCommand) Name() string { return "calc" }
+func (cmd CalcCommand) Description() string {
+	return "Base command for \"what if\" calculators."
+}
+
+func (cmd CalcCommand) Options() []AppCommandOpt {
+	return []AppCommandOpt{
+		discordutil.SubcommandOption("nation", "Simulate a nation's bonus and town claim limits after residents or towns change.",
+			nationInputOpt,
+			discordutil.IntegerOption("residents", "Residents gained (positive) or lost (negative).", -1000, 1000, false),
+			discordutil.AutocompleteStringOption("resident-town", "Town gaining/losing the residents. Defaults to the capital.", 2, 40, false),
+			discordutil.AutocompleteStringOption("add-town", "A town joining the nation.", 2, 40, false),
+			discordutil.AutocompleteStringOption("remove-town", "A town leaving the nation.", 2, 40, false),
+		),
+	}
+}
+
+func (cmd CalcCommand) Execute(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	if err := discordutil.DeferReply(s, i.Interaction); err != nil {
+		return err
+	}
+
+	cdata := i.ApplicationCommandData()
+	if opt := cdata.GetOption("nation"); opt != nil {
+		return executeCalcNation(s, i.Interaction, opt)
+	}
+
+	return nil
+}
+
+func (cmd CalcCommand) HandleAutocomplete(s *discordgo.Session, i *discordgo.Interaction) error {
+	cdata := i.ApplicationCommandData()
+	if len(cdata.Options) == 0 {
+		return nil
+	}
+
+	for _, opt := range cdata.Options[0].Options {
+		if !opt.Focused {
+			continue
+		}
+
+		if opt.Name == "name" {
+			return nationNameAutocomplete(s, i, cdata)
+		}
+
+		return townNameAutocomplete(s, i, cdata)
+	}
+
+	return nil
+}
+
+func executeCalcNation(s *discordgo.Session, i *discordgo.Interaction, opt *discordgo.ApplicationCommandInteractionDataOption) error {
+	mdb, err := database.Get(shared.ACTIVE_MAP)
+	if err != nil {
+		return err
+	}
+
+	nation, err := tryGetNation(mdb, opt.GetOption("name").StringValue())
+	if err != nil {
+		_, err := discordutil.FollowupContent(s, i, err.Error(), true)
+		return err
+	}
+
+	townStore, err := database.GetStore(mdb, database.TOWNS_STORE)
+	if err != nil {
+		return err
+	}
+
+	towns := townStore.FindAll(func(t oapi.TownInfo) bool {
+		return t.Nation.UUID != nil && *t.Nation.UUID == nation.UUID
+	})
+
+	// Looks up a town by name from the store, replying with an error if it doesn't exist.
+	findTown := func(name string) (*oapi.TownInfo, bool) {
+		town, _ := townStore.Find(func(t oapi.TownInfo) bool {
+			return strings.EqualFold(t.Name, name)
+		})
+		if town == nil {
+			discordutil.FollowupContent(s, i, fmt.Sprintf("Town `%s` does not seem to exist.", name), true)
+			return nil, false
+		}
+
+		return town, true
+	}
+
+	changes := database.NationChanges{RemoveTowns: sets.New[string]()}
+	if o := opt.GetOption("residents"); o != nil {
+		changes.ResidentDelta = int(o.IntValue())
+	}
+
+	var residentTown *oapi.TownInfo
+	if o := opt.GetOption("resident-town"); o != nil {
+		town, ok := findTown(o.StringValue())
+		if !ok {
+			return nil
+		}
+
+		residentTown = town
+		changes.ResidentTownID = town.UUID
+	}
+	if o := opt.GetOption("add-town"); o != nil {
+		town, ok := findTown(o.StringValue())
+		if !ok {
+			return nil
+		}
+		if town.Nation.UUID != nil && *town.Nation.UUID == nation.UUID {
+			_, err := discordutil.FollowupContent(s, i, fmt.Sprintf("Town `%s` is already in this nation.", town.Name), true)
+			return err
+		}
+
+		changes.AddTowns = append(changes.AddTowns, *town)
+	}
+	if o := opt.GetOption("remove-town"); o != nil {
+		town, ok := findTown(o.StringValue())
+		if !ok {
+			return nil
+		}
+		if town.Nation.UUID == nil || *town.Nation.UUID != nation.UUID {
+			_, err := discordutil.FollowupContent(s, i, fmt.Sprintf("Town `%s` is not in this nation.", town.Name), true)
+			return err
+		}
+
+		changes.RemoveTowns.Add(town.UUID)
+	}
+
+	// Residents can only move in or out of a town that's part of the nation once the changes are made.
+	if residentTown != nil {
+		id := residentTown.UUID
+		inNation := lo.ContainsBy(towns, func(t oapi.TownInfo) bool { return t.UUID == id })
+		joining := lo.ContainsBy(changes.AddTowns, func(t oapi.TownInfo) bool { return t.UUID == id })
+		if !(inNation || joining) || changes.RemoveTowns.Has(id) {
+			_, err := discordutil.FollowupContent(s, i, fmt.Sprintf(
+				"Town `%s` is not in this nation. Pick one of its towns, or the town being added.", residentTown.Name,
+			), true)
+			return err
+		}
+	}
+
+	sim := database.SimulateNation(*nation, towns, changes)
+	before, after := sim.Before, sim.After
+
+	statsStr := func(n oapi.NationInfo) string {
+		return logutil.HumanizedSprintf("Residents: `%d`\nTowns: `%d`\nBonus: `%d` %s\nSize: `%d` %s\nLand Value: `%d` %s",
+			n.NumResidents(), n.NumTowns(), n.Bonus(), shared.EMOJIS.CHUNK,
+			n.Size(), shared.EMOJIS.CHUNK, n.LandValue(), shared.EMOJIS.GOLD_INGOT,
+		)
+	}
+
+	overclaimed := sim.NewlyOverclaimed()
+	overclaimedStr := "None"
+	if len(overclaimed) > 0 {
+		lines := make([]string, 0, len(overclaimed))
+		for _, t := range overclaimed {
+			lines = append(lines, logutil.HumanizedSprintf("`%s` • `%d`/`%d` (was `%d`)", t.Name, t.Size, t.NewMax, t.OldMax))
+		}
+
+		overclaimedStr = strings.Join(lines, "\n")
+		if len(overclaimedStr) > discordutil.EMBED_FIELD_VALUE_LIMIT {
+			overclaimedStr = fmt.Sprintf("`%d` towns. Too many to display.", len(overclaimed))
+		}
+	}
+
+	title := fmt.Sprintf("Nation Simulation | `%s`", nation.Name)
+	desc := "*Bonus changes are estimates based on the nation bonus tiers and may differ slightly in-game.*"
+
+	colour := nation.FillColourInt()
+	embed := discordutil.NewEmbedBuilder(&colour, &title, &desc, nil)
+	embed.SetFields(
+		NewEmbedField("Before", statsStr(before), true),
+		NewEmbedField("After", statsStr(after), true),
+		NewEmbedField(fmt.Sprintf("Newly Overclaimed [%d]", len(overclaimed)), overclaimedStr, false),
+	)
+
+	_, err = discordutil.FollowupEmbeds(s, i, embed.Build())
+	return err
+}
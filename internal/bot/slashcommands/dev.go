@@ -30,11 +30,24 @@ func (cmd DevCommand) Options() []AppCommandOpt {
 			discordutil.IntegerOption("threshold", "Guilds above this member count will not be left.", 1, MAX_THRESHOLD, true),
 			discordutil.BoolOption("approx-only", "Determines whether to leave using only approx mem count."),
 		),
+		discordutil.SubcommandGroupOption("apikey", "Manage Custom API keys.",
+			discordutil.SubcommandOption("issue", "Issues a new API key. The key is only ever shown once.",
+				discordutil.RequiredStringOption("name", "Who or what the key is for.", 1, 64),
+				apiKeyTierOption(),
+			),
+			discordutil.SubcommandOption("revoke", "Revokes an API key so it can no longer be used.",
+				discordutil.RequiredStringOption("id", "The ID of the key. See /dev apikey list.", 8, 8),
+			),
+			discordutil.SubcommandOption("list", "Lists all API keys and their usage."),
+		),
+		webhookOptionGroup(),
+		discordutil.SubcommandOption("tasks", "Shows the state of every scheduled task, with buttons to pause, resume or run them."),
 	}
 }
 
 func (cmd DevCommand) Execute(s *discordgo.Session, i *discordgo.InteractionCreate) error {
-	if err := discordutil.DeferReply(s, i.Interaction); err != nil {
+	// Nobody else needs to see these, especially not API keys.
+	if err := discordutil.DeferEphemeralReply(s, i.Interaction); err != nil {
 		return err
 	}
 
@@ -57,6 +70,12 @@ func (cmd DevCommand) Execute(s *discordgo.Session, i *discordgo.InteractionCrea
 	// 	return executeReload(s, i.Interaction)
 	case "purge":
 		return executePurge(s, i.Interaction, subCmd)
+	case "apikey":
+		return executeApiKey(s, i.Interaction, subCmd)
+	case "webhook":
+		return executeWebhook(s, i.Interaction, subCmd)
+	case "tasks":
+		return executeTasks(s, i.Interaction)
 	}
 
 	return nil
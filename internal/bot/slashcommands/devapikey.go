@@ -0,0 +1,109 @@
+package slashcommands
+
+import (
+	"emcsrw/internal/database"
+	"emcsrw/internal/shared"
+	"emcsrw/pkg/utils/discordutil"
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func apiKeyTierOption() *discordgo.ApplicationCommandOption {
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0, len(database.API_KEY_TIERS))
+	for _, tier := range database.API_KEY_TIERS {
+		choices = append(choices, discordutil.Choice(string(tier), string(tier)))
+	}
+
+	return discordutil.StringOption("tier", "The rate limit tier of the key. Defaults to standard.", nil, nil, choices...)
+}
+
+func executeApiKey(s *discordgo.Session, i *discordgo.Interaction, group *discordgo.ApplicationCommandInteractionDataOption) error {
+	mdb, err := database.Get(shared.ACTIVE_MAP)
+	if err != nil {
+		return err
+	}
+
+	// Always open fresh since the API may have written usage (or the CLI issued keys) since we last looked.
+	keyStore, err := database.OpenStore(mdb, database.API_KEYS_STORE)
+	if err != nil {
+		return err
+	}
+
+	subCmd := group.Options[0]
+
+	var content string
+	switch subCmd.Name {
+	case "issue":
+		tier := database.ApiTierStandard
+		if opt := subCmd.GetOption("tier"); opt != nil {
+			tier = database.ApiKeyTier(opt.StringValue())
+		}
+
+		name := subCmd.GetOption("name").StringValue()
+		key, apiKey, err := database.IssueApiKey(keyStore, name, tier, discordutil.InteractionAuthor(i).ID)
+		if err != nil {
+			content = fmt.Sprintf("Failed to issue key: %s", err)
+			break
+		}
+
+		content = fmt.Sprintf(
+			"Issued **%s** key `%s` for %s.\nKey: ||`%s`||\n\nThis is the only time the key will be shown, store it somewhere safe.",
+			apiKey.Tier, apiKey.ID, apiKey.Name, key,
+		)
+	case "revoke":
+		apiKey, err := database.RevokeApiKey(keyStore, subCmd.GetOption("id").StringValue())
+		if err != nil {
+			content = fmt.Sprintf("Failed to revoke key: %s", err)
+			break
+		}
+
+		content = fmt.Sprintf("Revoked key `%s` (%s). The API will stop accepting it within a minute.", apiKey.ID, apiKey.Name)
+	case "list":
+		usageStore, err := database.OpenStore(mdb, database.API_KEY_USAGE_STORE)
+		if err != nil {
+			return err
+		}
+
+		content = apiKeyListContent(database.ListApiKeys(keyStore), usageStore.Get)
+	}
+
+	_, err = discordutil.EditReply(s, i, &discordgo.InteractionResponseData{
+		Content: content,
+	})
+
+	return err
+}
+
+func apiKeyListContent(keys []database.ApiKey, getUsage func(id string) (*database.ApiKeyUsage, error)) string {
+	if len(keys) == 0 {
+		return "No API keys have been issued yet."
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "**%d API key(s)**\n", len(keys))
+
+	for _, k := range keys {
+		status := "active"
+		if k.Revoked() {
+			status = fmt.Sprintf("revoked <t:%d:R>", *k.RevokedAt/1000)
+		}
+
+		line := fmt.Sprintf("- `%s` %s [%s] created <t:%d:R> - %s", k.ID, k.Name, k.Tier, k.CreatedAt/1000, status)
+		if usage, err := getUsage(k.ID); err == nil {
+			line += fmt.Sprintf(" - %d req(s), last used <t:%d:R>", usage.Total, usage.LastUsed/1000)
+		} else {
+			line += " - never used"
+		}
+
+		if sb.Len()+len(line) > 1950 {
+			sb.WriteString("...")
+			break
+		}
+
+		sb.WriteString(line + "\n")
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,210 @@
+package slashcommands
+
+import (
+	"emcsrw/internal/bot/scheduler"
+	"emcsrw/internal/shared"
+	"emcsrw/pkg/utils"
+	"emcsrw/pkg/utils/discordutil"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/samber/lo"
+)
+
+// Custom IDs of the /dev tasks components. Buttons have "@<task name>" appended.
+const (
+	DEV_TASKS_SELECT  = "dev_tasks_select"
+	DEV_TASKS_PAUSE   = "dev_tasks_pause"
+	DEV_TASKS_RESUME  = "dev_tasks_resume"
+	DEV_TASKS_RUN     = "dev_tasks_run"
+	DEV_TASKS_REFRESH = "dev_tasks_refresh"
+)
+
+func executeTasks(s *discordgo.Session, i *discordgo.Interaction) error {
+	_, err := discordutil.EditReply(s, i, tasksMessage("", ""))
+	return err
+}
+
+func (cmd DevCommand) HandleSelectMenu(s *discordgo.Session, i *discordgo.Interaction, customID string) error {
+	if customID != DEV_TASKS_SELECT {
+		return nil
+	}
+	if !discordutil.IsDev(i) {
+		return replyNotDev(s, i)
+	}
+
+	selected := ""
+	if values := i.MessageComponentData().Values; len(values) > 0 {
+		selected = values[0]
+	}
+
+	return discordutil.UpdateComponent(s, i, tasksMessage(selected, ""))
+}
+
+func (cmd DevCommand) HandleButton(s *discordgo.Session, i *discordgo.Interaction, customID string) error {
+	action, taskName, _ := strings.Cut(customID, "@")
+	if !strings.HasPrefix(action, "dev_tasks_") {
+		return nil
+	}
+	if !discordutil.IsDev(i) {
+		return replyNotDev(s, i)
+	}
+
+	var notice string
+	switch action {
+	case DEV_TASKS_PAUSE:
+		notice = taskActionNotice(scheduler.Instance.Pause(taskName), "Paused `%s` until it is resumed or the bot restarts.", taskName)
+	case DEV_TASKS_RESUME:
+		notice = taskActionNotice(scheduler.Instance.Resume(taskName), "Resumed `%s`.", taskName)
+	case DEV_TASKS_RUN:
+		queued, err := scheduler.Instance.RunNow(taskName)
+		if errors.Is(err, scheduler.ErrTaskRunning) {
+			notice = fmt.Sprintf("`%s` is already running.", taskName)
+			break
+		}
+
+		notice = taskActionNotice(err, lo.Ternary(queued, "`%s` is already running, it will run again once it finishes.", "Started `%s`."), taskName)
+	}
+
+	return discordutil.UpdateComponent(s, i, tasksMessage(taskName, notice))
+}
+
+func taskActionNotice(err error, format string, taskName string) string {
+	if err != nil {
+		return fmt.Sprintf("Failed to update `%s`: %s", taskName, err)
+	}
+
+	return fmt.Sprintf(format, taskName)
+}
+
+func replyNotDev(s *discordgo.Session, i *discordgo.Interaction) error {
+	return discordutil.SendReply(s, i, &discordgo.InteractionResponseData{
+		Content: "You are not a developer silly.",
+		Flags:   discordgo.MessageFlagsEphemeral,
+	})
+}
+
+// Builds the task overview with a menu to pick a task, and buttons to control the picked one.
+func tasksMessage(selected string, notice string) *discordgo.InteractionResponseData {
+	if scheduler.Instance == nil {
+		return &discordgo.InteractionResponseData{Content: "The scheduler isn't running in this process."}
+	}
+
+	tasks := scheduler.Instance.Tasks()
+	if len(tasks) == 0 {
+		return &discordgo.InteractionResponseData{Content: "No tasks have been scheduled yet."}
+	}
+
+	desc := make([]string, 0, len(tasks))
+	menuOpts := make([]discordgo.SelectMenuOption, 0, len(tasks))
+
+	var selectedTask *scheduler.TaskState
+	for idx, t := range tasks {
+		desc = append(desc, taskSummary(t))
+		menuOpts = append(menuOpts, discordutil.SelectMenuOption(t.Name, t.Name, lo.Ellipsis(t.Schedule, 100), t.Name == selected))
+
+		if t.Name == selected {
+			selectedTask = &tasks[idx]
+		}
+	}
+
+	title := fmt.Sprintf("Scheduled Tasks [%d]", len(tasks))
+
+	// Only the first page fits, leaving some room to say how many didn't.
+	page := discordutil.PaginateLines(desc, "\n\n", discordutil.EMBED_DESCRIPTION_LIMIT-32)[0]
+	body := strings.Join(page, "\n\n")
+	if hidden := len(desc) - len(page); hidden > 0 {
+		body += fmt.Sprintf("\n\n...and %d more", hidden)
+	}
+
+	embed := discordutil.NewEmbedBuilder(&discordutil.BLURPLE, &title, &body, nil)
+
+	minValues := 1
+	components := []discordgo.MessageComponent{
+		discordutil.SelectMenuActionRow(discordgo.SelectMenu{
+			CustomID:    DEV_TASKS_SELECT,
+			Placeholder: "Choose a task to pause, resume or run 👇",
+			MinValues:   &minValues,
+			MaxValues:   1,
+			Options:     menuOpts,
+		}),
+	}
+
+	refresh := discordgo.Button{
+		CustomID: DEV_TASKS_REFRESH + "@" + selected,
+		Label:    "Refresh",
+		Style:    discordgo.SecondaryButton,
+	}
+
+	if selectedTask == nil {
+		components = append(components, discordutil.ButtonActionRow(refresh))
+	} else {
+		toggle := discordgo.Button{
+			CustomID: DEV_TASKS_PAUSE + "@" + selectedTask.Name,
+			Label:    "Pause",
+			Style:    discordgo.DangerButton,
+		}
+		if selectedTask.Paused {
+			toggle = discordgo.Button{
+				CustomID: DEV_TASKS_RESUME + "@" + selectedTask.Name,
+				Label:    "Resume",
+				Style:    discordgo.SuccessButton,
+			}
+		}
+
+		run := discordgo.Button{
+			CustomID: DEV_TASKS_RUN + "@" + selectedTask.Name,
+			Label:    "Run now",
+			Style:    discordgo.PrimaryButton,
+		}
+
+		components = append(components, discordutil.ButtonActionRow(toggle, run, refresh))
+	}
+
+	return &discordgo.InteractionResponseData{
+		Content:    notice,
+		Embeds:     []*discordgo.MessageEmbed{embed.Build()},
+		Components: components,
+	}
+}
+
+func taskSummary(t scheduler.TaskState) string {
+	status := string(shared.EMOJIS.CIRCLE_CHECK)
+	switch {
+	case t.Paused:
+		status = "⏸️"
+	case t.Running:
+		status = "🔄"
+	case t.LastError != nil:
+		status = string(shared.EMOJIS.CIRCLE_CROSS)
+	case t.Runs == 0:
+		status = "⏳"
+	}
+
+	lines := []string{fmt.Sprintf("%s **%s** - %s", status, t.Name, t.Schedule)}
+
+	last := "Last: `never`"
+	if !t.LastRun.IsZero() {
+		last = fmt.Sprintf(
+			"Last: <t:%d:R> took %s (avg %s)",
+			t.LastRun.Unix(), utils.FormatElapsed(t.LastDuration), utils.FormatElapsed(t.AvgDuration),
+		)
+	}
+
+	next := "Next: `paused`"
+	if !t.Paused {
+		next = "Next: `none`"
+		if !t.NextRun.IsZero() {
+			next = fmt.Sprintf("Next: <t:%d:R>", t.NextRun.Unix())
+		}
+	}
+
+	lines = append(lines, fmt.Sprintf("%s • %s • Runs: `%d` (`%d` failed)", last, next, t.Runs, t.Failures))
+	if t.LastError != nil {
+		lines = append(lines, fmt.Sprintf("Last error: `%s`", lo.Ellipsis(t.LastError.Error(), 200)))
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,174 @@
+package slashcommands
+
+import (
+	"emcsrw/internal/database"
+	"emcsrw/internal/shared"
+	"emcsrw/pkg/utils/discordutil"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/samber/lo"
+)
+
+// Max amount of dead deliveries listed by /dev webhook deadletters.
+const WEBHOOK_DEAD_LETTERS_SHOWN = 10
+
+func webhookOptionGroup() *discordgo.ApplicationCommandOption {
+	return discordutil.SubcommandGroupOption("webhook", "Manage outgoing webhooks that receive town, nation and player events.",
+		discordutil.SubcommandOption("create", "Registers a webhook, replying with the secret its deliveries are signed with.",
+			discordutil.RequiredStringOption("url", "The HTTP(S) URL events are POSTed to.", 8, 512),
+			discordutil.RequiredStringOption("events", "Comma separated, like: townflow, nationflow.merged, playerflow", 1, 256),
+		),
+		discordutil.SubcommandOption("delete", "Deletes a webhook along with its pending deliveries.",
+			discordutil.RequiredStringOption("id", "The ID of the webhook. See /dev webhook list.", 8, 8),
+		),
+		discordutil.SubcommandOption("list", "Lists all webhooks and how many deliveries they have pending or dead."),
+		discordutil.SubcommandOption("deadletters", "Lists the most recent deliveries that ran out of attempts.",
+			discordutil.StringOption("id", "Only show ones for this webhook.", lo.ToPtr(8), lo.ToPtr(8)),
+		),
+		discordutil.SubcommandOption("retry", "Gives dead deliveries a fresh set of attempts.",
+			discordutil.StringOption("id", "Only retry ones for this webhook.", lo.ToPtr(8), lo.ToPtr(8)),
+		),
+	)
+}
+
+func executeWebhook(s *discordgo.Session, i *discordgo.Interaction, group *discordgo.ApplicationCommandInteractionDataOption) error {
+	mdb, err := database.Get(shared.ACTIVE_MAP)
+	if err != nil {
+		return err
+	}
+
+	// Always open fresh since the CLI may have changed them since we last looked.
+	hookStore, err := database.OpenStore(mdb, database.WEBHOOKS_STORE)
+	if err != nil {
+		return err
+	}
+
+	subCmd := group.Options[0]
+	webhookID := ""
+	if opt := subCmd.GetOption("id"); opt != nil {
+		webhookID = opt.StringValue()
+	}
+
+	var content string
+	switch subCmd.Name {
+	case "create":
+		events, err := database.ParseWebhookEvents(subCmd.GetOption("events").StringValue())
+		if err != nil {
+			content = fmt.Sprintf("Failed to create webhook: %s", err)
+			break
+		}
+
+		hook, err := database.CreateWebhook(hookStore, subCmd.GetOption("url").StringValue(), events, discordutil.InteractionAuthor(i).ID)
+		if err != nil {
+			content = fmt.Sprintf("Failed to create webhook: %s", err)
+			break
+		}
+
+		content = fmt.Sprintf(
+			"Created webhook `%s` for <%s> receiving `%s`.\nSecret: ||`%s`||\n\nDeliveries are signed with this secret in the `%s` header, see the README.",
+			hook.ID, hook.URL, strings.Join(hook.Events, ", "), hook.Secret, database.WEBHOOK_SIGNATURE_HEADER,
+		)
+	case "delete":
+		hook, err := database.DeleteWebhook(mdb, hookStore, webhookID)
+		if err != nil {
+			content = fmt.Sprintf("Failed to delete webhook: %s", err)
+			break
+		}
+
+		content = fmt.Sprintf("Deleted webhook `%s` for <%s>.", hook.ID, hook.URL)
+	case "list":
+		deliveryStore, err := database.OpenStore(mdb, database.WEBHOOK_DELIVERIES_STORE)
+		if err != nil {
+			return err
+		}
+
+		content = webhookListContent(database.ListWebhooks(hookStore), deliveryStore.Values())
+	case "deadletters":
+		deliveryStore, err := database.OpenStore(mdb, database.WEBHOOK_DELIVERIES_STORE)
+		if err != nil {
+			return err
+		}
+
+		content = deadLettersContent(database.DeadWebhookDeliveries(deliveryStore, webhookID))
+	case "retry":
+		count, err := database.RetryDeadWebhookDeliveries(mdb, webhookID, time.Now())
+		if err != nil {
+			return err
+		}
+
+		content = fmt.Sprintf("Requeued %d dead deliveries. They will be attempted again on the next delivery run.", count)
+	}
+
+	_, err = discordutil.EditReply(s, i, &discordgo.InteractionResponseData{
+		Content: content,
+	})
+
+	return err
+}
+
+func webhookListContent(hooks []database.Webhook, deliveries []database.WebhookDelivery) string {
+	if len(hooks) == 0 {
+		return "No webhooks have been created yet."
+	}
+
+	pending, dead := make(map[string]int), make(map[string]int)
+	for _, d := range deliveries {
+		if d.Status == database.WebhookDead {
+			dead[d.WebhookID]++
+		} else {
+			pending[d.WebhookID]++
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "**%d webhook(s)**\n", len(hooks))
+
+	for _, h := range hooks {
+		line := fmt.Sprintf(
+			"- `%s` <%s> created <t:%d:R> - `%s` - %d pending, %d dead",
+			h.ID, h.URL, h.CreatedAt/1000, strings.Join(h.Events, ", "), pending[h.ID], dead[h.ID],
+		)
+
+		if sb.Len()+len(line) > 1950 {
+			sb.WriteString("...")
+			break
+		}
+
+		sb.WriteString(line + "\n")
+	}
+
+	return sb.String()
+}
+
+func deadLettersContent(dead []database.WebhookDelivery) string {
+	if len(dead) == 0 {
+		return "There are no dead deliveries."
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "**%d dead deliveries**\n", len(dead))
+
+	for i, d := range dead {
+		if i >= WEBHOOK_DEAD_LETTERS_SHOWN {
+			fmt.Fprintf(&sb, "...and %d more", len(dead)-i)
+			break
+		}
+
+		line := fmt.Sprintf(
+			"- `%s` to `%s` (%s.%s) gave up <t:%d:R> after %d attempts: %s",
+			d.Event.ID, d.WebhookID, d.Event.Topic, d.Event.Type, d.UpdatedAt/1000, d.Attempts, d.LastError,
+		)
+
+		if sb.Len()+len(line) > 1950 {
+			sb.WriteString("...")
+			break
+		}
+
+		sb.WriteString(line + "\n")
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,54 @@
+package slashcommands
+
+import (
+	"emcsrw/internal/database"
+	"emcsrw/internal/shared"
+	"emcsrw/pkg/utils/discordutil"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+type DigestCommand struct{}
+
+func (cmd DigestCommand) Name() string { return "digest" }
+func (cmd DigestCommand) Description() string {
+	return "Summarises the towns, nations, alliances and news of the last day or week."
+}
+
+func (cmd DigestCommand) Options() []AppCommandOpt {
+	return []AppCommandOpt{
+		discordutil.StringOption("period", "How far back to summarise. Defaults to the last day.", nil, nil,
+			discordutil.Choice("Last 24 hours", string(database.DigestDaily)),
+			discordutil.Choice("Last 7 days", string(database.DigestWeekly)),
+		),
+	}
+}
+
+func (cmd DigestCommand) Execute(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	if err := discordutil.DeferReply(s, i.Interaction); err != nil {
+		return err
+	}
+
+	period := database.DigestDaily
+	if opt := i.ApplicationCommandData().GetOption("period"); opt != nil {
+		period = database.DigestPeriod(opt.StringValue())
+	}
+
+	mdb, err := database.Get(shared.ACTIVE_MAP)
+	if err != nil {
+		return err
+	}
+
+	src, err := database.GetDigestSources(mdb)
+	if err != nil {
+		return err
+	}
+
+	digest := database.ComputeDigest(src, period, time.Now())
+	_, err = discordutil.EditReply(s, i.Interaction, &discordgo.InteractionResponseData{
+		Embeds: []*discordgo.MessageEmbed{shared.NewDigestEmbed(digest)},
+	})
+
+	return err
+}
@@ -43,15 +43,8 @@ var fallingTownSorts = map[string]func([]database.FallingTown){
 		})
 	},
 	"overclaimed": func(towns []database.FallingTown) {
-		utils.RankSortAscending(towns, func(t database.FallingTown) int {
-			switch {
-			case t.Status.Overclaimed:
-				return 0
-			case t.Status.Overclaimed:
-				return 1
-			default:
-				return 2
-			}
+		utils.SortToggledOn(towns, func(t database.FallingTown) bool {
+			return t.Status.Overclaimed
 		})
 	},
 	"capital": func(towns []database.FallingTown) {
@@ -178,14 +171,14 @@ func (cmd FallingCommand) Execute(s *discordgo.Session, i *discordgo.Interaction
 
 	// Apply custom filter if chosen
 	if opt := cdata.GetOption("status"); opt != nil {
-		if filter, ok := statusFilters[opt.StringValue()]; ok {
+		if filter, ok := database.TOWN_STATUS_FILTERS[opt.StringValue()]; ok {
 			falling = lo.Filter(falling, func(t database.FallingTown, _ int) bool {
 				return filter(t.TownInfo)
 			})
 		}
 	}
 	if opt := cdata.GetOption("flags"); opt != nil {
-		if filter, ok := flagFilters[opt.StringValue()]; ok {
+		if filter, ok := database.TOWN_FLAG_FILTERS[opt.StringValue()]; ok {
 			falling = lo.Filter(falling, func(t database.FallingTown, _ int) bool {
 				return filter(t.TownInfo)
 			})
@@ -0,0 +1,189 @@
+package slashcommands
+
+import (
+	"emcsrw/internal/database"
+	"emcsrw/internal/shared"
+	"emcsrw/pkg/utils"
+	"emcsrw/pkg/utils/discordutil"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const NOT_TRACKING_MSG = "Player tracking is not enabled on this bot instance, or no players have been seen recently."
+
+type LocateCommand struct{}
+
+func (cmd LocateCommand) Name() string { return "locate" }
+func (cmd LocateCommand) Description() string {
+	return "Find players using recent map locations. Only players visible on the map can be found."
+}
+
+func (cmd LocateCommand) Options() []AppCommandOpt {
+	return []AppCommandOpt{
+		discordutil.SubcommandOption("player", "Shows where a player was last seen on the map, along with their recent trail.",
+			discordutil.RequiredStringOption("name", "The name of the player to locate.", 3, 16),
+		),
+		discordutil.SubcommandOption("town", "Lists visible players currently within a town's claims.",
+			discordutil.AutocompleteStringOption("name", "The name of the town to check.", 2, 40, true),
+		),
+		discordutil.SubcommandOption("near", "Lists visible players currently near the specified coordinates.",
+			discordutil.IntegerOption("x", "The X coordinate.", -100000, 100000, true),
+			discordutil.IntegerOption("z", "The Z coordinate.", -100000, 100000, true),
+			discordutil.IntegerOption("radius", "Radius in blocks around the coordinates. Default is 500.", 1, 5000, false),
+		),
+	}
+}
+
+func (cmd LocateCommand) Execute(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	if err := discordutil.DeferReply(s, i.Interaction); err != nil {
+		return err
+	}
+
+	trailStore, err := database.GetStoreForMap(shared.ACTIVE_MAP, database.PLAYER_TRAILS_STORE)
+	if err != nil {
+		return err
+	}
+	if trailStore.Count() == 0 {
+		_, err := discordutil.FollowupContent(s, i.Interaction, NOT_TRACKING_MSG, true)
+		return err
+	}
+
+	cdata := i.ApplicationCommandData()
+	if opt := cdata.GetOption("player"); opt != nil {
+		return executeLocatePlayer(s, i.Interaction, opt.GetOption("name").StringValue())
+	}
+	if opt := cdata.GetOption("town"); opt != nil {
+		return executeLocateTown(s, i.Interaction, opt.GetOption("name").StringValue())
+	}
+	if opt := cdata.GetOption("near"); opt != nil {
+		radius := int64(500)
+		if r := opt.GetOption("radius"); r != nil {
+			radius = r.IntValue()
+		}
+
+		return executeLocateNear(s, i.Interaction, opt.GetOption("x").IntValue(), opt.GetOption("z").IntValue(), radius)
+	}
+
+	return nil
+}
+
+func (cmd LocateCommand) HandleAutocomplete(s *discordgo.Session, i *discordgo.Interaction) error {
+	cdata := i.ApplicationCommandData()
+	if len(cdata.Options) == 0 {
+		return nil
+	}
+
+	if cdata.Options[0].Name == "town" {
+		return townNameAutocomplete(s, i, cdata)
+	}
+
+	return nil
+}
+
+func executeLocatePlayer(s *discordgo.Session, i *discordgo.Interaction, name string) error {
+	trailStore, err := database.GetStoreForMap(shared.ACTIVE_MAP, database.PLAYER_TRAILS_STORE)
+	if err != nil {
+		return err
+	}
+
+	trail, err := database.FindPlayerTrail(trailStore, name, time.Now().Add(-shared.PlayerTrailRetention()))
+	if err != nil {
+		_, err := discordutil.FollowupContent(s, i, fmt.Sprintf(
+			"Player `%s` has not been visible on the map recently. They may be offline, hidden or underground.", name,
+		), true)
+
+		return err
+	}
+
+	last := trail.Last()
+	desc := fmt.Sprintf("Last seen <t:%d:R> at [%d, %d, %d](%s) in `%s`.",
+		trail.LastSeen().Unix(), last.X, last.Y, last.Z, last.ToMapLink(5), last.World,
+	)
+
+	// Show the most recent few points (newest first) so the direction of travel is obvious.
+	const maxShown = 10
+
+	b := strings.Builder{}
+	for idx := len(trail.Points) - 1; idx >= max(0, len(trail.Points)-maxShown); idx-- {
+		p := trail.Points[idx]
+		fmt.Fprintf(&b, "<t:%d:T> • `%d, %d, %d`\n", p.Timestamp/1000, p.X, p.Y, p.Z)
+	}
+
+	title := fmt.Sprintf("Player Location | `%s`", trail.Name)
+	embed := discordutil.NewEmbedBuilder(&discordutil.BLURPLE, &title, &desc, nil)
+	embed.AddField(fmt.Sprintf("Recent Trail (%d points)", len(trail.Points)), b.String(), false)
+
+	_, err = discordutil.FollowupEmbeds(s, i, embed.Build())
+	return err
+}
+
+func executeLocateTown(s *discordgo.Session, i *discordgo.Interaction, townName string) error {
+	mdb, err := database.Get(shared.ACTIVE_MAP)
+	if err != nil {
+		return err
+	}
+
+	town, err := tryGetTown(mdb, townName)
+	if err != nil {
+		_, err := discordutil.FollowupContent(s, i, err.Error(), true)
+		return err
+	}
+
+	trailStore, err := database.GetStore(mdb, database.PLAYER_TRAILS_STORE)
+	if err != nil {
+		return err
+	}
+
+	trails := database.TrailsInTown(trailStore, *town, time.Now().Add(-database.TRAIL_CURRENT_WINDOW))
+	title := fmt.Sprintf("Players In Town | `%s` [%d]", town.Name, len(trails))
+
+	return sendTrailList(s, i, title, trails)
+}
+
+func executeLocateNear(s *discordgo.Session, i *discordgo.Interaction, x, z, radius int64) error {
+	trailStore, err := database.GetStoreForMap(shared.ACTIVE_MAP, database.PLAYER_TRAILS_STORE)
+	if err != nil {
+		return err
+	}
+
+	since := time.Now().Add(-database.TRAIL_CURRENT_WINDOW)
+	trails := database.TrailsNear(trailStore, float64(x), float64(z), float64(radius), since)
+	title := fmt.Sprintf("Players Within %d Blocks Of %d, %d [%d]", radius, x, z, len(trails))
+
+	return sendTrailList(s, i, title, trails)
+}
+
+func sendTrailList(s *discordgo.Session, i *discordgo.Interaction, title string, trails []database.PlayerTrail) error {
+	count := len(trails)
+	if count == 0 {
+		_, err := discordutil.FollowupContent(s, i, "No visible players were found there.", true)
+		return err
+	}
+
+	utils.KeySort(trails, []utils.KeySortOption[database.PlayerTrail]{
+		{Compare: func(a, b database.PlayerTrail) bool { return a.Name < b.Name }}, // ascending (A-Z)
+	})
+
+	perPage := 15
+	paginator := discordutil.NewInteractionPaginator(s, i, count, perPage)
+	paginator.PageFunc = func(curPage int, data *discordgo.InteractionResponseData) {
+		start, end := paginator.CurrentPageBounds(count)
+
+		b := strings.Builder{}
+		for idx, t := range trails[start:end] {
+			last := t.Last()
+			fmt.Fprintf(&b, "%d. **%s** • [%d, %d, %d](%s) • <t:%d:R>\n",
+				start+idx+1, t.Name, last.X, last.Y, last.Z, last.ToMapLink(5), t.LastSeen().Unix(),
+			)
+		}
+
+		desc := b.String() + fmt.Sprintf("\nPage %d/%d", curPage+1, paginator.TotalPages())
+		embed := discordutil.NewEmbedBuilder(&discordutil.BLURPLE, &title, &desc, nil)
+		data.Embeds = []*discordgo.MessageEmbed{embed.Build()}
+	}
+
+	return paginator.Start()
+}
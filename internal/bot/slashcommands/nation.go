@@ -31,6 +31,7 @@ func (cmd NationCommand) Options() []AppCommandOpt {
 		discordutil.SubcommandOption("query", "Query information about a nation. Similar to /n in-game.", nationInputOpt),
 		discordutil.SubcommandOption("activity", "See the last online and purge date of each resident in a town.", nationInputOpt),
 		discordutil.SubcommandOption("online", "Query the online status of a nation's residents. Alias of /online nation", nationInputOpt),
+		discordutil.SubcommandOption("neighbours", "List nations sharing a border with a nation, longest border first.", nationInputOpt),
 		discordutil.SubcommandOption("list", "Sends a paginator enabling navigation through all existing nations.",
 			discordutil.StringOption("sort", "Optional nation list sorting. Without this, nations are sorted by residents -> towns -> size.", nil, nil,
 				//discordutil.Choice("None", "none"),               // "No list sorting. The entropy enjoyer's choice."
@@ -66,6 +67,10 @@ func (cmd NationCommand) Execute(s *discordgo.Session, i *discordgo.InteractionC
 		nationNameArg := opt.GetOption("name").StringValue()
 		return executeOnlineNation(s, i.Interaction, nationNameArg)
 	}
+	if opt := cdata.GetOption("neighbours"); opt != nil {
+		nationNameArg := opt.GetOption("name").StringValue()
+		return executeNationNeighbours(s, i.Interaction, nationNameArg)
+	}
 	if opt := cdata.GetOption("list"); opt != nil {
 		return executeListNations(s, i.Interaction)
 	}
@@ -82,7 +87,7 @@ func (cmd NationCommand) HandleAutocomplete(s *discordgo.Session, i *discordgo.I
 	// top-level sub cmd or group
 	subCmd := cdata.Options[0]
 	switch subCmd.Name {
-	case "query", "activity", "online":
+	case "query", "activity", "online", "neighbours":
 		return nationNameAutocomplete(s, i, cdata)
 	}
 
@@ -168,8 +173,21 @@ func executeQueryNation(s *discordgo.Session, i *discordgo.Interaction, nationNa
 	allianceStore, _ := database.GetStore(mdb, database.ALLIANCES_STORE)
 	newsStore, _ := database.GetStore(mdb, database.NEWS_STORE)
 
+	townStore, _ := database.GetStore(mdb, database.TOWNS_STORE)
+
+	embed := shared.NewNationEmbed(*nation, newsStore, allianceStore)
+
 	msg := discordutil.NewMessageBuilder()
-	msg.AddEmbed(shared.NewNationEmbed(*nation, newsStore, allianceStore))
+	msg.AddEmbed(embed)
+
+	if townStore != nil {
+		claimsFile, err := shared.NewNationClaimsFile(embed, *nation, townStore)
+		if err != nil {
+			logutil.Printf(logutil.YELLOW, "\nWARN | %v\n", err)
+		} else if claimsFile != nil {
+			msg.Files = append(msg.Files, claimsFile)
+		}
+	}
 	if nation.Discord != nil {
 		msg.AddButton("Join discord", discordgo.LinkButton, *nation.Discord, &discordutil.DISCORD_EMOJI, nil)
 	}
@@ -180,6 +198,58 @@ func executeQueryNation(s *discordgo.Session, i *discordgo.Interaction, nationNa
 	return discordutil.Followup(s, i, msg.WebhookData())
 }
 
+func executeNationNeighbours(s *discordgo.Session, i *discordgo.Interaction, nationName string) error {
+	mdb, err := database.Get(shared.ACTIVE_MAP)
+	if err != nil {
+		return err
+	}
+
+	nation, err := tryGetNation(mdb, nationName)
+	if err != nil {
+		_, err := discordutil.FollowupContent(s, i, err.Error(), true)
+		return err
+	}
+
+	townStore, err := database.GetStore(mdb, database.TOWNS_STORE)
+	if err != nil {
+		return err
+	}
+
+	graph := database.ComputeBorderGraph(townStore.Values())
+	neighbours := graph.NationNeighbours(nation.UUID)
+
+	count := len(neighbours)
+	if count == 0 {
+		_, err := discordutil.FollowupContent(s, i, fmt.Sprintf("Nation `%s` does not share a border with any other nation.", nation.Name), false)
+		return err
+	}
+
+	totalBorder := graph.NationBorderEdges(nation.UUID) * database.CHUNK_EDGE_BLOCKS
+
+	perPage := 15
+	paginator := discordutil.NewInteractionPaginator(s, i, count, perPage)
+	paginator.PageFunc = func(curPage int, data *discordgo.InteractionResponseData) {
+		start, end := paginator.CurrentPageBounds(count)
+
+		b := strings.Builder{}
+		for idx, n := range neighbours[start:end] {
+			b.WriteString(logutil.HumanizedSprintf("%d. **%s** • `%d` blocks (`%d` chunk edges)\n",
+				start+idx+1, n.Name, n.BorderLength(), n.SharedEdges,
+			))
+		}
+
+		title := fmt.Sprintf("Neighbouring Nations | `%s` [%d]", nation.Name, count)
+		desc := logutil.HumanizedSprintf("Total shared border: `%d` blocks\n\n", totalBorder) + b.String() +
+			fmt.Sprintf("\nPage %d/%d", curPage+1, paginator.TotalPages())
+
+		colour := nation.FillColourInt()
+		embed := discordutil.NewEmbedBuilder(&colour, &title, &desc, nil)
+		data.Embeds = []*discordgo.MessageEmbed{embed.Build()}
+	}
+
+	return paginator.Start()
+}
+
 func executeListNations(s *discordgo.Session, i *discordgo.Interaction) error {
 	nationStore, err := database.GetStoreForMap(shared.ACTIVE_MAP, database.NATIONS_STORE)
 	if err != nil {
@@ -198,40 +268,11 @@ func executeListNations(s *discordgo.Session, i *discordgo.Interaction) error {
 
 	listOpt := i.ApplicationCommandData().GetOption("list")
 	if opt := listOpt.GetOption("sort"); opt != nil {
-		switch opt.StringValue() {
-		case "alphabetical":
-			utils.KeySort(nations, []utils.KeySortOption[oapi.NationInfo]{
-				{Compare: func(a, b oapi.NationInfo) bool { return b.Name > a.Name }}, // ascending (A-Z)
-			})
-		case "residents":
-			utils.KeySort(nations, []utils.KeySortOption[oapi.NationInfo]{
-				{Compare: func(a, b oapi.NationInfo) bool { return a.NumResidents() > b.NumResidents() }}, // descending
-			})
-		case "towns":
-			utils.KeySort(nations, []utils.KeySortOption[oapi.NationInfo]{
-				{Compare: func(a, b oapi.NationInfo) bool { return a.NumTowns() > b.NumTowns() }}, // descending
-			})
-		case "size":
-			utils.KeySort(nations, []utils.KeySortOption[oapi.NationInfo]{
-				{Compare: func(a, b oapi.NationInfo) bool { return a.Size() > b.Size() }}, // descending
-			})
-		case "balance":
-			utils.KeySort(nations, []utils.KeySortOption[oapi.NationInfo]{
-				{Compare: func(a, b oapi.NationInfo) bool { return a.Bal() > b.Bal() }}, // descending
-			})
-		case "founded":
-			utils.KeySort(nations, []utils.KeySortOption[oapi.NationInfo]{
-				{Compare: func(a, b oapi.NationInfo) bool { return b.Timestamps.Registered > a.Timestamps.Registered }}, // ascending (oldest-newest)
-			})
-			// case "towns-overclaimed":
+		if sorter, ok := database.NATION_SORTS[opt.StringValue()]; ok {
+			sorter(nations)
 		}
 	} else {
-		// No sort option provided, use default sort (residents -> towns -> size).
-		utils.KeySort(nations, []utils.KeySortOption[oapi.NationInfo]{
-			{Compare: func(a, b oapi.NationInfo) bool { return a.NumResidents() > b.NumResidents() }},
-			{Compare: func(a, b oapi.NationInfo) bool { return a.NumTowns() > b.NumTowns() }},
-			{Compare: func(a, b oapi.NationInfo) bool { return a.Size() > b.Size() }},
-		})
+		database.SortNationsDefault(nations) // residents -> towns -> size
 	}
 
 	nationCount := len(nations)
@@ -3,7 +3,6 @@ package slashcommands
 import (
 	"emcsrw/internal/database"
 	"emcsrw/internal/shared"
-	"emcsrw/pkg/api/oapi"
 	"emcsrw/pkg/utils"
 	"emcsrw/pkg/utils/discordutil"
 	"fmt"
@@ -13,8 +12,6 @@ import (
 	"github.com/bwmarrin/discordgo"
 )
 
-const DAY_SECS = 60 * 60 * 24
-
 type NewDayCommand struct{}
 
 func (cmd NewDayCommand) Name() string { return "newday" }
@@ -54,12 +51,14 @@ func executeNewDayWhen(s *discordgo.Session, i *discordgo.Interaction) error {
 		})
 	}
 
-	ts, secUntilNewDay := secUntilNewDay(info)
+	// Server info is refreshed often enough that treating it as fetched just now is accurate to the second.
+	now := time.Now()
+	newDay := database.NextNewDayAt(database.NewDayClock(*info, now), now)
 
 	title := "New Day | Time Information"
 	desc := fmt.Sprintf(
 		"The next Towny new day occurs in <t:%d:R>.\nExactly %s from now.",
-		ts, utils.FormatElapsed(time.Duration(secUntilNewDay)*time.Second),
+		newDay.Unix(), utils.FormatElapsed(newDay.Sub(now).Truncate(time.Second)),
 	)
 
 	embed := discordutil.NewEmbedBuilder(&discordutil.DARK_PURPLE, &title, &desc, nil)
@@ -69,16 +68,3 @@ func executeNewDayWhen(s *discordgo.Session, i *discordgo.Interaction) error {
 
 	return nil
 }
-
-func secUntilNewDay(info *oapi.ServerInfo) (unix int64, sec int64) {
-	newDayTime := info.Timestamps.NewDayTime
-	serverTod := info.Timestamps.ServerTimeOfDay
-
-	secUntilNewDay := (newDayTime - serverTod + DAY_SECS) % DAY_SECS
-
-	now := time.Now().Unix()
-	return now + secUntilNewDay, secUntilNewDay
-}
-
-// Minecraft ticks until next in-game day
-// ticksUntilMCNewDay := (newDayTime - timePassed + newDayTime) % newDayTime
@@ -113,6 +113,7 @@ func RegisterAllCommands() {
 	Register(OnlineCommand{})
 	Register(TownlessCommand{})
 	Register(VisibleCommand{})
+	Register(LocateCommand{})
 
 	// Main (Other)
 	Register(TownCommand{})
@@ -128,12 +129,16 @@ func RegisterAllCommands() {
 	Register(RouteCommand{})
 	Register(VotePartyCommand{})
 	Register(NewDayCommand{})
+	Register(DigestCommand{})
+	Register(CalcCommand{})
 	Register(MysteryMasterCommand{})
 	//Register(SSECommand{})
 
 	// Misc
 	Register(DevCommand{})
 	Register(UsageCommand{})
+	Register(SettingsCommand{})
+	Register(WatchCommand{})
 }
 
 // ======================================= COMMAND TEMPLATE =======================================
@@ -0,0 +1,347 @@
+package slashcommands
+
+import (
+	"emcsrw/internal/database"
+	"emcsrw/internal/database/store"
+	"emcsrw/internal/shared"
+	"emcsrw/pkg/api/oapi"
+	"emcsrw/pkg/utils/discordutil"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/samber/lo"
+)
+
+const VP_MAX_THRESHOLDS = 10
+
+// Permissions the bot needs in a channel to deliver notifications there.
+const FEED_CHANNEL_PERMS = discordgo.PermissionViewChannel | discordgo.PermissionSendMessages | discordgo.PermissionEmbedLinks
+
+type SettingsCommand struct{}
+
+func (cmd SettingsCommand) Name() string { return "settings" }
+func (cmd SettingsCommand) Description() string {
+	return "Configure the bot for this server. Requires the Manage Server permission."
+}
+
+func (cmd SettingsCommand) Options() []AppCommandOpt {
+	return []AppCommandOpt{
+		discordutil.SubcommandGroupOption("notifications", "Choose where this server receives notifications as they happen.",
+			discordutil.SubcommandOption("set", "Sends a type of notification to a channel, optionally only about certain nations.",
+				feedOption(),
+				discordutil.ChannelOption("channel", "The channel to send them to.", true, discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildNews),
+				discordutil.StringOption("nations", "Only notify about these nations. Separate names with commas.", nil, lo.ToPtr(500)),
+				discordutil.AutocompleteStringOption("alliance", "Only notify about nations in this alliance (including puppets).", 1, 32, false),
+			),
+			discordutil.SubcommandOption("remove", "Stops sending a type of notification to this server.", feedOption()),
+			discordutil.SubcommandOption("list", "Lists which notifications this server receives and where."),
+		),
+		discordutil.SubcommandGroupOption("voteparty", "Configure VoteParty notifications for this server.",
+			discordutil.SubcommandOption("thresholds", "Sets at how many remaining votes to notify. Leave empty to reset.",
+				discordutil.StringOption("values", "Remaining vote counts separated by commas, like: 500, 300, 150, 50", nil, lo.ToPtr(100)),
+			),
+		),
+	}
+}
+
+func feedOption() *discordgo.ApplicationCommandOption {
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0, len(database.NOTIFICATION_FEEDS))
+	for _, feed := range database.NOTIFICATION_FEEDS {
+		choices = append(choices, discordutil.Choice(feedLabel(feed), string(feed)))
+	}
+
+	opt := discordutil.StringOption("feed", "The type of notification.", nil, nil, choices...)
+	opt.Required = true
+	return opt
+}
+
+func feedLabel(feed database.NotificationFeed) string {
+	switch feed {
+	case database.FeedTownFlow:
+		return "Town Flow"
+	case database.FeedNationFlow:
+		return "Nation Flow"
+	case database.FeedPlayerFlow:
+		return "Player Flow"
+	case database.FeedVoteParty:
+		return "VoteParty"
+	case database.FeedNewDay:
+		return "New Day Report"
+	case database.FeedDigest:
+		return "Daily/Weekly Digest"
+	}
+
+	return string(feed)
+}
+
+func (cmd SettingsCommand) Execute(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	if err := discordutil.DeferEphemeralReply(s, i.Interaction); err != nil {
+		return err
+	}
+
+	if i.GuildID == "" || i.Member == nil {
+		_, err := discordutil.EditReply(s, i.Interaction, &discordgo.InteractionResponseData{
+			Content: "Settings can only be changed from within a server.",
+		})
+
+		return err
+	}
+
+	if !discordutil.HasChannelPerm(i.Member, discordgo.PermissionManageGuild|discordgo.PermissionAdministrator) {
+		_, err := discordutil.EditReply(s, i.Interaction, &discordgo.InteractionResponseData{
+			Content: "You need the Manage Server permission to change settings.",
+		})
+
+		return err
+	}
+
+	mdb, err := database.Get(shared.ACTIVE_MAP)
+	if err != nil {
+		return err
+	}
+
+	settingsStore, err := database.GetStore(mdb, database.GUILD_SETTINGS_STORE)
+	if err != nil {
+		return err
+	}
+
+	group := i.ApplicationCommandData().Options[0]
+	subCmd := group.Options[0]
+
+	var content string
+	switch group.Name + " " + subCmd.Name {
+	case "voteparty thresholds":
+		content, err = setVotePartyThresholds(settingsStore, i.GuildID, subCmd)
+		if err != nil {
+			return err
+		}
+	case "notifications set":
+		content, err = setNotifications(s, i.Interaction, mdb, subCmd)
+		if err != nil {
+			return err
+		}
+	case "notifications remove":
+		feed := database.NotificationFeed(subCmd.GetOption("feed").StringValue())
+		content = fmt.Sprintf("This server wasn't receiving **%s** notifications.", feedLabel(feed))
+		if database.RemoveFeedSubscription(settingsStore, i.GuildID, feed) {
+			content = fmt.Sprintf("This server will no longer receive **%s** notifications.", feedLabel(feed))
+			if err := settingsStore.WriteSnapshot(); err != nil {
+				return err
+			}
+		}
+	case "notifications list":
+		content, err = listNotifications(mdb, i.GuildID)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = discordutil.EditReply(s, i.Interaction, &discordgo.InteractionResponseData{
+		Content: content,
+	})
+
+	return err
+}
+
+func (cmd SettingsCommand) HandleAutocomplete(s *discordgo.Session, i *discordgo.Interaction) error {
+	return allianceIdentifierAutocomplete(s, i, i.ApplicationCommandData())
+}
+
+func setNotifications(
+	s *discordgo.Session, i *discordgo.Interaction,
+	mdb *database.Database, subCmd *discordgo.ApplicationCommandInteractionDataOption,
+) (string, error) {
+	feed := database.NotificationFeed(subCmd.GetOption("feed").StringValue())
+	if !feed.Valid() {
+		return fmt.Sprintf("`%s` is not a type of notification.", feed), nil
+	}
+
+	channelID := subCmd.GetOption("channel").ChannelValue(nil).ID
+
+	// The bot only sees channels of servers it was actually added to, not ones where it was only installed to someone's account.
+	perms, err := s.State.UserChannelPermissions(s.State.User.ID, channelID)
+	if err != nil {
+		return "I can't see that channel. Make sure I've been added to this server and can view it.", nil
+	}
+	if perms&FEED_CHANNEL_PERMS != FEED_CHANNEL_PERMS {
+		return fmt.Sprintf("I need the View Channel, Send Messages and Embed Links permissions in <#%s>.", channelID), nil
+	}
+
+	filter := database.FeedFilter{}
+	if opt := subCmd.GetOption("nations"); opt != nil {
+		nationStore, err := database.GetStore(mdb, database.NATIONS_STORE)
+		if err != nil {
+			return "", err
+		}
+
+		byName := lo.SliceToMap(nationStore.Values(), func(n oapi.NationInfo) (string, string) {
+			return strings.ToLower(n.Name), n.UUID
+		})
+
+		unknown := []string{}
+		for name := range strings.SplitSeq(opt.StringValue(), ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+
+			uuid, ok := byName[strings.ToLower(name)]
+			if !ok {
+				unknown = append(unknown, "`"+name+"`")
+				continue
+			}
+
+			filter.Nations = append(filter.Nations, uuid)
+		}
+
+		if len(unknown) > 0 {
+			return fmt.Sprintf("Could not find these nations: %s", strings.Join(unknown, ", ")), nil
+		}
+
+		filter.Nations = lo.Uniq(filter.Nations)
+	}
+
+	if opt := subCmd.GetOption("alliance"); opt != nil {
+		allianceStore, err := database.GetStore(mdb, database.ALLIANCES_STORE)
+		if err != nil {
+			return "", err
+		}
+
+		ident := opt.StringValue()
+		if _, err := allianceStore.Get(strings.ToLower(ident)); err != nil {
+			return fmt.Sprintf("Could not find alliance `%s`.", ident), nil
+		}
+
+		filter.Alliance = ident
+	}
+
+	if !feed.Filterable() && !filter.Empty() {
+		return fmt.Sprintf("**%s** notifications aren't about a single nation, so they can't be filtered.", feedLabel(feed)), nil
+	}
+
+	settingsStore, err := database.GetStore(mdb, database.GUILD_SETTINGS_STORE)
+	if err != nil {
+		return "", err
+	}
+
+	database.SetFeedSubscription(settingsStore, i.GuildID, feed, database.FeedSubscription{
+		ChannelID: channelID,
+		Filter:    filter,
+		UpdatedBy: discordutil.InteractionAuthor(i).ID,
+	})
+	if err := settingsStore.WriteSnapshot(); err != nil {
+		return "", err
+	}
+
+	content := fmt.Sprintf("**%s** notifications will now be sent to <#%s>.", feedLabel(feed), channelID)
+	if !filter.Empty() {
+		content += "\nOnly about: " + describeFeedFilter(mdb, filter)
+	}
+
+	return content, nil
+}
+
+func setVotePartyThresholds(
+	settingsStore *store.Store[database.GuildSettings], guildID string,
+	subCmd *discordgo.ApplicationCommandInteractionDataOption,
+) (string, error) {
+	thresholds := []int{}
+	if opt := subCmd.GetOption("values"); opt != nil {
+		for v := range strings.SplitSeq(opt.StringValue(), ",") {
+			v = strings.TrimSpace(v)
+			if v == "" {
+				continue
+			}
+
+			t, err := strconv.Atoi(v)
+			if err != nil || t <= 0 {
+				return fmt.Sprintf("`%s` is not a valid amount of votes.", v), nil
+			}
+
+			thresholds = append(thresholds, t)
+		}
+	}
+
+	thresholds = lo.Uniq(thresholds)
+	if len(thresholds) > VP_MAX_THRESHOLDS {
+		return fmt.Sprintf("You can only set up to %d thresholds.", VP_MAX_THRESHOLDS), nil
+	}
+
+	slices.Sort(thresholds)
+	slices.Reverse(thresholds)
+
+	database.SetGuildVotePartyThresholds(settingsStore, guildID, thresholds)
+	if err := settingsStore.WriteSnapshot(); err != nil {
+		return "", err
+	}
+
+	if len(thresholds) == 0 {
+		thresholds = database.VP_DEFAULT_THRESHOLDS
+	}
+
+	values := lo.Map(thresholds, func(t int, _ int) string { return fmt.Sprintf("`%d`", t) })
+	return fmt.Sprintf(
+		"VoteParty notifications will be sent when it has %s votes remaining.\nMake sure the **VoteParty** notification is set with `/settings notifications set`.",
+		strings.Join(values, ", "),
+	), nil
+}
+
+func listNotifications(mdb *database.Database, guildID string) (string, error) {
+	settingsStore, err := database.GetStore(mdb, database.GUILD_SETTINGS_STORE)
+	if err != nil {
+		return "", err
+	}
+
+	settings, err := settingsStore.Get(guildID)
+	if err != nil || len(settings.Feeds) == 0 {
+		return "This server doesn't receive any notifications. Use `/settings notifications set` to choose some.", nil
+	}
+
+	lines := []string{"This server receives these notifications:"}
+	for _, feed := range database.NOTIFICATION_FEEDS {
+		sub, ok := settings.Feeds[feed]
+		if !ok {
+			continue
+		}
+
+		line := fmt.Sprintf("- **%s** in <#%s>", feedLabel(feed), sub.ChannelID)
+		if !sub.Filter.Empty() {
+			line += ", only about " + describeFeedFilter(mdb, sub.Filter)
+		}
+
+		lines = append(lines, line)
+	}
+
+	if len(settings.VotePartyThresholds) > 0 {
+		values := lo.Map(settings.VotePartyThresholds, func(t int, _ int) string { return fmt.Sprintf("`%d`", t) })
+		lines = append(lines, "\nVoteParty thresholds: "+strings.Join(values, ", "))
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+func describeFeedFilter(mdb *database.Database, filter database.FeedFilter) string {
+	parts := []string{}
+	if len(filter.Nations) > 0 {
+		names := filter.Nations
+		if nationStore, err := database.GetStore(mdb, database.NATIONS_STORE); err == nil {
+			names = lo.Map(filter.Nations, func(uuid string, _ int) string {
+				if n, err := nationStore.Get(uuid); err == nil {
+					return n.Name
+				}
+
+				return uuid // no longer exists
+			})
+		}
+
+		parts = append(parts, "nations "+strings.Join(lo.Map(names, func(name string, _ int) string { return "`" + name + "`" }), ", "))
+	}
+	if filter.Alliance != "" {
+		parts = append(parts, fmt.Sprintf("alliance `%s`", filter.Alliance))
+	}
+
+	return strings.Join(parts, " and ")
+}
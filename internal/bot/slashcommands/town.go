@@ -24,115 +24,6 @@ const UINT64_MAX = ^uint64(0)
 
 var townInputOpt = discordutil.AutocompleteStringOption("name", "The name of the town to query.", 2, 40, true)
 
-// #region Filter & sort callbacks
-var statusFilters = map[string]func(oapi.TownInfo) bool{
-	"capital":             func(t oapi.TownInfo) bool { return t.Status.Capital },
-	"ruined":              func(t oapi.TownInfo) bool { return t.Status.Ruined },
-	"overclaimed":         func(t oapi.TownInfo) bool { return t.Status.Overclaimed },
-	"for-sale":            func(t oapi.TownInfo) bool { return t.Status.ForSale },
-	"can-outsiders-spawn": func(t oapi.TownInfo) bool { return t.Status.CanOutsidersSpawn },
-	"open":                func(t oapi.TownInfo) bool { return t.Status.Open },
-	"public":              func(t oapi.TownInfo) bool { return t.Status.Public },
-	"neutral":             func(t oapi.TownInfo) bool { return t.Status.Neutral },
-}
-
-var flagFilters = map[string]func(oapi.TownInfo) bool{
-	"explosions": func(t oapi.TownInfo) bool { return t.Perms.Flags.Explosions },
-	"mobs":       func(t oapi.TownInfo) bool { return t.Perms.Flags.Mobs },
-	"fire":       func(t oapi.TownInfo) bool { return t.Perms.Flags.Fire },
-	"pvp":        func(t oapi.TownInfo) bool { return t.Perms.Flags.PVP },
-}
-
-var townSorts = map[string]func([]oapi.TownInfo){
-	"alphabetical": func(towns []oapi.TownInfo) {
-		utils.KeySort(towns, []utils.KeySortOption[oapi.TownInfo]{
-			{Compare: func(a, b oapi.TownInfo) bool { return a.Name < b.Name }},
-		})
-	},
-	"residents": func(towns []oapi.TownInfo) {
-		utils.KeySort(towns, []utils.KeySortOption[oapi.TownInfo]{
-			{Compare: func(a, b oapi.TownInfo) bool { return a.NumResidents() > b.NumResidents() }},
-		})
-	},
-	"size": func(towns []oapi.TownInfo) {
-		utils.KeySort(towns, []utils.KeySortOption[oapi.TownInfo]{
-			{Compare: func(a, b oapi.TownInfo) bool { return a.Size() > b.Size() }},
-		})
-	},
-	"founded": func(towns []oapi.TownInfo) {
-		utils.KeySort(towns, []utils.KeySortOption[oapi.TownInfo]{
-			{Compare: func(a, b oapi.TownInfo) bool {
-				return a.Timestamps.Registered < b.Timestamps.Registered
-			}},
-		})
-	},
-	"balance": func(towns []oapi.TownInfo) {
-		utils.KeySort(towns, []utils.KeySortOption[oapi.TownInfo]{
-			{Compare: func(a, b oapi.TownInfo) bool { return a.Bal() > b.Bal() }},
-		})
-	},
-	"ruined": func(towns []oapi.TownInfo) {
-		utils.RankSortDescending(towns, func(t oapi.TownInfo) int {
-			if !t.Status.Ruined {
-				return 0
-			}
-			return int(*t.Timestamps.RuinedAt)
-		})
-	},
-	"overclaimed": func(towns []oapi.TownInfo) {
-		utils.RankSortAscending(towns, func(t oapi.TownInfo) int {
-			switch {
-			case t.Status.Overclaimed:
-				return 0
-			case t.Status.Overclaimed:
-				return 1
-			default:
-				return 2
-			}
-		})
-	},
-	"for-sale": func(towns []oapi.TownInfo) {
-		utils.RankSortDescending(towns, func(t oapi.TownInfo) int {
-			if !t.Status.ForSale || t.Stats.ForSalePrice == nil {
-				return 0
-			}
-			return int(*t.Stats.ForSalePrice * 100.0)
-		})
-	},
-	"capital": func(towns []oapi.TownInfo) {
-		utils.SortToggledOn(towns, func(t oapi.TownInfo) bool {
-			return t.Status.Capital
-		})
-	},
-	"has-nation": func(towns []oapi.TownInfo) {
-		utils.SortToggledOn(towns, func(t oapi.TownInfo) bool {
-			return t.Status.HasNation
-		})
-	},
-	"can-outsiders-spawn": func(towns []oapi.TownInfo) {
-		utils.SortToggledOn(towns, func(t oapi.TownInfo) bool {
-			return t.Status.CanOutsidersSpawn
-		})
-	},
-	"open": func(towns []oapi.TownInfo) {
-		utils.SortToggledOn(towns, func(t oapi.TownInfo) bool {
-			return t.Status.Open
-		})
-	},
-	"public": func(towns []oapi.TownInfo) {
-		utils.SortToggledOn(towns, func(t oapi.TownInfo) bool {
-			return t.Status.Public
-		})
-	},
-	"neutral": func(towns []oapi.TownInfo) {
-		utils.SortToggledOn(towns, func(t oapi.TownInfo) bool {
-			return t.Status.Neutral
-		})
-	},
-}
-
-// #endregion
-
 type TownCommand struct{}
 
 func (cmd TownCommand) Name() string { return "town" }
@@ -145,6 +36,9 @@ func (cmd TownCommand) Options() []AppCommandOpt {
 		discordutil.SubcommandOption("query", "Query information about a town. Similar to /t in-game.", townInputOpt),
 		discordutil.SubcommandOption("activity", "Query the last online and purge dates of a town's residents.", townInputOpt),
 		discordutil.SubcommandOption("online", "Query the online status of a town's residents. Alias of /online town", townInputOpt),
+		discordutil.SubcommandOption("overclaim", "Predict if and when a town could become overclaimed.", townInputOpt,
+			discordutil.AutocompleteStringOption("join", "Also predict its claims if it joined this nation.", 2, 40, false),
+		),
 		discordutil.SubcommandOption("list", "Sends a paginator enabling navigation through all existing towns.",
 			discordutil.StringOption("sort", "Optional town list sorting. Without this, towns are sorted by residents -> size.", nil, nil,
 				discordutil.Choice("Alphabetical", "alphabetical"), // "Sort the list alphabetically by name."
@@ -206,6 +100,16 @@ func (cmd TownCommand) Execute(s *discordgo.Session, i *discordgo.InteractionCre
 		townNameArg := opt.GetOption("name").StringValue()
 		return executeOnlineTown(s, i.Interaction, townNameArg)
 	}
+	if opt := cdata.GetOption("overclaim"); opt != nil {
+		townNameArg := opt.GetOption("name").StringValue()
+
+		joinArg := ""
+		if joinOpt := opt.GetOption("join"); joinOpt != nil {
+			joinArg = joinOpt.StringValue()
+		}
+
+		return executeTownOverclaim(s, i.Interaction, townNameArg, joinArg)
+	}
 	if opt := cdata.GetOption("list"); opt != nil {
 		return executeTownList(s, i.Interaction)
 	}
@@ -228,6 +132,14 @@ func (cmd TownCommand) HandleAutocomplete(s *discordgo.Session, i *discordgo.Int
 				return nationNameAutocomplete(s, i, cdata)
 			}
 		}
+	case "overclaim":
+		for _, opt := range subCmd.Options {
+			if opt.Name == "join" && opt.Focused {
+				return nationNameAutocomplete(s, i, cdata)
+			}
+		}
+
+		return townNameAutocomplete(s, i, cdata)
 	case "query", "activity", "online":
 		return townNameAutocomplete(s, i, cdata)
 	}
@@ -306,8 +218,19 @@ func executeTownQuery(s *discordgo.Session, i *discordgo.Interaction, townName s
 		return discordutil.FollowupContent(s, i, err.Error(), true)
 	}
 
+	embed := shared.NewTownEmbed(*town)
+	nationStore, _ := database.GetStore(mdb, database.NATIONS_STORE)
+
 	msg := discordutil.NewMessageBuilder()
-	msg.AddEmbed(shared.NewTownEmbed(*town))
+	msg.AddEmbed(embed)
+
+	claimsFile, err := shared.NewTownClaimsFile(embed, *town, nationStore)
+	if err != nil {
+		logutil.Printf(logutil.YELLOW, "\nWARN | %v\n", err)
+	} else if claimsFile != nil {
+		msg.Files = append(msg.Files, claimsFile)
+	}
+
 	if town.Discord != nil {
 		msg.AddButton("Join discord", discordgo.LinkButton, *town.Discord, &discordutil.DISCORD_EMOJI, nil)
 	}
@@ -318,6 +241,101 @@ func executeTownQuery(s *discordgo.Session, i *discordgo.Interaction, townName s
 	return discordutil.Followup(s, i, msg.WebhookData())
 }
 
+// The joinName nation is optional, an empty string only shows the worst case of joining a nation.
+func executeTownOverclaim(s *discordgo.Session, i *discordgo.Interaction, townName, joinName string) error {
+	mdb, err := database.Get(shared.ACTIVE_MAP)
+	if err != nil {
+		return err
+	}
+
+	town, err := tryGetTown(mdb, townName)
+	if err != nil {
+		_, err := discordutil.FollowupContent(s, i, err.Error(), true)
+		return err
+	}
+	if town.Status.Ruined {
+		_, err := discordutil.FollowupContent(s, i, fmt.Sprintf("Town `%s` is ruined, so it can already be overclaimed.", town.Name), false)
+		return err
+	}
+
+	var nation *oapi.NationInfo
+	var falling []database.FallingTown
+	if town.Nation.UUID != nil {
+		if nationStore, err := database.GetStore(mdb, database.NATIONS_STORE); err == nil {
+			nation, _ = nationStore.Get(*town.Nation.UUID)
+		}
+	}
+	if fallingStore, err := database.GetStore(mdb, database.FALLING_TOWNS_STORE); err == nil {
+		falling = fallingStore.Values()
+	}
+
+	risk := database.ComputeOverclaimRisk(*town, nation, falling)
+	model := risk.Model
+
+	claimsStr := logutil.HumanizedSprintf("Size: `%d`/`%d` %s\nSpare: `%d` %s",
+		risk.Size, risk.MaxSize, shared.EMOJIS.CHUNK, risk.Spare, shared.EMOJIS.CHUNK,
+	)
+	limitStr := logutil.HumanizedSprintf("Residents: `%d` * `%d`\nBought: `%d`\nNation Bonus: `%d`",
+		model.Residents, model.PerResident, model.BonusBlocks, model.NationBonus,
+	)
+
+	residentsStr := "Safe even if every resident except the mayor leaves."
+	if risk.ResidentsToOverclaim != nil {
+		residentsStr = fmt.Sprintf("Overclaimed if `%d` resident(s) leave.", *risk.ResidentsToOverclaim)
+	}
+
+	nationStr := "Not in a nation."
+	if risk.SpareIfLeavesNation != nil {
+		nationStr = logutil.HumanizedSprintf("Would have `%d` spare claims after leaving its nation.", *risk.SpareIfLeavesNation)
+	}
+
+	joinStr := logutil.HumanizedSprintf("Would have at least `%d` spare claims in any nation.", risk.SpareIfJoinsNation)
+	if joinName != "" {
+		target, err := tryGetNation(mdb, joinName)
+		if err != nil {
+			_, err := discordutil.FollowupContent(s, i, err.Error(), true)
+			return err
+		}
+
+		joinStr = logutil.HumanizedSprintf("Would have `%d` spare claims after joining **%s**.\n%s",
+			database.SpareIfJoins(*town, nation, *target), target.Name, joinStr,
+		)
+	}
+
+	fallingStr := "No falling mayors affect this town."
+	if risk.OverclaimableAt != nil {
+		fallingStr = fmt.Sprintf("Predicted to become overclaimable <t:%d:R>.", risk.OverclaimableAt.Unix())
+	} else if risk.FallingNationResidents > 0 {
+		fallingStr = logutil.HumanizedSprintf("`%d` resident(s) from falling towns in the nation. Would still have `%d` spare claims.",
+			risk.FallingNationResidents, risk.SpareAfterFalling,
+		)
+	}
+
+	colour := discordutil.GREEN
+	switch risk.Level {
+	case database.OverclaimRiskOverclaimed, database.OverclaimRiskHigh:
+		colour = discordutil.RED
+	case database.OverclaimRiskMedium, database.OverclaimRiskLow:
+		colour = discordutil.GOLD
+	}
+
+	title := fmt.Sprintf("Overclaim Risk | `%s`", town.Name)
+	desc := fmt.Sprintf("Risk level: **%s**", strings.ToUpper(string(risk.Level)))
+
+	embed := discordutil.NewEmbedBuilder(&colour, &title, &desc, nil)
+	embed.SetFields(
+		NewEmbedField("Claims", claimsStr, true),
+		NewEmbedField("Claim Limit", limitStr, true),
+		NewEmbedField("Residents Leaving", residentsStr, false),
+		NewEmbedField("Leaving Nation", nationStr, false),
+		NewEmbedField("Joining Nation", joinStr, false),
+		NewEmbedField("Falling Mayors", fallingStr, false),
+	)
+
+	_, err = discordutil.FollowupEmbeds(s, i, embed.Build())
+	return err
+}
+
 func executeTownList(s *discordgo.Session, i *discordgo.Interaction) error {
 	townStore, err := database.GetStoreForMap(shared.ACTIVE_MAP, database.TOWNS_STORE)
 	if err != nil {
@@ -359,14 +377,14 @@ func executeTownList(s *discordgo.Session, i *discordgo.Interaction) error {
 
 	// Apply custom filter if chosen
 	if opt := listOpt.GetOption("status"); opt != nil {
-		if filter, ok := statusFilters[opt.StringValue()]; ok {
+		if filter, ok := database.TOWN_STATUS_FILTERS[opt.StringValue()]; ok {
 			towns = lo.Filter(towns, func(t oapi.TownInfo, _ int) bool {
 				return filter(t)
 			})
 		}
 	}
 	if opt := listOpt.GetOption("flags"); opt != nil {
-		if filter, ok := flagFilters[opt.StringValue()]; ok {
+		if filter, ok := database.TOWN_FLAG_FILTERS[opt.StringValue()]; ok {
 			towns = lo.Filter(towns, func(t oapi.TownInfo, _ int) bool {
 				return filter(t)
 			})
@@ -375,15 +393,11 @@ func executeTownList(s *discordgo.Session, i *discordgo.Interaction) error {
 
 	// Apply custom sort if chosen
 	if opt := listOpt.GetOption("sort"); opt != nil {
-		if sorter, ok := townSorts[opt.StringValue()]; ok {
+		if sorter, ok := database.TOWN_SORTS[opt.StringValue()]; ok {
 			sorter(towns)
 		}
 	} else {
-		// default sort
-		utils.KeySort(towns, []utils.KeySortOption[oapi.TownInfo]{
-			{Compare: func(a, b oapi.TownInfo) bool { return a.NumResidents() > b.NumResidents() }},
-			{Compare: func(a, b oapi.TownInfo) bool { return a.Size() > b.Size() }},
-		})
+		database.SortTownsDefault(towns) // residents -> size
 	}
 
 	townCount := len(towns)
@@ -1,20 +1,29 @@
 package slashcommands
 
 import (
+	"bytes"
 	"emcsrw/internal/database"
 	"emcsrw/internal/shared"
+	"emcsrw/pkg/utils"
 	"emcsrw/pkg/utils/discordutil"
 	"emcsrw/pkg/utils/logutil"
+	"emcsrw/pkg/utils/render"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/samber/lo"
 )
 
+const VP_CHART_IMAGE_NAME = "vp-trend.png"
+const VP_HISTORY_SHOWN = 5 // Amount of past VoteParties listed.
+
 type VotePartyCommand struct{}
 
 func (cmd VotePartyCommand) Name() string { return "vp" }
 func (cmd VotePartyCommand) Description() string {
-	return "Retrieves info on the current status of the VoteParty."
+	return "Retrieves info on the current status of the VoteParty, its recent history and trend."
 }
 
 func (cmd VotePartyCommand) Options() []AppCommandOpt {
@@ -51,6 +60,91 @@ func (cmd VotePartyCommand) Execute(s *discordgo.Session, i *discordgo.Interacti
 	)
 
 	embed := discordutil.NewEmbedBuilder(&discordutil.BLURPLE, &title, &desc, nil)
-	_, err = discordutil.FollowupEmbeds(s, i.Interaction, embed.Build())
+	params := &discordgo.WebhookParams{}
+
+	vpStore, err := database.GetStoreForMap(shared.ACTIVE_MAP, database.VOTEPARTY_STORE)
+	if err != nil {
+		return err
+	}
+
+	if state, err := vpStore.Get(database.VOTEPARTY_KEY); err == nil {
+		addVotePartyStats(embed, *state, time.Now())
+
+		chart, peak, err := votePartyTrendChart(*state, time.Now())
+		if err != nil {
+			logutil.Printf(logutil.YELLOW, "\nWARN | failed to render VoteParty trend chart: %v\n", err)
+		} else if chart != nil {
+			params.Files = append(params.Files, chart)
+			embed.SetImage("attachment://"+VP_CHART_IMAGE_NAME, nil)
+			embed.AddField(
+				fmt.Sprintf("Votes Per Hour (last %dh)", database.VP_TREND_HOURS),
+				logutil.HumanizedSprintf("Oldest on the left, current hour on the right. The busiest hour (`%d` votes) is highlighted.", peak),
+				false,
+			)
+		}
+	}
+
+	params.Embeds = []*discordgo.MessageEmbed{embed.Build()}
+	_, err = discordutil.Followup(s, i.Interaction, params)
 	return err
 }
+
+func addVotePartyStats(embed *discordutil.EmbedBuilder, state database.VotePartyState, now time.Time) {
+	rateWindow := fmt.Sprintf("%.0f mins", database.VP_RATE_WINDOW.Minutes())
+	if rate, eta := state.Rate(now), state.ETA(now); rate > 0 && eta > 0 {
+		embed.AddField("Rate (last "+rateWindow+")", fmt.Sprintf("~%.2f votes/min", rate), true)
+		embed.AddField("ETA", fmt.Sprintf("<t:%d:R>", now.Add(eta).Unix()), true)
+	} else {
+		embed.AddField("Rate (last "+rateWindow+")", "No votes recently.", true)
+	}
+
+	if len(state.Completions) == 0 {
+		return
+	}
+
+	last := state.Completions[len(state.Completions)-1]
+	embed.AddField("Last VoteParty", fmt.Sprintf("<t:%d:R>", last.CompletedAt/1000), true)
+	if avg := state.AverageInterval(); avg > 0 {
+		embed.AddField(
+			fmt.Sprintf("Average Time Between (last %d)", len(state.Completions)),
+			utils.FormatElapsed(avg.Round(time.Minute)), true,
+		)
+	}
+
+	recent := state.Completions[max(0, len(state.Completions)-VP_HISTORY_SHOWN):]
+	lines := make([]string, 0, len(recent))
+	for idx := len(recent) - 1; idx >= 0; idx-- {
+		c := recent[idx]
+		line := fmt.Sprintf("<t:%d:f>", c.CompletedAt/1000)
+
+		// Time taken since the one before it, if we know of it.
+		if prevIdx := len(state.Completions) - len(recent) + idx - 1; prevIdx >= 0 {
+			took := time.Duration(c.CompletedAt-state.Completions[prevIdx].CompletedAt) * time.Millisecond
+			line += " (took " + utils.FormatElapsed(took.Round(time.Minute)) + ")"
+		}
+
+		lines = append(lines, line)
+	}
+
+	embed.AddField("Recent VoteParties", strings.Join(lines, "\n"), false)
+}
+
+// Renders the votes cast per hour as a bar chart, also returning the most votes cast in an hour.
+// Nil (no error) if no votes were recorded at all.
+func votePartyTrendChart(state database.VotePartyState, now time.Time) (*discordgo.File, int, error) {
+	hourly := state.HourlyVotes(now, database.VP_TREND_HOURS)
+	if lo.Sum(hourly) == 0 {
+		return nil, 0, nil
+	}
+
+	png, err := render.RenderBarChartPNG(lo.Map(hourly, func(v int, _ int) float64 { return float64(v) }))
+	if err != nil || png == nil {
+		return nil, 0, err
+	}
+
+	return &discordgo.File{
+		Name:        VP_CHART_IMAGE_NAME,
+		ContentType: "image/png",
+		Reader:      bytes.NewReader(png),
+	}, lo.Max(hourly), nil
+}
@@ -0,0 +1,304 @@
+package slashcommands
+
+import (
+	"emcsrw/internal/database"
+	"emcsrw/internal/shared"
+	"emcsrw/pkg/api/oapi"
+	"emcsrw/pkg/utils/discordutil"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/samber/lo"
+)
+
+type WatchCommand struct{}
+
+func (cmd WatchCommand) Name() string { return "watch" }
+func (cmd WatchCommand) Description() string {
+	return "Get DMed when towns, nations or players you care about change."
+}
+
+func (cmd WatchCommand) Options() []AppCommandOpt {
+	kindChoices := lo.Map(database.WATCH_KINDS, func(k database.WatchKind, _ int) *discordgo.ApplicationCommandOptionChoice {
+		return discordutil.Choice(strings.ToUpper(string(k[:1]))+string(k[1:]), string(k))
+	})
+
+	kindOpt := discordutil.StringOption("type", "What you want to watch.", nil, nil, kindChoices...)
+	kindOpt.Required = true
+
+	alertsOpt := discordutil.BoolOption("enabled", "Whether you want to receive watchlist DMs.")
+	alertsOpt.Required = true
+
+	return []AppCommandOpt{
+		discordutil.SubcommandOption("add", "Adds a town, nation or player to your watchlist.",
+			kindOpt,
+			discordutil.AutocompleteStringOption("name", "The name of the town, nation or player.", 2, 40, true),
+		),
+		discordutil.SubcommandOption("remove", "Removes something from your watchlist.",
+			discordutil.AutocompleteStringOption("name", "The town, nation or player to stop watching.", 1, 80, true),
+		),
+		discordutil.SubcommandOption("list", "Lists everything on your watchlist."),
+		discordutil.SubcommandOption("alerts", "Turns watchlist DMs on or off without clearing your watchlist.", alertsOpt),
+	}
+}
+
+func (cmd WatchCommand) Execute(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	if err := discordutil.DeferEphemeralReply(s, i.Interaction); err != nil {
+		return err
+	}
+
+	watchStore, err := database.GetStoreForMap(shared.ACTIVE_MAP, database.WATCHLISTS_STORE)
+	if err != nil {
+		return err
+	}
+
+	userID := discordutil.InteractionAuthor(i.Interaction).ID
+	subCmd := i.ApplicationCommandData().Options[0]
+
+	var content string
+	switch subCmd.Name {
+	case "add":
+		kind := database.WatchKind(subCmd.GetOption("type").StringValue())
+		entity, err := findWatchable(kind, subCmd.GetOption("name").StringValue())
+		if err != nil {
+			content = "Error: " + err.Error()
+			break
+		}
+
+		switch err := database.AddWatch(watchStore, userID, database.WatchedEntity{Kind: kind, UUID: entity.UUID, Name: entity.Name}); {
+		case errors.Is(err, database.ErrAlreadyWatching):
+			content = fmt.Sprintf("You are already watching %s `%s`.", kind, entity.Name)
+		case errors.Is(err, database.ErrWatchlistFull):
+			content = fmt.Sprintf("Your watchlist is full! You can watch up to %d things at once.", database.WATCHLIST_MAX_ENTRIES)
+		default:
+			content = fmt.Sprintf("Now watching %s `%s`. %s", kind, entity.Name, watchAlertDescription(kind))
+		}
+	case "remove":
+		w, _ := watchStore.Get(userID)
+		entry, ok := findWatchEntry(w, subCmd.GetOption("name").StringValue())
+		if !ok || !database.RemoveWatch(watchStore, userID, entry.Kind, entry.UUID) {
+			content = "That isn't on your watchlist."
+			break
+		}
+
+		content = fmt.Sprintf("No longer watching %s `%s`.", entry.Kind, entry.Name)
+	case "list":
+		w, err := watchStore.Get(userID)
+		if err != nil || len(w.Entries) == 0 {
+			content = "Your watchlist is empty. Use `/watch add` to start watching something."
+			break
+		}
+
+		_, err = discordutil.EditReply(s, i.Interaction, &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{watchlistEmbed(*w)},
+		})
+
+		return err
+	case "alerts":
+		enabled := subCmd.GetOption("enabled").BoolValue()
+		database.SetWatchAlerts(watchStore, userID, enabled)
+
+		content = lo.Ternary(enabled,
+			"Watchlist DMs are now **on**. Make sure you allow DMs from this bot, otherwise they'll be turned off again.",
+			"Watchlist DMs are now **off**. Your watchlist has been kept.",
+		)
+	}
+
+	if err := watchStore.WriteSnapshot(); err != nil {
+		return err
+	}
+
+	_, err = discordutil.EditReply(s, i.Interaction, &discordgo.InteractionResponseData{
+		Content: content,
+	})
+
+	return err
+}
+
+func (cmd WatchCommand) HandleAutocomplete(s *discordgo.Session, i *discordgo.Interaction) error {
+	cdata := i.ApplicationCommandData()
+	if len(cdata.Options) == 0 {
+		return nil
+	}
+
+	subCmd := cdata.Options[0]
+	switch subCmd.Name {
+	case "add":
+		kindOpt := subCmd.GetOption("type")
+		if kindOpt == nil {
+			return respondChoices(s, i, nil)
+		}
+
+		switch database.WatchKind(kindOpt.StringValue()) {
+		case database.WatchTown:
+			return townNameAutocomplete(s, i, cdata)
+		case database.WatchNation:
+			return nationNameAutocomplete(s, i, cdata)
+		case database.WatchPlayer:
+			return playerNameAutocomplete(s, i, cdata)
+		}
+	case "remove":
+		return watchEntryAutocomplete(s, i, cdata)
+	}
+
+	return nil
+}
+
+// Looks up the town, nation or player with the given name (case-insensitive) or UUID.
+func findWatchable(kind database.WatchKind, name string) (oapi.Entity, error) {
+	matches := func(entName, uuid string) bool {
+		return strings.EqualFold(entName, name) || uuid == name
+	}
+
+	switch kind {
+	case database.WatchTown:
+		townStore, err := database.GetStoreForMap(shared.ACTIVE_MAP, database.TOWNS_STORE)
+		if err != nil {
+			return oapi.Entity{}, err
+		}
+		if t, err := townStore.Find(func(t oapi.TownInfo) bool { return matches(t.Name, t.UUID) }); err == nil {
+			return t.Entity, nil
+		}
+	case database.WatchNation:
+		nationStore, err := database.GetStoreForMap(shared.ACTIVE_MAP, database.NATIONS_STORE)
+		if err != nil {
+			return oapi.Entity{}, err
+		}
+		if n, err := nationStore.Find(func(n oapi.NationInfo) bool { return matches(n.Name, n.UUID) }); err == nil {
+			return n.Entity, nil
+		}
+	case database.WatchPlayer:
+		playerStore, err := database.GetStoreForMap(shared.ACTIVE_MAP, database.PLAYERS_STORE)
+		if err != nil {
+			return oapi.Entity{}, err
+		}
+		if p, err := playerStore.Find(func(p database.BasicPlayer) bool { return matches(p.Name, p.UUID) }); err == nil {
+			return p.Entity, nil
+		}
+	default:
+		return oapi.Entity{}, fmt.Errorf("`%s` is not something you can watch", kind)
+	}
+
+	return oapi.Entity{}, fmt.Errorf("could not find %s `%s`", kind, name)
+}
+
+// Finds an entry on the watchlist by the "kind:uuid" value from autocomplete, or by name if typed out manually.
+func findWatchEntry(w *database.Watchlist, value string) (database.WatchedEntity, bool) {
+	if w == nil {
+		return database.WatchedEntity{}, false
+	}
+
+	return lo.Find(w.Entries, func(e database.WatchedEntity) bool {
+		return watchEntryValue(e) == value || strings.EqualFold(e.Name, value)
+	})
+}
+
+func watchEntryValue(e database.WatchedEntity) string {
+	return string(e.Kind) + ":" + e.UUID
+}
+
+func watchAlertDescription(kind database.WatchKind) string {
+	switch kind {
+	case database.WatchTown:
+		return "You'll be DMed when it's close to falling, falls into ruin or changes mayor."
+	case database.WatchNation:
+		return "You'll be DMed when it gains or loses towns."
+	case database.WatchPlayer:
+		return "You'll be DMed when they join or leave a town, or come online."
+	}
+
+	return ""
+}
+
+func watchlistEmbed(w database.Watchlist) *discordgo.MessageEmbed {
+	title := fmt.Sprintf("Your Watchlist [%d/%d]", len(w.Entries), database.WATCHLIST_MAX_ENTRIES)
+	embed := discordutil.NewEmbedBuilder(&discordutil.BLURPLE, &title, nil, nil)
+
+	for _, kind := range database.WATCH_KINDS {
+		entries := lo.Filter(w.Entries, func(e database.WatchedEntity, _ int) bool { return e.Kind == kind })
+		if len(entries) == 0 {
+			continue
+		}
+
+		names := lo.Map(entries, func(e database.WatchedEntity, _ int) string {
+			return fmt.Sprintf("`%s` (added <t:%d:R>)", e.Name, e.AddedAt/1000)
+		})
+
+		embed.AddField(strings.ToUpper(string(kind[:1]))+string(kind[1:])+"s", strings.Join(names, "\n"), false)
+	}
+
+	if w.AlertsDisabled {
+		embed.SetFooter("Watchlist DMs are off. Use /watch alerts to turn them back on.", nil)
+	}
+
+	return embed.Build()
+}
+
+func playerNameAutocomplete(s *discordgo.Session, i *discordgo.Interaction, cdata discordgo.ApplicationCommandInteractionData) error {
+	focused, ok := discordutil.GetFocusedValue[string](cdata.Options)
+	if !ok {
+		return fmt.Errorf("player autocomplete error: focused value could not be cast as string")
+	}
+
+	focusedLower := strings.ToLower(strings.TrimSpace(focused))
+	if focusedLower == "" {
+		return respondChoices(s, i, nil) // way too many players to suggest without a hint
+	}
+
+	playerStore, err := database.GetStoreForMap(shared.ACTIVE_MAP, database.PLAYERS_STORE)
+	if err != nil {
+		return err
+	}
+
+	matches := playerStore.FindAll(func(p database.BasicPlayer) bool {
+		return strings.HasPrefix(strings.ToLower(p.Name), focusedLower)
+	})
+	if len(matches) > discordutil.AUTOCOMPLETE_CHOICE_LIMIT {
+		matches = matches[:discordutil.AUTOCOMPLETE_CHOICE_LIMIT]
+	}
+
+	return respondChoices(s, i, discordutil.CreateAutocompleteChoices(matches, func(p database.BasicPlayer, _ int) (string, string) {
+		if p.Town != nil {
+			return fmt.Sprintf("%s (%s)", p.Name, p.Town.Name), p.Name
+		}
+
+		return p.Name, p.Name
+	}))
+}
+
+func watchEntryAutocomplete(s *discordgo.Session, i *discordgo.Interaction, cdata discordgo.ApplicationCommandInteractionData) error {
+	focused, _ := discordutil.GetFocusedValue[string](cdata.Options)
+	focusedLower := strings.ToLower(strings.TrimSpace(focused))
+
+	watchStore, err := database.GetStoreForMap(shared.ACTIVE_MAP, database.WATCHLISTS_STORE)
+	if err != nil {
+		return err
+	}
+
+	w, err := watchStore.Get(discordutil.InteractionAuthor(i).ID)
+	if err != nil {
+		return respondChoices(s, i, nil)
+	}
+
+	matches := lo.Filter(w.Entries, func(e database.WatchedEntity, _ int) bool {
+		return strings.Contains(strings.ToLower(e.Name), focusedLower)
+	})
+	if len(matches) > discordutil.AUTOCOMPLETE_CHOICE_LIMIT {
+		matches = matches[:discordutil.AUTOCOMPLETE_CHOICE_LIMIT]
+	}
+
+	return respondChoices(s, i, discordutil.CreateAutocompleteChoices(matches, func(e database.WatchedEntity, _ int) (string, string) {
+		return fmt.Sprintf("%s (%s)", e.Name, e.Kind), watchEntryValue(e)
+	}))
+}
+
+func respondChoices(s *discordgo.Session, i *discordgo.Interaction, choices []*discordgo.ApplicationCommandOptionChoice) error {
+	return s.InteractionRespond(i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: choices,
+		},
+	})
+}
@@ -0,0 +1,128 @@
+package cli
+
+import (
+	"emcsrw/internal/database"
+	"emcsrw/internal/shared"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const APIKEY_USAGE = "Usage: go run . apikey [issue <name> [-tier standard|partner]|revoke <id>|list]"
+
+// Manages Custom API keys from the command line. Useful when the bot isn't running.
+//
+// Keys are written straight to the DB files, the API picks them up on its next sync.
+func ApiKey(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("missing apikey subcommand. %s", APIKEY_USAGE)
+	}
+
+	mdb := database.TryInit(shared.ACTIVE_MAP)
+	keyStore, err := database.OpenStore(mdb, database.API_KEYS_STORE)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "issue":
+		fs := flag.NewFlagSet("apikey issue", flag.ContinueOnError)
+		tierFlag := fs.String("tier", string(database.ApiTierStandard), "rate limit tier of the key")
+
+		// Allow flags before or after the name.
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		rest := fs.Args()
+		if len(rest) > 1 {
+			if err := fs.Parse(rest[1:]); err != nil {
+				return err
+			}
+		}
+		if len(rest) < 1 {
+			return fmt.Errorf("missing key name. %s", APIKEY_USAGE)
+		}
+
+		tier, ok := database.ParseApiKeyTier(*tierFlag)
+		if !ok {
+			return fmt.Errorf("invalid tier '%s'. expected one of: %v", *tierFlag, database.API_KEY_TIERS)
+		}
+
+		key, apiKey, err := database.IssueApiKey(keyStore, rest[0], tier, "cli")
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Issued %s key %s for %s.\n\n\t%s\n\nThis is the only time the key will be shown, store it somewhere safe.\n",
+			apiKey.Tier, apiKey.ID, apiKey.Name, key,
+		)
+	case "revoke":
+		if len(args) < 2 {
+			return fmt.Errorf("missing key id. %s", APIKEY_USAGE)
+		}
+
+		apiKey, err := database.RevokeApiKey(keyStore, args[1])
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Revoked key %s (%s).\n", apiKey.ID, apiKey.Name)
+	case "list":
+		usageStore, err := database.OpenStore(mdb, database.API_KEY_USAGE_STORE)
+		if err != nil {
+			return err
+		}
+
+		printApiKeys(database.ListApiKeys(keyStore), usageStore.Get)
+	default:
+		return fmt.Errorf("unknown apikey subcommand: %s. %s", args[0], APIKEY_USAGE)
+	}
+
+	return nil
+}
+
+func printApiKeys(keys []database.ApiKey, getUsage func(id string) (*database.ApiKeyUsage, error)) {
+	if len(keys) == 0 {
+		fmt.Println("No API keys have been issued yet.")
+		return
+	}
+
+	formatMs := func(ms int64) string {
+		return time.UnixMilli(ms).Format(time.DateTime)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tTIER\tCREATED\tSTATUS\tREQUESTS\tLAST USED\tENDPOINTS")
+
+	for _, k := range keys {
+		status := "active"
+		if k.Revoked() {
+			status = "revoked " + formatMs(*k.RevokedAt)
+		}
+
+		requests, lastUsed, endpoints := "0", "never", "-"
+		if usage, err := getUsage(k.ID); err == nil {
+			requests = fmt.Sprint(usage.Total)
+			lastUsed = formatMs(usage.LastUsed)
+
+			var parts []string
+			for _, endpoint := range slices.Sorted(maps.Keys(usage.Endpoints)) {
+				parts = append(parts, fmt.Sprintf("%s=%d", endpoint, usage.Endpoints[endpoint]))
+			}
+			if len(parts) > 0 {
+				endpoints = strings.Join(parts, " ")
+			}
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			k.ID, k.Name, k.Tier, formatMs(k.CreatedAt), status, requests, lastUsed, endpoints,
+		)
+	}
+
+	tw.Flush()
+}
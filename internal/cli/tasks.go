@@ -0,0 +1,133 @@
+package cli
+
+import (
+	"emcsrw/internal/database"
+	"emcsrw/internal/shared"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+const TASKS_USAGE = "Usage: go run . tasks [name]"
+
+// How many of the most recent runs are shown when inspecting a single task.
+const TASKS_HISTORY_SHOWN = 15
+
+// Shows the state of the bot's scheduled tasks, or the recent runs of a single task if a name is given.
+//
+// Read from the DB files the bot writes, so this works from anywhere the bot's db folder is. Next runs and
+// whether a task is paused come from the bot's last heartbeat, which will be out of date if it isn't running.
+func Tasks(args []string) error {
+	mdb := database.TryInit(shared.ACTIVE_MAP)
+
+	runStore, err := database.OpenStore(mdb, database.TASK_RUNS_STORE)
+	if err != nil {
+		return err
+	}
+	statusStore, err := database.OpenStore(mdb, database.BOT_STATUS_STORE)
+	if err != nil {
+		return err
+	}
+
+	scheduled := map[string]database.ScheduledTask{}
+	if status, err := statusStore.Get(database.BOT_STATUS_KEY); err == nil {
+		scheduled = lo.SliceToMap(status.Tasks, func(t database.ScheduledTask) (string, database.ScheduledTask) {
+			return t.Name, t
+		})
+
+		if age := time.Since(time.UnixMilli(status.UpdatedAt)); age > time.Minute {
+			fmt.Printf("WARN: The bot last reported its status %s ago, it may not be running.\n\n", age.Round(time.Second))
+		}
+	} else {
+		fmt.Print("WARN: The bot has never reported its status, only past runs can be shown.\n\n")
+	}
+
+	if len(args) > 0 {
+		run, err := runStore.Get(args[0])
+		if err != nil {
+			return fmt.Errorf("no runs recorded for task '%s'. %s", args[0], TASKS_USAGE)
+		}
+
+		printTaskHistory(args[0], run.History)
+		return nil
+	}
+
+	// Includes tasks that are scheduled but never ran, and ones that ran before but are no longer scheduled.
+	runs := runStore.Entries()
+	names := lo.Union(slices.Collect(maps.Keys(runs)), slices.Collect(maps.Keys(scheduled)))
+	slices.Sort(names)
+
+	if len(names) == 0 {
+		fmt.Println("No tasks have been scheduled or run yet.")
+		return nil
+	}
+
+	printTasks(names, runs, scheduled)
+	return nil
+}
+
+func formatMs(ms int64) string {
+	if ms == 0 {
+		return "-"
+	}
+
+	return time.UnixMilli(ms).Format(time.DateTime)
+}
+
+func printTasks(names []string, runs map[string]database.TaskRun, scheduled map[string]database.ScheduledTask) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSCHEDULE\tSTATUS\tLAST RUN\tDURATION\tAVG\tNEXT RUN\tFAILS IN A ROW\tLAST ERROR")
+
+	for _, name := range names {
+		run, task := runs[name], scheduled[name]
+
+		status := "ok"
+		switch {
+		case task.Name == "":
+			status = "unknown" // not in the last heartbeat
+		case task.Paused:
+			status = "paused"
+		case task.Running:
+			status = "running"
+		case run.LastError != "":
+			status = "failing"
+		case run.LastRun == 0:
+			status = "pending"
+		}
+
+		schedule := lo.Ternary(task.Schedule == "", "-", task.Schedule)
+		lastErr := lo.Ternary(run.LastError == "", "-", lo.Ellipsis(run.LastError, 80))
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\n",
+			name, schedule, status, formatMs(run.LastRun),
+			time.Duration(run.LastDuration)*time.Millisecond, time.Duration(task.AvgDuration)*time.Millisecond,
+			formatMs(task.NextRun), run.ConsecutiveFailures, lastErr,
+		)
+	}
+
+	tw.Flush()
+}
+
+func printTaskHistory(name string, runs []database.TaskRunRecord) {
+	failed := lo.CountBy(runs, func(r database.TaskRunRecord) bool { return r.Error != "" })
+	fmt.Printf("%s: %d recorded run(s), %d failed.\n\n", name, len(runs), failed)
+
+	if len(runs) > TASKS_HISTORY_SHOWN {
+		runs = runs[len(runs)-TASKS_HISTORY_SHOWN:]
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STARTED\tDURATION\tRESULT")
+
+	for _, r := range slices.Backward(runs) {
+		result := lo.Ternary(r.Error == "", "ok", "error: "+r.Error)
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", formatMs(r.Start), time.Duration(r.Duration)*time.Millisecond, result)
+	}
+
+	tw.Flush()
+}
@@ -0,0 +1,137 @@
+package cli
+
+import (
+	"emcsrw/internal/database"
+	"emcsrw/internal/shared"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const WEBHOOK_USAGE = "Usage: go run . webhook [create <url> <events>|delete <id>|list|deadletters [id]|retry [id]]"
+
+// Manages outgoing webhooks from the command line. Useful when the bot isn't running.
+//
+// Written straight to the DB files, the bot picks up changes on its next delivery run.
+func Webhook(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("missing webhook subcommand. %s", WEBHOOK_USAGE)
+	}
+
+	mdb := database.TryInit(shared.ACTIVE_MAP)
+	hookStore, err := database.OpenStore(mdb, database.WEBHOOKS_STORE)
+	if err != nil {
+		return err
+	}
+
+	// Optional for deadletters and retry, where no ID means every webhook.
+	webhookID := ""
+	if len(args) > 1 {
+		webhookID = args[1]
+	}
+
+	switch args[0] {
+	case "create":
+		if len(args) < 3 {
+			return fmt.Errorf("missing url or events. %s", WEBHOOK_USAGE)
+		}
+
+		events, err := database.ParseWebhookEvents(strings.Join(args[2:], ","))
+		if err != nil {
+			return err
+		}
+
+		hook, err := database.CreateWebhook(hookStore, args[1], events, "cli")
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Created webhook %s for %s receiving %s.\n\n\t%s\n\nDeliveries are signed with this secret in the %s header.\n",
+			hook.ID, hook.URL, strings.Join(hook.Events, ", "), hook.Secret, database.WEBHOOK_SIGNATURE_HEADER,
+		)
+	case "delete":
+		if webhookID == "" {
+			return fmt.Errorf("missing webhook id. %s", WEBHOOK_USAGE)
+		}
+
+		hook, err := database.DeleteWebhook(mdb, hookStore, webhookID)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Deleted webhook %s (%s).\n", hook.ID, hook.URL)
+	case "list":
+		deliveryStore, err := database.OpenStore(mdb, database.WEBHOOK_DELIVERIES_STORE)
+		if err != nil {
+			return err
+		}
+
+		printWebhooks(database.ListWebhooks(hookStore), deliveryStore.Values())
+	case "deadletters":
+		deliveryStore, err := database.OpenStore(mdb, database.WEBHOOK_DELIVERIES_STORE)
+		if err != nil {
+			return err
+		}
+
+		printDeadLetters(database.DeadWebhookDeliveries(deliveryStore, webhookID))
+	case "retry":
+		count, err := database.RetryDeadWebhookDeliveries(mdb, webhookID, time.Now())
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Requeued %d dead deliveries.\n", count)
+	default:
+		return fmt.Errorf("unknown webhook subcommand: %s. %s", args[0], WEBHOOK_USAGE)
+	}
+
+	return nil
+}
+
+func printWebhooks(hooks []database.Webhook, deliveries []database.WebhookDelivery) {
+	if len(hooks) == 0 {
+		fmt.Println("No webhooks have been created yet.")
+		return
+	}
+
+	pending, dead := make(map[string]int), make(map[string]int)
+	for _, d := range deliveries {
+		if d.Status == database.WebhookDead {
+			dead[d.WebhookID]++
+		} else {
+			pending[d.WebhookID]++
+		}
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tURL\tEVENTS\tCREATED\tPENDING\tDEAD")
+
+	for _, h := range hooks {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%d\n",
+			h.ID, h.URL, strings.Join(h.Events, ","), time.UnixMilli(h.CreatedAt).Format(time.DateTime), pending[h.ID], dead[h.ID],
+		)
+	}
+
+	tw.Flush()
+}
+
+func printDeadLetters(dead []database.WebhookDelivery) {
+	if len(dead) == 0 {
+		fmt.Println("There are no dead deliveries.")
+		return
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "EVENT\tWEBHOOK\tTYPE\tGAVE UP\tATTEMPTS\tLAST ERROR")
+
+	for _, d := range dead {
+		fmt.Fprintf(tw, "%s\t%s\t%s.%s\t%s\t%d\t%s\n",
+			d.Event.ID, d.WebhookID, d.Event.Topic, d.Event.Type,
+			time.UnixMilli(d.UpdatedAt).Format(time.DateTime), d.Attempts, d.LastError,
+		)
+	}
+
+	tw.Flush()
+}
@@ -161,6 +161,24 @@ func (a *Alliance) QueryAllNations(alliances []Alliance, nationStore *store.Stor
 	return merged
 }
 
+// Computes how territorially connected the towns of every nation in this alliance (including puppets) are.
+func (a *Alliance) Contiguity(
+	alliances []Alliance,
+	nationStore *store.Store[oapi.NationInfo],
+	townStore *store.Store[oapi.TownInfo],
+) Contiguity {
+	nationIds := sets.New[string]()
+	for _, entry := range a.QueryAllNations(alliances, nationStore) {
+		nationIds.Add(entry.Nation.UUID)
+	}
+
+	towns := townStore.FindAll(func(t oapi.TownInfo) bool {
+		return t.Nation.UUID != nil && nationIds.Has(*t.Nation.UUID)
+	})
+
+	return ComputeContiguity(towns)
+}
+
 // Attempts to set the alliance leaders given their IGNs.
 //
 // The leaders are stored in UUID form if they exist, otherwise the IGN will be added to the `invalid` output slice.
@@ -293,7 +311,7 @@ func GetRankedAlliances(
 		s := stats[i]
 
 		// Scores could be in the millions, scale down to ensure its readable.
-		score := s.Residents*w.Residents + s.Towns*w.Towns + s.Nations*w.Nations + s.LandValue*w.LandValue
+		score := w.Score(s)
 		ranked[i] = AllianceRankInfo{
 			UUID:  a.UUID,
 			Score: score,
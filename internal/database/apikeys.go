@@ -0,0 +1,162 @@
+package database
+
+import (
+	"cmp"
+	"crypto/rand"
+	"crypto/sha256"
+	"emcsrw/internal/database/store"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Every key starts with this so it can be easily recognised (and picked up by secret scanners) if leaked.
+const API_KEY_PREFIX = "emcs_"
+
+type ApiKeyTier string
+
+const (
+	ApiTierAnonymous ApiKeyTier = "anonymous" // Requests without a key. Cannot be issued.
+	ApiTierStandard  ApiKeyTier = "standard"
+	ApiTierPartner   ApiKeyTier = "partner"
+)
+
+// Tiers that can be given to a key when issuing one.
+var API_KEY_TIERS = []ApiKeyTier{ApiTierStandard, ApiTierPartner}
+
+// An API key for the Custom API. The key itself is never stored, only its SHA-256 hash (which is the store key).
+type ApiKey struct {
+	ID        string     `json:"id"` // Short public identifier used to refer to the key, e.g. when revoking it.
+	Name      string     `json:"name"`
+	Tier      ApiKeyTier `json:"tier"`
+	CreatedBy string     `json:"createdBy"` // Discord user ID of whoever issued it, or "cli".
+	CreatedAt int64      `json:"createdAt"` // Unix timestamp (ms)
+	RevokedAt *int64     `json:"revokedAt"` // Unix timestamp (ms). Nil if still active.
+}
+
+func (k ApiKey) Revoked() bool {
+	return k.RevokedAt != nil
+}
+
+// Per-key usage counters. Only ever written by the Custom API.
+type ApiKeyUsage struct {
+	Total     uint64            `json:"total"`
+	Endpoints map[string]uint64 `json:"endpoints"`
+	LastUsed  int64             `json:"lastUsed"` // Unix timestamp (ms)
+}
+
+// API keys and their usage are read and written by multiple processes (bot, API and CLI), so unlike other stores
+// they are not assigned to the DB. Each process opens them itself when needed, meaning a DB flush can never
+// overwrite a newer version of the file with a stale in-memory copy.
+//
+// Opening a store always loads it fresh from file.
+func OpenStore[T any](db *Database, storeDef StoreDefinition[T]) (*store.Store[T], error) {
+	return store.New[T](filepath.Join(db.dirPath, storeDef.Name+".json"))
+}
+
+func HashApiKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Generates a random 8 character hex ID that isn't taken yet. IDs are public, so unlike
+// using part of a secret as the ID, they give nothing away about what they identify.
+func newPublicID(taken func(id string) bool) (string, error) {
+	b := make([]byte, 4)
+	for range 10 {
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+
+		if id := hex.EncodeToString(b); !taken(id) {
+			return id, nil
+		}
+	}
+
+	return "", fmt.Errorf("failed to generate an unused id")
+}
+
+func ParseApiKeyTier(s string) (ApiKeyTier, bool) {
+	tier := ApiKeyTier(strings.ToLower(strings.TrimSpace(s)))
+	return tier, slices.Contains(API_KEY_TIERS, tier)
+}
+
+// Generates a new key and saves its hash to the store, returning the full key.
+// This is the only time the full key is available so it must be shown to whoever requested it.
+func IssueApiKey(keyStore *store.Store[ApiKey], name string, tier ApiKeyTier, createdBy string) (string, *ApiKey, error) {
+	if !slices.Contains(API_KEY_TIERS, tier) {
+		return "", nil, fmt.Errorf("invalid tier '%s'", tier)
+	}
+
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+
+	id, err := newPublicID(func(id string) bool {
+		_, err := keyStore.Find(func(k ApiKey) bool { return k.ID == id })
+		return err == nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	key := API_KEY_PREFIX + hex.EncodeToString(secret)
+	apiKey := ApiKey{
+		ID:        id,
+		Name:      name,
+		Tier:      tier,
+		CreatedBy: createdBy,
+		CreatedAt: time.Now().UnixMilli(),
+	}
+
+	keyStore.Set(HashApiKey(key), apiKey)
+	if err := keyStore.WriteSnapshot(); err != nil {
+		return "", nil, err
+	}
+
+	return key, &apiKey, nil
+}
+
+// Revokes the key with the given ID. Revoked keys are kept so their usage can still be looked up.
+//
+// Keys issued before IDs were checked for collisions could share one, so every active key with the ID is revoked.
+func RevokeApiKey(keyStore *store.Store[ApiKey], id string) (*ApiKey, error) {
+	var revoked *ApiKey
+	found := false
+
+	now := time.Now().UnixMilli()
+	for hash, k := range keyStore.Entries() {
+		if k.ID != id {
+			continue
+		}
+
+		found = true
+		if k.Revoked() {
+			continue
+		}
+
+		k.RevokedAt = &now
+		keyStore.Set(hash, k)
+		revoked = &k
+	}
+
+	if !found {
+		return nil, fmt.Errorf("no key exists with id %s", id)
+	}
+	if revoked == nil {
+		return nil, fmt.Errorf("key %s is already revoked", id)
+	}
+
+	return revoked, keyStore.WriteSnapshot()
+}
+
+// All keys, newest first.
+func ListApiKeys(keyStore *store.Store[ApiKey]) []ApiKey {
+	return keyStore.ValuesSorted(func(a, b ApiKey) int {
+		return cmp.Compare(b.CreatedAt, a.CreatedAt)
+	})
+}
@@ -0,0 +1,202 @@
+package database
+
+import (
+	"cmp"
+	"emcsrw/pkg/api/oapi"
+	"slices"
+
+	"github.com/samber/lo"
+)
+
+// Length of a single chunk edge in blocks.
+const CHUNK_EDGE_BLOCKS = 16
+
+// A single entity (town or nation) that shares a border with another, along with the length of said border.
+type Neighbour struct {
+	UUID        string `json:"uuid"`
+	Name        string `json:"name"`
+	SharedEdges int    `json:"sharedEdges"` // Amount of chunk edges touching the other entity.
+}
+
+// Length of the shared border in blocks.
+func (n Neighbour) BorderLength() int {
+	return n.SharedEdges * CHUNK_EDGE_BLOCKS
+}
+
+// Adjacency graph between towns and nations computed from town blocks.
+//
+// Two towns are considered neighbours if any of their chunks share an edge (diagonals do not count).
+// Two nations are neighbours if any of their towns are, where towns within the same nation are ignored.
+type BorderGraph struct {
+	Towns   map[string]map[string]int // Town UUID -> neighbouring town UUID -> shared edges
+	Nations map[string]map[string]int // Nation UUID -> neighbouring nation UUID -> shared edges
+
+	townNames   map[string]string // Town UUID -> name
+	nationNames map[string]string // Nation UUID -> name
+	townNation  map[string]string // Town UUID -> nation UUID (only for towns with a nation)
+}
+
+func addEdge(graph map[string]map[string]int, a, b string) {
+	if graph[a] == nil {
+		graph[a] = make(map[string]int)
+	}
+	if graph[b] == nil {
+		graph[b] = make(map[string]int)
+	}
+
+	graph[a][b]++
+	graph[b][a]++
+}
+
+// Computes the adjacency graph of the given towns by walking every chunk once and checking
+// only its +X and +Z neighbours, meaning each shared edge is counted exactly once.
+func ComputeBorderGraph(towns []oapi.TownInfo) BorderGraph {
+	g := BorderGraph{
+		Towns:       make(map[string]map[string]int),
+		Nations:     make(map[string]map[string]int),
+		townNames:   make(map[string]string, len(towns)),
+		nationNames: make(map[string]string),
+		townNation:  make(map[string]string),
+	}
+
+	owners := make(map[[2]int]string) // Chunk -> town UUID
+	for _, t := range towns {
+		g.townNames[t.UUID] = t.Name
+		if t.Nation.UUID != nil {
+			g.townNation[t.UUID] = *t.Nation.UUID
+			g.nationNames[*t.Nation.UUID] = lo.FromPtr(t.Nation.Name)
+		}
+
+		for _, tb := range t.Coordinates.TownBlocks {
+			if len(tb) >= 2 {
+				owners[[2]int{tb[0], tb[1]}] = t.UUID
+			}
+		}
+	}
+
+	for chunk, owner := range owners {
+		for _, adj := range [2][2]int{{chunk[0] + 1, chunk[1]}, {chunk[0], chunk[1] + 1}} {
+			other, ok := owners[adj]
+			if !ok || other == owner {
+				continue
+			}
+
+			addEdge(g.Towns, owner, other)
+
+			nationA, okA := g.townNation[owner]
+			nationB, okB := g.townNation[other]
+			if okA && okB && nationA != nationB {
+				addEdge(g.Nations, nationA, nationB)
+			}
+		}
+	}
+
+	return g
+}
+
+func toNeighbours(edges map[string]int, names map[string]string) []Neighbour {
+	neighbours := make([]Neighbour, 0, len(edges))
+	for uuid, count := range edges {
+		neighbours = append(neighbours, Neighbour{UUID: uuid, Name: names[uuid], SharedEdges: count})
+	}
+
+	// Longest border first, then alphabetical so the output is stable.
+	slices.SortFunc(neighbours, func(a, b Neighbour) int {
+		if c := cmp.Compare(b.SharedEdges, a.SharedEdges); c != 0 {
+			return c
+		}
+
+		return cmp.Compare(a.Name, b.Name)
+	})
+
+	return neighbours
+}
+
+// Gets all towns bordering the town with the given UUID, longest border first.
+func (g BorderGraph) TownNeighbours(townUUID string) []Neighbour {
+	return toNeighbours(g.Towns[townUUID], g.townNames)
+}
+
+// Gets all nations bordering the nation with the given UUID, longest border first.
+func (g BorderGraph) NationNeighbours(nationUUID string) []Neighbour {
+	return toNeighbours(g.Nations[nationUUID], g.nationNames)
+}
+
+// Total length (in chunk edges) of the border this nation shares with all other nations.
+func (g BorderGraph) NationBorderEdges(nationUUID string) (total int) {
+	for _, count := range g.Nations[nationUUID] {
+		total += count
+	}
+
+	return
+}
+
+// Splits the given towns into groups of towns that are connected to each other through shared borders.
+// Any town UUID not present in this graph will end up in a group of its own.
+//
+// The groups are returned largest first, so if len(groups) == 1, all of the towns form a single contiguous territory.
+func (g BorderGraph) TownComponents(townUUIDs []string) [][]string {
+	include := make(map[string]bool, len(townUUIDs))
+	for _, uuid := range townUUIDs {
+		include[uuid] = true
+	}
+
+	visited := make(map[string]bool, len(townUUIDs))
+	components := [][]string{}
+	for _, start := range townUUIDs {
+		if visited[start] {
+			continue
+		}
+
+		// Iterative DFS restricted to the included towns.
+		component := []string{}
+		stack := []string{start}
+		visited[start] = true
+		for len(stack) > 0 {
+			cur := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			component = append(component, cur)
+
+			for next := range g.Towns[cur] {
+				if include[next] && !visited[next] {
+					visited[next] = true
+					stack = append(stack, next)
+				}
+			}
+		}
+
+		components = append(components, component)
+	}
+
+	slices.SortFunc(components, func(a, b []string) int {
+		return cmp.Compare(len(b), len(a))
+	})
+
+	return components
+}
+
+// Summary of how territorially connected a group of towns is, such as all towns within an alliance.
+type Contiguity struct {
+	Regions      int  `json:"regions"`      // Amount of separate, disconnected regions of claims.
+	LargestTowns int  `json:"largestTowns"` // Amount of towns within the largest region.
+	TotalTowns   int  `json:"totalTowns"`
+	Contiguous   bool `json:"contiguous"` // Whether every town is connected, i.e. Regions == 1.
+}
+
+// Computes the contiguity of the given towns. Only the towns themselves are used to build the graph,
+// meaning a path through a town outside this group does NOT connect two regions.
+func ComputeContiguity(towns []oapi.TownInfo) Contiguity {
+	uuids := make([]string, 0, len(towns))
+	for _, t := range towns {
+		uuids = append(uuids, t.UUID)
+	}
+
+	components := ComputeBorderGraph(towns).TownComponents(uuids)
+	c := Contiguity{Regions: len(components), TotalTowns: len(towns)}
+	if len(components) > 0 {
+		c.LargestTowns = len(components[0])
+	}
+
+	c.Contiguous = c.Regions == 1
+	return c
+}
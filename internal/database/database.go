@@ -10,6 +10,7 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 )
 
 // Looks a lil pointless, but this wraps the store's name together with its type
@@ -36,16 +37,35 @@ func NewStoreDefinition[T any](name string) StoreDefinition[T] {
 // Then assign it to a DB in TryInit() below.
 
 var (
-	FALLING_TOWNS_STORE = NewStoreDefinition[FallingTown]("falling-towns") // Key is town UUID
-	TOWNS_STORE         = NewStoreDefinition[oapi.TownInfo]("towns")       // Key is town UUID
-	NATIONS_STORE       = NewStoreDefinition[oapi.NationInfo]("nations")   // Key is nation UUID
-	ENTITIES_STORE      = NewStoreDefinition[oapi.EntityList]("entities")  // Keys: residentlist, townlesslist
-	SERVER_STORE        = NewStoreDefinition[oapi.ServerInfo]("server")    // Key is "info"
-	PLAYERS_STORE       = NewStoreDefinition[BasicPlayer]("players")       // Key is player UUID
-	ALLIANCES_STORE     = NewStoreDefinition[Alliance]("alliances")        // Key is alliance UUID
-	NEWS_STORE          = NewStoreDefinition[NewsEntry]("news")            // Key is a Discord message ID
-	USAGE_USERS_STORE   = NewStoreDefinition[UserUsage]("usage-users")     // TODO: This should not be attached to a store but live in /db.
-	//SSE_STORE         = NewStoreDefinition[UserUsage]("sse")
+	FALLING_TOWNS_STORE = NewStoreDefinition[FallingTown]("falling-towns")  // Key is town UUID
+	TOWNS_STORE         = NewStoreDefinition[oapi.TownInfo]("towns")        // Key is town UUID
+	NATIONS_STORE       = NewStoreDefinition[oapi.NationInfo]("nations")    // Key is nation UUID
+	ENTITIES_STORE      = NewStoreDefinition[oapi.EntityList]("entities")   // Keys: residentlist, townlesslist, onlinelist
+	SERVER_STORE        = NewStoreDefinition[oapi.ServerInfo]("server")     // Key is "info"
+	PLAYERS_STORE       = NewStoreDefinition[BasicPlayer]("players")        // Key is player UUID
+	ALLIANCES_STORE     = NewStoreDefinition[Alliance]("alliances")         // Key is alliance UUID
+	NEWS_STORE          = NewStoreDefinition[NewsEntry]("news")             // Key is a Discord message ID
+	USAGE_USERS_STORE   = NewStoreDefinition[UserUsage]("usage-users")      // TODO: This should not be attached to a store but live in /db.
+	PLAYER_TRAILS_STORE = NewStoreDefinition[PlayerTrail]("player-trails")  // Key is player UUID
+	STATS_HISTORY_STORE = NewStoreDefinition[StatsHistory]("stats-history") // Key is HistoryKey, like "town:<uuid>"
+	STREAM_EVENTS_STORE = NewStoreDefinition[StreamEvent]("stream-events")  // Key is the event ID
+	TASK_RUNS_STORE     = NewStoreDefinition[TaskRun]("task-runs")          // Key is the scheduled task name
+	BOT_STATUS_STORE    = NewStoreDefinition[BotStatus]("bot-status")       // Key is BOT_STATUS_KEY
+
+	NEW_DAY_SNAPSHOTS_STORE = NewStoreDefinition[NewDaySnapshot]("new-day-snapshots") // Keys: NEW_DAY_PRE_KEY, NEW_DAY_POST_KEY
+	NEW_DAY_REPORTS_STORE   = NewStoreDefinition[NewDayReport]("new-day-reports")     // Key is the date of the new day, see NEW_DAY_REPORT_KEY_FORMAT
+	GUILD_SETTINGS_STORE    = NewStoreDefinition[GuildSettings]("guild-settings")     // Key is the Discord guild ID
+	WATCHLISTS_STORE        = NewStoreDefinition[Watchlist]("watchlists")             // Key is the Discord user ID
+	VOTEPARTY_STORE         = NewStoreDefinition[VotePartyState]("voteparty")         // Key is VOTEPARTY_KEY
+	TOWN_FLOW_LOG_STORE     = NewStoreDefinition[TownFlowDay]("town-flow-log")        // Key is the date (UTC), see TOWN_FLOW_LOG_KEY_FORMAT
+	DIGESTS_STORE           = NewStoreDefinition[Digest]("digests")                   // Key is the period and date of the new day, see DigestKey
+
+	// Not assigned in TryInit, use OpenStore instead. See OpenStore for why.
+	API_KEYS_STORE      = NewStoreDefinition[ApiKey]("api-keys")           // Key is the SHA-256 hash of the API key
+	API_KEY_USAGE_STORE = NewStoreDefinition[ApiKeyUsage]("api-key-usage") // Key is the API key ID
+
+	WEBHOOKS_STORE           = NewStoreDefinition[Webhook]("webhooks")                   // Key is the webhook ID
+	WEBHOOK_DELIVERIES_STORE = NewStoreDefinition[WebhookDelivery]("webhook-deliveries") // Key is the event and webhook ID, see webhookDeliveryID
 )
 
 // =============================================================
@@ -105,6 +125,9 @@ func (db *Database) Flush() error {
 	db.flushMu.Lock()
 	defer db.flushMu.Unlock()
 
+	start := time.Now()
+	defer flushDuration.With(db.Name()).ObserveSince(start)
+
 	for name, s := range db.stores {
 		if err := s.WriteSnapshot(); err != nil {
 			errs = append(errs, fmt.Errorf("store %s: %w", name, err))
@@ -119,6 +142,19 @@ func (db *Database) Flush() error {
 	return nil
 }
 
+// The amount of entries in each store assigned to this DB, keyed by store name.
+func (db *Database) StoreCounts() map[string]int {
+	db.storeMu.RLock()
+	defer db.storeMu.RUnlock()
+
+	counts := make(map[string]int, len(db.stores))
+	for name, s := range db.stores {
+		counts[name] = s.Count()
+	}
+
+	return counts
+}
+
 func Register(name string, mdb *Database) {
 	mu.Lock()
 	defer mu.Unlock()
@@ -142,7 +178,7 @@ func TryInit(mapName string) *Database {
 
 	// Define all stores we want to exist on this new database.
 	// If a store does not exist, it is created under the ./db/<mapName> dir.
-	AssignStore(mdb, SERVER_STORE)
+	SyncNewDayClock(AssignStore(mdb, SERVER_STORE)) // so the API knows it too, the bot updates it on every fetch
 	AssignStore(mdb, FALLING_TOWNS_STORE)
 	AssignStore(mdb, TOWNS_STORE)
 	AssignStore(mdb, NATIONS_STORE)
@@ -151,6 +187,18 @@ func TryInit(mapName string) *Database {
 	AssignStore(mdb, ALLIANCES_STORE)
 	AssignStore(mdb, NEWS_STORE)
 	AssignStore(mdb, USAGE_USERS_STORE)
+	AssignStore(mdb, PLAYER_TRAILS_STORE)
+	AssignStore(mdb, STATS_HISTORY_STORE)
+	AssignStore(mdb, STREAM_EVENTS_STORE)
+	AssignStore(mdb, TASK_RUNS_STORE)
+	AssignStore(mdb, BOT_STATUS_STORE)
+	AssignStore(mdb, NEW_DAY_SNAPSHOTS_STORE)
+	AssignStore(mdb, NEW_DAY_REPORTS_STORE)
+	AssignStore(mdb, GUILD_SETTINGS_STORE)
+	AssignStore(mdb, WATCHLISTS_STORE)
+	AssignStore(mdb, VOTEPARTY_STORE)
+	AssignStore(mdb, TOWN_FLOW_LOG_STORE)
+	AssignStore(mdb, DIGESTS_STORE)
 	//AssignStore(mdb, USAGE_LEADERBOARD_STORE)
 
 	logutil.Printf(logutil.HIDDEN, "DEBUG | Initialized database for map '%s'.\n", mapName)
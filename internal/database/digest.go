@@ -0,0 +1,283 @@
+package database
+
+import (
+	"cmp"
+	"emcsrw/internal/database/store"
+	"emcsrw/pkg/api/oapi"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+const TOWN_FLOW_LOG_KEY_FORMAT = time.DateOnly
+const TOWN_FLOW_LOG_RETENTION = 14 * 24 * time.Hour // Must cover the longest DigestPeriod.
+const DIGEST_TOP_N = 5                              // Amount of gainers, losers, rank changes and headlines in a digest.
+const DIGEST_RETENTION = 90 * 24 * time.Hour        // How long posted digests are kept for.
+
+type DigestPeriod string
+
+const (
+	DigestDaily  DigestPeriod = "daily"
+	DigestWeekly DigestPeriod = "weekly"
+)
+
+func (p DigestPeriod) Duration() time.Duration {
+	if p == DigestWeekly {
+		return 7 * 24 * time.Hour
+	}
+
+	return 24 * time.Hour
+}
+
+// Key of a scheduled digest in the digests store, like "weekly:2026-01-05".
+func DigestKey(period DigestPeriod, newDay time.Time) string {
+	return string(period) + ":" + newDay.UTC().Format(TOWN_FLOW_LOG_KEY_FORMAT)
+}
+
+type DigestTown struct {
+	oapi.Entity
+	Nation string `json:"nation,omitempty"` // Name of its nation at the time, if it had one.
+	At     int64  `json:"at"`               // Unix timestamp (ms) of when DataUpdate noticed it.
+}
+
+// Towns created, deleted and ruined on a single (UTC) day. Split by day so old ones are easy to drop.
+type TownFlowDay struct {
+	Created []DigestTown `json:"created"`
+	Deleted []DigestTown `json:"deleted"`
+	Ruined  []DigestTown `json:"ruined"`
+}
+
+// Adds towns to the log of the day that at falls on, dropping days older than TOWN_FLOW_LOG_RETENTION.
+// Each town's At should already be set.
+func AppendTownFlowLog(logStore *store.Store[TownFlowDay], at time.Time, created, deleted, ruined []DigestTown) {
+	if len(created) == 0 && len(deleted) == 0 && len(ruined) == 0 {
+		return
+	}
+
+	key := at.UTC().Format(TOWN_FLOW_LOG_KEY_FORMAT)
+
+	day := TownFlowDay{}
+	if existing, err := logStore.Get(key); err == nil {
+		day = *existing
+	}
+
+	day.Created = append(day.Created, created...)
+	day.Deleted = append(day.Deleted, deleted...)
+	day.Ruined = append(day.Ruined, ruined...)
+	logStore.Set(key, day)
+
+	cutoff := at.UTC().Add(-TOWN_FLOW_LOG_RETENTION).Format(TOWN_FLOW_LOG_KEY_FORMAT)
+	for _, k := range logStore.Keys() {
+		if k < cutoff { // dates compare correctly as strings
+			logStore.Delete(k)
+		}
+	}
+}
+
+// Drops digests of new days older than DIGEST_RETENTION.
+func PruneDigests(digestStore *store.Store[Digest], now time.Time) {
+	cutoff := now.UTC().Add(-DIGEST_RETENTION).Format(TOWN_FLOW_LOG_KEY_FORMAT)
+	for _, k := range digestStore.Keys() {
+		if _, date, ok := strings.Cut(k, ":"); ok && date < cutoff {
+			digestStore.Delete(k)
+		}
+	}
+}
+
+type NationResidentChange struct {
+	oapi.Entity
+	Before int `json:"before"`
+	After  int `json:"after"`
+}
+
+func (c NationResidentChange) Change() int {
+	return c.After - c.Before
+}
+
+type AllianceRankChange struct {
+	Identifier string `json:"identifier"`
+	Before     int    `json:"before"`
+	After      int    `json:"after"`
+}
+
+// A summary of everything that happened between From and To.
+type Digest struct {
+	Period DigestPeriod `json:"period"`
+	From   int64        `json:"from"` // Unix timestamp (ms)
+	To     int64        `json:"to"`   // Unix timestamp (ms)
+
+	Created []DigestTown `json:"created"`
+	Deleted []DigestTown `json:"deleted"`
+	Ruined  []DigestTown `json:"ruined"`
+
+	NetResidents int                    `json:"netResidents"` // Across every nation, including ones created/deleted in the period.
+	Gainers      []NationResidentChange `json:"gainers"`      // Most residents gained first.
+	Losers       []NationResidentChange `json:"losers"`       // Most residents lost first.
+	RankChanges  []AllianceRankChange   `json:"rankChanges"`  // Biggest moves first.
+	News         []NewsEntry            `json:"news"`         // Newest first.
+}
+
+// The stores a digest is computed from.
+type DigestSources struct {
+	TownFlowLog *store.Store[TownFlowDay]
+	History     *store.Store[StatsHistory]
+	Nations     *store.Store[oapi.NationInfo]
+	Alliances   *store.Store[Alliance]
+	News        *store.Store[NewsEntry]
+}
+
+func GetDigestSources(mdb *Database) (src DigestSources, err error) {
+	if src.TownFlowLog, err = GetStore(mdb, TOWN_FLOW_LOG_STORE); err != nil {
+		return
+	}
+	if src.History, err = GetStore(mdb, STATS_HISTORY_STORE); err != nil {
+		return
+	}
+	if src.Nations, err = GetStore(mdb, NATIONS_STORE); err != nil {
+		return
+	}
+	if src.Alliances, err = GetStore(mdb, ALLIANCES_STORE); err != nil {
+		return
+	}
+
+	src.News, err = GetStore(mdb, NEWS_STORE)
+	return
+}
+
+// Summarises the period leading up to `to`. Resident changes and alliance ranks compare
+// the latest stats history sample at the start of the period to the current data.
+func ComputeDigest(src DigestSources, period DigestPeriod, to time.Time) Digest {
+	from := to.Add(-period.Duration())
+	d := Digest{Period: period, From: from.UnixMilli(), To: to.UnixMilli()}
+
+	//#region Town flow
+	fromKey := from.UTC().Format(TOWN_FLOW_LOG_KEY_FORMAT)
+	toKey := to.UTC().Format(TOWN_FLOW_LOG_KEY_FORMAT)
+	inPeriod := func(t DigestTown, _ int) bool { return t.At > d.From && t.At <= d.To }
+
+	for key, day := range src.TownFlowLog.Entries() {
+		if key < fromKey || key > toKey {
+			continue
+		}
+
+		d.Created = append(d.Created, lo.Filter(day.Created, inPeriod)...)
+		d.Deleted = append(d.Deleted, lo.Filter(day.Deleted, inPeriod)...)
+		d.Ruined = append(d.Ruined, lo.Filter(day.Ruined, inPeriod)...)
+	}
+
+	byName := func(a, b DigestTown) int { return cmp.Compare(a.Name, b.Name) }
+	slices.SortFunc(d.Created, byName)
+	slices.SortFunc(d.Deleted, byName)
+	slices.SortFunc(d.Ruined, byName)
+	//#endregion
+
+	history := src.History.Entries()
+	fromMs := from.UnixMilli()
+
+	//#region Nation residents
+	changes := make(map[string]*NationResidentChange)
+	for key, h := range history {
+		uuid, ok := strings.CutPrefix(key, string(HistoryKindNation)+":")
+		if !ok {
+			continue
+		}
+
+		if s := sampleAt(h, fromMs); s != nil {
+			changes[uuid] = &NationResidentChange{Entity: oapi.Entity{UUID: uuid, Name: h.Name}, Before: s.Residents}
+		}
+	}
+
+	for _, n := range src.Nations.Values() {
+		c, ok := changes[n.UUID]
+		if !ok {
+			c = &NationResidentChange{} // created during the period
+			changes[n.UUID] = c
+		}
+
+		c.Entity = n.Entity
+		c.After = n.NumResidents()
+	}
+
+	all := lo.FilterMap(lo.Values(changes), func(c *NationResidentChange, _ int) (NationResidentChange, bool) {
+		d.NetResidents += c.Change()
+		return *c, c.Change() != 0
+	})
+
+	slices.SortFunc(all, func(a, b NationResidentChange) int {
+		return cmp.Or(cmp.Compare(b.Change(), a.Change()), cmp.Compare(a.Name, b.Name))
+	})
+
+	gainers := lo.Filter(all, func(c NationResidentChange, _ int) bool { return c.Change() > 0 })
+	losers := lo.Filter(all, func(c NationResidentChange, _ int) bool { return c.Change() < 0 })
+	slices.Reverse(losers)
+
+	d.Gainers = gainers[:min(len(gainers), DIGEST_TOP_N)]
+	d.Losers = losers[:min(len(losers), DIGEST_TOP_N)]
+	//#endregion
+
+	//#region Alliance ranks
+	ranked, alliances := GetRankedAlliances(src.Alliances, src.Nations, DEFAULT_ALLIANCE_WEIGHTS)
+
+	// Rank at the start of the period, by the scores recorded back then.
+	type pastScore struct {
+		uuid  uint64
+		score float64
+	}
+
+	past := []pastScore{}
+	for _, a := range alliances {
+		h, ok := history[HistoryKey(HistoryKindAlliance, strconv.FormatUint(a.UUID, 10))]
+		if !ok {
+			continue
+		}
+		if s := sampleAt(h, fromMs); s != nil {
+			past = append(past, pastScore{a.UUID, s.Score})
+		}
+	}
+
+	slices.SortStableFunc(past, func(a, b pastScore) int { return cmp.Compare(b.score, a.score) })
+	for i, p := range past {
+		before, after := i+1, ranked[p.uuid].Rank
+		if after == 0 || before == after {
+			continue
+		}
+
+		a, _ := lo.Find(alliances, func(a Alliance) bool { return a.UUID == p.uuid })
+		d.RankChanges = append(d.RankChanges, AllianceRankChange{Identifier: a.Identifier, Before: before, After: after})
+	}
+
+	slices.SortFunc(d.RankChanges, func(a, b AllianceRankChange) int {
+		absMove := func(c AllianceRankChange) int { return max(c.Before-c.After, c.After-c.Before) }
+		return cmp.Or(cmp.Compare(absMove(b), absMove(a)), cmp.Compare(a.After, b.After))
+	})
+	d.RankChanges = d.RankChanges[:min(len(d.RankChanges), DIGEST_TOP_N)]
+	//#endregion
+
+	//#region News
+	d.News = src.News.FindAll(func(n NewsEntry) bool {
+		return n.Headline != "" && n.Timestamp > fromMs && n.Timestamp <= d.To
+	})
+
+	slices.SortFunc(d.News, func(a, b NewsEntry) int { return cmp.Compare(b.Timestamp, a.Timestamp) })
+	d.News = d.News[:min(len(d.News), DIGEST_TOP_N)]
+	//#endregion
+
+	return d
+}
+
+// The latest sample taken at or before ts, nil if the history starts after it.
+func sampleAt(h StatsHistory, ts int64) *StatsSample {
+	var found *StatsSample
+	for i, s := range h.Samples {
+		if s.Timestamp > ts {
+			break
+		}
+
+		found = &h.Samples[i]
+	}
+
+	return found
+}
@@ -0,0 +1,169 @@
+package database
+
+import (
+	"cmp"
+	"emcsrw/internal/database/store"
+	"emcsrw/pkg/utils/sets"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// A kind of notification the bot posts to channels as it detects it.
+type NotificationFeed string
+
+const (
+	FeedTownFlow   NotificationFeed = "townflow"
+	FeedNationFlow NotificationFeed = "nationflow"
+	FeedPlayerFlow NotificationFeed = "playerflow"
+	FeedVoteParty  NotificationFeed = "voteparty"
+	FeedNewDay     NotificationFeed = "newday"
+	FeedDigest     NotificationFeed = "digest"
+)
+
+var NOTIFICATION_FEEDS = []NotificationFeed{
+	FeedTownFlow, FeedNationFlow, FeedPlayerFlow, FeedVoteParty, FeedNewDay, FeedDigest,
+}
+
+func (f NotificationFeed) Valid() bool {
+	return slices.Contains(NOTIFICATION_FEEDS, f)
+}
+
+// Whether notifications of this feed are about individual towns/nations, and can therefore be filtered by them.
+// Digests summarise the whole server so they aren't either.
+func (f NotificationFeed) Filterable() bool {
+	return f != FeedVoteParty && f != FeedDigest
+}
+
+// Narrows a feed down to only what concerns certain nations. An empty filter lets everything through.
+type FeedFilter struct {
+	Nations  []string `json:"nations,omitempty"`  // UUIDs of nations to notify about.
+	Alliance string   `json:"alliance,omitempty"` // Identifier of an alliance whose nations (including puppets) to notify about.
+}
+
+func (f FeedFilter) Empty() bool {
+	return len(f.Nations) == 0 && f.Alliance == ""
+}
+
+// UUIDs of every nation this filter lets through, nil if it lets everything through.
+// An alliance that no longer exists lets nothing through rather than everything.
+func (f FeedFilter) NationSet(allianceStore *store.Store[Alliance]) sets.Set[string] {
+	if f.Empty() {
+		return nil
+	}
+
+	set := sets.New[string]()
+	set.Add(f.Nations...)
+
+	if f.Alliance != "" {
+		if a, err := allianceStore.Get(strings.ToLower(f.Alliance)); err == nil {
+			set.Add(a.OwnNations.Keys()...)
+			set.Add(a.ChildAlliances(allianceStore.Values()).NationIds().Keys()...)
+		}
+	}
+
+	return set
+}
+
+type FeedSubscription struct {
+	ChannelID string     `json:"channelID"`
+	Filter    FeedFilter `json:"filter,omitzero"`
+	UpdatedBy string     `json:"updatedBy"` // Discord ID of who last changed this subscription.
+	UpdatedAt int64      `json:"updatedAt"` // Unix timestamp (ms)
+}
+
+type GuildSettings struct {
+	GuildID             string                                `json:"guildID"`
+	Feeds               map[NotificationFeed]FeedSubscription `json:"feeds"`
+	VotePartyThresholds []int                                 `json:"votePartyThresholds,omitempty"` // Nil to use VP_DEFAULT_THRESHOLDS.
+}
+
+// A channel that should receive a feed, as configured by a guild.
+type FeedTarget struct {
+	GuildID string
+	FeedSubscription
+}
+
+// Sets (or replaces) where a guild receives feed.
+func SetFeedSubscription(settingsStore *store.Store[GuildSettings], guildID string, feed NotificationFeed, sub FeedSubscription) {
+	sub.UpdatedAt = time.Now().UnixMilli()
+	settingsStore.Update(guildID, func(existing *GuildSettings) (GuildSettings, bool) {
+		settings := GuildSettings{GuildID: guildID}
+		if existing != nil {
+			settings = *existing
+		}
+
+		settings.Feeds = maps.Clone(settings.Feeds) // still shared with the store and FeedTargets callers
+		if settings.Feeds == nil {
+			settings.Feeds = make(map[NotificationFeed]FeedSubscription)
+		}
+
+		settings.Feeds[feed] = sub
+		return settings, true
+	})
+}
+
+// The remaining vote counts at which a guild is notified about the VoteParty.
+// An empty guild ID (the VP_CHANNEL_ID channel) or a guild without its own always gets VP_DEFAULT_THRESHOLDS.
+func GuildVotePartyThresholds(settingsStore *store.Store[GuildSettings], guildID string) []int {
+	if guildID == "" {
+		return VP_DEFAULT_THRESHOLDS
+	}
+
+	settings, err := settingsStore.Get(guildID)
+	if err != nil || len(settings.VotePartyThresholds) == 0 {
+		return VP_DEFAULT_THRESHOLDS
+	}
+
+	return settings.VotePartyThresholds
+}
+
+// Sets the VoteParty thresholds of a guild, or resets them to default if thresholds is empty.
+func SetGuildVotePartyThresholds(settingsStore *store.Store[GuildSettings], guildID string, thresholds []int) {
+	settingsStore.Update(guildID, func(existing *GuildSettings) (GuildSettings, bool) {
+		settings := GuildSettings{GuildID: guildID}
+		if existing != nil {
+			settings = *existing
+		}
+
+		settings.VotePartyThresholds = thresholds
+		return settings, true
+	})
+}
+
+// Stops a guild receiving feed. Returns false if it wasn't receiving it in the first place.
+func RemoveFeedSubscription(settingsStore *store.Store[GuildSettings], guildID string, feed NotificationFeed) (removed bool) {
+	settingsStore.Update(guildID, func(existing *GuildSettings) (GuildSettings, bool) {
+		if existing == nil {
+			return GuildSettings{}, false
+		}
+		if _, removed = existing.Feeds[feed]; !removed {
+			return *existing, true
+		}
+
+		settings := *existing
+		settings.Feeds = maps.Clone(settings.Feeds) // still shared with the store and FeedTargets callers
+		delete(settings.Feeds, feed)
+
+		return settings, len(settings.Feeds) > 0 || len(settings.VotePartyThresholds) > 0
+	})
+
+	return removed
+}
+
+// Every channel subscribed to feed, sorted by guild ID.
+func FeedTargets(settingsStore *store.Store[GuildSettings], feed NotificationFeed) []FeedTarget {
+	targets := []FeedTarget{}
+	for guildID, settings := range settingsStore.Entries() {
+		if sub, ok := settings.Feeds[feed]; ok {
+			targets = append(targets, FeedTarget{GuildID: guildID, FeedSubscription: sub})
+		}
+	}
+
+	slices.SortFunc(targets, func(a, b FeedTarget) int {
+		return cmp.Compare(a.GuildID, b.GuildID)
+	})
+
+	return targets
+}
@@ -0,0 +1,72 @@
+package database
+
+import (
+	"emcsrw/internal/database/store"
+	"emcsrw/pkg/api/oapi"
+	"slices"
+	"time"
+)
+
+// The key of the only entry in BOT_STATUS_STORE.
+const BOT_STATUS_KEY = "bot"
+
+// The outcome of the most recent runs of a scheduled task. Written by the bot so other processes
+// (like the Custom API) can tell how fresh the data they serve is.
+type TaskRun struct {
+	LastRun             int64           `json:"lastRun"`               // Unix timestamp (ms) of when the last run started.
+	LastSuccess         int64           `json:"lastSuccess,omitempty"` // Unix timestamp (ms) of when the last successful run started.
+	LastDuration        int64           `json:"lastDuration"`          // How long the last run took (ms).
+	LastError           string          `json:"lastError,omitempty"`   // Empty if the last run succeeded.
+	ConsecutiveFailures int             `json:"consecutiveFailures"`
+	History             []TaskRunRecord `json:"history,omitempty"` // The most recent runs, oldest first. See TASK_HISTORY_MAX.
+}
+
+type GatewayStatus struct {
+	Connected bool  `json:"connected"`
+	LatencyMs int64 `json:"latencyMs"` // Between the last heartbeat being sent and acknowledged.
+}
+
+// A heartbeat from the bot process with the state of things only it knows about.
+type BotStatus struct {
+	UpdatedAt int64              `json:"updatedAt"` // Unix timestamp (ms)
+	StartedAt int64              `json:"startedAt"` // Unix timestamp (ms)
+	Gateway   GatewayStatus      `json:"gateway"`
+	OAPI      oapi.CircuitStatus `json:"oapi"`
+	Tasks     []ScheduledTask    `json:"tasks,omitempty"`
+}
+
+// Updates the run record of taskName with the result of a run that started at start, appending it to
+// the history and dropping the oldest runs past TASK_HISTORY_MAX.
+func RecordTaskRun(runStore *store.Store[TaskRun], taskName string, start time.Time, elapsed time.Duration, err error) TaskRun {
+	record := TaskRunRecord{Start: start.UnixMilli(), Duration: elapsed.Milliseconds()}
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	var run TaskRun
+	runStore.Update(taskName, func(existing *TaskRun) (TaskRun, bool) {
+		if existing != nil {
+			run = *existing
+		}
+
+		run.LastRun = record.Start
+		run.LastDuration = record.Duration
+
+		if err != nil {
+			run.LastError = record.Error
+			run.ConsecutiveFailures++
+		} else {
+			run.LastSuccess = run.LastRun
+			run.LastError = ""
+			run.ConsecutiveFailures = 0
+		}
+
+		// Always a new array, readers may still hold the old one.
+		keep := run.History[max(0, len(run.History)-TASK_HISTORY_MAX+1):]
+		run.History = append(slices.Clone(keep), record)
+
+		return run, true
+	})
+
+	return run
+}
@@ -0,0 +1,206 @@
+package database
+
+import (
+	"emcsrw/internal/database/store"
+	"emcsrw/pkg/api/oapi"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	HISTORY_SAMPLE_INTERVAL = 1 * time.Hour        // How often a new sample is recorded for each entity.
+	HISTORY_HOURLY_WINDOW   = 3 * 24 * time.Hour   // Samples newer than this are kept at full (hourly) resolution.
+	HISTORY_RETENTION       = 180 * 24 * time.Hour // Samples older than this are dropped entirely.
+)
+
+type HistoryKind string
+
+const (
+	HistoryKindTown     HistoryKind = "town"
+	HistoryKindNation   HistoryKind = "nation"
+	HistoryKindAlliance HistoryKind = "alliance"
+)
+
+// Key of an entity's history in the stats history store, like "town:<uuid>".
+// Alliances use their UUID rather than the identifier since identifiers can change.
+func HistoryKey(kind HistoryKind, id string) string {
+	return fmt.Sprintf("%s:%s", kind, id)
+}
+
+// Stats of a town, nation or alliance at a single point in time.
+type StatsSample struct {
+	Timestamp int64   `json:"timestamp"` // Unix timestamp (ms) at which this sample was taken.
+	Residents int     `json:"residents"`
+	Chunks    int     `json:"chunks"`
+	Balance   float64 `json:"balance"`
+	Score     float64 `json:"score"` // Calculated using the same weights as alliance rankings so scores are comparable.
+}
+
+type StatsHistory struct {
+	Name    string        `json:"name"` // Name at the time of the latest sample.
+	Samples []StatsSample `json:"samples"`
+}
+
+func (h StatsHistory) Last() *StatsSample {
+	if len(h.Samples) == 0 {
+		return nil
+	}
+
+	return &h.Samples[len(h.Samples)-1]
+}
+
+// Appends a sample, then compacts samples outside the hourly window down to one per day
+// and drops any older than the retention period. Samples are expected in chronological order.
+func (h *StatsHistory) Add(sample StatsSample, now time.Time) {
+	h.Samples = append(h.Samples, sample)
+
+	hourlyCutoff := now.Add(-HISTORY_HOURLY_WINDOW).UnixMilli()
+	retentionCutoff := now.Add(-HISTORY_RETENTION).UnixMilli()
+
+	out := make([]StatsSample, 0, len(h.Samples))
+	for i, s := range h.Samples {
+		if s.Timestamp < retentionCutoff {
+			continue
+		}
+
+		// Only keep the last sample of each day once outside the hourly window.
+		if s.Timestamp < hourlyCutoff && i+1 < len(h.Samples) {
+			next := h.Samples[i+1]
+			if sameDay(s.Timestamp, next.Timestamp) {
+				continue
+			}
+		}
+
+		out = append(out, s)
+	}
+
+	h.Samples = out
+}
+
+func sameDay(a, b int64) bool {
+	ay, am, ad := time.UnixMilli(a).UTC().Date()
+	by, bm, bd := time.UnixMilli(b).UTC().Date()
+	return ay == by && am == bm && ad == bd
+}
+
+// Stats score using the given weights. Same formula used to rank alliances.
+func (w AllianceWeights) Score(s AllianceStats) float64 {
+	return s.Residents*w.Residents + s.Towns*w.Towns + s.Nations*w.Nations + s.LandValue*w.LandValue
+}
+
+func NewTownSample(t oapi.TownInfo, ts int64) StatsSample {
+	return StatsSample{
+		Timestamp: ts,
+		Residents: int(t.NumResidents()),
+		Chunks:    int(t.Size()),
+		Balance:   float64(t.Bal()),
+		Score: DEFAULT_ALLIANCE_WEIGHTS.Score(AllianceStats{
+			Residents: float64(t.NumResidents()),
+			Towns:     1,
+			LandValue: float64(t.LandValue()),
+		}),
+	}
+}
+
+func NewNationSample(n oapi.NationInfo, ts int64) StatsSample {
+	return StatsSample{
+		Timestamp: ts,
+		Residents: n.NumResidents(),
+		Chunks:    n.Size(),
+		Balance:   float64(n.Bal()),
+		Score: DEFAULT_ALLIANCE_WEIGHTS.Score(AllianceStats{
+			Residents: float64(n.NumResidents()),
+			Towns:     float64(n.NumTowns()),
+			Nations:   1,
+			LandValue: float64(n.LandValue()),
+		}),
+	}
+}
+
+// Records a sample for every town, nation and alliance, skipping any entity that was already
+// sampled within the last sample interval (such as when the bot restarts). Returns the amount recorded.
+func RecordStatsHistory(
+	historyStore *store.Store[StatsHistory],
+	townStore *store.Store[oapi.TownInfo],
+	nationStore *store.Store[oapi.NationInfo],
+	allianceStore *store.Store[Alliance],
+	now time.Time,
+) (recorded int) {
+	ts := now.UnixMilli()
+	minGap := (HISTORY_SAMPLE_INTERVAL * 9 / 10).Milliseconds() // leeway for tasks not running exactly on time
+
+	record := func(key, name string, sample StatsSample) {
+		h := StatsHistory{}
+		if existing, err := historyStore.Get(key); err == nil {
+			h = *existing
+		}
+		if last := h.Last(); last != nil && ts-last.Timestamp < minGap {
+			return
+		}
+
+		h.Name = name
+		h.Add(sample, now)
+		historyStore.Set(key, h)
+		recorded++
+	}
+
+	for _, t := range townStore.Values() {
+		record(HistoryKey(HistoryKindTown, t.UUID), t.Name, NewTownSample(t, ts))
+	}
+
+	for _, n := range nationStore.Values() {
+		record(HistoryKey(HistoryKindNation, n.UUID), n.Name, NewNationSample(n, ts))
+	}
+
+	ranked, alliances := GetRankedAlliances(allianceStore, nationStore, DEFAULT_ALLIANCE_WEIGHTS)
+	for _, a := range alliances {
+		nations := nationStore.GetFromSet(a.OwnNations)
+		puppets := nationStore.GetFromSet(a.ChildAlliances(alliances).NationIds())
+
+		_, residents, area, _ := a.Stats(nations, puppets)
+
+		balance := 0.0
+		for _, n := range append(nations, puppets...) {
+			balance += float64(n.Bal())
+		}
+
+		record(HistoryKey(HistoryKindAlliance, strconv.FormatUint(a.UUID, 10)), a.Identifier, StatsSample{
+			Timestamp: ts,
+			Residents: residents,
+			Chunks:    area,
+			Balance:   balance,
+			Score:     ranked[a.UUID].Score,
+		})
+	}
+
+	return
+}
+
+// Groups samples between from and to (inclusive) into buckets of the given resolution,
+// using the latest sample in each bucket with its timestamp set to the start of the bucket.
+// Empty buckets are omitted rather than filled.
+func BucketHistory(samples []StatsSample, from, to time.Time, resolution time.Duration) []StatsSample {
+	points := []StatsSample{}
+	if resolution <= 0 {
+		return points
+	}
+
+	fromMs, toMs, resMs := from.UnixMilli(), to.UnixMilli(), resolution.Milliseconds()
+	for _, s := range samples {
+		if s.Timestamp < fromMs || s.Timestamp > toMs {
+			continue
+		}
+
+		bucket := s.Timestamp - (s.Timestamp-fromMs)%resMs
+		if len(points) > 0 && points[len(points)-1].Timestamp == bucket {
+			points[len(points)-1] = s
+		} else {
+			points = append(points, s)
+		}
+
+		points[len(points)-1].Timestamp = bucket
+	}
+
+	return points
+}
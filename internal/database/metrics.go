@@ -0,0 +1,26 @@
+package database
+
+import (
+	"emcsrw/pkg/utils/metrics"
+)
+
+var flushDuration = metrics.NewHistogramVec(
+	"emcs_db_flush_duration_seconds", "How long flushing every store in a database to disk took.",
+	nil, "db",
+)
+
+func init() {
+	metrics.NewGaugeFunc(
+		"emcs_store_entries", "Amount of entries in each store.",
+		[]string{"db", "store"}, func(set func(v float64, labelValues ...string)) {
+			mu.RLock()
+			defer mu.RUnlock()
+
+			for name, db := range databases {
+				for storeName, count := range db.StoreCounts() {
+					set(float64(count), name, storeName)
+				}
+			}
+		},
+	)
+}
@@ -0,0 +1,230 @@
+package database
+
+import (
+	"cmp"
+	"emcsrw/internal/database/store"
+	"emcsrw/pkg/api/oapi"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+// Time of day (UTC) the Towny new day is assumed to happen at until we've fetched server info.
+const DEFAULT_NEW_DAY_CLOCK = 10 * time.Hour
+
+// Keys of the only entries in NEW_DAY_SNAPSHOTS_STORE.
+const (
+	NEW_DAY_PRE_KEY  = "pre"  // Taken shortly before the new day.
+	NEW_DAY_POST_KEY = "post" // Taken once DataUpdate succeeded after the new day.
+)
+
+// Format of the keys in NEW_DAY_REPORTS_STORE, the date (UTC) of the new day.
+const NEW_DAY_REPORT_KEY_FORMAT = time.DateOnly
+
+var newDayClock atomic.Int64 // time.Duration since midnight UTC
+var newDayClockSet atomic.Bool
+
+func init() {
+	newDayClock.Store(int64(DEFAULT_NEW_DAY_CLOCK))
+}
+
+// Works out what time of day (UTC) the new day happens at using server info fetched at fetchedAt.
+//
+// The server only tells us its own time of day and the time of day of the new day, both in its own timezone.
+// Comparing the former to our clock gives us its UTC offset, which is rounded to the nearest 15 minutes so
+// a little delay between the server answering and us calling this doesn't matter.
+func NewDayClock(info oapi.ServerInfo, fetchedAt time.Time) time.Duration {
+	const day = 24 * time.Hour
+
+	utc := fetchedAt.UTC()
+	utcClock := time.Duration(utc.Hour())*time.Hour + time.Duration(utc.Minute())*time.Minute + time.Duration(utc.Second())*time.Second
+
+	offset := (time.Duration(info.Timestamps.ServerTimeOfDay)*time.Second - utcClock).Round(15 * time.Minute)
+	clock := (time.Duration(info.Timestamps.NewDayTime)*time.Second - offset) % day
+	if clock < 0 {
+		clock += day
+	}
+
+	return clock
+}
+
+// Sets the time of day (UTC) used by NextNewDay. The bot calls this whenever it fetches server info,
+// other processes get it from SERVER_STORE with SyncNewDayClock.
+func SetNewDayClock(clock time.Duration) {
+	newDayClock.Store(int64(clock))
+	newDayClockSet.Store(true)
+}
+
+// Sets the new day clock from the server info in SERVER_STORE, so processes that don't fetch it themselves (like the API)
+// agree with the bot. The bot writes the store right after fetching, so the file's mod time stands in for when it was fetched.
+//
+// Returns false (leaving the clock as is) if there is no server info yet.
+func SyncNewDayClock(serverStore *store.Store[oapi.ServerInfo]) bool {
+	info, err := serverStore.Get("info")
+	if err != nil {
+		return false
+	}
+
+	fetchedAt := serverStore.ModTime()
+	if fetchedAt.IsZero() {
+		return false
+	}
+
+	SetNewDayClock(NewDayClock(*info, fetchedAt))
+	return true
+}
+
+// Whether the new day clock came from server info rather than DEFAULT_NEW_DAY_CLOCK.
+func NewDayClockKnown() bool {
+	return newDayClockSet.Load()
+}
+
+func CurrentNewDayClock() time.Duration {
+	return time.Duration(newDayClock.Load())
+}
+
+// The first new day strictly after t.
+func NextNewDay(t time.Time) time.Time {
+	return NextNewDayAt(CurrentNewDayClock(), t)
+}
+
+// The most recent new day at or before t.
+func LastNewDay(t time.Time) time.Time {
+	return NextNewDay(t).Add(-24 * time.Hour)
+}
+
+// The first new day strictly after t, given the time of day (UTC) new days happen at.
+func NextNewDayAt(clock time.Duration, t time.Time) time.Time {
+	t = t.UTC()
+
+	newDay := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Add(clock)
+	if !newDay.After(t) {
+		newDay = newDay.Add(24 * time.Hour)
+	}
+
+	return newDay
+}
+
+//#region Snapshots & Reports
+
+// The bits of a town we need to tell what happened to it over the new day.
+type NewDayTown struct {
+	oapi.Entity
+	Mayor     string      `json:"mayor"`
+	Nation    oapi.Entity `json:"nation,omitzero"`
+	Residents uint32      `json:"residents"`
+	Chunks    uint32      `json:"chunks"`
+	Balance   float32     `json:"balance"`
+	Ruined    bool        `json:"ruined"`
+	Spawn     oapi.Spawn  `json:"spawn"`
+}
+
+type NewDayNation struct {
+	oapi.Entity
+	King      string `json:"king"`
+	Capital   string `json:"capital"`
+	Towns     int    `json:"towns"`
+	Residents int    `json:"residents"`
+}
+
+type NewDaySnapshot struct {
+	TakenAt int64                   `json:"takenAt"` // Unix timestamp (ms)
+	Towns   map[string]NewDayTown   `json:"towns"`   // Key is town UUID
+	Nations map[string]NewDayNation `json:"nations"` // Key is nation UUID
+}
+
+// What happened over a single new day.
+type NewDayReport struct {
+	NewDay    int64          `json:"newDay"` // Unix timestamp (ms)
+	PreAt     int64          `json:"preAt"`  // When the snapshot before the new day was taken (ms).
+	PostAt    int64          `json:"postAt"` // When the snapshot after the new day was taken (ms).
+	Ruined    []NewDayTown   `json:"ruined"`
+	Deleted   []NewDayTown   `json:"deleted"`
+	Dissolved []NewDayNation `json:"dissolved"`
+}
+
+func (r NewDayReport) Empty() bool {
+	return len(r.Ruined) == 0 && len(r.Deleted) == 0 && len(r.Dissolved) == 0
+}
+
+func TakeNewDaySnapshot(townStore *store.Store[oapi.TownInfo], nationStore *store.Store[oapi.NationInfo], now time.Time) NewDaySnapshot {
+	snapshot := NewDaySnapshot{
+		TakenAt: now.UnixMilli(),
+		Towns:   map[string]NewDayTown{},
+		Nations: map[string]NewDayNation{},
+	}
+
+	for uuid, t := range townStore.Entries() {
+		town := NewDayTown{
+			Entity:    t.Entity,
+			Mayor:     t.Mayor.Name,
+			Residents: t.Stats.NumResidents,
+			Chunks:    t.Stats.NumTownBlocks,
+			Balance:   t.Stats.Balance,
+			Ruined:    t.Status.Ruined,
+			Spawn:     t.Coordinates.Spawn,
+		}
+		if t.Nation.UUID != nil {
+			town.Nation = oapi.Entity{Name: lo.FromPtr(t.Nation.Name), UUID: *t.Nation.UUID}
+		}
+
+		snapshot.Towns[uuid] = town
+	}
+
+	for uuid, n := range nationStore.Entries() {
+		snapshot.Nations[uuid] = NewDayNation{
+			Entity:    n.Entity,
+			King:      n.King.Name,
+			Capital:   n.Capital.Name,
+			Towns:     n.Stats.NumTowns,
+			Residents: n.Stats.NumResidents,
+		}
+	}
+
+	return snapshot
+}
+
+// Compares snapshots from either side of a new day. Towns that were already ruined before it aren't reported as ruined again.
+func ComputeNewDayReport(newDay time.Time, pre, post NewDaySnapshot) NewDayReport {
+	report := NewDayReport{
+		NewDay:    newDay.UnixMilli(),
+		PreAt:     pre.TakenAt,
+		PostAt:    post.TakenAt,
+		Ruined:    []NewDayTown{},
+		Deleted:   []NewDayTown{},
+		Dissolved: []NewDayNation{},
+	}
+
+	for uuid, before := range pre.Towns {
+		after, exists := post.Towns[uuid]
+		switch {
+		case !exists:
+			report.Deleted = append(report.Deleted, before)
+		case after.Ruined && !before.Ruined:
+			after.Nation = before.Nation // ruined towns are kicked from their nation
+			report.Ruined = append(report.Ruined, after)
+		}
+	}
+
+	for uuid, before := range pre.Nations {
+		if _, exists := post.Nations[uuid]; !exists {
+			report.Dissolved = append(report.Dissolved, before)
+		}
+	}
+
+	// Biggest first since they're the most interesting.
+	byChunks := func(a, b NewDayTown) int {
+		return cmp.Or(cmp.Compare(b.Chunks, a.Chunks), cmp.Compare(a.Name, b.Name))
+	}
+	slices.SortFunc(report.Ruined, byChunks)
+	slices.SortFunc(report.Deleted, byChunks)
+	slices.SortFunc(report.Dissolved, func(a, b NewDayNation) int {
+		return cmp.Or(cmp.Compare(b.Residents, a.Residents), cmp.Compare(a.Name, b.Name))
+	})
+
+	return report
+}
+
+//#endregion
@@ -0,0 +1,360 @@
+package database
+
+import (
+	"emcsrw/internal/database/store"
+	"emcsrw/pkg/api/oapi"
+	"emcsrw/pkg/utils/config"
+	"emcsrw/pkg/utils/logutil"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default amount of claims each resident grants their town. Only used as a fallback when it cannot be
+// derived from the town itself, for example a town with 0 residents (which shouldn't really exist anyway).
+const DEFAULT_CHUNKS_PER_RESIDENT = 12
+
+type NationBonusTier struct {
+	MinResidents int
+	Bonus        int
+}
+
+// The nation bonus granted to every town in a nation based on the nation's total residents, lowest tier first.
+// Used unless NATION_BONUS_TIERS is set, see NationBonusTiers.
+//
+// These values are approximate and only used to work out how the bonus CHANGES between tiers.
+// The actual bonus of a nation (from the OAPI) is always used as the starting point of any prediction.
+//
+// See: https://wiki.earthmc.net/wiki/Aurora:Nation_Bonus
+var DEFAULT_NATION_BONUS_TIERS = []NationBonusTier{
+	{MinResidents: 0, Bonus: 10},
+	{MinResidents: 10, Bonus: 20},
+	{MinResidents: 20, Bonus: 40},
+	{MinResidents: 40, Bonus: 60},
+	{MinResidents: 60, Bonus: 100},
+	{MinResidents: 80, Bonus: 140},
+	{MinResidents: 100, Bonus: 180},
+	{MinResidents: 120, Bonus: 220},
+	{MinResidents: 140, Bonus: 260},
+	{MinResidents: 200, Bonus: 300},
+}
+
+// Parses tiers like "0:10,10:20,20:40" where each is the min residents and the bonus at that amount.
+// Tiers must be in ascending order of min residents.
+func ParseNationBonusTiers(s string) ([]NationBonusTier, error) {
+	tiers := []NationBonusTier{}
+	for part := range strings.SplitSeq(s, ",") {
+		minStr, bonusStr, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid tier '%s'. expected <minResidents>:<bonus>", part)
+		}
+
+		minResidents, err := strconv.Atoi(strings.TrimSpace(minStr))
+		if err != nil || minResidents < 0 {
+			return nil, fmt.Errorf("invalid min residents in tier '%s'", part)
+		}
+		bonus, err := strconv.Atoi(strings.TrimSpace(bonusStr))
+		if err != nil || bonus < 0 {
+			return nil, fmt.Errorf("invalid bonus in tier '%s'", part)
+		}
+		if len(tiers) > 0 && minResidents <= tiers[len(tiers)-1].MinResidents {
+			return nil, fmt.Errorf("tier '%s' is out of order", part)
+		}
+
+		tiers = append(tiers, NationBonusTier{MinResidents: minResidents, Bonus: bonus})
+	}
+
+	return tiers, nil
+}
+
+// The nation bonus tiers in use. Read once from NATION_BONUS_TIERS so they can be updated when EarthMC
+// changes them without a new release, falling back to DEFAULT_NATION_BONUS_TIERS if unset or invalid.
+var NationBonusTiers = sync.OnceValue(func() []NationBonusTier {
+	v, err := config.GetEnviroVar("NATION_BONUS_TIERS")
+	if err != nil {
+		return DEFAULT_NATION_BONUS_TIERS
+	}
+
+	tiers, err := ParseNationBonusTiers(v)
+	if err != nil {
+		logutil.Printf(logutil.YELLOW, "\nWARN | Invalid NATION_BONUS_TIERS, using the defaults: %s\n", err)
+		return DEFAULT_NATION_BONUS_TIERS
+	}
+
+	return tiers
+})
+
+// Looks up the nation bonus tier for a nation with the given amount of residents.
+// A nation with no residents doesn't exist, so 0 is returned in that case.
+func NationBonusForResidents(residents int) int {
+	if residents <= 0 {
+		return 0
+	}
+
+	bonus := 0
+	for _, tier := range NationBonusTiers() {
+		if residents < tier.MinResidents {
+			break
+		}
+
+		bonus = tier.Bonus
+	}
+
+	return bonus
+}
+
+// Predicts the bonus of a nation after its resident count changes from its current amount to newResidents.
+// The difference between tiers is applied to the actual bonus, so any inaccuracy in the tiers is mostly cancelled out.
+func ProjectNationBonus(nation oapi.NationInfo, newResidents int) int {
+	if newResidents <= 0 {
+		return 0
+	}
+
+	delta := NationBonusForResidents(newResidents) - NationBonusForResidents(nation.NumResidents())
+	return max(0, nation.Bonus()+delta)
+}
+
+// Breakdown of where a town's claim limit comes from.
+//
+// MaxTownBlocks = (Residents * PerResident) + BonusBlocks + NationBonus
+type TownClaimModel struct {
+	Residents   int `json:"residents"`
+	PerResident int `json:"perResident"`
+	BonusBlocks int `json:"bonusBlocks"` // Claims bought by the town, unaffected by residents or nations.
+	NationBonus int `json:"nationBonus"`
+}
+
+// Builds the claim model of a town, deriving how many claims each resident is worth from its current
+// claim limit so we don't have to hard-code values that EarthMC could change at any moment.
+//
+// The nation may be nil if the town has no nation (or it couldn't be found).
+func NewTownClaimModel(town oapi.TownInfo, nation *oapi.NationInfo) TownClaimModel {
+	m := TownClaimModel{
+		Residents:   int(town.NumResidents()),
+		PerResident: DEFAULT_CHUNKS_PER_RESIDENT,
+		BonusBlocks: int(town.Stats.BonusBlocks),
+	}
+	if nation != nil {
+		m.NationBonus = nation.Bonus()
+	}
+
+	residentPart := int(town.MaxSize()) - m.BonusBlocks - m.NationBonus
+	if m.Residents > 0 && residentPart > 0 {
+		m.PerResident = residentPart / m.Residents
+	}
+
+	return m
+}
+
+func (m TownClaimModel) MaxSize() int {
+	return m.Residents*m.PerResident + m.BonusBlocks + m.NationBonus
+}
+
+// Returns a copy of the model with the residents and nation bonus replaced.
+func (m TownClaimModel) With(residents, nationBonus int) TownClaimModel {
+	m.Residents = max(0, residents)
+	m.NationBonus = max(0, nationBonus)
+	return m
+}
+
+type OverclaimRiskLevel string
+
+const (
+	OverclaimRiskNone        OverclaimRiskLevel = "none"
+	OverclaimRiskLow         OverclaimRiskLevel = "low"
+	OverclaimRiskMedium      OverclaimRiskLevel = "medium"
+	OverclaimRiskHigh        OverclaimRiskLevel = "high"
+	OverclaimRiskOverclaimed OverclaimRiskLevel = "overclaimed"
+)
+
+// Predicts if and how a town can become overclaimed (claims exceeding its claim limit).
+type OverclaimRisk struct {
+	TownUUID string             `json:"townUUID"`
+	TownName string             `json:"townName"`
+	Level    OverclaimRiskLevel `json:"level"`
+	Size     int                `json:"size"`
+	MaxSize  int                `json:"maxSize"`
+	Spare    int                `json:"spare"` // Claims left before overclaimed. Negative if already overclaimed.
+	Model    TownClaimModel     `json:"model"`
+
+	// Min residents that would need to leave for this town to become overclaimed.
+	// Nil if it stays within its limit even when only the mayor remains.
+	ResidentsToOverclaim *int `json:"residentsToOverclaim"`
+
+	// Spare claims after leaving its current nation, losing the nation bonus. Nil if the town has no nation.
+	SpareIfLeavesNation *int `json:"spareIfLeavesNation"`
+
+	// Spare claims after joining (or founding) the smallest nation it could, one made up of just itself.
+	// The worst case when switching nations, or the least a town without a nation would gain. See SpareIfJoins for a specific nation.
+	SpareIfJoinsNation int `json:"spareIfJoinsNation"`
+
+	// Residents belonging to other falling towns (inactive mayors) in the same nation.
+	FallingNationResidents int `json:"fallingNationResidents"`
+
+	// Spare claims once every falling town in the nation has ruined and left, shrinking the nation bonus.
+	SpareAfterFalling int `json:"spareAfterFalling"`
+
+	// Predicted time the town becomes overclaimable due to falling mayors. Nil if it wouldn't.
+	// If this town's own mayor is falling, this is the time it ruins since ruins are always overclaimable.
+	OverclaimableAt *time.Time `json:"overclaimableAt"`
+}
+
+// Computes the overclaim risk of a single town.
+//
+// Nation should be the town's nation or nil if it has none. Falling should contain the falling towns
+// of the town's nation and the town itself if its mayor is falling. Towns from other nations are ignored.
+func ComputeOverclaimRisk(town oapi.TownInfo, nation *oapi.NationInfo, falling []FallingTown) OverclaimRisk {
+	model := NewTownClaimModel(town, nation)
+	size := int(town.Size())
+
+	r := OverclaimRisk{
+		TownUUID: town.UUID,
+		TownName: town.Name,
+		Size:     size,
+		MaxSize:  int(town.MaxSize()),
+		Spare:    int(town.MaxSize()) - size,
+		Model:    model,
+	}
+
+	nationResidents := 0
+	if nation != nil {
+		nationResidents = nation.NumResidents()
+	}
+
+	projectBonus := func(residentsLost int) int {
+		if nation == nil {
+			return 0
+		}
+
+		return ProjectNationBonus(*nation, nationResidents-residentsLost)
+	}
+
+	// Residents leaving shrink both the town's own claims and possibly the nation bonus.
+	// The mayor can never leave, hence we stop one short.
+	for k := 1; k < model.Residents; k++ {
+		if model.With(model.Residents-k, projectBonus(k)).MaxSize() < size {
+			r.ResidentsToOverclaim = &k
+			break
+		}
+	}
+
+	if nation != nil {
+		spare := model.With(model.Residents, 0).MaxSize() - size
+		r.SpareIfLeavesNation = &spare
+	}
+
+	// No actual bonus to start from here, so unlike ProjectNationBonus this relies on the tiers being right.
+	r.SpareIfJoinsNation = model.With(model.Residents, NationBonusForResidents(model.Residents)).MaxSize() - size
+
+	// Soonest to ruin first so we find the earliest point the town tips over.
+	falling = slices.Clone(falling)
+	slices.SortFunc(falling, func(a, b FallingTown) int {
+		return a.RuinAt.Compare(b.RuinAt)
+	})
+
+	for _, ft := range falling {
+		if ft.UUID == town.UUID && r.OverclaimableAt == nil {
+			ruinAt := ft.RuinAt
+			r.OverclaimableAt = &ruinAt
+		}
+	}
+
+	// Falling towns in the nation will ruin then leave, taking their residents with them.
+	r.SpareAfterFalling = r.Spare
+	if nation != nil {
+		var tippedAt *time.Time
+		for _, ft := range falling {
+			if ft.UUID == town.UUID || ft.Nation.UUID == nil || *ft.Nation.UUID != nation.UUID {
+				continue
+			}
+
+			r.FallingNationResidents += int(ft.NumResidents())
+			if tippedAt == nil && model.With(model.Residents, projectBonus(r.FallingNationResidents)).MaxSize() < size {
+				ruinAt := ft.RuinAt
+				tippedAt = &ruinAt
+			}
+		}
+
+		if tippedAt != nil && (r.OverclaimableAt == nil || tippedAt.Before(*r.OverclaimableAt)) {
+			r.OverclaimableAt = tippedAt
+		}
+
+		r.SpareAfterFalling = model.With(model.Residents, projectBonus(r.FallingNationResidents)).MaxSize() - size
+	}
+
+	r.Level = r.level()
+	return r
+}
+
+// Spare claims a town would have after joining the target nation, leaving its current one (nil if none).
+// The target's bonus is projected to include the town's own residents.
+func SpareIfJoins(town oapi.TownInfo, current *oapi.NationInfo, target oapi.NationInfo) int {
+	model := NewTownClaimModel(town, current)
+	if current != nil && current.UUID == target.UUID {
+		return model.MaxSize() - int(town.Size()) // already in it
+	}
+
+	bonus := ProjectNationBonus(target, target.NumResidents()+model.Residents)
+	return model.With(model.Residents, bonus).MaxSize() - int(town.Size())
+}
+
+func (r OverclaimRisk) level() OverclaimRiskLevel {
+	switch {
+	case r.Spare < 0:
+		return OverclaimRiskOverclaimed
+	case r.OverclaimableAt != nil || (r.ResidentsToOverclaim != nil && *r.ResidentsToOverclaim <= 1):
+		return OverclaimRiskHigh
+	case r.ResidentsToOverclaim != nil && *r.ResidentsToOverclaim <= 3:
+		return OverclaimRiskMedium
+	case r.ResidentsToOverclaim != nil || (r.SpareIfLeavesNation != nil && *r.SpareIfLeavesNation < 0):
+		return OverclaimRiskLow
+	default:
+		return OverclaimRiskNone
+	}
+}
+
+// Computes the overclaim risk of every town that is not already ruined, keyed by town UUID.
+// The falling store may be nil, in which case falling mayors are not considered.
+func ComputeOverclaimRisks(
+	townStore *store.Store[oapi.TownInfo],
+	nationStore *store.Store[oapi.NationInfo],
+	fallingStore *store.Store[FallingTown],
+) map[string]OverclaimRisk {
+	nations := nationStore.Entries()
+
+	fallingByNation := make(map[string][]FallingTown)
+	fallingByTown := make(map[string]FallingTown)
+	if fallingStore != nil {
+		for _, ft := range fallingStore.Values() {
+			fallingByTown[ft.UUID] = ft
+			if ft.Nation.UUID != nil {
+				fallingByNation[*ft.Nation.UUID] = append(fallingByNation[*ft.Nation.UUID], ft)
+			}
+		}
+	}
+
+	risks := make(map[string]OverclaimRisk)
+	for _, t := range townStore.Values() {
+		if t.Status.Ruined {
+			continue
+		}
+
+		var nation *oapi.NationInfo
+		var falling []FallingTown
+		if t.Nation.UUID != nil {
+			if n, ok := nations[*t.Nation.UUID]; ok {
+				nation = &n
+				falling = fallingByNation[n.UUID]
+			}
+		} else if ft, ok := fallingByTown[t.UUID]; ok {
+			falling = []FallingTown{ft}
+		}
+
+		risks[t.UUID] = ComputeOverclaimRisk(t, nation, falling)
+	}
+
+	return risks
+}
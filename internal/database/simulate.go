@@ -0,0 +1,141 @@
+package database
+
+import (
+	"emcsrw/pkg/api/oapi"
+	"emcsrw/pkg/utils/sets"
+	"slices"
+)
+
+// Hypothetical changes to apply to a nation when simulating.
+type NationChanges struct {
+	ResidentDelta  int              // Residents gained (positive) or lost (negative).
+	ResidentTownID string           // UUID of the town the residents are gained/lost from. Defaults to the capital.
+	AddTowns       []oapi.TownInfo  // Towns joining the nation.
+	RemoveTowns    sets.Set[string] // UUIDs of towns leaving the nation.
+}
+
+// A single town within a simulated nation, showing its claim limit before and after the changes.
+type SimulatedTown struct {
+	UUID      string `json:"uuid"`
+	Name      string `json:"name"`
+	Size      int    `json:"size"`
+	Residents int    `json:"residents"`
+	OldMax    int    `json:"oldMax"`
+	NewMax    int    `json:"newMax"`
+	Joined    bool   `json:"joined"` // Whether this town was added as part of the simulation.
+}
+
+func (t SimulatedTown) WasOverclaimed() bool {
+	return !t.Joined && t.Size > t.OldMax
+}
+
+func (t SimulatedTown) Overclaimed() bool {
+	return t.Size > t.NewMax
+}
+
+type NationSimulation struct {
+	Before oapi.NationInfo `json:"before"`
+	After  oapi.NationInfo `json:"after"` // Copy of the nation with its stats replaced by the simulated ones.
+	Towns  []SimulatedTown `json:"towns"`
+	Left   []SimulatedTown `json:"left"` // Towns that left and lost the nation bonus.
+}
+
+// Towns that were fine before the changes, but would be overclaimed after them.
+func (s NationSimulation) NewlyOverclaimed() []SimulatedTown {
+	out := []SimulatedTown{}
+	for _, t := range slices.Concat(s.Towns, s.Left) {
+		if t.Overclaimed() && !t.WasOverclaimed() {
+			out = append(out, t)
+		}
+	}
+
+	return out
+}
+
+// Simulates a nation after applying the given changes, working out the new nation bonus,
+// the claim limit of every town (including ones that left) and the resulting land value.
+//
+// Towns should be all towns currently in the nation. The nation bonus is projected from the actual
+// bonus using NationBonusTiers, and each town's claim limit uses its own TownClaimModel.
+func SimulateNation(nation oapi.NationInfo, towns []oapi.TownInfo, changes NationChanges) NationSimulation {
+	residentTown := changes.ResidentTownID
+	if residentTown == "" {
+		residentTown = nation.Capital.UUID
+	}
+
+	// A town always keeps at least its mayor, so work out how many residents it can actually lose
+	// once and use that for both the town and the nation, otherwise they'd disagree.
+	residentDelta := changes.ResidentDelta
+	for _, t := range slices.Concat(towns, changes.AddTowns) {
+		if t.UUID == residentTown && !changes.RemoveTowns.Has(t.UUID) {
+			r := int(t.NumResidents())
+			residentDelta = max(1, r+residentDelta) - r
+			break
+		}
+	}
+
+	after := nation
+	after.Stats.NumResidents += residentDelta
+
+	sim := NationSimulation{Before: nation}
+
+	// Work out the nation's new size before computing any claim limits since they depend on it.
+	remaining := []oapi.TownInfo{}
+	leaving := []oapi.TownInfo{}
+	for _, t := range towns {
+		if changes.RemoveTowns.Has(t.UUID) {
+			leaving = append(leaving, t)
+			after.Stats.NumResidents -= int(t.NumResidents())
+			after.Stats.NumTowns--
+			after.Stats.NumTownBlocks -= int(t.Size())
+			continue
+		}
+
+		remaining = append(remaining, t)
+	}
+	for _, t := range changes.AddTowns {
+		after.Stats.NumResidents += int(t.NumResidents())
+		after.Stats.NumTowns++
+		after.Stats.NumTownBlocks += int(t.Size())
+	}
+
+	after.Stats.NumResidents = max(0, after.Stats.NumResidents)
+	after.Stats.NationBonus = ProjectNationBonus(nation, after.Stats.NumResidents)
+	if after.Stats.NumTowns <= 0 {
+		after.Stats.NationBonus = 0 // nation no longer exists
+	}
+
+	// Nation is nil for joining towns since they don't have our bonus yet. If they are leaving another
+	// nation we don't know its bonus, so the per-resident claims may be slightly overestimated for them.
+	simulate := func(t oapi.TownInfo, n *oapi.NationInfo, newBonus int) SimulatedTown {
+		model := NewTownClaimModel(t, n)
+
+		residents := model.Residents
+		if t.UUID == residentTown {
+			residents += residentDelta
+		}
+
+		return SimulatedTown{
+			UUID:      t.UUID,
+			Name:      t.Name,
+			Size:      int(t.Size()),
+			Residents: residents,
+			OldMax:    int(t.MaxSize()),
+			NewMax:    model.With(residents, newBonus).MaxSize(),
+			Joined:    n == nil,
+		}
+	}
+
+	for _, t := range remaining {
+		sim.Towns = append(sim.Towns, simulate(t, &nation, after.Stats.NationBonus))
+	}
+	for _, t := range changes.AddTowns {
+		sim.Towns = append(sim.Towns, simulate(t, nil, after.Stats.NationBonus))
+	}
+	for _, t := range leaving {
+		sim.Left = append(sim.Left, simulate(t, &nation, 0))
+	}
+
+	sim.After = after
+	return sim
+}
@@ -0,0 +1,170 @@
+package database
+
+import (
+	"emcsrw/pkg/api/oapi"
+	"emcsrw/pkg/utils"
+)
+
+// Filters and sorts shared by anything that lists towns or nations, like `/town list` and the Custom API.
+// Keys are what users/clients pass in, so they should never be renamed without updating both.
+
+// #region Town filters & sorts
+var TOWN_STATUS_FILTERS = map[string]func(oapi.TownInfo) bool{
+	"capital":             func(t oapi.TownInfo) bool { return t.Status.Capital },
+	"ruined":              func(t oapi.TownInfo) bool { return t.Status.Ruined },
+	"overclaimed":         func(t oapi.TownInfo) bool { return t.Status.Overclaimed },
+	"for-sale":            func(t oapi.TownInfo) bool { return t.Status.ForSale },
+	"can-outsiders-spawn": func(t oapi.TownInfo) bool { return t.Status.CanOutsidersSpawn },
+	"open":                func(t oapi.TownInfo) bool { return t.Status.Open },
+	"public":              func(t oapi.TownInfo) bool { return t.Status.Public },
+	"neutral":             func(t oapi.TownInfo) bool { return t.Status.Neutral },
+}
+
+var TOWN_FLAG_FILTERS = map[string]func(oapi.TownInfo) bool{
+	"explosions": func(t oapi.TownInfo) bool { return t.Perms.Flags.Explosions },
+	"mobs":       func(t oapi.TownInfo) bool { return t.Perms.Flags.Mobs },
+	"fire":       func(t oapi.TownInfo) bool { return t.Perms.Flags.Fire },
+	"pvp":        func(t oapi.TownInfo) bool { return t.Perms.Flags.PVP },
+}
+
+var TOWN_SORTS = map[string]func([]oapi.TownInfo){
+	"alphabetical": func(towns []oapi.TownInfo) {
+		utils.KeySort(towns, []utils.KeySortOption[oapi.TownInfo]{
+			{Compare: func(a, b oapi.TownInfo) bool { return a.Name < b.Name }},
+		})
+	},
+	"residents": func(towns []oapi.TownInfo) {
+		utils.KeySort(towns, []utils.KeySortOption[oapi.TownInfo]{
+			{Compare: func(a, b oapi.TownInfo) bool { return a.NumResidents() > b.NumResidents() }},
+		})
+	},
+	"size": func(towns []oapi.TownInfo) {
+		utils.KeySort(towns, []utils.KeySortOption[oapi.TownInfo]{
+			{Compare: func(a, b oapi.TownInfo) bool { return a.Size() > b.Size() }},
+		})
+	},
+	"founded": func(towns []oapi.TownInfo) {
+		utils.KeySort(towns, []utils.KeySortOption[oapi.TownInfo]{
+			{Compare: func(a, b oapi.TownInfo) bool {
+				return a.Timestamps.Registered < b.Timestamps.Registered
+			}},
+		})
+	},
+	"balance": func(towns []oapi.TownInfo) {
+		utils.KeySort(towns, []utils.KeySortOption[oapi.TownInfo]{
+			{Compare: func(a, b oapi.TownInfo) bool { return a.Bal() > b.Bal() }},
+		})
+	},
+	"ruined": func(towns []oapi.TownInfo) {
+		utils.RankSortDescending(towns, func(t oapi.TownInfo) int {
+			if !t.Status.Ruined {
+				return 0
+			}
+			return int(*t.Timestamps.RuinedAt)
+		})
+	},
+	"overclaimed": func(towns []oapi.TownInfo) {
+		utils.SortToggledOn(towns, func(t oapi.TownInfo) bool {
+			return t.Status.Overclaimed
+		})
+	},
+	"for-sale": func(towns []oapi.TownInfo) {
+		utils.RankSortDescending(towns, func(t oapi.TownInfo) int {
+			if !t.Status.ForSale || t.Stats.ForSalePrice == nil {
+				return 0
+			}
+			return int(*t.Stats.ForSalePrice * 100.0)
+		})
+	},
+	"capital": func(towns []oapi.TownInfo) {
+		utils.SortToggledOn(towns, func(t oapi.TownInfo) bool {
+			return t.Status.Capital
+		})
+	},
+	"has-nation": func(towns []oapi.TownInfo) {
+		utils.SortToggledOn(towns, func(t oapi.TownInfo) bool {
+			return t.Status.HasNation
+		})
+	},
+	"can-outsiders-spawn": func(towns []oapi.TownInfo) {
+		utils.SortToggledOn(towns, func(t oapi.TownInfo) bool {
+			return t.Status.CanOutsidersSpawn
+		})
+	},
+	"open": func(towns []oapi.TownInfo) {
+		utils.SortToggledOn(towns, func(t oapi.TownInfo) bool {
+			return t.Status.Open
+		})
+	},
+	"public": func(towns []oapi.TownInfo) {
+		utils.SortToggledOn(towns, func(t oapi.TownInfo) bool {
+			return t.Status.Public
+		})
+	},
+	"neutral": func(towns []oapi.TownInfo) {
+		utils.SortToggledOn(towns, func(t oapi.TownInfo) bool {
+			return t.Status.Neutral
+		})
+	},
+}
+
+// Default town sort when none is chosen (residents -> size).
+func SortTownsDefault(towns []oapi.TownInfo) {
+	utils.KeySort(towns, []utils.KeySortOption[oapi.TownInfo]{
+		{Compare: func(a, b oapi.TownInfo) bool { return a.NumResidents() > b.NumResidents() }},
+		{Compare: func(a, b oapi.TownInfo) bool { return a.Size() > b.Size() }},
+	})
+}
+
+// #endregion
+
+// #region Nation filters & sorts
+var NATION_STATUS_FILTERS = map[string]func(oapi.NationInfo) bool{
+	"open":    func(n oapi.NationInfo) bool { return n.Status.Open },
+	"public":  func(n oapi.NationInfo) bool { return n.Status.Public },
+	"neutral": func(n oapi.NationInfo) bool { return n.Status.Neutral },
+}
+
+var NATION_SORTS = map[string]func([]oapi.NationInfo){
+	"alphabetical": func(nations []oapi.NationInfo) {
+		utils.KeySort(nations, []utils.KeySortOption[oapi.NationInfo]{
+			{Compare: func(a, b oapi.NationInfo) bool { return b.Name > a.Name }}, // ascending (A-Z)
+		})
+	},
+	"residents": func(nations []oapi.NationInfo) {
+		utils.KeySort(nations, []utils.KeySortOption[oapi.NationInfo]{
+			{Compare: func(a, b oapi.NationInfo) bool { return a.NumResidents() > b.NumResidents() }}, // descending
+		})
+	},
+	"towns": func(nations []oapi.NationInfo) {
+		utils.KeySort(nations, []utils.KeySortOption[oapi.NationInfo]{
+			{Compare: func(a, b oapi.NationInfo) bool { return a.NumTowns() > b.NumTowns() }}, // descending
+		})
+	},
+	"size": func(nations []oapi.NationInfo) {
+		utils.KeySort(nations, []utils.KeySortOption[oapi.NationInfo]{
+			{Compare: func(a, b oapi.NationInfo) bool { return a.Size() > b.Size() }}, // descending
+		})
+	},
+	"balance": func(nations []oapi.NationInfo) {
+		utils.KeySort(nations, []utils.KeySortOption[oapi.NationInfo]{
+			{Compare: func(a, b oapi.NationInfo) bool { return a.Bal() > b.Bal() }}, // descending
+		})
+	},
+	"founded": func(nations []oapi.NationInfo) {
+		utils.KeySort(nations, []utils.KeySortOption[oapi.NationInfo]{
+			{Compare: func(a, b oapi.NationInfo) bool { return b.Timestamps.Registered > a.Timestamps.Registered }}, // ascending (oldest-newest)
+		})
+	},
+}
+
+// Default nation sort when none is chosen (residents -> towns -> size).
+func SortNationsDefault(nations []oapi.NationInfo) {
+	utils.KeySort(nations, []utils.KeySortOption[oapi.NationInfo]{
+		{Compare: func(a, b oapi.NationInfo) bool { return a.NumResidents() > b.NumResidents() }},
+		{Compare: func(a, b oapi.NationInfo) bool { return a.NumTowns() > b.NumTowns() }},
+		{Compare: func(a, b oapi.NationInfo) bool { return a.Size() > b.Size() }},
+	})
+}
+
+// #endregion
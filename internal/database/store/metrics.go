@@ -0,0 +1,33 @@
+package store
+
+import (
+	"emcsrw/pkg/utils/metrics"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	snapshotDuration = metrics.NewHistogramVec(
+		"emcs_store_snapshot_duration_seconds", "How long writing a store snapshot to its file took.",
+		nil, "db", "store",
+	)
+	snapshotErrors = metrics.NewCounterVec(
+		"emcs_store_snapshot_errors_total", "Store snapshots that failed to write.",
+		"db", "store",
+	)
+)
+
+// Splits the store path into labels, e.g. "db/aurora/towns.json" becomes "aurora" and "towns".
+func (s *Store[T]) metricLabels() (db string, name string) {
+	path := s.CleanPath()
+	return filepath.Base(filepath.Dir(path)), strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
+
+func (s *Store[T]) observeSnapshot(start time.Time, err error) {
+	db, name := s.metricLabels()
+	snapshotDuration.With(db, name).ObserveSince(start)
+	if err != nil {
+		snapshotErrors.With(db, name).Inc()
+	}
+}
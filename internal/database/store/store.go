@@ -11,12 +11,14 @@ import (
 	"path/filepath"
 	"slices"
 	"sync"
+	"time"
 )
 
 // The interface that a generic store must implement to retain basic functionality that is common across all stores.
 // Once converted to a concrete store type, further type-specific operations may become available.
 type IStore interface {
 	CleanPath() string
+	Count() int
 	WriteSnapshot() error
 	LoadFromFile() error
 }
@@ -67,6 +69,16 @@ func (s *Store[T]) CleanPath() string {
 	return filepath.Clean(s.filePath)
 }
 
+// When the store's file was last written, by this process or any other. Zero if it doesn't exist yet.
+func (s *Store[T]) ModTime() time.Time {
+	info, err := os.Stat(s.CleanPath())
+	if err != nil {
+		return time.Time{}
+	}
+
+	return info.ModTime()
+}
+
 func (s *Store[T]) Keys() []StoreKey {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -239,6 +251,27 @@ func (s *Store[T]) Set(key string, value T) {
 	s.data[key] = value
 }
 
+// Reads and replaces the value at key while holding the lock, so nothing else can change it in between.
+// f is given a copy of the current value (nil if there is none) and returns the new value, or false to delete it.
+// f must not use the store itself, since it's called with the lock held.
+//
+// Maps and slices in the copy are still shared with the store and anyone that read it before, so clone them before changing them.
+func (s *Store[T]) Update(key string, f func(existing *T) (T, bool)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var existing *T
+	if v, ok := s.data[key]; ok {
+		existing = &v
+	}
+
+	if v, keep := f(existing); keep {
+		s.data[key] = v
+	} else {
+		delete(s.data, key)
+	}
+}
+
 func (s *Store[T]) SetKeyFunc(key string, f func() (T, error)) (T, error) {
 	res, err := f()
 	if err != nil {
@@ -354,7 +387,10 @@ func (s *Store[T]) LoadFromFile() error {
 
 // Creates a snapshot of the current cache state and writes it to the
 // database (JSON file) at the path we provided when the store was initialized.
-func (s *Store[T]) WriteSnapshot() error {
+func (s *Store[T]) WriteSnapshot() (err error) {
+	start := time.Now()
+	defer func() { s.observeSnapshot(start, err) }()
+
 	s.mu.RLock()
 	cpy := s.data.shallowCopy() // TODO: Do we really need a copy if we use mutex on all ops anyway?
 	s.mu.RUnlock()
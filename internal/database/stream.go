@@ -0,0 +1,231 @@
+package database
+
+import (
+	"emcsrw/pkg/api/oapi"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long published events are kept in the stream store. Clients that reconnect with a
+// Last-Event-ID older than this will miss events, so it should comfortably cover a reconnect.
+const STREAM_EVENT_RETENTION = 10 * time.Minute
+
+type StreamTopic string
+
+const (
+	StreamTopicTownFlow   StreamTopic = "townflow"
+	StreamTopicPlayerFlow StreamTopic = "playerflow"
+	StreamTopicNews       StreamTopic = "news"
+	StreamTopicAlliances  StreamTopic = "alliances"
+	StreamTopicVoteParty  StreamTopic = "voteparty"
+	StreamTopicNationFlow StreamTopic = "nationflow"
+)
+
+var STREAM_TOPICS = []StreamTopic{
+	StreamTopicTownFlow, StreamTopicPlayerFlow, StreamTopicNews,
+	StreamTopicAlliances, StreamTopicVoteParty, StreamTopicNationFlow,
+}
+
+// An event published by the bot's tasks for the Custom API to push to stream clients.
+//
+// The bot and API run as separate processes, so the stream store acts as a short-lived
+// event log between them. The API polls it for events newer than the last one it sent.
+type StreamEvent struct {
+	ID        string          `json:"id"` // Sortable, so newer events always have a greater ID.
+	Topic     StreamTopic     `json:"topic"`
+	Type      string          `json:"type"` // Kind of event within the topic, e.g. "created" or "deleted".
+	Timestamp int64           `json:"timestamp"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Highest sequence that fits in the 4 digits of a stream event ID.
+const STREAM_SEQ_MAX = 9999
+
+var streamSeqMu sync.Mutex
+var streamLastMs int64
+var streamSeq int
+
+// Generates a unique ID that sorts by time. The sequence handles multiple events within the same ms.
+//
+// Once the sequence runs out of digits (like a big batch published at once), the ID moves on to the next ms
+// instead so it still sorts correctly. Later IDs never go back before that ms, even if the clock hasn't caught up yet.
+func newStreamEventID(now time.Time) string {
+	streamSeqMu.Lock()
+	defer streamSeqMu.Unlock()
+
+	ms := now.UnixMilli()
+	if ms <= streamLastMs {
+		ms = streamLastMs
+		streamSeq++
+		if streamSeq > STREAM_SEQ_MAX {
+			ms++
+			streamSeq = 0
+		}
+	} else {
+		streamSeq = 0
+	}
+
+	streamLastMs = ms
+	return fmt.Sprintf("%013d-%04d", ms, streamSeq)
+}
+
+func ParseStreamTopic(s string) (StreamTopic, bool) {
+	topic := StreamTopic(strings.ToLower(strings.TrimSpace(s)))
+	return topic, slices.Contains(STREAM_TOPICS, topic)
+}
+
+// Publishes events of a single topic and type to the stream store of the given DB, one per item in data.
+// Events older than STREAM_EVENT_RETENTION are pruned and the store is written straight away so the API sees them.
+//
+// The published events are returned so they can be passed on elsewhere (like to webhooks) with the same IDs.
+func PublishStreamEvents[T any](mdb *Database, topic StreamTopic, eventType string, data ...T) ([]StreamEvent, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	streamStore, err := GetStore(mdb, STREAM_EVENTS_STORE)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	events := make([]StreamEvent, 0, len(data))
+	for _, d := range data {
+		raw, err := json.Marshal(d)
+		if err != nil {
+			return events, err
+		}
+
+		id := newStreamEventID(now)
+		event := StreamEvent{
+			ID:        id,
+			Topic:     topic,
+			Type:      eventType,
+			Timestamp: now.UnixMilli(),
+			Data:      raw,
+		}
+
+		streamStore.Set(id, event)
+		events = append(events, event)
+	}
+
+	cutoff := now.Add(-STREAM_EVENT_RETENTION).UnixMilli()
+	for _, e := range streamStore.FindAll(func(e StreamEvent) bool { return e.Timestamp < cutoff }) {
+		streamStore.Delete(e.ID)
+	}
+
+	return events, streamStore.WriteSnapshot()
+}
+
+// Returns all events with an ID greater than lastID, oldest first. An empty lastID returns every event.
+func StreamEventsSince(events []StreamEvent, lastID string) []StreamEvent {
+	out := slices.DeleteFunc(slices.Clone(events), func(e StreamEvent) bool {
+		return e.ID <= lastID
+	})
+
+	slices.SortFunc(out, func(a, b StreamEvent) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	return out
+}
+
+//#region Event payloads
+
+// Payload of townflow events (created, renamed, mayor-changed, joined-nation, left-nation, capital-changed, ruined, reclaimed, deleted).
+type StreamTown struct {
+	UUID      string  `json:"uuid"`
+	Name      string  `json:"name"`
+	OldName   *string `json:"oldName,omitempty"`   // Only set for renamed events.
+	OldMayor  *string `json:"oldMayor,omitempty"`  // Only set for mayor-changed events.
+	OldNation *string `json:"oldNation,omitempty"` // Only set for left-nation events.
+	Nation    *string `json:"nation"`
+	Mayor     string  `json:"mayor"`
+	Residents int     `json:"residents"`
+	Chunks    int     `json:"chunks"`
+	Balance   float64 `json:"balance"`
+}
+
+func NewStreamTown(t oapi.TownInfo) StreamTown {
+	return StreamTown{
+		UUID:      t.UUID,
+		Name:      t.Name,
+		Nation:    t.Nation.Name,
+		Mayor:     t.Mayor.Name,
+		Residents: int(t.NumResidents()),
+		Chunks:    int(t.Size()),
+		Balance:   float64(t.Bal()),
+	}
+}
+
+// Payload of nationflow events (created, renamed, king-changed, capital-changed, town-joined, town-left, merged, deleted).
+type StreamNation struct {
+	UUID       string   `json:"uuid"`
+	Name       string   `json:"name"`
+	King       string   `json:"king"`
+	Capital    string   `json:"capital"`
+	Towns      int      `json:"towns"`
+	Residents  int      `json:"residents"`
+	OldName    *string  `json:"oldName,omitempty"`    // Only set for renamed events.
+	OldKing    *string  `json:"oldKing,omitempty"`    // Only set for king-changed events.
+	OldCapital *string  `json:"oldCapital,omitempty"` // Only set for capital-changed events.
+	Town       *string  `json:"town,omitempty"`       // Only set for town-joined and town-left events.
+	MergedInto *string  `json:"mergedInto,omitempty"` // Only set for merged events.
+	MovedTowns []string `json:"movedTowns,omitempty"` // Only set for merged events.
+}
+
+func NewStreamNation(n oapi.NationInfo) StreamNation {
+	return StreamNation{
+		UUID:      n.UUID,
+		Name:      n.Name,
+		King:      n.King.Name,
+		Capital:   n.Capital.Name,
+		Towns:     n.Stats.NumTowns,
+		Residents: n.Stats.NumResidents,
+	}
+}
+
+// Payload of playerflow events (left, joined).
+type StreamPlayerFlow struct {
+	UUID     string  `json:"uuid"`
+	Name     string  `json:"name"`
+	Town     string  `json:"town"`
+	TownUUID string  `json:"townUUID"`
+	Nation   *string `json:"nation"`
+}
+
+// Payload of news events (published).
+type StreamNews struct {
+	NewsEntry
+	ID string `json:"id"`
+}
+
+// Payload of alliance events (created, updated, disbanded).
+type StreamAlliance struct {
+	UUID       uint64   `json:"uuid"`
+	Identifier string   `json:"identifier"`
+	Label      string   `json:"label"`
+	OwnNations []string `json:"ownNations"`
+}
+
+func NewStreamAlliance(a Alliance) StreamAlliance {
+	return StreamAlliance{
+		UUID:       a.UUID,
+		Identifier: a.Identifier,
+		Label:      a.Label,
+		OwnNations: slices.Sorted(maps.Keys(a.OwnNations)),
+	}
+}
+
+// Payload of voteparty events (progress, completed).
+type StreamVoteParty struct {
+	Target    int `json:"target"`
+	Remaining int `json:"remaining"`
+}
+
+//#endregion
@@ -0,0 +1,43 @@
+package database
+
+import (
+	"time"
+)
+
+// How many of the most recent runs are kept for each task.
+// The busiest task (DataUpdate) runs every minute, so this covers at least the last few hours.
+const TASK_HISTORY_MAX = 240
+
+// A scheduled task as last reported by the bot. Things that outlive the bot process, like when a task
+// last ran and whether it failed, are in TASK_RUNS_STORE instead.
+type ScheduledTask struct {
+	Name        string `json:"name"`
+	Schedule    string `json:"schedule"` // Human readable, like "every 1m0s" or "every 1m30s or 2m0s after the new day".
+	Overlap     string `json:"overlap"`  // What happens when it's due while still running: skip or queue.
+	Paused      bool   `json:"paused"`
+	Running     bool   `json:"running"`
+	NextRun     int64  `json:"nextRun,omitempty"` // Unix timestamp (ms)
+	Runs        int    `json:"runs"`              // Since the bot started.
+	Failures    int    `json:"failures"`          // Since the bot started.
+	AvgDuration int64  `json:"avgDuration"`       // Over the most recent runs (ms).
+}
+
+// A single run of a scheduled task.
+type TaskRunRecord struct {
+	Start    int64  `json:"start"`           // Unix timestamp (ms)
+	Duration int64  `json:"duration"`        // How long the run took (ms).
+	Error    string `json:"error,omitempty"` // Empty if the run succeeded.
+}
+
+// The most recent successful run that started at or after t, or nil if there isn't one.
+// Handy for checking whether a task has already run since something happened, like the new day.
+func (r TaskRun) LastSuccessSince(t time.Time) *TaskRunRecord {
+	since := t.UnixMilli()
+	for i := len(r.History) - 1; i >= 0 && r.History[i].Start >= since; i-- {
+		if r.History[i].Error == "" {
+			return &r.History[i]
+		}
+	}
+
+	return nil
+}
@@ -58,7 +58,7 @@ func ComputeFallingTowns(mdb *Database, window time.Duration) (map[MayorUUID]Fal
 		lo := time.UnixMilli(int64(*m.Timestamps.LastOnline))
 
 		ruinRaw := lo.Add(FALL_DAYS)
-		ruinAt := nextNewDayAfter(ruinRaw)
+		ruinAt := NextNewDay(ruinRaw)
 
 		timeToRuin := ruinAt.Sub(now)
 		if timeToRuin < 0 || timeToRuin > window {
@@ -66,7 +66,7 @@ func ComputeFallingTowns(mdb *Database, window time.Duration) (map[MayorUUID]Fal
 		}
 
 		deletionRaw := ruinRaw.Add(72 * time.Hour)
-		deletionAt := nextNewDayAfter(deletionRaw)
+		deletionAt := NextNewDay(deletionRaw)
 		fts[town.UUID] = FallingTown{
 			TownInfo:         town,
 			MayorLastOnline:  lo,
@@ -94,7 +94,7 @@ func ComputeRuinedTowns(townStore *store.Store[oapi.TownInfo]) []RuinedTown {
 		ruinAt := time.UnixMilli(int64(*town.Timestamps.RuinedAt))
 
 		deletionRaw := ruinAt.Add(72 * time.Hour)
-		deletionAt := nextNewDayAfter(deletionRaw)
+		deletionAt := NextNewDay(deletionRaw)
 
 		ruinedTowns[i] = RuinedTown{
 			TownInfo:   town,
@@ -104,12 +104,3 @@ func ComputeRuinedTowns(townStore *store.Store[oapi.TownInfo]) []RuinedTown {
 
 	return ruinedTowns
 }
-
-func nextNewDayAfter(t time.Time) time.Time {
-	newDay := time.Date(t.Year(), t.Month(), t.Day(), 10, 0, 0, 0, time.UTC)
-	if !newDay.After(t) {
-		newDay = newDay.Add(24 * time.Hour)
-	}
-
-	return newDay
-}
@@ -0,0 +1,175 @@
+package database
+
+import (
+	"emcsrw/internal/database/store"
+	"emcsrw/pkg/api/mapi"
+	"emcsrw/pkg/api/oapi"
+	"emcsrw/pkg/utils/geometry"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// How long trail points are kept before being pruned. Deliberately short since
+// we only care about recent movement, NOT a long-term history of where someone has been.
+const DEFAULT_TRAIL_RETENTION = 30 * time.Minute
+
+// Hard limit on the number of points per trail regardless of retention,
+// preventing a single player from bloating the store if the poll interval is very low.
+const MAX_TRAIL_POINTS = 90
+
+// Players not seen within this window are no longer considered "currently" visible on the map.
+// Should be a few times larger than the poll interval so a single failed poll doesn't hide everyone.
+const TRAIL_CURRENT_WINDOW = 1 * time.Minute
+
+// A single sample of where a player was when the map was polled.
+type TrailPoint struct {
+	mapi.Location
+	World     string `json:"world"`
+	Timestamp int64  `json:"timestamp"` // Unix ms when this point was recorded.
+}
+
+// Short rolling trail of a single visible player's locations, oldest first.
+type PlayerTrail struct {
+	UUID   string       `json:"uuid"`
+	Name   string       `json:"name"`
+	Points []TrailPoint `json:"points"`
+}
+
+// The most recent point in this trail. Trails in the store always have at least one point.
+func (t PlayerTrail) Last() TrailPoint {
+	return t.Points[len(t.Points)-1]
+}
+
+func (t PlayerTrail) LastSeen() time.Time {
+	return time.UnixMilli(t.Last().Timestamp)
+}
+
+// Reports whether the player was visible on the map at or after the given time.
+func (t PlayerTrail) SeenSince(since time.Time) bool {
+	return len(t.Points) > 0 && !t.LastSeen().Before(since)
+}
+
+// Chunk coords (X, Z) of the most recent point in this trail.
+func (t PlayerTrail) LastChunk() [2]int {
+	last := t.Last()
+	return [2]int{int(floorDiv(last.X, 16)), int(floorDiv(last.Z, 16))}
+}
+
+// Integer division that rounds towards negative infinity, matching how Minecraft maps blocks to chunks.
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if (a%b != 0) && ((a < 0) != (b < 0)) {
+		q--
+	}
+
+	return q
+}
+
+// Appends the current location of every visible player to their trail, then prunes points (and entire trails)
+// older than the retention duration. The number of trails updated and removed is returned for logging purposes.
+func UpdatePlayerTrails(
+	trailStore *store.Store[PlayerTrail], players []mapi.MapPlayer,
+	now time.Time, retention time.Duration,
+) (updated, removed int) {
+	nowMs := now.UnixMilli()
+	for _, p := range players {
+		uuid := mapi.NormalizeUUID(p.UUID)
+
+		trail, _ := trailStore.Get(uuid)
+		if trail == nil {
+			trail = &PlayerTrail{UUID: uuid}
+		}
+
+		trail.Name = p.Name // keep up to date incase of name change
+		trail.Points = append(trail.Points, TrailPoint{
+			Location:  p.Location,
+			World:     p.World,
+			Timestamp: nowMs,
+		})
+		if len(trail.Points) > MAX_TRAIL_POINTS {
+			trail.Points = trail.Points[len(trail.Points)-MAX_TRAIL_POINTS:]
+		}
+
+		trailStore.Set(uuid, *trail)
+		updated++
+	}
+
+	cutoff := now.Add(-retention).UnixMilli()
+	for uuid, trail := range trailStore.Entries() {
+		idx := 0
+		for idx < len(trail.Points) && trail.Points[idx].Timestamp < cutoff {
+			idx++
+		}
+		if idx == 0 {
+			continue
+		}
+
+		if idx == len(trail.Points) {
+			trailStore.Delete(uuid)
+			removed++
+			continue
+		}
+
+		trail.Points = trail.Points[idx:]
+		trailStore.Set(uuid, trail)
+	}
+
+	return
+}
+
+// Finds the trail of a player by their name (case-insensitive) or UUID, only keeping points at or after since.
+//
+// Trails are only pruned while tracking is running, so without since a trail left over from before tracking
+// stopped (or the bot went down) would be shown as if it were recent.
+func FindPlayerTrail(trailStore *store.Store[PlayerTrail], nameOrUUID string, since time.Time) (*PlayerTrail, error) {
+	trail, _ := trailStore.Find(func(t PlayerTrail) bool {
+		return strings.EqualFold(t.Name, nameOrUUID) || t.UUID == nameOrUUID
+	})
+	if trail == nil {
+		return nil, fmt.Errorf("no trail exists for player %s", nameOrUUID)
+	}
+
+	sinceMs := since.UnixMilli()
+	idx := 0
+	for idx < len(trail.Points) && trail.Points[idx].Timestamp < sinceMs {
+		idx++
+	}
+	if idx == len(trail.Points) {
+		return nil, fmt.Errorf("player %s has not been seen since %s", nameOrUUID, since.Format(time.DateTime))
+	}
+
+	trail.Points = trail.Points[idx:]
+	return trail, nil
+}
+
+// Gets the trails of all players whose last known location since the given time is within the town's claims.
+func TrailsInTown(trailStore *store.Store[PlayerTrail], town oapi.TownInfo, since time.Time) []PlayerTrail {
+	claimed := make(map[[2]int]struct{}, len(town.Coordinates.TownBlocks))
+	for _, tb := range town.Coordinates.TownBlocks {
+		if len(tb) >= 2 {
+			claimed[[2]int{tb[0], tb[1]}] = struct{}{}
+		}
+	}
+
+	return trailStore.FindAll(func(t PlayerTrail) bool {
+		if !t.SeenSince(since) {
+			return false
+		}
+
+		_, ok := claimed[t.LastChunk()]
+		return ok
+	})
+}
+
+// Gets the trails of all players whose last known location since the given time is within radius (in blocks) of X, Z.
+func TrailsNear(trailStore *store.Store[PlayerTrail], x, z, radius float64, since time.Time) []PlayerTrail {
+	return trailStore.FindAll(func(t PlayerTrail) bool {
+		if !t.SeenSince(since) {
+			return false
+		}
+
+		last := t.Last()
+		return geometry.WithinEuclideanRadius2D(float64(last.X), float64(last.Z), x, z, radius)
+	})
+}
@@ -0,0 +1,166 @@
+package database
+
+import (
+	"emcsrw/pkg/api/oapi"
+	"slices"
+	"time"
+)
+
+const VOTEPARTY_KEY = "state"
+
+const VP_SAMPLE_INTERVAL = 1 * time.Minute // Min time between samples while the remaining votes haven't changed.
+const VP_SAMPLE_RETENTION = 48 * time.Hour // How long samples are kept for. Must cover VP_TREND_HOURS.
+const VP_RATE_WINDOW = 15 * time.Minute    // Rate and ETA are worked out from the votes cast within this window.
+const VP_MAX_COMPLETIONS = 100             // Amount of past VoteParties to remember.
+const VP_TREND_HOURS = 24                  // Amount of hourly buckets shown in the /vp trend chart.
+
+// Used for the VP_CHANNEL_ID channel and any guild that hasn't set its own.
+var VP_DEFAULT_THRESHOLDS = []int{500, 300, 150, 50}
+
+type VotePartySample struct {
+	Time      int64 `json:"time"` // Unix timestamp (ms)
+	Target    int   `json:"target"`
+	Remaining int   `json:"remaining"`
+}
+
+type VotePartyCompletion struct {
+	CompletedAt int64 `json:"completedAt"` // Unix timestamp (ms) of the first sample after it happened.
+	Target      int   `json:"target"`
+}
+
+// Everything we know about the VoteParty over time. Persisted so rate/ETA and notifications survive restarts.
+type VotePartyState struct {
+	Samples     []VotePartySample     `json:"samples"`     // Oldest first.
+	Completions []VotePartyCompletion `json:"completions"` // Oldest first.
+}
+
+func (st VotePartyState) Latest() (VotePartySample, bool) {
+	if len(st.Samples) == 0 {
+		return VotePartySample{}, false
+	}
+
+	return st.Samples[len(st.Samples)-1], true
+}
+
+// Amount of votes cast between two consecutive samples. If the VoteParty happened in between,
+// that's whatever was left before it plus whatever has been done towards the next one.
+func votesBetween(prev, cur VotePartySample) int {
+	if cur.Remaining <= prev.Remaining {
+		return prev.Remaining - cur.Remaining
+	}
+
+	return prev.Remaining + (cur.Target - cur.Remaining)
+}
+
+// Records the current VoteParty status, returning the previous sample (if any) and whether a VoteParty
+// happened since then. Samples are only kept every VP_SAMPLE_INTERVAL unless the remaining votes changed.
+func (st *VotePartyState) Record(vp oapi.ServerVoteParty, now time.Time) (prev *VotePartySample, completed bool) {
+	cur := VotePartySample{Time: now.UnixMilli(), Target: vp.Target, Remaining: vp.NumRemaining}
+
+	// The state usually comes straight from a store, so don't append to or delete from the slices it shares.
+	st.Samples = slices.Clone(st.Samples)
+	st.Completions = slices.Clone(st.Completions)
+
+	if last, ok := st.Latest(); ok {
+		prev = &last
+
+		// Hitting 0 counts as completing, as does going back up (if we never saw it hit 0).
+		completed = last.Remaining > 0 && (cur.Remaining == 0 || cur.Remaining > last.Remaining)
+		if completed {
+			st.Completions = append(st.Completions, VotePartyCompletion{CompletedAt: cur.Time, Target: last.Target})
+			if len(st.Completions) > VP_MAX_COMPLETIONS {
+				st.Completions = st.Completions[len(st.Completions)-VP_MAX_COMPLETIONS:]
+			}
+		}
+
+		if cur.Remaining == last.Remaining && now.Sub(time.UnixMilli(last.Time)) < VP_SAMPLE_INTERVAL {
+			return prev, completed
+		}
+	}
+
+	st.Samples = append(st.Samples, cur)
+
+	cutoff := now.Add(-VP_SAMPLE_RETENTION).UnixMilli()
+	st.Samples = slices.DeleteFunc(st.Samples, func(s VotePartySample) bool { return s.Time < cutoff })
+
+	return prev, completed
+}
+
+// Votes per minute over the last VP_RATE_WINDOW. Zero if there aren't enough samples to tell.
+func (st VotePartyState) Rate(now time.Time) float64 {
+	from := now.Add(-VP_RATE_WINDOW).UnixMilli()
+
+	votes, start, end := 0, int64(0), int64(0)
+	for i := 1; i < len(st.Samples); i++ {
+		prev, cur := st.Samples[i-1], st.Samples[i]
+		if prev.Time < from {
+			continue
+		}
+		if start == 0 {
+			start = prev.Time
+		}
+
+		votes += votesBetween(prev, cur)
+		end = cur.Time
+	}
+
+	minutes := (time.Duration(end-start) * time.Millisecond).Minutes()
+	if votes <= 0 || minutes < 1 {
+		return 0
+	}
+
+	return float64(votes) / minutes
+}
+
+// How long until the next VoteParty at the current rate. Zero if unknown.
+func (st VotePartyState) ETA(now time.Time) time.Duration {
+	latest, ok := st.Latest()
+	rate := st.Rate(now)
+	if !ok || rate <= 0 {
+		return 0
+	}
+
+	return time.Duration(float64(latest.Remaining) / rate * float64(time.Minute))
+}
+
+// Votes cast in each of the last `hours` hours, oldest first. The last bucket is the current (partial) hour.
+func (st VotePartyState) HourlyVotes(now time.Time, hours int) []int {
+	buckets := make([]int, hours)
+	end := now.Truncate(time.Hour).Add(time.Hour)
+	start := end.Add(-time.Duration(hours) * time.Hour)
+
+	for i := 1; i < len(st.Samples); i++ {
+		prev, cur := st.Samples[i-1], st.Samples[i]
+
+		t := time.UnixMilli(cur.Time)
+		if t.Before(start) || !t.Before(end) {
+			continue
+		}
+
+		buckets[int(t.Sub(start)/time.Hour)] += votesBetween(prev, cur)
+	}
+
+	return buckets
+}
+
+// Average time between the recorded VoteParties. Zero if less than 2 were recorded.
+func (st VotePartyState) AverageInterval() time.Duration {
+	if len(st.Completions) < 2 {
+		return 0
+	}
+
+	first, last := st.Completions[0], st.Completions[len(st.Completions)-1]
+	return time.Duration(last.CompletedAt-first.CompletedAt) * time.Millisecond / time.Duration(len(st.Completions)-1)
+}
+
+// The lowest of thresholds that the remaining votes went below (or hit) between prev and cur, if any.
+func CrossedVotePartyThreshold(thresholds []int, prev, cur int) (int, bool) {
+	crossed, ok := 0, false
+	for _, t := range thresholds {
+		if prev > t && cur <= t && (!ok || t < crossed) {
+			crossed, ok = t, true
+		}
+	}
+
+	return crossed, ok
+}
@@ -0,0 +1,184 @@
+package database
+
+import (
+	"emcsrw/internal/database/store"
+	"errors"
+	"slices"
+	"time"
+)
+
+const WATCHLIST_MAX_ENTRIES = 25 // Max amount of towns, nations and players a single user can watch.
+const WATCH_ALERT_LIMIT = 6      // Max amount of alert DMs a user can receive within WATCH_ALERT_WINDOW.
+const WATCH_ALERT_WINDOW = 1 * time.Hour
+
+var ErrWatchlistFull = errors.New("watchlist is full")
+var ErrAlreadyWatching = errors.New("already watching")
+
+type WatchKind string
+
+const (
+	WatchPlayer WatchKind = "player"
+	WatchTown   WatchKind = "town"
+	WatchNation WatchKind = "nation"
+)
+
+var WATCH_KINDS = []WatchKind{WatchPlayer, WatchTown, WatchNation}
+
+type WatchedEntity struct {
+	Kind    WatchKind `json:"kind"`
+	UUID    string    `json:"uuid"`
+	Name    string    `json:"name"`    // Name when it was added, only used for display if it no longer exists.
+	AddedAt int64     `json:"addedAt"` // Unix timestamp (ms)
+}
+
+type Watchlist struct {
+	UserID         string          `json:"userID"`
+	Entries        []WatchedEntity `json:"entries"`
+	AlertsDisabled bool            `json:"alertsDisabled,omitempty"` // Opted out, or DMs to the user failed.
+	AlertTimes     []int64         `json:"alertTimes,omitempty"`     // Unix timestamps (ms) of alerts sent within WATCH_ALERT_WINDOW.
+	Suppressed     int             `json:"suppressed,omitempty"`     // Alerts dropped by the rate limit since the last one sent.
+}
+
+func (w Watchlist) Watching(kind WatchKind, uuid string) bool {
+	return slices.ContainsFunc(w.Entries, func(e WatchedEntity) bool {
+		return e.Kind == kind && e.UUID == uuid
+	})
+}
+
+// Records an alert being sent at now if the user hasn't hit WATCH_ALERT_LIMIT, returning whether it can be sent.
+// Alerts over the limit are counted in Suppressed instead.
+func (w *Watchlist) TryAlert(now time.Time, count int) bool {
+	cutoff := now.Add(-WATCH_ALERT_WINDOW).UnixMilli()
+	w.AlertTimes = slices.DeleteFunc(slices.Clone(w.AlertTimes), func(ts int64) bool { return ts <= cutoff }) // may still be shared with the store
+
+	if len(w.AlertTimes) >= WATCH_ALERT_LIMIT {
+		w.Suppressed += count
+		return false
+	}
+
+	w.AlertTimes = append(w.AlertTimes, now.UnixMilli())
+	return true
+}
+
+// Adds an entity to a user's watchlist, creating the watchlist if it doesn't exist.
+func AddWatch(watchStore *store.Store[Watchlist], userID string, entity WatchedEntity) (err error) {
+	entity.AddedAt = time.Now().UnixMilli()
+	watchStore.Update(userID, func(existing *Watchlist) (Watchlist, bool) {
+		w := Watchlist{UserID: userID}
+		if existing != nil {
+			w = *existing
+		}
+
+		if w.Watching(entity.Kind, entity.UUID) {
+			err = ErrAlreadyWatching
+		} else if len(w.Entries) >= WATCHLIST_MAX_ENTRIES {
+			err = ErrWatchlistFull
+		} else {
+			w.Entries = append(slices.Clone(w.Entries), entity)
+		}
+
+		return w, true
+	})
+
+	return err
+}
+
+// Removes an entity from a user's watchlist. Returns false if they weren't watching it.
+func RemoveWatch(watchStore *store.Store[Watchlist], userID string, kind WatchKind, uuid string) (removed bool) {
+	watchStore.Update(userID, func(existing *Watchlist) (Watchlist, bool) {
+		if existing == nil {
+			return Watchlist{}, false
+		}
+
+		w := *existing
+		if removed = w.Watching(kind, uuid); removed {
+			w.Entries = slices.DeleteFunc(slices.Clone(w.Entries), func(e WatchedEntity) bool {
+				return e.Kind == kind && e.UUID == uuid
+			})
+		}
+
+		return w, true
+	})
+
+	return removed
+}
+
+// Turns a user's alert DMs on or off, creating their watchlist if it doesn't exist.
+func SetWatchAlerts(watchStore *store.Store[Watchlist], userID string, enabled bool) {
+	watchStore.Update(userID, func(existing *Watchlist) (Watchlist, bool) {
+		w := Watchlist{UserID: userID}
+		if existing != nil {
+			w = *existing
+		}
+
+		w.AlertsDisabled = !enabled
+		w.Suppressed = 0
+		return w, true
+	})
+}
+
+// Uses up one of a user's alerts if they haven't hit the rate limit (see TryAlert), returning whether it can be sent along
+// with how many alerts were suppressed before it. The user's latest watchlist is used, since the DM is sent after this.
+func ReserveWatchAlert(watchStore *store.Store[Watchlist], userID string, now time.Time, count int) (allowed bool, suppressed int) {
+	watchStore.Update(userID, func(existing *Watchlist) (Watchlist, bool) {
+		if existing == nil {
+			return Watchlist{}, false
+		}
+
+		w := *existing
+		if w.AlertsDisabled {
+			return w, true // opted out since the alerts were worked out
+		}
+
+		if allowed = w.TryAlert(now, count); allowed {
+			suppressed, w.Suppressed = w.Suppressed, 0
+		}
+
+		return w, true
+	})
+
+	return allowed, suppressed
+}
+
+// Records the outcome of an alert DM reserved with ReserveWatchAlert. Alerts are disabled if the user can't be DMed,
+// otherwise a failed DM counts its alerts (and the ones suppressed before it) as suppressed again.
+func FinishWatchAlert(watchStore *store.Store[Watchlist], userID string, sent, cannotDM bool, count, suppressed int) {
+	if sent {
+		return
+	}
+
+	watchStore.Update(userID, func(existing *Watchlist) (Watchlist, bool) {
+		if existing == nil {
+			return Watchlist{}, false
+		}
+
+		w := *existing
+		if cannotDM {
+			w.AlertsDisabled = true
+		} else {
+			w.Suppressed += suppressed + count
+		}
+
+		return w, true
+	})
+}
+
+// Every user watching each entity, keyed by kind then UUID. Users with alerts disabled are left out.
+func WatchersIndex(watchStore *store.Store[Watchlist]) map[WatchKind]map[string][]string {
+	index := make(map[WatchKind]map[string][]string)
+	for _, kind := range WATCH_KINDS {
+		index[kind] = make(map[string][]string)
+	}
+
+	for userID, w := range watchStore.Entries() {
+		if w.AlertsDisabled {
+			continue
+		}
+
+		for _, e := range w.Entries {
+			index[e.Kind][e.UUID] = append(index[e.Kind][e.UUID], userID)
+		}
+	}
+
+	return index
+}
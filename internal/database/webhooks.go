@@ -0,0 +1,396 @@
+package database
+
+import (
+	"cmp"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"emcsrw/internal/database/store"
+	"encoding/hex"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Every secret starts with this so it can be easily recognised (and picked up by secret scanners) if leaked.
+const WEBHOOK_SECRET_PREFIX = "whsec_"
+
+const WEBHOOK_MAX_ATTEMPTS = 8                           // Deliveries are dead-lettered after failing this many times.
+const WEBHOOK_BASE_BACKOFF = 30 * time.Second            // Wait after the first failed attempt, doubled for every one after.
+const WEBHOOK_MAX_BACKOFF = time.Hour                    // Longest wait between two attempts.
+const WEBHOOK_DEAD_LETTER_RETENTION = 7 * 24 * time.Hour // How long dead deliveries are kept around to be retried.
+
+// Headers sent with every delivery. The signature is "sha256=" followed by the hex HMAC-SHA256 of
+// "<timestamp>.<body>" using the webhook's secret, see SignWebhookPayload.
+const (
+	WEBHOOK_SIGNATURE_HEADER = "X-EMCS-Signature"
+	WEBHOOK_TIMESTAMP_HEADER = "X-EMCS-Timestamp" // Unix timestamp (seconds) the signature was made at.
+	WEBHOOK_EVENT_HEADER     = "X-EMCS-Event"     // Like "townflow.ruined"
+	WEBHOOK_DELIVERY_HEADER  = "X-EMCS-Delivery"  // Same on every attempt so receivers can ignore duplicates.
+)
+
+// Topics of the events computed by DataUpdate, which are the only ones sent to webhooks.
+var WEBHOOK_TOPICS = []StreamTopic{StreamTopicTownFlow, StreamTopicNationFlow, StreamTopicPlayerFlow}
+
+// Webhooks and their deliveries are managed by the CLI as well as the bot, so like API keys they use OpenStore.
+// This only guards against the bot's own tasks and commands changing deliveries at the same time.
+var webhookDeliveryMu sync.Mutex
+
+// An HTTP(S) endpoint that receives events as signed JSON.
+type Webhook struct {
+	ID        string   `json:"id"`
+	URL       string   `json:"url"`
+	Events    []string `json:"events"`    // A topic like "townflow" for all of its events, or "townflow.ruined" for a single type.
+	Secret    string   `json:"secret"`    // Shared with the receiver to verify deliveries, so it has to be stored as is.
+	CreatedBy string   `json:"createdBy"` // Discord user ID of whoever created it, or "cli".
+	CreatedAt int64    `json:"createdAt"` // Unix timestamp (ms)
+}
+
+func (w Webhook) Subscribed(topic StreamTopic, eventType string) bool {
+	return slices.Contains(w.Events, string(topic)) || slices.Contains(w.Events, string(topic)+"."+eventType)
+}
+
+// Parses a comma separated list of events like "townflow, nationflow.merged", making sure each is of a WEBHOOK_TOPICS topic.
+func ParseWebhookEvents(s string) ([]string, error) {
+	events := []string{}
+	for event := range strings.SplitSeq(s, ",") {
+		event = strings.ToLower(strings.TrimSpace(event))
+		if event == "" {
+			continue
+		}
+
+		topic, _, _ := strings.Cut(event, ".")
+		if !slices.Contains(WEBHOOK_TOPICS, StreamTopic(topic)) {
+			return nil, fmt.Errorf("invalid event '%s'. expected one of %v, optionally followed by .<type>", event, WEBHOOK_TOPICS)
+		}
+
+		if !slices.Contains(events, event) {
+			events = append(events, event)
+		}
+	}
+
+	if len(events) == 0 {
+		return nil, fmt.Errorf("at least one event is required")
+	}
+
+	return events, nil
+}
+
+// Whether deliveries may be sent to an address. Loopback, private, link-local and unspecified addresses are refused
+// so a webhook can't be used to reach services on the bot's own host or network. Checked again when connecting,
+// since a hostname can resolve to anything.
+func WebhookAddrAllowed(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsValid() && addr.IsGlobalUnicast() && !addr.IsPrivate()
+}
+
+func validateWebhookURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("'%s' is not a valid HTTP(S) URL", rawURL)
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("'%s' points to this machine", rawURL)
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && !WebhookAddrAllowed(addr) {
+		return fmt.Errorf("'%s' is not a public address", rawURL)
+	}
+
+	return nil
+}
+
+// Registers a new webhook with a generated secret. Unlike API keys the secret can always be looked up again.
+func CreateWebhook(hookStore *store.Store[Webhook], rawURL string, events []string, createdBy string) (*Webhook, error) {
+	if err := validateWebhookURL(rawURL); err != nil {
+		return nil, err
+	}
+
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	id, err := newPublicID(hookStore.HasKey)
+	if err != nil {
+		return nil, err
+	}
+
+	hook := Webhook{
+		ID:        id,
+		URL:       rawURL,
+		Events:    events,
+		Secret:    WEBHOOK_SECRET_PREFIX + hex.EncodeToString(secret),
+		CreatedBy: createdBy,
+		CreatedAt: time.Now().UnixMilli(),
+	}
+
+	hookStore.Set(hook.ID, hook)
+	if err := hookStore.WriteSnapshot(); err != nil {
+		return nil, err
+	}
+
+	return &hook, nil
+}
+
+// Deletes the webhook with the given ID along with all of its deliveries, pending or dead.
+func DeleteWebhook(mdb *Database, hookStore *store.Store[Webhook], id string) (*Webhook, error) {
+	hook, err := hookStore.Get(id)
+	if err != nil {
+		return nil, fmt.Errorf("no webhook exists with id %s", id)
+	}
+
+	hookStore.Delete(id)
+	if err := hookStore.WriteSnapshot(); err != nil {
+		return nil, err
+	}
+
+	webhookDeliveryMu.Lock()
+	defer webhookDeliveryMu.Unlock()
+
+	deliveryStore, err := OpenStore(mdb, WEBHOOK_DELIVERIES_STORE)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, d := range deliveryStore.FindAll(func(d WebhookDelivery) bool { return d.WebhookID == id }) {
+		deliveryStore.Delete(d.ID)
+	}
+
+	return hook, deliveryStore.WriteSnapshot()
+}
+
+// All webhooks, newest first.
+func ListWebhooks(hookStore *store.Store[Webhook]) []Webhook {
+	return hookStore.ValuesSorted(func(a, b Webhook) int {
+		return cmp.Compare(b.CreatedAt, a.CreatedAt)
+	})
+}
+
+// Returns the signature header value for a delivery body sent at ts (Unix seconds).
+func SignWebhookPayload(secret string, ts int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", ts)
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookPending WebhookDeliveryStatus = "pending"
+	WebhookDead    WebhookDeliveryStatus = "dead" // Ran out of attempts, only retried by hand.
+)
+
+// A single event waiting to be (or that failed to be) sent to a single webhook.
+type WebhookDelivery struct {
+	ID            string                `json:"id"` // Event ID and webhook ID, see webhookDeliveryID.
+	WebhookID     string                `json:"webhookID"`
+	Event         StreamEvent           `json:"event"`
+	Status        WebhookDeliveryStatus `json:"status"`
+	Attempts      int                   `json:"attempts"`
+	NextAttemptAt int64                 `json:"nextAttemptAt"` // Unix timestamp (ms)
+	LastError     string                `json:"lastError,omitempty"`
+	UpdatedAt     int64                 `json:"updatedAt"` // Unix timestamp (ms)
+}
+
+// Starts with the event ID, which sorts by time, so sorting deliveries by ID puts them in the order the events happened.
+func webhookDeliveryID(eventID, webhookID string) string {
+	return eventID + ":" + webhookID
+}
+
+// How long to wait before the next attempt after failing `attempts` times.
+func WebhookBackoff(attempts int) time.Duration {
+	backoff := WEBHOOK_BASE_BACKOFF
+	for i := 1; i < attempts && backoff < WEBHOOK_MAX_BACKOFF; i++ {
+		backoff *= 2
+	}
+
+	return min(backoff, WEBHOOK_MAX_BACKOFF)
+}
+
+// Records a failed attempt, scheduling the next one or dead-lettering it once out of attempts.
+func (d *WebhookDelivery) Fail(reason string, now time.Time) {
+	d.Attempts++
+	d.LastError = reason
+	d.UpdatedAt = now.UnixMilli()
+
+	if d.Attempts >= WEBHOOK_MAX_ATTEMPTS {
+		d.Status = WebhookDead
+		return
+	}
+
+	d.NextAttemptAt = now.Add(WebhookBackoff(d.Attempts)).UnixMilli()
+}
+
+// Queues a delivery of every event to every webhook subscribed to it.
+func QueueWebhookDeliveries(mdb *Database, events []StreamEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	hookStore, err := OpenStore(mdb, WEBHOOKS_STORE)
+	if err != nil {
+		return err
+	}
+
+	hooks := hookStore.Values()
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	webhookDeliveryMu.Lock()
+	defer webhookDeliveryMu.Unlock()
+
+	deliveryStore, err := OpenStore(mdb, WEBHOOK_DELIVERIES_STORE)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UnixMilli()
+	for _, e := range events {
+		for _, hook := range hooks {
+			if !hook.Subscribed(e.Topic, e.Type) {
+				continue
+			}
+
+			id := webhookDeliveryID(e.ID, hook.ID)
+			deliveryStore.Set(id, WebhookDelivery{
+				ID: id, WebhookID: hook.ID, Event: e,
+				Status: WebhookPending, NextAttemptAt: now, UpdatedAt: now,
+			})
+		}
+	}
+
+	return deliveryStore.WriteSnapshot()
+}
+
+// Pending deliveries whose next attempt is due, oldest event first.
+//
+// A webhook's deliveries are held back while an earlier one of its own is waiting to be retried. This keeps them in the
+// order the events happened, and means an endpoint that's down only gets the retries rather than every new event too.
+func DueWebhookDeliveries(deliveryStore *store.Store[WebhookDelivery], now time.Time) []WebhookDelivery {
+	pending := deliveryStore.FindAll(func(d WebhookDelivery) bool {
+		return d.Status == WebhookPending
+	})
+
+	slices.SortFunc(pending, func(a, b WebhookDelivery) int { return strings.Compare(a.ID, b.ID) })
+
+	due := []WebhookDelivery{}
+	waiting := make(map[string]bool) // webhook IDs with an earlier delivery that isn't due yet
+	for _, d := range pending {
+		if waiting[d.WebhookID] {
+			continue
+		}
+		if d.NextAttemptAt > now.UnixMilli() {
+			waiting[d.WebhookID] = true
+			continue
+		}
+
+		due = append(due, d)
+	}
+
+	return due
+}
+
+// Applies the outcome of delivery attempts made by the bot. Deliveries in `delivered` (or to webhooks that no longer exist)
+// are removed, ones in `failed` are retried later or dead-lettered. Dead deliveries past their retention are also pruned.
+//
+// When a delivery is dead-lettered, the webhook's later pending ones are too. Otherwise they'd go out ahead of it,
+// and retrying them all together keeps them in order.
+//
+// The store is reopened since the CLI may have changed it while the attempts were being made.
+func ApplyWebhookDeliveryResults(mdb *Database, delivered []string, failed map[string]string, now time.Time) error {
+	hookStore, err := OpenStore(mdb, WEBHOOKS_STORE)
+	if err != nil {
+		return err
+	}
+
+	webhookDeliveryMu.Lock()
+	defer webhookDeliveryMu.Unlock()
+
+	deliveryStore, err := OpenStore(mdb, WEBHOOK_DELIVERIES_STORE)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range delivered {
+		deliveryStore.Delete(id)
+	}
+
+	died := make(map[string]string) // webhook ID -> earliest of its deliveries that just ran out of attempts
+	for id, reason := range failed {
+		d, err := deliveryStore.Get(id)
+		if err != nil {
+			continue
+		}
+
+		d.Fail(reason, now)
+		deliveryStore.Set(id, *d)
+
+		if first, ok := died[d.WebhookID]; d.Status == WebhookDead && (!ok || id < first) {
+			died[d.WebhookID] = id
+		}
+	}
+
+	for id, d := range deliveryStore.Entries() {
+		if first, ok := died[d.WebhookID]; ok && d.Status == WebhookPending && id > first {
+			d.Status = WebhookDead
+			d.LastError = fmt.Sprintf("held back behind %s, which ran out of attempts", first)
+			d.UpdatedAt = now.UnixMilli()
+			deliveryStore.Set(id, d)
+		}
+	}
+
+	cutoff := now.Add(-WEBHOOK_DEAD_LETTER_RETENTION).UnixMilli()
+	for id, d := range deliveryStore.Entries() {
+		if !hookStore.HasKey(d.WebhookID) || (d.Status == WebhookDead && d.UpdatedAt < cutoff) {
+			deliveryStore.Delete(id)
+		}
+	}
+
+	return deliveryStore.WriteSnapshot()
+}
+
+// Dead deliveries, newest failure first. An empty webhookID lists them for every webhook.
+func DeadWebhookDeliveries(deliveryStore *store.Store[WebhookDelivery], webhookID string) []WebhookDelivery {
+	dead := deliveryStore.FindAll(func(d WebhookDelivery) bool {
+		return d.Status == WebhookDead && (webhookID == "" || d.WebhookID == webhookID)
+	})
+
+	slices.SortFunc(dead, func(a, b WebhookDelivery) int { return cmp.Compare(b.UpdatedAt, a.UpdatedAt) })
+	return dead
+}
+
+// Gives dead deliveries a fresh set of attempts, starting on the next delivery run. An empty webhookID retries
+// them for every webhook. Returns how many were requeued.
+func RetryDeadWebhookDeliveries(mdb *Database, webhookID string, now time.Time) (int, error) {
+	webhookDeliveryMu.Lock()
+	defer webhookDeliveryMu.Unlock()
+
+	deliveryStore, err := OpenStore(mdb, WEBHOOK_DELIVERIES_STORE)
+	if err != nil {
+		return 0, err
+	}
+
+	dead := DeadWebhookDeliveries(deliveryStore, webhookID)
+	for _, d := range dead {
+		d.Status = WebhookPending
+		d.Attempts = 0
+		d.NextAttemptAt = now.UnixMilli()
+		d.UpdatedAt = now.UnixMilli()
+		deliveryStore.Set(d.ID, d)
+	}
+
+	if len(dead) == 0 {
+		return 0, nil
+	}
+
+	return len(dead), deliveryStore.WriteSnapshot()
+}
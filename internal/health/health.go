@@ -0,0 +1,302 @@
+// Builds the reports served at /healthz and /readyz by both the bot and the Custom API.
+//
+// Uptime monitors can only tell whether a process is dead by pinging it, which doesn't help when it's alive but serving
+// data from hours ago because the Official API (or our DataUpdate task) has been failing. These reports go non-200 in that case too.
+package health
+
+import (
+	"cmp"
+	"emcsrw/internal/database"
+	"emcsrw/internal/shared"
+	"emcsrw/pkg/api/oapi"
+	"emcsrw/pkg/utils/config"
+	"emcsrw/pkg/utils/logutil"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+// How old the data of the active map can get before we are considered stale, unless HEALTH_MAX_AGE_MINS is set.
+const DEFAULT_MAX_AGE = 10 * time.Minute
+
+// Tasks whose last successful run decides how fresh the data of the active map is.
+var FRESHNESS_TASKS = []string{"DataUpdate", "FallingTowns", "ServerInfo"}
+
+type Status string
+
+const (
+	StatusOK       Status = "ok"
+	StatusStarting Status = "starting" // Data isn't there yet but we only just started, give it a chance.
+	StatusStale    Status = "stale"    // Data is older than the max age.
+	StatusDown     Status = "down"     // Something we depend on (like the Discord gateway) is unavailable.
+)
+
+// Worse statuses have a higher rank, the worst of all checks is the overall status.
+func (s Status) rank() int {
+	return slices.Index([]Status{StatusOK, StatusStarting, StatusStale, StatusDown}, s)
+}
+
+// Whether the process is alive and not serving stale data. Starting up counts as healthy.
+func (s Status) Healthy() bool {
+	return s == StatusOK || s == StatusStarting
+}
+
+// Whether the process is fully up and its data is fresh.
+func (s Status) Ready() bool {
+	return s == StatusOK
+}
+
+type TaskReport struct {
+	database.TaskRun
+	Age   int64 `json:"age"` // Seconds since the last successful run started, -1 if it never succeeded.
+	Stale bool  `json:"stale"`
+}
+
+type MapReport struct {
+	Name   string                `json:"name"`
+	Active bool                  `json:"active"` // Only the active map is updated by the bot, so only it can go stale.
+	Tasks  map[string]TaskReport `json:"tasks"`
+	Stores map[string]int        `json:"stores"` // Store name -> amount of entries.
+}
+
+type Report struct {
+	Status   Status      `json:"status"`
+	Process  string      `json:"process"`
+	Uptime   int64       `json:"uptime"` // Seconds
+	MaxAge   int64       `json:"maxAge"` // Seconds
+	Maps     []MapReport `json:"maps"`
+	Problems []string    `json:"problems,omitempty"`
+
+	// These come from the bot. The API reports the last heartbeat the bot wrote, which may be missing if it never ran.
+	BotUpdatedAt int64                   `json:"botUpdatedAt,omitempty"` // Unix timestamp (ms)
+	Discord      *database.GatewayStatus `json:"discord,omitempty"`
+	OAPI         *oapi.CircuitStatus     `json:"oapi,omitempty"`
+}
+
+type Checker struct {
+	Process   string
+	StartedAt time.Time
+	MaxAge    time.Duration
+	Maps      []*database.Database
+	Active    string // Name of the map whose data has to be fresh. Defaults to shared.ACTIVE_MAP.
+
+	// Returns the live status of the bot. Only set within the bot process itself,
+	// otherwise the last heartbeat is read from the active map's BOT_STATUS_STORE.
+	Bot func() database.BotStatus
+
+	// How often to reload task runs and bot status from file when checking. Zero = never.
+	// Needed by any process other than the bot, since the bot is the only one that writes them.
+	// Checks in between use what was last loaded, so hammering the endpoints can't force constant disk reads.
+	ReloadEvery time.Duration
+
+	reloadedAt time.Time
+	reloadMu   sync.Mutex
+}
+
+// Gets the max age from HEALTH_MAX_AGE_MINS, falling back to DEFAULT_MAX_AGE if unset or invalid.
+func MaxAgeFromEnv() time.Duration {
+	v, err := config.GetEnviroVar("HEALTH_MAX_AGE_MINS")
+	if err != nil {
+		return DEFAULT_MAX_AGE
+	}
+
+	mins, err := config.ParseEnviroVar[uint](v)
+	if err != nil || mins == 0 {
+		logutil.Printf(logutil.YELLOW, "\nWARN | Invalid HEALTH_MAX_AGE_MINS. Using default of %s.\n", DEFAULT_MAX_AGE)
+		return DEFAULT_MAX_AGE
+	}
+
+	return time.Duration(mins) * time.Minute
+}
+
+func (c *Checker) activeMap() string {
+	if c.Active == "" {
+		return shared.ACTIVE_MAP
+	}
+
+	return c.Active
+}
+
+// Whether this check should reload from file, claiming the reload so concurrent checks don't do it too.
+func (c *Checker) claimReload(now time.Time) bool {
+	if c.ReloadEvery <= 0 {
+		return false
+	}
+
+	c.reloadMu.Lock()
+	defer c.reloadMu.Unlock()
+
+	if now.Sub(c.reloadedAt) < c.ReloadEvery {
+		return false
+	}
+
+	c.reloadedAt = now
+	return true
+}
+
+func (c *Checker) Check() Report {
+	now := time.Now()
+	uptime := now.Sub(c.StartedAt)
+	reload := c.claimReload(now)
+
+	report := Report{
+		Status:  StatusOK,
+		Process: c.Process,
+		Uptime:  int64(uptime.Seconds()),
+		MaxAge:  int64(c.MaxAge.Seconds()),
+		Maps:    []MapReport{},
+	}
+
+	fail := func(status Status, format string, args ...any) {
+		if status.rank() > report.Status.rank() {
+			report.Status = status
+		}
+
+		report.Problems = append(report.Problems, fmt.Sprintf(format, args...))
+	}
+
+	// Missing data is expected for a little while after starting, after that it's just as bad as stale data.
+	missing := lo.Ternary(uptime < c.MaxAge, StatusStarting, StatusStale)
+
+	for _, mdb := range c.Maps {
+		mapReport := MapReport{
+			Name:   mdb.Name(),
+			Active: mdb.Name() == c.activeMap(),
+			Tasks:  map[string]TaskReport{},
+			Stores: mdb.StoreCounts(),
+		}
+
+		runStore, err := database.GetStore(mdb, database.TASK_RUNS_STORE)
+		if err != nil {
+			fail(StatusDown, "%s: %s", mdb.Name(), err)
+			report.Maps = append(report.Maps, mapReport)
+			continue
+		}
+		if reload {
+			if err := runStore.LoadFromFile(); err != nil {
+				fail(StatusDown, "%s: failed to load task runs: %s", mdb.Name(), err)
+			}
+		}
+
+		for name, run := range runStore.Entries() {
+			age := int64(-1)
+			if run.LastSuccess > 0 {
+				age = int64(now.Sub(time.UnixMilli(run.LastSuccess)).Seconds())
+			}
+
+			run.History = nil // only the latest run matters here
+			mapReport.Tasks[name] = TaskReport{
+				TaskRun: run,
+				Age:     age,
+				Stale:   age < 0 || age > report.MaxAge,
+			}
+		}
+
+		if mapReport.Active {
+			for _, name := range FRESHNESS_TASKS {
+				task, ok := mapReport.Tasks[name]
+				switch {
+				case !ok || task.Age < 0:
+					fail(missing, "%s: %s has not succeeded yet", mdb.Name(), name)
+				case task.Stale:
+					fail(StatusStale, "%s: %s last succeeded %s ago", mdb.Name(), name, time.Duration(task.Age)*time.Second)
+				}
+			}
+
+			if mapReport.Stores[database.TOWNS_STORE.Name] == 0 {
+				fail(missing, "%s: towns store is empty", mdb.Name())
+			}
+		}
+
+		report.Maps = append(report.Maps, mapReport)
+	}
+
+	slices.SortFunc(report.Maps, func(a, b MapReport) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+
+	c.checkBot(&report, now, reload, missing, fail)
+	return report
+}
+
+func (c *Checker) checkBot(report *Report, now time.Time, reload bool, missing Status, fail func(Status, string, ...any)) {
+	var bot database.BotStatus
+	if c.Bot != nil {
+		bot = c.Bot()
+
+		// Only the bot itself depends on the gateway, the API keeps serving data regardless.
+		if !bot.Gateway.Connected {
+			fail(lo.Ternary(missing == StatusStarting, StatusStarting, StatusDown), "not connected to the Discord gateway")
+		}
+	} else {
+		mdb, err := database.Get(c.activeMap())
+		if err != nil {
+			return // not serving the active map, nothing to report
+		}
+
+		statusStore, err := database.GetStore(mdb, database.BOT_STATUS_STORE)
+		if err != nil {
+			return
+		}
+		if reload {
+			_ = statusStore.LoadFromFile()
+		}
+
+		last, err := statusStore.Get(database.BOT_STATUS_KEY)
+		if err != nil {
+			report.Problems = append(report.Problems, "bot has never reported its status")
+			return
+		}
+
+		bot = *last
+		if age := now.Sub(time.UnixMilli(bot.UpdatedAt)); age > c.MaxAge {
+			// Not a failure by itself, the data freshness checks will catch it if it matters.
+			report.Problems = append(report.Problems, fmt.Sprintf("bot last reported its status %s ago", age.Round(time.Second)))
+		}
+	}
+
+	report.BotUpdatedAt = bot.UpdatedAt
+	report.Discord = &bot.Gateway
+	report.OAPI = &bot.OAPI
+
+	if bot.OAPI.State != oapi.CircuitClosed {
+		report.Problems = append(report.Problems, fmt.Sprintf("official api circuit is %s: %s", bot.OAPI.State, bot.OAPI.LastError))
+	}
+}
+
+// Serves the report as JSON, responding with 503 if the process isn't healthy (or ready, if readiness is true).
+func (c *Checker) Handler(readiness bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := c.Check()
+
+		ok := report.Status.Healthy()
+		if readiness {
+			ok = report.Status.Ready()
+		}
+
+		data, err := json.Marshal(report)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if !ok {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+
+		w.Write(data)
+	}
+}
+
+// Registers /healthz and /readyz on mux.
+func (c *Checker) Serve(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", c.Handler(false))
+	mux.HandleFunc("/readyz", c.Handler(true))
+}
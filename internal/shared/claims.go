@@ -0,0 +1,161 @@
+package shared
+
+import (
+	"bytes"
+	"emcsrw/internal/database"
+	"emcsrw/internal/database/store"
+	"emcsrw/pkg/api/oapi"
+	"emcsrw/pkg/utils/render"
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const CLAIMS_IMAGE_NAME = "claims.png"
+const CLAIMS_FILL_ALPHA = 110
+
+// Towny defaults for towns without a nation (and nations that never bothered to set a colour).
+const DEFAULT_CLAIM_FILL = "3FB4FF"
+const DEFAULT_CLAIM_OUTLINE = "000000"
+
+func townChunks(town oapi.TownInfo) [][2]int {
+	chunks := make([][2]int, 0, len(town.Coordinates.TownBlocks))
+	for _, tb := range town.Coordinates.TownBlocks {
+		if len(tb) < 2 {
+			continue
+		}
+
+		chunks = append(chunks, [2]int{tb[0], tb[1]})
+	}
+
+	return chunks
+}
+
+// Creates a single claim layer for a town using the specified HEX fill and outline colours.
+// The home block is always marked, but the spawn is only marked when markSpawn is true.
+func NewTownClaimLayer(town oapi.TownInfo, fill, outline string, markSpawn bool) render.ClaimLayer {
+	hb := town.Coordinates.HomeBlock
+	layer := render.ClaimLayer{
+		Chunks:    townChunks(town),
+		Fill:      render.HexToNRGBA(fill, CLAIMS_FILL_ALPHA),
+		Outline:   render.HexToNRGBA(outline, 255),
+		HomeBlock: &hb,
+	}
+
+	if markSpawn {
+		spawn := town.Coordinates.Spawn
+		layer.Spawn = &[2]float64{float64(spawn.X), float64(spawn.Z)}
+	}
+
+	return layer
+}
+
+// Gets all towns in the store belonging to the nation with the given UUID.
+func nationTowns(townStore *store.Store[oapi.TownInfo], nationUUID string) []oapi.TownInfo {
+	return townStore.FindAll(func(t oapi.TownInfo) bool {
+		return t.Nation.UUID != nil && *t.Nation.UUID == nationUUID
+	})
+}
+
+func nationColours(nation oapi.NationInfo) (fill, outline string) {
+	fill, outline = nation.MapColourFill, nation.MapColourOutline
+	if fill == "" {
+		fill = DEFAULT_CLAIM_FILL
+	}
+	if outline == "" {
+		outline = fill
+	}
+
+	return
+}
+
+// Wraps PNG bytes into a file that can be attached to a message and points the embed image at it.
+// If png is nil (nothing was drawn), nil is returned and the embed is left untouched.
+func attachClaimsImage(embed *discordgo.MessageEmbed, png []byte) *discordgo.File {
+	if png == nil {
+		return nil
+	}
+
+	if embed != nil {
+		embed.Image = &discordgo.MessageEmbedImage{URL: "attachment://" + CLAIMS_IMAGE_NAME}
+	}
+
+	return &discordgo.File{
+		Name:        CLAIMS_IMAGE_NAME,
+		ContentType: "image/png",
+		Reader:      bytes.NewReader(png),
+	}
+}
+
+// Renders the claims of a single town, coloured the same as its nation on the map (if it has one).
+// The returned file should be attached to the message containing the embed, whose image is set to point to it.
+func NewTownClaimsFile(embed *discordgo.MessageEmbed, town oapi.TownInfo, nationStore *store.Store[oapi.NationInfo]) (*discordgo.File, error) {
+	fill, outline := DEFAULT_CLAIM_FILL, DEFAULT_CLAIM_OUTLINE
+	if nationStore != nil && town.Nation.UUID != nil {
+		if nation, err := nationStore.Get(*town.Nation.UUID); err == nil {
+			fill, outline = nationColours(*nation)
+		}
+	}
+
+	png, err := render.RenderClaimsPNG([]render.ClaimLayer{
+		NewTownClaimLayer(town, fill, outline, true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to render claims for town %s: %w", town.Name, err)
+	}
+
+	return attachClaimsImage(embed, png), nil
+}
+
+// Renders the claims of every town in a nation using the nation's map colours.
+// Only the capital has its spawn marked, though every town has its home block marked.
+func NewNationClaimsFile(embed *discordgo.MessageEmbed, nation oapi.NationInfo, townStore *store.Store[oapi.TownInfo]) (*discordgo.File, error) {
+	fill, outline := nationColours(nation)
+
+	towns := nationTowns(townStore, nation.UUID)
+	layers := make([]render.ClaimLayer, 0, len(towns))
+	for _, t := range towns {
+		layers = append(layers, NewTownClaimLayer(t, fill, outline, t.UUID == nation.Capital.UUID))
+	}
+
+	png, err := render.RenderClaimsPNG(layers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render claims for nation %s: %w", nation.Name, err)
+	}
+
+	return attachClaimsImage(embed, png), nil
+}
+
+// Renders the combined claims of every nation in an alliance (including child alliances).
+// Nations are coloured by the alliance colours if set, otherwise each nation falls back to its own map colours.
+func NewAllianceClaimsFile(
+	embed *discordgo.MessageEmbed, alliance database.Alliance, alliances []database.Alliance,
+	nationStore *store.Store[oapi.NationInfo], townStore *store.Store[oapi.TownInfo],
+) (*discordgo.File, error) {
+	var allianceFill, allianceOutline *string
+	if c := alliance.Optional.Colours; c != nil {
+		allianceFill, allianceOutline = c.Fill, c.Outline
+		if allianceOutline == nil {
+			allianceOutline = allianceFill
+		}
+	}
+
+	layers := []render.ClaimLayer{}
+	for _, entry := range alliance.QueryAllNations(alliances, nationStore) {
+		fill, outline := nationColours(entry.Nation)
+		if allianceFill != nil {
+			fill, outline = *allianceFill, *allianceOutline
+		}
+
+		for _, t := range nationTowns(townStore, entry.Nation.UUID) {
+			layers = append(layers, NewTownClaimLayer(t, fill, outline, false))
+		}
+	}
+
+	png, err := render.RenderClaimsPNG(layers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render claims for alliance %s: %w", alliance.Identifier, err)
+	}
+
+	return attachClaimsImage(embed, png), nil
+}
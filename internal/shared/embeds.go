@@ -102,6 +102,20 @@ func NewAllianceEmbed(
 	embed := discordutil.NewEmbedBuilder(&embedColour, &title, &desc, nil)
 	embed.AddField("Stats", stats, true)
 
+	if townStore, err := database.GetStore(mdb, database.TOWNS_STORE); err == nil {
+		contiguity := a.Contiguity(alliances, nationStore, townStore)
+		if contiguity.TotalTowns > 0 {
+			territoryStr := "Contiguous"
+			if !contiguity.Contiguous {
+				territoryStr = logutil.HumanizedSprintf("`%d` separate regions\nLargest: `%d`/`%d` towns",
+					contiguity.Regions, contiguity.LargestTowns, contiguity.TotalTowns,
+				)
+			}
+
+			embed.AddField("Territory", territoryStr, true)
+		}
+	}
+
 	coloursStr := "No colours set."
 	if a.Optional.Colours != nil && a.Optional.Colours.Fill != nil {
 		fill := *a.Optional.Colours.Fill
@@ -569,3 +583,65 @@ func NewNationEmbed(
 // 	desc := fmt.Sprintf("```%s```", strings.Join(names, "\n"))
 // 	return discordutil.NewEmbedBuilder(&discordutil.PURPLE, &title, &desc, nil).Build(), nil
 // }
+
+// Max amount of towns listed per field of a digest, the rest are summarised.
+const DIGEST_TOWN_LIST_MAX = 15
+
+func NewDigestEmbed(d database.Digest) *discordgo.MessageEmbed {
+	title := fmt.Sprintf("%s Digest", lo.Ternary(d.Period == database.DigestWeekly, "Weekly", "Daily"))
+	desc := fmt.Sprintf("Everything that happened between <t:%d:f> and <t:%d:f>.", d.From/1000, d.To/1000)
+
+	embed := discordutil.NewEmbedBuilder(&discordutil.BLURPLE, &title, &desc, nil)
+
+	townList := func(towns []database.DigestTown) string {
+		if len(towns) == 0 {
+			return "None"
+		}
+
+		lines := lo.Map(towns, func(t database.DigestTown, _ int) string {
+			if t.Nation == "" {
+				return fmt.Sprintf("`%s`", t.Name)
+			}
+
+			return fmt.Sprintf("`%s` (**%s**)", t.Name, t.Nation)
+		})
+
+		return discordutil.JoinLimited(lines, DIGEST_TOWN_LIST_MAX, "\n")
+	}
+
+	embed.AddField(fmt.Sprintf("Towns Created [%d]", len(d.Created)), townList(d.Created), true)
+	embed.AddField(fmt.Sprintf("Towns Deleted [%d]", len(d.Deleted)), townList(d.Deleted), true)
+	embed.AddField(fmt.Sprintf("Towns Ruined [%d]", len(d.Ruined)), townList(d.Ruined), true)
+
+	changeList := func(changes []database.NationResidentChange) string {
+		if len(changes) == 0 {
+			return "None"
+		}
+
+		lines := lo.Map(changes, func(c database.NationResidentChange, _ int) string {
+			return fmt.Sprintf("`%s` %+d (`%d` → `%d`)", c.Name, c.Change(), c.Before, c.After)
+		})
+
+		return discordutil.JoinLimited(lines, database.DIGEST_TOP_N, "\n")
+	}
+
+	embed.AddField("Net Residents", fmt.Sprintf("`%+d` %s across all nations", d.NetResidents, EMOJIS.RESIDENT_PURPLE), false)
+	embed.AddField(EMOJIS.ARROW_UP_GREEN+" Biggest Gainers", changeList(d.Gainers), true)
+	embed.AddField(EMOJIS.ARROW_DOWN_RED+" Biggest Losers", changeList(d.Losers), true)
+
+	if len(d.RankChanges) > 0 {
+		lines := lo.Map(d.RankChanges, func(c database.AllianceRankChange, _ int) string {
+			arrow := lo.Ternary(c.After < c.Before, EMOJIS.ARROW_UP_GREEN, EMOJIS.ARROW_DOWN_RED)
+			return fmt.Sprintf("%s `%s` #%d → #%d", arrow, c.Identifier, c.Before, c.After)
+		})
+
+		embed.AddField("Alliance Rank Changes", discordutil.JoinLimited(lines, database.DIGEST_TOP_N, "\n"), false)
+	}
+
+	if len(d.News) > 0 {
+		newsStr, _ := BuildNewsString(d.News, database.DIGEST_TOP_N, discordutil.EMBED_FIELD_VALUE_LIMIT)
+		embed.AddField("Top Headlines", newsStr, false)
+	}
+
+	return embed.Build()
+}
@@ -3,11 +3,15 @@ package shared
 import (
 	"emcsrw/internal/database"
 	"emcsrw/pkg/api/oapi"
+	"emcsrw/pkg/utils/config"
 	"emcsrw/pkg/utils/discordutil"
+	"emcsrw/pkg/utils/logutil"
 	"fmt"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 	"unicode/utf8"
 
 	"github.com/samber/lo"
@@ -18,6 +22,23 @@ var NewEmbedField = discordutil.NewEmbedField
 var PrependField = discordutil.PrependField
 var AddField = discordutil.AddField
 
+// Gets the trail retention from TRACK_RETENTION_MINS, falling back to the default if unset or invalid.
+// Read once, since both the tracking task and /locate need it.
+var PlayerTrailRetention = sync.OnceValue(func() time.Duration {
+	v, err := config.GetEnviroVar("TRACK_RETENTION_MINS")
+	if err != nil {
+		return database.DEFAULT_TRAIL_RETENTION
+	}
+
+	mins, err := config.ParseEnviroVar[uint](v)
+	if err != nil || mins == 0 {
+		logutil.Printf(logutil.YELLOW, "\nWARN | Invalid TRACK_RETENTION_MINS. Using default trail retention.\n")
+		return database.DEFAULT_TRAIL_RETENTION
+	}
+
+	return time.Duration(mins) * time.Minute
+})
+
 // Returns a circular emoji equivalent to the value of v
 // where true becomes a green check, false a red cross.
 func BoolToEmoji(v bool) string {
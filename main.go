@@ -3,6 +3,7 @@ package main
 import (
 	"emcsrw/internal/bot"
 	"emcsrw/internal/bot/slashcommands"
+	"emcsrw/internal/cli"
 	"emcsrw/pkg/api/capi"
 	"emcsrw/pkg/utils/config"
 	"emcsrw/pkg/utils/logutil"
@@ -42,7 +43,7 @@ func lockProcess() (func() error, error) {
 func main() {
 	//#region Always runs no matter the subcommand
 	if len(os.Args) < 2 {
-		logutil.Println(logutil.RED, "ERR | missing subcommand. Usage: go run . [sync|bot|api]")
+		logutil.Println(logutil.RED, "ERR | missing subcommand. Usage: go run . [sync|bot|api|apikey|tasks|webhook]")
 		return
 	}
 
@@ -71,6 +72,21 @@ func main() {
 		bot.Start(s)
 	case "api":
 		capi.Start()
+	case "apikey":
+		if err := cli.ApiKey(os.Args[2:]); err != nil {
+			logutil.Println(logutil.RED, "ERR |", err)
+			os.Exit(1)
+		}
+	case "tasks":
+		if err := cli.Tasks(os.Args[2:]); err != nil {
+			logutil.Println(logutil.RED, "ERR |", err)
+			os.Exit(1)
+		}
+	case "webhook":
+		if err := cli.Webhook(os.Args[2:]); err != nil {
+			logutil.Println(logutil.RED, "ERR |", err)
+			os.Exit(1)
+		}
 	case "register", "sync":
 		slashcommands.SyncRemote(s, config.GetBotID(), "") // Empty str = register commands globally
 	default:
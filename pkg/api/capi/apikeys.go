@@ -0,0 +1,192 @@
+package capi
+
+import (
+	"emcsrw/internal/database"
+	"emcsrw/internal/database/store"
+	"emcsrw/pkg/utils/logutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How often usage counters are written to disk and keys are reloaded to pick up newly issued/revoked ones.
+const API_KEYS_SYNC_INTERVAL = 30 * time.Second
+
+// Rate limited endpoints. Each tier has its own limit for every one of these.
+const (
+	ENDPOINT_ALLIANCES = "alliances"
+	ENDPOINT_NEWS      = "news"
+	ENDPOINT_PLAYERS   = "players"
+	ENDPOINT_TOWNS     = "towns"
+	ENDPOINT_NATIONS   = "nations"
+	ENDPOINT_HISTORY   = "history"
+	ENDPOINT_STREAM    = "stream" // Connections, not events.
+	ENDPOINT_PROXY     = "proxy"
+)
+
+// Req/m for each endpoint per tier. Anonymous requests (no key) are limited per IP, keyed requests per key.
+var RATE_TIERS = map[database.ApiKeyTier]map[string]int{
+	database.ApiTierAnonymous: {
+		ENDPOINT_ALLIANCES: 8,
+		ENDPOINT_NEWS:      6,
+		ENDPOINT_PLAYERS:   3,
+		ENDPOINT_TOWNS:     10,
+		ENDPOINT_NATIONS:   10,
+		ENDPOINT_HISTORY:   10,
+		ENDPOINT_STREAM:    6,
+		ENDPOINT_PROXY:     30,
+	},
+	database.ApiTierStandard: {
+		ENDPOINT_ALLIANCES: 30,
+		ENDPOINT_NEWS:      30,
+		ENDPOINT_PLAYERS:   15,
+		ENDPOINT_TOWNS:     60,
+		ENDPOINT_NATIONS:   60,
+		ENDPOINT_HISTORY:   60,
+		ENDPOINT_STREAM:    12,
+		ENDPOINT_PROXY:     120,
+	},
+	database.ApiTierPartner: {
+		ENDPOINT_ALLIANCES: 120,
+		ENDPOINT_NEWS:      120,
+		ENDPOINT_PLAYERS:   60,
+		ENDPOINT_TOWNS:     300,
+		ENDPOINT_NATIONS:   300,
+		ENDPOINT_HISTORY:   300,
+		ENDPOINT_STREAM:    30,
+		ENDPOINT_PROXY:     600,
+	},
+}
+
+// Gets the req/m allowed for an endpoint by the given tier, falling back to anonymous limits if the tier is unknown.
+func TierRPM(tier database.ApiKeyTier, endpoint string) int {
+	if limits, ok := RATE_TIERS[tier]; ok {
+		if rpm, ok := limits[endpoint]; ok {
+			return rpm
+		}
+	}
+
+	return RATE_TIERS[database.ApiTierAnonymous][endpoint]
+}
+
+// Looks up API keys sent with requests and counts how much each one is used.
+//
+// Keys are only ever issued or revoked by the bot or CLI, so the API just reloads them periodically.
+// Usage is counted in memory and flushed to its own store on the same interval.
+type ApiKeys struct {
+	keyStore   *store.Store[database.ApiKey]
+	usageStore *store.Store[database.ApiKeyUsage]
+
+	pending map[string]map[string]uint64 // key ID -> endpoint -> requests since last flush
+	lastUse map[string]int64
+	mu      sync.Mutex
+}
+
+func NewApiKeys(mdb *database.Database) (*ApiKeys, error) {
+	keyStore, err := database.OpenStore(mdb, database.API_KEYS_STORE)
+	if err != nil {
+		return nil, err
+	}
+	usageStore, err := database.OpenStore(mdb, database.API_KEY_USAGE_STORE)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ApiKeys{
+		keyStore:   keyStore,
+		usageStore: usageStore,
+		pending:    make(map[string]map[string]uint64),
+		lastUse:    make(map[string]int64),
+	}, nil
+}
+
+// Starts periodically reloading keys and flushing usage counters.
+func (k *ApiKeys) StartSync(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := k.keyStore.LoadFromFile(); err != nil {
+				logutil.Printf(logutil.RED, "\nERR | failed to reload API keys:\n\t%s", err)
+			}
+			if err := k.FlushUsage(); err != nil {
+				logutil.Printf(logutil.RED, "\nERR | failed to flush API key usage:\n\t%s", err)
+			}
+		}
+	}()
+}
+
+// Extracts the API key from the X-API-Key header, or an Authorization header with the Bearer scheme.
+func requestApiKey(req *http.Request) string {
+	if key := strings.TrimSpace(req.Header.Get("X-API-Key")); key != "" {
+		return key
+	}
+
+	auth := req.Header.Get("Authorization")
+	if token, ok := strings.CutPrefix(auth, "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+
+	return ""
+}
+
+// Finds the key with the given raw value. Returns nil if it doesn't exist or has been revoked.
+func (k *ApiKeys) Lookup(key string) *database.ApiKey {
+	if !strings.HasPrefix(key, database.API_KEY_PREFIX) {
+		return nil
+	}
+
+	apiKey, err := k.keyStore.Get(database.HashApiKey(key))
+	if err != nil || apiKey.Revoked() {
+		return nil
+	}
+
+	return apiKey
+}
+
+func (k *ApiKeys) RecordUsage(id, endpoint string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.pending[id] == nil {
+		k.pending[id] = make(map[string]uint64)
+	}
+
+	k.pending[id][endpoint]++
+	k.lastUse[id] = time.Now().UnixMilli()
+}
+
+// Adds pending usage onto the stored counters and writes them to disk.
+func (k *ApiKeys) FlushUsage() error {
+	k.mu.Lock()
+	pending, lastUse := k.pending, k.lastUse
+	k.pending = make(map[string]map[string]uint64)
+	k.lastUse = make(map[string]int64)
+	k.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	for id, endpoints := range pending {
+		usage := database.ApiKeyUsage{Endpoints: make(map[string]uint64)}
+		if existing, err := k.usageStore.Get(id); err == nil {
+			usage = *existing
+			if usage.Endpoints == nil {
+				usage.Endpoints = make(map[string]uint64)
+			}
+		}
+
+		for endpoint, count := range endpoints {
+			usage.Endpoints[endpoint] += count
+			usage.Total += count
+		}
+
+		usage.LastUsed = lastUse[id]
+		k.usageStore.Set(id, usage)
+	}
+
+	return k.usageStore.WriteSnapshot()
+}
@@ -0,0 +1,102 @@
+package capi
+
+import (
+	"cmp"
+	"emcsrw/internal/database"
+	"emcsrw/internal/database/store"
+	"emcsrw/pkg/api/oapi"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// How long a computed border graph is served before being recomputed.
+// Borders rarely change much between data updates, so this can be fairly long.
+const BORDERS_TTL = 5 * time.Minute
+
+type EntityBorders struct {
+	UUID         string               `json:"uuid"`
+	Name         string               `json:"name"`
+	BorderLength int                  `json:"borderLength"` // Total length (in blocks) of all shared borders.
+	Neighbours   []database.Neighbour `json:"neighbours"`
+}
+
+type AllianceContiguity struct {
+	Identifier string `json:"identifier"`
+	database.Contiguity
+}
+
+func newEntityBorders(uuid, name string, neighbours []database.Neighbour) EntityBorders {
+	total := 0
+	for _, n := range neighbours {
+		total += n.BorderLength()
+	}
+
+	return EntityBorders{UUID: uuid, Name: name, BorderLength: total, Neighbours: neighbours}
+}
+
+func sortByBorderLength(borders []EntityBorders) []EntityBorders {
+	slices.SortFunc(borders, func(a, b EntityBorders) int {
+		return cmp.Compare(b.BorderLength, a.BorderLength)
+	})
+
+	return borders
+}
+
+func ServeBorders(
+	mux *http.ServeMux, mdbName string,
+	townStore *store.Store[oapi.TownInfo],
+	nationStore *store.Store[oapi.NationInfo],
+	allianceStore *store.Store[database.Alliance],
+) {
+	nationsEndpoint := fmt.Sprintf("/%s/borders/nations", mdbName)
+	mux.HandleFunc(nationsEndpoint, TTLGzipHandler(BORDERS_TTL, func() []EntityBorders {
+		graph := database.ComputeBorderGraph(townStore.Values())
+
+		borders := []EntityBorders{}
+		for _, n := range nationStore.Values() {
+			neighbours := graph.NationNeighbours(n.UUID)
+			if len(neighbours) > 0 {
+				borders = append(borders, newEntityBorders(n.UUID, n.Name, neighbours))
+			}
+		}
+
+		return sortByBorderLength(borders)
+	}))
+
+	townsEndpoint := fmt.Sprintf("/%s/borders/towns", mdbName)
+	mux.HandleFunc(townsEndpoint, TTLGzipHandler(BORDERS_TTL, func() []EntityBorders {
+		towns := townStore.Values()
+		graph := database.ComputeBorderGraph(towns)
+
+		borders := []EntityBorders{}
+		for _, t := range towns {
+			neighbours := graph.TownNeighbours(t.UUID)
+			if len(neighbours) > 0 {
+				borders = append(borders, newEntityBorders(t.UUID, t.Name, neighbours))
+			}
+		}
+
+		return sortByBorderLength(borders)
+	}))
+
+	alliancesEndpoint := fmt.Sprintf("/%s/borders/alliances", mdbName)
+	mux.HandleFunc(alliancesEndpoint, TTLGzipHandler(BORDERS_TTL, func() []AllianceContiguity {
+		alliances := allianceStore.Values()
+
+		contiguity := make([]AllianceContiguity, 0, len(alliances))
+		for _, a := range alliances {
+			contiguity = append(contiguity, AllianceContiguity{
+				Identifier: a.Identifier,
+				Contiguity: a.Contiguity(alliances, nationStore, townStore),
+			})
+		}
+
+		slices.SortFunc(contiguity, func(a, b AllianceContiguity) int {
+			return cmp.Compare(a.Identifier, b.Identifier)
+		})
+
+		return contiguity
+	}))
+}
@@ -0,0 +1,174 @@
+package capi
+
+import (
+	"emcsrw/pkg/utils/config"
+	"emcsrw/pkg/utils/logutil"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Used when API_TRUSTED_PROXIES isn't set. Only trusting loopback covers the usual setup of
+// a reverse proxy (like the Caddy example in the README) running on the same machine.
+var DEFAULT_TRUSTED_PROXIES = []string{"127.0.0.0/8", "::1/128"}
+
+// Resolves the real IP of the client that sent a request.
+//
+// Forwarding headers are only believed when they were added by a proxy we trust, since anyone can send them.
+// Hops are read right-to-left (nearest first) and the first one that isn't a trusted proxy is the client.
+// Reading left-to-right would let a client prepend any IP it wants and get a fresh rate limit each time.
+//
+// A nil resolver trusts nothing and always uses the address of the direct connection.
+type ClientIPResolver struct {
+	trusted []netip.Prefix
+	trustCF bool // Whether to use CF-Connecting-IP. Only safe if Cloudflare is the (trusted) proxy in front of us.
+}
+
+// Creates a resolver trusting the given CIDRs. Bare IPs are treated as a single address range.
+func NewClientIPResolver(cidrs []string, trustCF bool) (*ClientIPResolver, error) {
+	res := &ClientIPResolver{trustCF: trustCF}
+	for _, s := range cidrs {
+		prefix, err := parsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy '%s': %w", s, err)
+		}
+
+		res.trusted = append(res.trusted, prefix)
+	}
+
+	return res, nil
+}
+
+// Creates a resolver from the API_TRUSTED_PROXIES (comma separated CIDRs) and API_TRUST_CF_HEADER environment variables.
+// Falls back to DEFAULT_TRUSTED_PROXIES if unset or invalid.
+func ClientIPResolverFromEnv() *ClientIPResolver {
+	trustCF := false
+	if v, err := config.GetEnviroVar("API_TRUST_CF_HEADER"); err == nil {
+		trustCF, _ = config.ParseEnviroVar[bool](v)
+	}
+
+	cidrs := DEFAULT_TRUSTED_PROXIES
+	if v, err := config.GetEnviroVar("API_TRUSTED_PROXIES"); err == nil {
+		cidrs = splitQueryList(v)
+	}
+
+	res, err := NewClientIPResolver(cidrs, trustCF)
+	if err != nil {
+		logutil.Printf(logutil.YELLOW, "\nWARN | %s. Only trusting default proxies.\n", err)
+		res, _ = NewClientIPResolver(DEFAULT_TRUSTED_PROXIES, trustCF)
+	}
+
+	return res
+}
+
+func parsePrefix(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		return prefix.Masked(), err
+	}
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+
+	return netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()), nil
+}
+
+func (res *ClientIPResolver) isTrusted(addr netip.Addr) bool {
+	for _, prefix := range res.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Gets the IP of the client that sent r. See ClientIPResolver.
+func (res *ClientIPResolver) ClientIP(r *http.Request) string {
+	peer, ok := parseHostIP(r.RemoteAddr)
+	if !ok {
+		return r.RemoteAddr // unlikely, but just in case
+	}
+	if res == nil || !res.isTrusted(peer) {
+		return peer.String()
+	}
+
+	if res.trustCF {
+		if ip, ok := parseHostIP(r.Header.Get("CF-Connecting-IP")); ok {
+			return ip.String()
+		}
+	}
+
+	// Prefer the standardised header if present, proxies shouldn't be sending both.
+	hops := forwardedHops(r.Header.Values("Forwarded"))
+	if len(hops) == 0 {
+		hops = xffHops(r.Header.Values("X-Forwarded-For"))
+	}
+
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip, ok := parseHostIP(hops[i])
+		if !ok {
+			break // Garbage or obfuscated ("unknown", "_hidden"), can't go any further back than the last hop we know.
+		}
+
+		client = ip
+		if !res.isTrusted(ip) {
+			break
+		}
+	}
+
+	return client.String()
+}
+
+// Splits every X-Forwarded-For header into its hops, in the order they were added.
+func xffHops(values []string) (hops []string) {
+	for _, v := range values {
+		for hop := range strings.SplitSeq(v, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+
+	return hops
+}
+
+// Extracts the "for" parameter of every element in the Forwarded headers (RFC 7239), in the order they were added.
+//
+//	Forwarded: for=192.0.2.60;proto=http;by=203.0.113.43, for="[2001:db8:cafe::17]:4711"
+func forwardedHops(values []string) (hops []string) {
+	for _, v := range values {
+		for elem := range strings.SplitSeq(v, ",") {
+			hop := "" // Elements without a "for" still count as a hop we can't identify.
+			for pair := range strings.SplitSeq(elem, ";") {
+				k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(k, "for") {
+					hop = strings.Trim(v, `"`)
+				}
+			}
+
+			hops = append(hops, hop)
+		}
+	}
+
+	return hops
+}
+
+// Parses an IP that may have a port and/or be wrapped in brackets (IPv6), e.g. "1.2.3.4:80" or "[::1]:80".
+func parseHostIP(s string) (netip.Addr, bool) {
+	s = strings.TrimSpace(s)
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+
+	addr, err := netip.ParseAddr(strings.Trim(s, "[]"))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+
+	return addr.Unmap(), true
+}
@@ -28,28 +28,11 @@ import (
 
 var md = goldmark.New(goldmark.WithRendererOptions(html.WithUnsafe()))
 
-// Req/m for each endpoint
-const (
-	// FALLING_RPM   = 2
-	// RUINED_RPM    = 4
-	ALLIANCES_RPM = 8
-	NEWS_RPM      = 6
-	PLAYERS_RPM   = 3
-	PROXY_RPM     = 30
-)
-
 const BASE_WELCOME_STR = `
 Welcome to the Custom API! All info here is only available originally by the EarthMC Stats Discord bot.
 
 To access data for a specific map, navigate to "https://emcstats.bot.nu/mapName/endpoint".
 For example, "/nostra/alliances" for alliance data on the Nostra map.
-
-The following endpoints are available:
-- /falling
-- /ruined
-- /alliances
-- /players
-- /news
 `
 
 type BasicPlayer struct {
@@ -80,6 +63,7 @@ func ServeBase(mux *http.ServeMux) {
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/plain")
 		w.Write([]byte(strings.TrimPrefix(BASE_WELCOME_STR, "\n")))
+		w.Write([]byte("\nThe following endpoints are available (see /docs for details):\n" + endpointListText()))
 	})
 	mux.HandleFunc("/favicon.ico", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "image/png")
@@ -95,21 +79,27 @@ func ServeTerms(mux *http.ServeMux) {
 			return
 		}
 
-		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		w.Write([]byte(`
-			<!doctype html><html><head><style>
-			body{line-height:1.3rem;font-size:14px;font-family:monospace;background:#1a1c23f7;color:#ffffff;max-width:900px;margin:20px auto;padding:20px}
-			strong{color:#cde2ff}
-			h1{text-decoration:underline;color:#cde2ff}
-			h2{margin-block-end:0px;color:#cde2ff}
-			</style></head><body>`,
-		))
-
-		md.Convert(data, w) // Render the terms file (converts markdown to HTML).
-		w.Write([]byte(`</body></html>`))
+		writeMarkdownPage(w, data)
 	})
 }
 
+// Writes markdown rendered as a styled HTML page.
+func writeMarkdownPage(w http.ResponseWriter, data []byte) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(`
+		<!doctype html><html><head><style>
+		body{line-height:1.3rem;font-size:14px;font-family:monospace;background:#1a1c23f7;color:#ffffff;max-width:900px;margin:20px auto;padding:20px}
+		strong{color:#cde2ff}
+		h1{text-decoration:underline;color:#cde2ff}
+		h2{margin-block-end:0px;color:#cde2ff}
+		a{color:#8ab4f8}
+		</style></head><body>`,
+	))
+
+	md.Convert(data, w) // Converts markdown to HTML.
+	w.Write([]byte(`</body></html>`))
+}
+
 func ServeBotInvite(mux *http.ServeMux) {
 	mux.HandleFunc("/invite", func(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "https://discord.com/oauth2/authorize?client_id=656231016385478657", http.StatusFound)
@@ -156,6 +146,39 @@ func ServeRuined(
 	}))
 }
 
+// Orders risk levels from most to least severe for sorting.
+var overclaimRiskOrder = map[database.OverclaimRiskLevel]int{
+	database.OverclaimRiskOverclaimed: 0,
+	database.OverclaimRiskHigh:        1,
+	database.OverclaimRiskMedium:      2,
+	database.OverclaimRiskLow:         3,
+	database.OverclaimRiskNone:        4,
+}
+
+func ServeOverclaim(
+	mux *http.ServeMux, mdbName string,
+	townStore *store.Store[oapi.TownInfo],
+	nationStore *store.Store[oapi.NationInfo],
+	fallingTownStore *store.Store[database.FallingTown],
+) {
+	overclaimEndpoint := fmt.Sprintf("/%s/overclaim", mdbName)
+	mux.HandleFunc(overclaimEndpoint, TTLGzipHandler(90*time.Second, func() []database.OverclaimRisk {
+		risks := lo.Filter(lo.Values(database.ComputeOverclaimRisks(townStore, nationStore, fallingTownStore)),
+			func(r database.OverclaimRisk, _ int) bool { return r.Level != database.OverclaimRiskNone },
+		)
+
+		// Most severe first, then least spare claims.
+		utils.KeySort(risks, []utils.KeySortOption[database.OverclaimRisk]{
+			{Compare: func(a, b database.OverclaimRisk) bool {
+				return overclaimRiskOrder[a.Level] < overclaimRiskOrder[b.Level]
+			}},
+			{Compare: func(a, b database.OverclaimRisk) bool { return a.Spare < b.Spare }},
+		})
+
+		return risks
+	}))
+}
+
 func ServeAlliances(
 	mux *http.ServeMux, rl *RateLimit, mdbName string,
 	allianceStore *store.Store[database.Alliance],
@@ -167,6 +190,11 @@ func ServeAlliances(
 
 	alliancesEndpoint := fmt.Sprintf("/%s/alliances", mdbName)
 	mux.HandleFunc(alliancesEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		format, ok := requestFormat(w, r)
+		if !ok {
+			return
+		}
+
 		alliances := allianceStore.Values()
 
 		// compute lightweight hash of alliance identifiers + timestamps
@@ -174,7 +202,7 @@ func ServeAlliances(
 			return a.Identifier, int64(*a.UpdatedTimestamp)
 		})
 
-		etag := `"` + currentHash + `"`
+		etag := `"` + currentHash + format.etagSuffix() + `"`
 		if r.Header.Get("If-None-Match") == etag {
 			w.WriteHeader(http.StatusNotModified)
 			return
@@ -189,9 +217,7 @@ func ServeAlliances(
 			parsedAlliances = entry.Data
 		} else {
 			// cache miss → apply limiter
-			limiter := rl.clientLimiter(r, ALLIANCES_RPM)
-			if !limiter.Allow() {
-				http.Error(w, "Rate Limit Exceeded", http.StatusTooManyRequests)
+			if !rl.allow(w, r, ENDPOINT_ALLIANCES) {
 				return
 			}
 
@@ -207,17 +233,22 @@ func ServeAlliances(
 			alliancesCacheMu.Unlock()
 		}
 
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		if format != FormatJSON {
+			writeExport(w, r, format, parsedAlliances)
+			return
+		}
+
 		data, err := netutil.GzipJSON(parsedAlliances, 1)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		w.Header().Set("ETag", etag)
-		w.Header().Set("Cache-Control", "public, max-age=60")
 		w.Header().Set("Content-Type", "application/json")
 		w.Header().Set("Content-Encoding", "gzip")
-		w.Header().Set("Vary", "Accept-Encoding")
+		w.Header().Set("Vary", "Accept, Accept-Encoding")
 		w.Write(data)
 	})
 }
@@ -228,6 +259,11 @@ func ServeNews(
 ) {
 	newsEndpoint := fmt.Sprintf("/%s/news", mdbName)
 	mux.HandleFunc(newsEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		format, ok := requestFormat(w, r)
+		if !ok {
+			return
+		}
+
 		newsValues := lo.MapToSlice(newsStore.Entries(), func(key string, n database.NewsEntry) NewsEntry {
 			return NewsEntry{NewsEntry: n, ID: key}
 		})
@@ -237,7 +273,7 @@ func ServeNews(
 
 		b, _ := json.Marshal(newsValues)
 		sum := sha1.Sum(b)
-		etag := fmt.Sprintf(`"%x"`, sum)
+		etag := fmt.Sprintf(`"%x%s"`, sum, format.etagSuffix())
 
 		// 304 if client already has current snapshot
 		if r.Header.Get("If-None-Match") == etag && etag != "" {
@@ -246,9 +282,14 @@ func ServeNews(
 		}
 
 		// rate limit applies only when serving data
-		limiter := rl.clientLimiter(r, NEWS_RPM)
-		if !limiter.Allow() {
-			http.Error(w, "Rate Limit Exceeded", http.StatusTooManyRequests)
+		if !rl.allow(w, r, ENDPOINT_NEWS) {
+			return
+		}
+
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", "public, max-age=120")
+		if format != FormatJSON {
+			writeExport(w, r, format, newsValues)
 			return
 		}
 
@@ -264,11 +305,9 @@ func ServeNews(
 		}
 		gz.Close()
 
-		w.Header().Set("ETag", etag)
-		w.Header().Set("Cache-Control", "public, max-age=120")
 		w.Header().Set("Content-Type", "application/json")
 		w.Header().Set("Content-Encoding", "gzip")
-		w.Header().Set("Vary", "Accept-Encoding")
+		w.Header().Set("Vary", "Accept, Accept-Encoding")
 		w.Write(buf.Bytes())
 	})
 }
@@ -279,23 +318,13 @@ func ServePlayers(
 ) {
 	playersEndpoint := fmt.Sprintf("/%s/players", mdbName)
 	mux.HandleFunc(playersEndpoint, func(w http.ResponseWriter, r *http.Request) {
-		limiter := rl.clientLimiter(r, PLAYERS_RPM)
-		if !limiter.Allow() {
-			http.Error(w, "Rate Limit Exceeded", http.StatusTooManyRequests)
+		format, ok := requestFormat(w, r)
+		if !ok {
 			return
 		}
-
-		w.Header().Set("Cache-Control", "public, max-age=30")
-		w.Header().Set("Content-Type", "application/json")
-		w.Header().Set("Content-Encoding", "gzip")
-		w.Header().Set("Vary", "Accept-Encoding")
-
-		gz, err := gzip.NewWriterLevel(w, 3)
-		if err != nil {
-			http.Error(w, "Error during gzip data compression", http.StatusInternalServerError)
+		if !rl.allow(w, r, ENDPOINT_PLAYERS) {
 			return
 		}
-		defer gz.Close()
 
 		// Condense town and nation fields from entity object to array to reduce payload size
 		playerStoreValues := lo.MapToSlice(playersStore.Entries(), func(key string, p database.BasicPlayer) BasicPlayer {
@@ -318,6 +347,23 @@ func ServePlayers(
 			}
 		})
 
+		w.Header().Set("Cache-Control", "public, max-age=30")
+		if format != FormatJSON {
+			writeExport(w, r, format, playerStoreValues) // NDJSON is streamed, so prefer it for huge player lists
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Vary", "Accept, Accept-Encoding")
+
+		gz, err := gzip.NewWriterLevel(w, 3)
+		if err != nil {
+			http.Error(w, "Error during gzip data compression", http.StatusInternalServerError)
+			return
+		}
+		defer gz.Close()
+
 		json.NewEncoder(gz).Encode(playerStoreValues)
 	})
 }
@@ -327,25 +373,36 @@ func TTLGzipHandler[T any](
 	dataFunc func() []T,
 ) http.HandlerFunc {
 	var cache []byte
+	var cacheItems []T // kept alongside the JSON so other formats can be exported without recomputing
 	var cacheExp time.Time
 	var mu sync.RWMutex
 
-	write := func(w http.ResponseWriter, data []byte) {
+	write := func(w http.ResponseWriter, r *http.Request, format ExportFormat, data []byte, items []T) {
 		w.Header().Set("Cache-Control", "public, max-age=90")
+		if format != FormatJSON {
+			writeExport(w, r, format, items)
+			return
+		}
+
 		w.Header().Set("Content-Type", "application/json")
 		w.Header().Set("Content-Encoding", "gzip")
-		w.Header().Set("Vary", "Accept-Encoding")
+		w.Header().Set("Vary", "Accept, Accept-Encoding")
 		w.Write(data)
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
+		format, ok := requestFormat(w, r)
+		if !ok {
+			return
+		}
+
 		now := time.Now()
 
 		mu.RLock()
 		if now.Before(cacheExp) && cache != nil {
-			data := cache
+			data, items := cache, cacheItems
 			mu.RUnlock()
-			write(w, data)
+			write(w, r, format, data, items)
 			return
 		}
 		mu.RUnlock()
@@ -355,7 +412,7 @@ func TTLGzipHandler[T any](
 
 		now = time.Now()
 		if now.Before(cacheExp) && cache != nil {
-			write(w, cache)
+			write(w, r, format, cache, cacheItems)
 			return
 		}
 
@@ -367,8 +424,9 @@ func TTLGzipHandler[T any](
 		}
 
 		cache = data
+		cacheItems = dataSlice
 		cacheExp = now.Add(ttl)
 
-		write(w, data)
+		write(w, r, format, data, dataSlice)
 	}
 }
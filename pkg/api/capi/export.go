@@ -0,0 +1,341 @@
+package capi
+
+import (
+	"bytes"
+	"compress/gzip"
+	"emcsrw/pkg/utils/logutil"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+type ExportFormat string
+
+const (
+	FormatJSON   ExportFormat = "json"
+	FormatCSV    ExportFormat = "csv"
+	FormatNDJSON ExportFormat = "ndjson" // One JSON object per line. Streamed, so clients can start reading before the whole list is written.
+)
+
+var EXPORT_FORMATS = []string{string(FormatJSON), string(FormatCSV), string(FormatNDJSON)}
+
+// Media types we answer with for each format, and accept in the Accept header.
+var exportMediaTypes = map[ExportFormat][]string{
+	FormatJSON:   {"application/json"},
+	FormatCSV:    {"text/csv"},
+	FormatNDJSON: {"application/x-ndjson", "application/ndjson", "application/jsonl"},
+}
+
+// Nested values inside a CSV cell (lists of scalars) are joined with this.
+const CSV_LIST_SEPARATOR = ";"
+
+// Picks the format of a list response. The "format" query param takes priority over the Accept header,
+// which makes it easy to grab a CSV from a browser or a spreadsheet's "import from web" feature.
+//
+// Media ranges in Accept are tried in order, anything we don't know (including */*) falls back to JSON.
+func negotiateFormat(r *http.Request) (ExportFormat, error) {
+	if f := strings.ToLower(r.URL.Query().Get("format")); f != "" {
+		if !slices.Contains(EXPORT_FORMATS, f) {
+			return "", fmt.Errorf("unknown format '%s'. expected one of: %s", f, strings.Join(EXPORT_FORMATS, ", "))
+		}
+
+		return ExportFormat(f), nil
+	}
+
+	for part := range strings.SplitSeq(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		for format, types := range exportMediaTypes {
+			if slices.Contains(types, mediaType) {
+				return format, nil
+			}
+		}
+	}
+
+	return FormatJSON, nil
+}
+
+// Like negotiateFormat, but responds with 400 if the format is invalid. Returns false if so.
+func requestFormat(w http.ResponseWriter, r *http.Request) (ExportFormat, bool) {
+	format, err := negotiateFormat(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", false
+	}
+
+	return format, true
+}
+
+// Suffix for ETags so the same data in different formats doesn't share one.
+func (f ExportFormat) etagSuffix() string {
+	if f == FormatJSON {
+		return ""
+	}
+
+	return "-" + string(f)
+}
+
+// Writes items as CSV or NDJSON, gzipped if the client accepts it.
+// Only meant for those formats, JSON responses are written by each endpoint as usual.
+func writeExport[T any](w http.ResponseWriter, r *http.Request, format ExportFormat, items []T) {
+	// Turns "/aurora/borders/towns" into "aurora-borders-towns.csv"
+	filename := strings.ReplaceAll(strings.Trim(r.URL.Path, "/"), "/", "-") + "." + string(format)
+
+	w.Header().Set("Content-Type", exportMediaTypes[format][0]+"; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="%s"`, filename))
+	w.Header().Add("Vary", "Accept, Accept-Encoding")
+
+	var out io.Writer = w
+	if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		w.Header().Set("Content-Encoding", "gzip")
+
+		gz, _ := gzip.NewWriterLevel(w, 2)
+		defer gz.Close()
+
+		out = gz
+	}
+
+	var err error
+	switch format {
+	case FormatCSV:
+		err = writeCSV(out, items)
+	case FormatNDJSON:
+		err = writeNDJSON(out, w, items)
+	default:
+		err = fmt.Errorf("cannot export as %s", format)
+	}
+
+	if err != nil {
+		// Most likely the client went away, headers are already sent so there isn't much else we can do.
+		logutil.Printf(logutil.RED, "\nERR | failed to export %s as %s: %v\n", r.URL.Path, format, err)
+	}
+}
+
+// Writes one JSON object per line, flushing every so often so the client can start reading straight away.
+func writeNDJSON[T any](out io.Writer, w http.ResponseWriter, items []T) error {
+	flusher, _ := w.(http.Flusher)
+	gz, _ := out.(*gzip.Writer)
+
+	enc := json.NewEncoder(out) // Encode already ends each value with a newline
+	for i, item := range items {
+		if err := enc.Encode(item); err != nil {
+			return err
+		}
+
+		if (i+1)%500 == 0 && flusher != nil {
+			if gz != nil {
+				gz.Flush()
+			}
+
+			flusher.Flush()
+		}
+	}
+
+	return nil
+}
+
+// Writes items as CSV with a header row. Columns are the union of every item's flattened fields in the order
+// they were first seen, so optional fields that only some items have still get a column.
+func writeCSV[T any](out io.Writer, items []T) error {
+	var columns []string
+	seen := map[string]bool{}
+
+	rows := make([]map[string]string, 0, len(items))
+	for _, item := range items {
+		fields, err := FlattenJSON(item)
+		if err != nil {
+			return err
+		}
+
+		row := make(map[string]string, len(fields))
+		for _, f := range fields {
+			if !seen[f.Key] {
+				seen[f.Key] = true
+				columns = append(columns, f.Key)
+			}
+
+			row[f.Key] = csvSafe(f.Value)
+		}
+
+		rows = append(rows, row)
+	}
+
+	cw := csv.NewWriter(out)
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+
+	record := make([]string, len(columns))
+	for _, row := range rows {
+		for i, col := range columns {
+			record[i] = row[col]
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// #region Flattener
+
+// A single column of a flattened value.
+// Characters that make spreadsheet apps treat a cell as a formula, see https://owasp.org/www-community/attacks/CSV_Injection.
+const CSV_FORMULA_CHARS = "=+-@\t\r"
+
+// Names and boards are player controlled, so a cell that would run as a formula gets a ' in front to keep it as text.
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune(CSV_FORMULA_CHARS, rune(value[0])) {
+		return "'" + value
+	}
+
+	return value
+}
+
+type FlatField struct {
+	Key   string
+	Value string
+}
+
+// Flattens v (as it would be marshalled to JSON) into a single level of fields, keeping the order of its JSON keys.
+// Nested objects become dotted keys, e.g. {"stats": {"numResidents": 3}} becomes "stats.numResidents" = "3".
+//
+// Lists of scalars are joined by CSV_LIST_SEPARATOR, while lists containing objects or other lists are kept as JSON
+// since there is no sane way to give them their own columns. Nulls become empty strings.
+//
+// Going through JSON means json tags, omitempty and custom MarshalJSON funcs are all respected,
+// so the columns always match the fields of the JSON response.
+func FlattenJSON(v any) ([]FlatField, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := []FlatField{}
+	if err := flattenRaw("", data, &fields); err != nil {
+		return nil, err
+	}
+
+	return fields, nil
+}
+
+func flattenRaw(key string, raw json.RawMessage, fields *[]FlatField) error {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return nil
+	}
+
+	switch raw[0] {
+	case '{':
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		if _, err := dec.Token(); err != nil { // opening brace
+			return err
+		}
+
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return err
+			}
+
+			var value json.RawMessage
+			if err := dec.Decode(&value); err != nil {
+				return err
+			}
+
+			if err := flattenRaw(joinKey(key, tok.(string)), value, fields); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case '[':
+		value, err := flattenList(raw)
+		if err != nil {
+			return err
+		}
+
+		*fields = append(*fields, FlatField{keyOrValue(key), value})
+		return nil
+	default:
+		value, err := scalarString(raw)
+		if err != nil {
+			return err
+		}
+
+		*fields = append(*fields, FlatField{keyOrValue(key), value})
+		return nil
+	}
+}
+
+func flattenList(raw json.RawMessage) (string, error) {
+	var elems []json.RawMessage
+	if err := json.Unmarshal(raw, &elems); err != nil {
+		return "", err
+	}
+
+	values := make([]string, 0, len(elems))
+	for _, elem := range elems {
+		elem = bytes.TrimSpace(elem)
+		if len(elem) > 0 && (elem[0] == '{' || elem[0] == '[') {
+			var compact bytes.Buffer
+			if err := json.Compact(&compact, raw); err != nil {
+				return "", err
+			}
+
+			return compact.String(), nil
+		}
+
+		value, err := scalarString(elem)
+		if err != nil {
+			return "", err
+		}
+
+		values = append(values, value)
+	}
+
+	return strings.Join(values, CSV_LIST_SEPARATOR), nil
+}
+
+// Strings are unquoted, null is empty and anything else (numbers, bools) is kept exactly as it was encoded.
+func scalarString(raw json.RawMessage) (string, error) {
+	switch raw[0] {
+	case '"':
+		var s string
+		err := json.Unmarshal(raw, &s)
+		return s, err
+	case 'n':
+		return "", nil
+	}
+
+	return string(raw), nil
+}
+
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+
+	return prefix + "." + key
+}
+
+// Values that aren't inside an object (like a list of strings) still need a column name.
+func keyOrValue(key string) string {
+	if key == "" {
+		return "value"
+	}
+
+	return key
+}
+
+// #endregion
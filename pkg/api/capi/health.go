@@ -0,0 +1,23 @@
+package capi
+
+import (
+	"emcsrw/internal/database"
+	"emcsrw/internal/health"
+	"net/http"
+	"time"
+)
+
+// Serves /healthz and /readyz, reporting how fresh the data in each map DB is.
+//
+// Only the bot updates the DBs, so its task runs and status are read from file, at most as often as the stores are synced.
+func ServeHealth(mux *http.ServeMux, mdbs []*database.Database) {
+	checker := &health.Checker{
+		Process:     "api",
+		StartedAt:   time.Now(),
+		MaxAge:      health.MaxAgeFromEnv(),
+		Maps:        mdbs,
+		ReloadEvery: STORE_SYNC_INTERVAL,
+	}
+
+	checker.Serve(mux)
+}
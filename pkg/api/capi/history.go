@@ -0,0 +1,160 @@
+package capi
+
+import (
+	"emcsrw/internal/database"
+	"emcsrw/internal/database/store"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DEFAULT_HISTORY_RANGE = 7 * 24 * time.Hour
+	MIN_HISTORY_RES       = database.HISTORY_SAMPLE_INTERVAL // No point going lower, there wouldn't be any data.
+)
+
+var historyResolutions = map[string]time.Duration{
+	"hour": time.Hour,
+	"day":  24 * time.Hour,
+	"week": 7 * 24 * time.Hour,
+}
+
+type HistorySeries struct {
+	ID         string                 `json:"id"`
+	Name       string                 `json:"name"`
+	From       int64                  `json:"from"`       // Unix timestamp (ms)
+	To         int64                  `json:"to"`         // Unix timestamp (ms)
+	Resolution int64                  `json:"resolution"` // Bucket size in ms
+	Points     []database.StatsSample `json:"points"`
+}
+
+// Parses a time from either a unix timestamp in ms or an RFC3339 string.
+func parseQueryTime(s string) (time.Time, error) {
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+
+	return time.Parse(time.RFC3339, s)
+}
+
+// Parses from, to and resolution query params.
+//
+// If no resolution is given, hourly is used for ranges within the hourly window since
+// samples older than that have been compacted to one per day anyway.
+func parseHistoryQuery(q url.Values, now time.Time) (from, to time.Time, res time.Duration, err error) {
+	to = now
+	if s := q.Get("to"); s != "" {
+		if to, err = parseQueryTime(s); err != nil {
+			return from, to, res, fmt.Errorf("to must be a unix timestamp (ms) or RFC3339 time")
+		}
+	}
+
+	from = to.Add(-DEFAULT_HISTORY_RANGE)
+	if s := q.Get("from"); s != "" {
+		if from, err = parseQueryTime(s); err != nil {
+			return from, to, res, fmt.Errorf("from must be a unix timestamp (ms) or RFC3339 time")
+		}
+	}
+	if !from.Before(to) {
+		return from, to, res, fmt.Errorf("from must be before to")
+	}
+
+	s := strings.ToLower(q.Get("resolution"))
+	switch {
+	case s == "":
+		res = historyResolutions["day"]
+		if now.Sub(from) <= database.HISTORY_HOURLY_WINDOW {
+			res = historyResolutions["hour"]
+		}
+	case historyResolutions[s] != 0:
+		res = historyResolutions[s]
+	default:
+		if res, err = time.ParseDuration(s); err != nil || res < MIN_HISTORY_RES {
+			return from, to, res, fmt.Errorf("resolution must be hour, day, week or a duration of at least %s", MIN_HISTORY_RES)
+		}
+	}
+
+	return from, to, res, nil
+}
+
+// Serves the history of a single entity, using resolveID to turn the {id} path value into its history store ID.
+// If resolveID returns false, the entity is treated as not found.
+func historyHandler(
+	rl *RateLimit, kind database.HistoryKind,
+	historyStore *store.Store[database.StatsHistory],
+	resolveID func(id string) (string, bool),
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		from, to, res, err := parseHistoryQuery(r.URL.Query(), time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		id, ok := resolveID(r.PathValue("id"))
+		if !ok {
+			http.Error(w, fmt.Sprintf("%s not found", kind), http.StatusNotFound)
+			return
+		}
+
+		history, err := historyStore.Get(database.HistoryKey(kind, id))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("no history recorded for this %s yet", kind), http.StatusNotFound)
+			return
+		}
+
+		if !allowBeforeBuild(w, r, rl, ENDPOINT_HISTORY, FormatJSON) {
+			return
+		}
+
+		writeETagJSON(w, r, rl, ENDPOINT_HISTORY, HistorySeries{
+			ID:         id,
+			Name:       history.Name,
+			From:       from.UnixMilli(),
+			To:         to.UnixMilli(),
+			Resolution: res.Milliseconds(),
+			Points:     database.BucketHistory(history.Samples, from, to, res),
+		})
+	}
+}
+
+// Serves time-bucketed stats (residents, chunks, balance and score) of towns, nations and alliances.
+// Towns and nations are looked up by UUID, alliances by identifier or UUID.
+//
+// Query params (all optional):
+//   - from, to: Unix timestamp (ms) or RFC3339 time. Defaults to the last 7 days.
+//   - resolution: hour, day, week or any Go duration (e.g. "6h") of at least 1h.
+func ServeHistory(
+	mux *http.ServeMux, rl *RateLimit, mdbName string,
+	historyStore *store.Store[database.StatsHistory],
+	allianceStore *store.Store[database.Alliance],
+) {
+	// History outlives the entity (a deleted town still has history) so these don't check the town/nation stores.
+	byUUID := func(id string) (string, bool) { return id, id != "" }
+
+	townEndpoint := fmt.Sprintf("/%s/towns/{id}/history", mdbName)
+	mux.HandleFunc(townEndpoint, historyHandler(rl, database.HistoryKindTown, historyStore, byUUID))
+
+	nationEndpoint := fmt.Sprintf("/%s/nations/{id}/history", mdbName)
+	mux.HandleFunc(nationEndpoint, historyHandler(rl, database.HistoryKindNation, historyStore, byUUID))
+
+	allianceEndpoint := fmt.Sprintf("/%s/alliances/{id}/history", mdbName)
+	mux.HandleFunc(allianceEndpoint, historyHandler(rl, database.HistoryKindAlliance, historyStore, func(id string) (string, bool) {
+		alliance, err := allianceStore.Get(strings.ToLower(id))
+		if err == nil {
+			return strconv.FormatUint(alliance.UUID, 10), true
+		}
+
+		alliance, _ = allianceStore.Find(func(a database.Alliance) bool {
+			return strconv.FormatUint(a.UUID, 10) == id
+		})
+		if alliance == nil {
+			return "", false
+		}
+
+		return strconv.FormatUint(alliance.UUID, 10), true
+	}))
+}
@@ -0,0 +1,90 @@
+package capi
+
+import (
+	"emcsrw/pkg/utils/metrics"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	apiRequestsTotal = metrics.NewCounterVec(
+		"emcs_capi_requests_total", "Requests served by the Custom API by endpoint and status code.",
+		"endpoint", "status",
+	)
+	apiRequestDuration = metrics.NewHistogramVec(
+		"emcs_capi_request_duration_seconds", "How long the Custom API took to serve requests. Streams are not included.",
+		nil, "endpoint",
+	)
+)
+
+// Serves Prometheus metrics for this process at /metrics. See [metrics.Handler] for auth.
+func ServeMetrics(mux *http.ServeMux) {
+	mux.Handle("/metrics", metrics.Handler())
+}
+
+// Wraps the mux so every request is counted under the pattern it matched (e.g. "/aurora/towns/{id}"),
+// rather than its path which would create a new series for every town, player etc.
+func InstrumentMux(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+
+		mux.ServeHTTP(rec, r) // sets r.Pattern to whatever it matched
+
+		endpoint := r.Pattern
+		if endpoint == "" {
+			endpoint = "unmatched" // method not allowed etc.
+		}
+
+		apiRequestsTotal.With(endpoint, strconv.Itoa(rec.Status())).Inc()
+
+		// A stream lasts as long as the client stays connected, which would wreck the histogram.
+		if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/event-stream") {
+			apiRequestDuration.With(endpoint).ObserveSince(start)
+		}
+	})
+}
+
+// Remembers the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+
+	return rec.ResponseWriter.Write(b)
+}
+
+func (rec *statusRecorder) Status() int {
+	if rec.status == 0 {
+		return http.StatusOK
+	}
+
+	return rec.status
+}
+
+// The stream endpoint needs to flush, which it can't do through the wrapper unless we pass it on.
+func (rec *statusRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Lets http.ResponseController reach the real writer.
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
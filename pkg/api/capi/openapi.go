@@ -0,0 +1,656 @@
+package capi
+
+import (
+	"cmp"
+	"emcsrw/internal/database"
+	"emcsrw/internal/health"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const OPENAPI_VERSION = "3.0.3"
+
+// A query, path or header param accepted by an endpoint.
+type ApiParam struct {
+	Name        string
+	In          string // query, path or header
+	Description string
+	Required    bool
+	Integer     bool     // Params are strings unless this is set.
+	Enum        []string // Allowed values, if limited.
+	List        bool     // Whether multiple comma separated values from Enum are accepted.
+}
+
+// Describes a single endpoint for the OpenAPI spec, docs page and welcome text.
+// Every handler registered in NewMux should have one of these in API_ENDPOINTS.
+type ApiEndpoint struct {
+	Path        string // Relative to the map if PerMap, e.g. "/towns/{uuid}".
+	PerMap      bool
+	Summary     string
+	Description string
+	Params      []ApiParam
+	Response    any    // Zero value of the response type, e.g. []database.FallingTown{}. Nil if not JSON.
+	ListOf      any    // If set, the response is a ListPage where each item in "data" is of this type.
+	ContentType string // Defaults to application/json.
+	Status      int    // Status of a successful response. Defaults to 200.
+	RateLimit   string // One of the ENDPOINT_* consts if rate limited, see RATE_TIERS.
+	Export      bool   // Whether the list can also be requested as CSV or NDJSON. See negotiateFormat.
+}
+
+func (e ApiEndpoint) FullPath() string {
+	if e.PerMap {
+		return "/{map}" + e.Path
+	}
+
+	return e.Path
+}
+
+func queryParam(name, description string, enum ...string) ApiParam {
+	return ApiParam{Name: name, In: "query", Description: description, Enum: enum}
+}
+
+func intQueryParam(name, description string) ApiParam {
+	return ApiParam{Name: name, In: "query", Description: description, Integer: true}
+}
+
+func listQueryParam(name, description string, enum ...string) ApiParam {
+	return ApiParam{Name: name, In: "query", Description: description, Enum: enum, List: true}
+}
+
+func pathParam(name, description string) ApiParam {
+	return ApiParam{Name: name, In: "path", Description: description, Required: true}
+}
+
+var listParams = []ApiParam{
+	queryParam("fields", "Comma separated top-level fields to keep, e.g. `uuid,name,stats`."),
+	intQueryParam("limit", fmt.Sprintf("Items per page, between 1 and %d. Defaults to %d.", MAX_PAGE_LIMIT, DEFAULT_PAGE_LIMIT)),
+	queryParam("cursor", "The `nextCursor` of the previous page."),
+}
+
+var formatParam = queryParam(
+	"format", "Format of the list. Takes priority over the `Accept` header (`text/csv`, `application/x-ndjson`). Defaults to `json`. "+
+		"CSV has a row per item with nested fields flattened to dotted columns. Only JSON is paginated, CSV and NDJSON include every item.",
+	EXPORT_FORMATS...,
+)
+
+var historyParams = []ApiParam{
+	queryParam("from", "Unix timestamp (ms) or RFC3339 time. Defaults to 7 days before `to`."),
+	queryParam("to", "Unix timestamp (ms) or RFC3339 time. Defaults to now."),
+	queryParam("resolution", "`hour`, `day`, `week` or a duration like `6h` (at least 1h). Defaults to hourly for the last 3 days, daily otherwise."),
+}
+
+var API_ENDPOINTS = []ApiEndpoint{
+	{
+		Path: "/towns", PerMap: true, Export: true, RateLimit: ENDPOINT_TOWNS,
+		Summary: "Paginated list of towns.",
+		Params: append([]ApiParam{
+			queryParam("nation", "Only towns in this nation (name or UUID). Use `none` for nationless towns."),
+			listQueryParam("status", "Statuses the town must have.", sortedKeys(database.TOWN_STATUS_FILTERS)...),
+			listQueryParam("flags", "Flags the town must have toggled on.", sortedKeys(database.TOWN_FLAG_FILTERS)...),
+			intQueryParam("minResidents", "Only towns with at least this many residents."),
+			queryParam("sort", "Same keys as /town list. Defaults to residents, then size.", sortedKeys(database.TOWN_SORTS)...),
+		}, listParams...),
+		ListOf: TownPayload{},
+	},
+	{
+		Path: "/towns/{uuid}", PerMap: true, RateLimit: ENDPOINT_TOWNS,
+		Summary: "A single town.",
+		Params: []ApiParam{
+			pathParam("uuid", "UUID of the town."),
+			listParams[0],
+		},
+		Response: TownPayload{},
+	},
+	{
+		Path: "/towns/{id}/history", PerMap: true, RateLimit: ENDPOINT_HISTORY,
+		Summary:     "Stats of a town over time.",
+		Description: "Samples are recorded hourly, kept hourly for 3 days and daily for 180 days.",
+		Params:      append([]ApiParam{pathParam("id", "UUID of the town.")}, historyParams...),
+		Response:    HistorySeries{},
+	},
+	{
+		Path: "/nations", PerMap: true, Export: true, RateLimit: ENDPOINT_NATIONS,
+		Summary: "Paginated list of nations.",
+		Params: append([]ApiParam{
+			listQueryParam("status", "Statuses the nation must have.", sortedKeys(database.NATION_STATUS_FILTERS)...),
+			intQueryParam("minResidents", "Only nations with at least this many residents."),
+			queryParam("sort", "Same keys as /nation list. Defaults to residents, then towns, then size.", sortedKeys(database.NATION_SORTS)...),
+		}, listParams...),
+		ListOf: NationPayload{},
+	},
+	{
+		Path: "/nations/{id}/history", PerMap: true, RateLimit: ENDPOINT_HISTORY,
+		Summary:  "Stats of a nation over time.",
+		Params:   append([]ApiParam{pathParam("id", "UUID of the nation.")}, historyParams...),
+		Response: HistorySeries{},
+	},
+	{
+		Path: "/falling", PerMap: true, Export: true,
+		Summary:  "Towns that will fall into ruin soon, most inactive mayor first.",
+		Response: []database.FallingTown{},
+	},
+	{
+		Path: "/ruined", PerMap: true, Export: true,
+		Summary:  "Towns currently in ruin.",
+		Response: []database.RuinedTown{},
+	},
+	{
+		Path: "/overclaim", PerMap: true, Export: true,
+		Summary:  "Towns at risk of being overclaimed, most severe first.",
+		Response: []database.OverclaimRisk{},
+	},
+	{
+		Path: "/alliances", PerMap: true, Export: true, RateLimit: ENDPOINT_ALLIANCES,
+		Summary:  "All alliances with their nations and stats.",
+		Response: []Alliance{},
+	},
+	{
+		Path: "/alliances/{id}/history", PerMap: true, RateLimit: ENDPOINT_HISTORY,
+		Summary:  "Stats of an alliance over time.",
+		Params:   append([]ApiParam{pathParam("id", "Identifier or UUID of the alliance.")}, historyParams...),
+		Response: HistorySeries{},
+	},
+	{
+		Path: "/players", PerMap: true, Export: true, RateLimit: ENDPOINT_PLAYERS,
+		Summary:     "Every known player.",
+		Description: "Town and nation are condensed to `[name, uuid]` pairs to reduce payload size.",
+		Response:    []BasicPlayer{},
+	},
+	{
+		Path: "/news", PerMap: true, Export: true, RateLimit: ENDPOINT_NEWS,
+		Summary:  "News posted in the EarthMC Discord, newest first.",
+		Response: []NewsEntry{},
+	},
+	{
+		Path: "/borders/nations", PerMap: true, Export: true,
+		Summary:  "Nations and every nation they share a border with.",
+		Response: []EntityBorders{},
+	},
+	{
+		Path: "/borders/towns", PerMap: true, Export: true,
+		Summary:  "Towns and every town they share a border with.",
+		Response: []EntityBorders{},
+	},
+	{
+		Path: "/borders/alliances", PerMap: true, Export: true,
+		Summary:  "Whether each alliance's territory is contiguous.",
+		Response: []AllianceContiguity{},
+	},
+	{
+		Path: "/stream", PerMap: true, RateLimit: ENDPOINT_STREAM,
+		Summary: "Server-Sent Events stream of events as the bot detects them.",
+		Description: "Each event is sent as JSON in the `data` field. Reconnecting clients that send `Last-Event-ID` " +
+			"are sent any events they missed from the last 10 minutes.",
+		Params: []ApiParam{
+			listQueryParam("topics", "Topics to receive. Defaults to all.", topicNames()...),
+			{Name: "Last-Event-ID", In: "header", Description: "ID of the last event received. Sent automatically by EventSource."},
+		},
+		Response:    database.StreamEvent{},
+		ContentType: "text/event-stream",
+	},
+	{
+		Path: "/proxy", RateLimit: ENDPOINT_PROXY,
+		Summary: "CORS proxy for EarthMC hosts.",
+		Description: "GET responses are cached following the upstream Cache-Control and ETag. " +
+			"The `X-Cache` header says whether it was a HIT, MISS, REVALIDATED, COLLAPSED, STALE or BYPASS.",
+		Params: []ApiParam{
+			{Name: "target", In: "query", Required: true, Description: "HTTPS URL on an EarthMC host (or a Wayback Machine copy of one)."},
+		},
+	},
+	{Path: "/openapi.json", Summary: "This OpenAPI document."},
+	{Path: "/docs", Summary: "Human readable version of this document.", ContentType: "text/html"},
+	{
+		Path: "/healthz", Summary: "Whether the API is up and its data is fresh.", Response: health.Report{},
+		Description: "Responds with `503` if the data of the active map is older than the max age, or hasn't shown up a while after starting.",
+	},
+	{
+		Path: "/readyz", Summary: "Whether the API is fully up with fresh data.", Response: health.Report{},
+		Description: "Same as `/healthz`, except it also responds with `503` while still starting.",
+	},
+	{
+		Path: "/metrics", Summary: "Prometheus metrics.", ContentType: "text/plain",
+		Description: "Requires the `Authorization: Bearer <token>` header if the host has set a metrics token.",
+	},
+	{Path: "/terms", Summary: "Terms of Service and Privacy Policy.", ContentType: "text/html"},
+	{Path: "/invite", Summary: "Redirects to the bot invite.", Status: http.StatusFound},
+}
+
+func topicNames() []string {
+	names := make([]string, 0, len(database.STREAM_TOPICS))
+	for _, t := range database.STREAM_TOPICS {
+		names = append(names, string(t))
+	}
+
+	return names
+}
+
+// #region OpenAPI types
+type OpenAPIDoc struct {
+	OpenAPI    string                          `json:"openapi"`
+	Info       OpenAPIInfo                     `json:"info"`
+	Paths      map[string]map[string]Operation `json:"paths"`
+	Components OpenAPIComponents               `json:"components"`
+}
+
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Version     string `json:"version"`
+}
+
+type OpenAPIComponents struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes"`
+}
+
+type SecurityScheme struct {
+	Type   string `json:"type"`
+	In     string `json:"in,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Scheme string `json:"scheme,omitempty"`
+}
+
+type Operation struct {
+	Summary     string                `json:"summary"`
+	Description string                `json:"description,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required"`
+	Schema      *Schema `json:"schema"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// #endregion
+
+// #region Schema generation
+
+// Builds schemas from Go types by reflection, following the same rules as encoding/json.
+// Named structs become components and are referenced with $ref so each one is only described once.
+type schemaGen struct {
+	schemas map[string]*Schema
+	names   map[reflect.Type]string
+}
+
+func newSchemaGen() *schemaGen {
+	return &schemaGen{schemas: map[string]*Schema{}, names: map[reflect.Type]string{}}
+}
+
+var (
+	timeType       = reflect.TypeFor[time.Time]()
+	rawMessageType = reflect.TypeFor[json.RawMessage]()
+	marshalerType  = reflect.TypeFor[json.Marshaler]()
+)
+
+func (g *schemaGen) schemaOf(t reflect.Type) *Schema {
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case rawMessageType:
+		return &Schema{} // any
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := g.schemaOf(t.Elem())
+		if s.Ref == "" {
+			s.Nullable = true
+		}
+		return s
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer", Format: intFormat(t)}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 && t.Kind() == reflect.Slice {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: g.schemaOf(t.Elem())}
+	case reflect.Map:
+		// Sets marshal to an array of their keys.
+		if t.Implements(marshalerType) && t.Elem().Kind() == reflect.Struct && t.Elem().NumField() == 0 {
+			return &Schema{Type: "array", Items: g.schemaOf(t.Key())}
+		}
+		return &Schema{Type: "object", AdditionalProperties: g.schemaOf(t.Elem())}
+	case reflect.Struct:
+		return g.structRef(t)
+	}
+
+	return &Schema{} // interfaces and anything else json can encode as anything
+}
+
+func intFormat(t reflect.Type) string {
+	if t.Bits() > 32 {
+		return "int64"
+	}
+
+	return "int32"
+}
+
+// Registers a struct as a component if it isn't already, returning a reference to it.
+func (g *schemaGen) structRef(t reflect.Type) *Schema {
+	if t.Name() == "" {
+		return g.structSchema(t) // anonymous struct, nothing to name it
+	}
+
+	name, ok := g.names[t]
+	if !ok {
+		name = g.componentName(t)
+		g.names[t] = name
+		g.schemas[name] = &Schema{} // placeholder so recursive types terminate
+		*g.schemas[name] = *g.structSchema(t)
+	}
+
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// Uses the type name, prefixed with its package if another type already took it (e.g. capi.Alliance and database.Alliance).
+func (g *schemaGen) componentName(t reflect.Type) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, t.Name())
+
+	if _, taken := g.schemas[name]; !taken {
+		return name
+	}
+
+	pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+	return strings.ToUpper(pkg[:1]) + pkg[1:] + name
+}
+
+func (g *schemaGen) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	g.addFields(s, t)
+
+	return s
+}
+
+func (g *schemaGen) addFields(s *Schema, t reflect.Type) {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() && !f.Anonymous {
+			continue
+		}
+
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+
+		// Embedded structs without a name have their fields promoted, same as encoding/json.
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.addFields(s, ft)
+				continue
+			}
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		s.Properties[name] = g.schemaOf(f.Type)
+		if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Pointer {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// #endregion
+
+// Builds the OpenAPI document for every endpoint in API_ENDPOINTS, where {map} can be any of the given map names.
+func BuildOpenAPI(mapNames []string) *OpenAPIDoc {
+	g := newSchemaGen()
+	doc := &OpenAPIDoc{
+		OpenAPI: OPENAPI_VERSION,
+		Info: OpenAPIInfo{
+			Title:       "EMCS Custom API",
+			Description: strings.TrimSpace(BASE_WELCOME_STR) + " See /docs for a human readable version of this document.",
+			Version:     "1.0.0",
+		},
+		Paths: map[string]map[string]Operation{},
+		Components: OpenAPIComponents{
+			Schemas: g.schemas,
+			SecuritySchemes: map[string]SecurityScheme{
+				"ApiKey": {Type: "apiKey", In: "header", Name: "X-API-Key"},
+				"Bearer": {Type: "http", Scheme: "bearer"},
+			},
+		},
+	}
+
+	for _, e := range API_ENDPOINTS {
+		status := cmp.Or(e.Status, http.StatusOK)
+		op := Operation{
+			Summary:     e.Summary,
+			Description: e.Description,
+			Responses: map[string]Response{
+				strconv.Itoa(status): {Description: http.StatusText(status)},
+			},
+		}
+		if status == http.StatusOK {
+			op.Responses["200"] = Response{Description: "OK", Content: g.responseContent(e)}
+		}
+
+		if e.PerMap {
+			op.Parameters = append(op.Parameters, Parameter{
+				Name: "map", In: "path", Required: true,
+				Description: "Name of the map.",
+				Schema:      &Schema{Type: "string", Enum: mapNames},
+			})
+		}
+		params := e.Params
+		if e.Export {
+			params = append(slices.Clone(params), formatParam)
+		}
+
+		for _, p := range params {
+			schema := &Schema{Type: "string"}
+			if p.Integer {
+				schema = &Schema{Type: "integer", Format: "int32"}
+			}
+			if p.List {
+				p.Description += " Comma separated, any of: `" + strings.Join(p.Enum, "`, `") + "`."
+			} else {
+				schema.Enum = p.Enum
+			}
+
+			op.Parameters = append(op.Parameters, Parameter{
+				Name: p.Name, In: p.In, Required: p.Required,
+				Description: p.Description,
+				Schema:      schema,
+			})
+		}
+
+		if e.RateLimit != "" {
+			// Keys are optional, an empty requirement means anonymous access is allowed.
+			op.Security = []map[string][]string{{}, {"ApiKey": {}}, {"Bearer": {}}}
+			op.Responses["401"] = Response{Description: "Invalid or revoked API key."}
+			op.Responses["429"] = Response{Description: fmt.Sprintf(
+				"Rate limit exceeded. Anonymous requests are allowed %d per minute.",
+				TierRPM(database.ApiTierAnonymous, e.RateLimit),
+			)}
+		}
+
+		doc.Paths[e.FullPath()] = map[string]Operation{"get": op}
+	}
+
+	return doc
+}
+
+func (g *schemaGen) responseContent(e ApiEndpoint) map[string]MediaType {
+	contentType := e.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+
+	var schema *Schema
+	switch {
+	case e.ListOf != nil:
+		pageType := reflect.TypeFor[ListPage]()
+		g.schemaOf(pageType)
+		page := g.schemas[g.names[pageType]]
+
+		// Each endpoint has different items, so describe this page inline instead of via the shared component.
+		schema = &Schema{Type: "object", Required: page.Required, Properties: map[string]*Schema{}}
+		for k, v := range page.Properties {
+			schema.Properties[k] = v
+		}
+		schema.Properties["data"] = &Schema{Type: "array", Items: g.schemaOf(reflect.TypeOf(e.ListOf))}
+	case e.Response != nil:
+		schema = g.schemaOf(reflect.TypeOf(e.Response))
+	}
+
+	content := map[string]MediaType{contentType: {Schema: schema}}
+	if e.Export {
+		// Flattened rows, so there isn't much of a schema to give.
+		content[exportMediaTypes[FormatCSV][0]] = MediaType{Schema: &Schema{Type: "string"}}
+		content[exportMediaTypes[FormatNDJSON][0]] = MediaType{Schema: &Schema{Type: "string"}}
+	}
+
+	return content
+}
+
+// Lists every endpoint and its summary as plain text for the welcome page.
+func endpointListText() string {
+	var sb strings.Builder
+	for _, e := range API_ENDPOINTS {
+		fmt.Fprintf(&sb, "- %s - %s\n", e.FullPath(), e.Summary)
+	}
+
+	return sb.String()
+}
+
+// Renders the document as markdown for the docs page.
+func (doc *OpenAPIDoc) Markdown() []byte {
+	var sb strings.Builder
+	sb.WriteString("# " + doc.Info.Title + "\n\n")
+	sb.WriteString("Machine readable version: [/openapi.json](/openapi.json)\n\n")
+	sb.WriteString("Rate limited endpoints accept an optional API key in the `X-API-Key` or `Authorization: Bearer` header for higher limits.\n\n")
+
+	for _, e := range API_ENDPOINTS {
+		op := doc.Paths[e.FullPath()]["get"]
+		fmt.Fprintf(&sb, "## GET %s\n%s", e.FullPath(), op.Summary)
+		if op.Description != "" {
+			sb.WriteString(" " + op.Description)
+		}
+		sb.WriteString("\n\n")
+
+		if len(op.Parameters) > 0 {
+			sb.WriteString("**Parameters**\n")
+			for _, p := range op.Parameters {
+				required := ""
+				if p.Required {
+					required = " (required)"
+				}
+
+				desc := p.Description
+				if len(p.Schema.Enum) > 0 {
+					desc += " One of: `" + strings.Join(p.Schema.Enum, "`, `") + "`."
+				}
+
+				fmt.Fprintf(&sb, "- `%s` %s%s: %s\n", p.Name, p.In, required, desc)
+			}
+			sb.WriteString("\n")
+		}
+
+		if resp := responseTypeName(e); resp != "" {
+			fmt.Fprintf(&sb, "**Returns** %s\n\n", resp)
+		}
+		if e.RateLimit != "" {
+			fmt.Fprintf(&sb, "**Rate limit** %d/min anonymous, %d/min standard, %d/min partner\n\n",
+				TierRPM(database.ApiTierAnonymous, e.RateLimit),
+				TierRPM(database.ApiTierStandard, e.RateLimit),
+				TierRPM(database.ApiTierPartner, e.RateLimit),
+			)
+		}
+	}
+
+	return []byte(sb.String())
+}
+
+func responseTypeName(e ApiEndpoint) string {
+	switch {
+	case e.ListOf != nil:
+		return fmt.Sprintf("`ListPage` of `%s`", reflect.TypeOf(e.ListOf).Name())
+	case e.Response != nil:
+		t := reflect.TypeOf(e.Response)
+		if t.Kind() == reflect.Slice {
+			return fmt.Sprintf("Array of `%s`", t.Elem().Name())
+		}
+		return fmt.Sprintf("`%s`", t.Name())
+	}
+
+	return ""
+}
+
+// Serves the OpenAPI document at /openapi.json and a docs page generated from it at /docs.
+func ServeOpenAPI(mux *http.ServeMux, mapNames []string) error {
+	doc := BuildOpenAPI(mapNames)
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	mux.HandleFunc("/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Access-Control-Allow-Origin", "*") // so it can be loaded into external viewers
+		w.Write(data)
+	})
+
+	docs := doc.Markdown()
+	mux.HandleFunc("/docs", func(w http.ResponseWriter, r *http.Request) {
+		writeMarkdownPage(w, docs)
+	})
+
+	return nil
+}
@@ -27,11 +27,11 @@ var noRedirectClient = &http.Client{
 type Proxy struct {
 	allowedHosts []string
 	rl           *RateLimit
-	rpm          int
+	cache        *ProxyCache // May be nil to always go upstream.
 }
 
-func NewProxy(rl *RateLimit, reqPerMin uint8, allowedHosts []string) *Proxy {
-	return &Proxy{rl: rl, rpm: int(reqPerMin), allowedHosts: allowedHosts}
+func NewProxy(rl *RateLimit, cache *ProxyCache, allowedHosts []string) *Proxy {
+	return &Proxy{rl: rl, cache: cache, allowedHosts: allowedHosts}
 }
 
 // Handles CORS preflight, parses the target URL and forwards the request to the upstream HTTPS endpoint.
@@ -42,19 +42,13 @@ func (p *Proxy) handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !p.allow(r) {
-		http.Error(w, "Rate Limit Exceeded", http.StatusTooManyRequests)
+	if !p.rl.allow(w, r, ENDPOINT_PROXY) {
 		return
 	}
 
 	p.forward(w, r, turl)
 }
 
-func (p *Proxy) allow(r *http.Request) bool {
-	lim := p.rl.clientLimiter(r, p.rpm) // amt of reqs/min allowed per client
-	return lim.Allow()
-}
-
 func (p *Proxy) isAllowedHost(hostname string) bool {
 	hostname = strings.ToLower(hostname)
 	return slices.Contains(p.allowedHosts, hostname)
@@ -114,6 +108,8 @@ func (p *Proxy) getTargetUrl(r *http.Request) (*url.URL, error) {
 
 // Proxies the request to the validated HTTPS target, buffering the request body
 // for safe forwarding and streaming the upstream response back to the client.
+//
+// GET requests go through the cache if there is one.
 func (p *Proxy) forward(w http.ResponseWriter, r *http.Request, targetUrl *url.URL) {
 	reqBody, err := cloneBody(r)
 	if err != nil {
@@ -121,14 +117,35 @@ func (p *Proxy) forward(w http.ResponseWriter, r *http.Request, targetUrl *url.U
 		return
 	}
 
-	req, err := http.NewRequest(r.Method, targetUrl.String(), bytes.NewReader(reqBody))
-	if err != nil {
-		http.Error(w, "bad request", http.StatusBadRequest)
+	// The cache decides what it can share based on what actually goes upstream, so it gets the sanitised headers too.
+	sanitized := r.Clone(r.Context())
+	sanitized.Header = sanitizeHeader(r)
+
+	fetch := func(conditional http.Header) (*http.Response, error) {
+		req, err := http.NewRequest(r.Method, targetUrl.String(), bytes.NewReader(reqBody))
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header = sanitized.Header.Clone()
+		if conditional != nil {
+			// The cache does its own revalidation, the client's validators are for the cached copy.
+			req.Header.Del("If-None-Match")
+			req.Header.Del("If-Modified-Since")
+			for k, vv := range conditional {
+				req.Header[k] = vv
+			}
+		}
+
+		return noRedirectClient.Do(req)
+	}
+
+	if p.cache != nil {
+		p.cache.Serve(w, sanitized, targetUrl.String(), fetch)
 		return
 	}
-	req.Header = sanitizeHeader(r)
 
-	resp, err := noRedirectClient.Do(req)
+	resp, err := fetch(nil)
 	if err != nil {
 		http.Error(w, "fetch failed", http.StatusBadGateway)
 		return
@@ -177,6 +194,23 @@ func sanitizeHeader(r *http.Request) http.Header {
 	h.Del("Sec-Ch-Ua-Full-Version-List")
 	h.Del("Sec-CH-UA-Full-Version-List")
 
+	// Remove forwarding fields. These come from the client (or our own reverse proxy) and
+	// would either leak the client's IP or let them spoof one to the upstream server.
+	h.Del("Forwarded")
+	h.Del("X-Forwarded-For")
+	h.Del("X-Forwarded-Host")
+	h.Del("X-Forwarded-Proto")
+	h.Del("X-Real-IP")
+	h.Del("CF-Connecting-IP")
+
+	// Our own API key was only for the rate limit, it must never reach a third party.
+	// Any other Authorization (like Basic) is left alone since it was meant for upstream.
+	key := requestApiKey(r)
+	h.Del("X-API-Key")
+	if token, ok := strings.CutPrefix(h.Get("Authorization"), "Bearer "); ok && key != "" && strings.TrimSpace(token) == key {
+		h.Del("Authorization")
+	}
+
 	// Privacy (bc why not)
 	h.Set("DNT", "1")
 	h.Set("X-Do-Not-Track", "1")
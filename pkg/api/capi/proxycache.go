@@ -0,0 +1,566 @@
+package capi
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"emcsrw/pkg/utils/config"
+	"emcsrw/pkg/utils/logutil"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	PROXY_CACHE_MAX_ENTRY  = 2 << 20   // Responses bigger than this are streamed and never cached.
+	PROXY_CACHE_MAX_MEMORY = 64 << 20  // Least recently used responses are evicted from memory past this.
+	PROXY_CACHE_MAX_DISK   = 512 << 20 // Oldest files are removed past this when disk backing is enabled.
+)
+
+// Values of the X-Cache response header.
+const (
+	CACHE_HIT         = "HIT"         // Served from cache without contacting upstream.
+	CACHE_MISS        = "MISS"        // Fetched from upstream.
+	CACHE_REVALIDATED = "REVALIDATED" // Upstream confirmed (304) our stale copy is still good.
+	CACHE_COLLAPSED   = "COLLAPSED"   // Shared the response of an identical request that was already in flight.
+	CACHE_STALE       = "STALE"       // Upstream failed so a stale copy was served instead.
+	CACHE_BYPASS      = "BYPASS"      // Not cacheable (not a GET, too big, etc).
+)
+
+// Headers that only apply to a single connection and must never be stored or replayed.
+var hopByHopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+type ProxyCacheOptions struct {
+	MaxEntryBytes  int64
+	MaxMemoryBytes int64
+	MaxDiskBytes   int64
+	Dir            string // Where responses are also written so they survive restarts. Empty = memory only.
+}
+
+// Default caps, with disk backing enabled if PROXY_CACHE_DIR is set.
+func ProxyCacheOptionsFromEnv() ProxyCacheOptions {
+	dir, _ := config.GetEnviroVar("PROXY_CACHE_DIR")
+	return ProxyCacheOptions{
+		MaxEntryBytes:  PROXY_CACHE_MAX_ENTRY,
+		MaxMemoryBytes: PROXY_CACHE_MAX_MEMORY,
+		MaxDiskBytes:   PROXY_CACHE_MAX_DISK,
+		Dir:            dir,
+	}
+}
+
+type cachedResponse struct {
+	Status    int         `json:"status"`
+	Header    http.Header `json:"header"`
+	Body      []byte      `json:"body"`
+	StoredAt  time.Time   `json:"storedAt"`
+	ExpiresAt time.Time   `json:"expiresAt"` // Fresh until this time, after which it must be revalidated.
+}
+
+func (c *cachedResponse) fresh(now time.Time) bool {
+	return now.Before(c.ExpiresAt)
+}
+
+func (c *cachedResponse) canRevalidate() bool {
+	return c.Header.Get("ETag") != "" || c.Header.Get("Last-Modified") != ""
+}
+
+// Rough in-memory size, the body is all that really matters.
+func (c *cachedResponse) size() int64 {
+	n := int64(len(c.Body))
+	for k, vv := range c.Header {
+		for _, v := range vv {
+			n += int64(len(k) + len(v))
+		}
+	}
+
+	return n
+}
+
+type lruItem struct {
+	key  string
+	resp *cachedResponse
+}
+
+// An identical request already being fetched. Resp is nil if the response couldn't be shared (too big or not storable).
+// Err is set if upstream failed and there was no stale copy to fall back on, so waiters fail with it instead of retrying.
+type inflightCall struct {
+	done chan struct{}
+	resp *cachedResponse
+	err  error
+}
+
+// A shared HTTP cache for proxied GET requests, so many clients asking for the same thing only costs upstream one request.
+//
+// Follows upstream Cache-Control (max-age, s-maxage, no-cache, no-store, private), Expires and Vary.
+// Stale responses with an ETag or Last-Modified are revalidated with a conditional request instead of refetched.
+// Identical requests made while one is in flight wait for it rather than each going upstream, but only share its
+// response if it could be stored. Otherwise they fetch their own.
+// Requests carrying credentials (Authorization or Cookie) are never cached or collapsed.
+type ProxyCache struct {
+	opts ProxyCacheOptions
+
+	entries  map[string]*list.Element
+	lru      *list.List // Front is most recently used.
+	memBytes int64
+	inflight map[string]*inflightCall
+	mu       sync.Mutex
+
+	diskBytes int64
+	diskMu    sync.Mutex
+}
+
+func NewProxyCache(opts ProxyCacheOptions) (*ProxyCache, error) {
+	c := &ProxyCache{
+		opts:     opts,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+		inflight: make(map[string]*inflightCall),
+	}
+
+	if opts.Dir != "" {
+		if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+			return nil, err
+		}
+
+		files, _ := os.ReadDir(opts.Dir)
+		for _, f := range files {
+			if info, err := f.Info(); err == nil {
+				c.diskBytes += info.Size()
+			}
+		}
+	}
+
+	return c, nil
+}
+
+// Responses differ by encoding since the body is stored as sent by upstream (possibly compressed).
+func proxyCacheKey(target string, r *http.Request) string {
+	return target + "|" + strings.ToLower(strings.ReplaceAll(r.Header.Get("Accept-Encoding"), " ", ""))
+}
+
+// Whether the request carries credentials, meaning the response may be specific to whoever sent it.
+func requestHasCredentials(r *http.Request) bool {
+	return r.Header.Get("Authorization") != "" || r.Header.Get("Cookie") != ""
+}
+
+// #region Memory and disk storage
+func (c *ProxyCache) get(key string) *cachedResponse {
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(el)
+		c.mu.Unlock()
+		return el.Value.(*lruItem).resp
+	}
+	c.mu.Unlock()
+
+	resp := c.readDisk(key)
+	if resp != nil {
+		c.putMemory(key, resp)
+	}
+
+	return resp
+}
+
+func (c *ProxyCache) put(key string, resp *cachedResponse) {
+	c.putMemory(key, resp)
+	c.writeDisk(key, resp)
+}
+
+func (c *ProxyCache) putMemory(key string, resp *cachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		item := el.Value.(*lruItem)
+		c.memBytes += resp.size() - item.resp.size()
+		item.resp = resp
+		c.lru.MoveToFront(el)
+	} else {
+		c.entries[key] = c.lru.PushFront(&lruItem{key: key, resp: resp})
+		c.memBytes += resp.size()
+	}
+
+	for c.memBytes > c.opts.MaxMemoryBytes && c.lru.Len() > 1 {
+		oldest := c.lru.Back()
+		item := oldest.Value.(*lruItem)
+
+		c.lru.Remove(oldest)
+		delete(c.entries, item.key)
+		c.memBytes -= item.resp.size()
+	}
+}
+
+func (c *ProxyCache) diskPath(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.opts.Dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (c *ProxyCache) readDisk(key string) *cachedResponse {
+	if c.opts.Dir == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(c.diskPath(key))
+	if err != nil {
+		return nil
+	}
+
+	var resp cachedResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil
+	}
+
+	return &resp
+}
+
+func (c *ProxyCache) writeDisk(key string, resp *cachedResponse) {
+	if c.opts.Dir == "" {
+		return
+	}
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return
+	}
+
+	c.diskMu.Lock()
+	defer c.diskMu.Unlock()
+
+	path := c.diskPath(key)
+	if info, err := os.Stat(path); err == nil {
+		c.diskBytes -= info.Size()
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		logutil.Printf(logutil.RED, "\nERR | failed to write proxy cache entry:\n\t%s", err)
+		return
+	}
+
+	c.diskBytes += int64(len(data))
+	if c.diskBytes > c.opts.MaxDiskBytes {
+		c.pruneDisk()
+	}
+}
+
+// Removes the least recently written files until the cache dir is back under 90% of its cap.
+// Must be called with diskMu held.
+func (c *ProxyCache) pruneDisk() {
+	files, err := os.ReadDir(c.opts.Dir)
+	if err != nil {
+		return
+	}
+
+	infos := make([]os.FileInfo, 0, len(files))
+	for _, f := range files {
+		if info, err := f.Info(); err == nil {
+			infos = append(infos, info)
+		}
+	}
+	slices.SortFunc(infos, func(a, b os.FileInfo) int {
+		return a.ModTime().Compare(b.ModTime())
+	})
+
+	target := c.opts.MaxDiskBytes * 9 / 10
+	for _, info := range infos {
+		if c.diskBytes <= target {
+			break
+		}
+		if os.Remove(filepath.Join(c.opts.Dir, info.Name())) == nil {
+			c.diskBytes -= info.Size()
+		}
+	}
+}
+
+// #endregion
+
+// #region Request collapsing
+
+// Returns the in-flight call for key, and whether the caller is the leader responsible for fetching it.
+func (c *ProxyCache) join(key string) (*inflightCall, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if call, ok := c.inflight[key]; ok {
+		return call, false
+	}
+
+	call := &inflightCall{done: make(chan struct{})}
+	c.inflight[key] = call
+	return call, true
+}
+
+func (c *ProxyCache) finish(key string, call *inflightCall) {
+	c.mu.Lock()
+	delete(c.inflight, key)
+	c.mu.Unlock()
+
+	close(call.done)
+}
+
+// #endregion
+
+// #region Cache-Control
+
+func parseCacheControl(h string) map[string]string {
+	directives := map[string]string{}
+	for part := range strings.SplitSeq(h, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		if k != "" {
+			directives[strings.ToLower(k)] = strings.Trim(v, `"`)
+		}
+	}
+
+	return directives
+}
+
+// How long a response can be served without revalidating, and whether it may be stored at all.
+func responseFreshness(h http.Header, now time.Time) (ttl time.Duration, storable bool) {
+	cc := parseCacheControl(h.Get("Cache-Control"))
+	if _, ok := cc["no-store"]; ok {
+		return 0, false
+	}
+	if _, ok := cc["private"]; ok {
+		return 0, false // we are a shared cache
+	}
+	if h.Get("Set-Cookie") != "" {
+		return 0, false
+	}
+
+	// Only Accept-Encoding is part of the cache key, anything else could serve the wrong variant.
+	for v := range strings.SplitSeq(h.Get("Vary"), ",") {
+		if v = strings.TrimSpace(v); v != "" && !strings.EqualFold(v, "Accept-Encoding") {
+			return 0, false
+		}
+	}
+
+	if _, ok := cc["no-cache"]; ok {
+		return 0, true
+	}
+
+	parseSecs := func(s string) (time.Duration, bool) {
+		n, err := strconv.ParseInt(s, 10, 64)
+		return time.Duration(n) * time.Second, err == nil && n >= 0
+	}
+
+	age, _ := parseSecs(h.Get("Age"))
+	if v, ok := cc["s-maxage"]; ok {
+		if ttl, ok := parseSecs(v); ok {
+			return max(ttl-age, 0), true
+		}
+	}
+	if v, ok := cc["max-age"]; ok {
+		if ttl, ok := parseSecs(v); ok {
+			return max(ttl-age, 0), true
+		}
+	}
+	if expires, err := http.ParseTime(h.Get("Expires")); err == nil {
+		return max(expires.Sub(now), 0), true
+	}
+
+	return 0, true
+}
+
+// Whether the client asked us not to use a cached copy.
+func requestNoCache(r *http.Request) bool {
+	cc := parseCacheControl(r.Header.Get("Cache-Control"))
+	_, noCache := cc["no-cache"]
+	_, noStore := cc["no-store"]
+	return noCache || noStore || r.Header.Get("Pragma") == "no-cache"
+}
+
+// #endregion
+
+func newCachedResponse(resp *http.Response, body []byte, now time.Time) (cr *cachedResponse, storable bool) {
+	header := resp.Header.Clone()
+	for _, h := range hopByHopHeaders {
+		header.Del(h)
+	}
+	header.Del("Content-Length") // we set it ourselves when writing
+
+	ttl, storable := responseFreshness(header, now)
+	cr = &cachedResponse{
+		Status:    resp.StatusCode,
+		Header:    header,
+		Body:      body,
+		StoredAt:  now,
+		ExpiresAt: now.Add(ttl),
+	}
+
+	storable = storable && resp.StatusCode == http.StatusOK && (ttl > 0 || cr.canRevalidate())
+	return cr, storable
+}
+
+// Updates a stale response with the headers of a 304 from upstream, making it fresh again.
+func (c *cachedResponse) revalidated(h http.Header, now time.Time) (*cachedResponse, bool) {
+	header := c.Header.Clone()
+	for _, k := range []string{"Cache-Control", "Expires", "ETag", "Last-Modified", "Date", "Age", "Vary"} {
+		if v := h.Values(k); len(v) > 0 {
+			header[k] = v
+		}
+	}
+
+	ttl, storable := responseFreshness(header, now)
+	return &cachedResponse{
+		Status:    c.Status,
+		Header:    header,
+		Body:      c.Body,
+		StoredAt:  now,
+		ExpiresAt: now.Add(ttl),
+	}, storable
+}
+
+func writeCachedResponse(w http.ResponseWriter, r *http.Request, cr *cachedResponse, status string) {
+	for k, vv := range cr.Header {
+		for _, v := range vv {
+			w.Header().Add(k, v)
+		}
+	}
+
+	w.Header().Set("X-Cache", status)
+	if status == CACHE_HIT || status == CACHE_STALE {
+		w.Header().Set("Age", strconv.Itoa(int(time.Since(cr.StoredAt).Seconds())))
+	}
+
+	if etag := cr.Header.Get("ETag"); etag != "" && r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(cr.Body)))
+	w.WriteHeader(cr.Status)
+	w.Write(cr.Body)
+}
+
+// Copies an upstream response straight to the client. Prefix is any part of the body that was already read.
+func streamResponse(w http.ResponseWriter, resp *http.Response, prefix []byte, status string) {
+	for k, vv := range resp.Header {
+		for _, v := range vv {
+			w.Header().Add(k, v)
+		}
+	}
+
+	w.Header().Set("X-Cache", status)
+	w.WriteHeader(resp.StatusCode)
+	w.Write(prefix)
+	io.Copy(w, resp.Body)
+}
+
+// Serves r from the cache if possible, otherwise calls fetch to get it from upstream.
+// Fetch receives any conditional headers (If-None-Match etc) that should be added to the upstream request.
+func (c *ProxyCache) Serve(
+	w http.ResponseWriter, r *http.Request, target string,
+	fetch func(conditional http.Header) (*http.Response, error),
+) {
+	if r.Method != http.MethodGet || requestHasCredentials(r) {
+		c.passthrough(w, fetch)
+		return
+	}
+
+	key := proxyCacheKey(target, r)
+	now := time.Now()
+
+	cached := c.get(key)
+	if cached != nil && cached.fresh(now) && !requestNoCache(r) {
+		writeCachedResponse(w, r, cached, CACHE_HIT)
+		return
+	}
+
+	call, leader := c.join(key)
+	if !leader {
+		<-call.done
+		if call.resp != nil {
+			writeCachedResponse(w, r, call.resp, CACHE_COLLAPSED)
+		} else if call.err != nil {
+			http.Error(w, "fetch failed", http.StatusBadGateway)
+		} else {
+			c.passthrough(w, fetch)
+		}
+		return
+	}
+	defer c.finish(key, call)
+
+	conditional := http.Header{}
+	if cached != nil {
+		if etag := cached.Header.Get("ETag"); etag != "" {
+			conditional.Set("If-None-Match", etag)
+		}
+		if lm := cached.Header.Get("Last-Modified"); lm != "" {
+			conditional.Set("If-Modified-Since", lm)
+		}
+	}
+
+	resp, err := fetch(conditional)
+	if err != nil {
+		if cached != nil {
+			call.resp = cached
+			writeCachedResponse(w, r, cached, CACHE_STALE)
+			return
+		}
+
+		call.err = err
+		http.Error(w, "fetch failed", http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		refreshed, storable := cached.revalidated(resp.Header, time.Now())
+		if storable {
+			c.put(key, refreshed)
+			call.resp = refreshed
+		}
+
+		writeCachedResponse(w, r, refreshed, CACHE_REVALIDATED)
+		return
+	}
+
+	// Read one byte past the cap so we know if it was exceeded.
+	body, err := io.ReadAll(io.LimitReader(resp.Body, c.opts.MaxEntryBytes+1))
+	if err != nil {
+		call.err = err
+		http.Error(w, "fetch failed", http.StatusBadGateway)
+		return
+	}
+	if int64(len(body)) > c.opts.MaxEntryBytes {
+		streamResponse(w, resp, body, CACHE_BYPASS)
+		return
+	}
+
+	// Only share what we would have stored. Anything else (like no-store or private) may be meant for this client
+	// alone, so waiters are left to fetch it themselves.
+	cr, storable := newCachedResponse(resp, body, time.Now())
+	if storable {
+		c.put(key, cr)
+		call.resp = cr
+	}
+
+	writeCachedResponse(w, r, cr, CACHE_MISS)
+}
+
+func (c *ProxyCache) passthrough(w http.ResponseWriter, fetch func(http.Header) (*http.Response, error)) {
+	resp, err := fetch(nil)
+	if err != nil {
+		http.Error(w, "fetch failed", http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	streamResponse(w, resp, nil, CACHE_BYPASS)
+}
+
+// Amount of responses and bytes currently held in memory.
+func (c *ProxyCache) Stats() (entries int, bytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lru.Len(), c.memBytes
+}
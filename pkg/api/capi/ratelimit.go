@@ -1,6 +1,7 @@
 package capi
 
 import (
+	"emcsrw/internal/database"
 	"net/http"
 	"sync"
 	"time"
@@ -8,32 +9,46 @@ import (
 	"golang.org/x/time/rate"
 )
 
+// How often limiters that have gone idle are evicted, so the map doesn't grow with every IP ever seen.
+const RATE_LIMIT_SWEEP_INTERVAL = 5 * time.Minute
+
 type RateLimit struct {
 	perEndpoint bool
-	maxBurst    int // Requests are allowed in bursts up until this amount.
+	maxBurst    int               // Requests are allowed in bursts up until this amount.
+	keys        *ApiKeys          // May be nil, in which case every request is treated as anonymous.
+	ips         *ClientIPResolver // May be nil, in which case forwarding headers are ignored.
 
-	clients map[string]*rate.Limiter
-	mu      sync.Mutex
+	clients   map[string]*rate.Limiter
+	lastSweep time.Time
+	mu        sync.Mutex
 }
 
-func NewRateLimit(perEndpoint bool, maxBurst uint8) *RateLimit {
+func NewRateLimit(perEndpoint bool, maxBurst uint8, keys *ApiKeys, ips *ClientIPResolver) *RateLimit {
 	return &RateLimit{
 		perEndpoint: perEndpoint,
 		maxBurst:    int(maxBurst),
+		keys:        keys,
+		ips:         ips,
 		clients:     make(map[string]*rate.Limiter),
+		lastSweep:   time.Now(),
 	}
 }
 
-func (r *RateLimit) clientLimiter(req *http.Request, rpm int) *rate.Limiter {
-	key := getClientIP(req)
+// Gets the limiter for a client on an endpoint, where the client is either an API key ID or an IP for anonymous requests.
+func (r *RateLimit) clientLimiter(client, endpoint string, rpm int) *rate.Limiter {
+	key := client
 	if r.perEndpoint {
-		endpoint := req.URL.Path
 		key += "@" + endpoint
 	}
 
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	now := time.Now()
+	if now.Sub(r.lastSweep) >= RATE_LIMIT_SWEEP_INTERVAL {
+		r.evictIdle(now)
+	}
+
 	limiter, exists := r.clients[key]
 	if !exists {
 		interval := rate.Every(time.Minute / time.Duration(rpm)) // interval per request
@@ -43,3 +58,48 @@ func (r *RateLimit) clientLimiter(req *http.Request, rpm int) *rate.Limiter {
 
 	return limiter
 }
+
+// Drops limiters that have refilled to a full burst. They're no different from a new one, so nobody gains anything by it.
+// Must be called with mu held.
+func (r *RateLimit) evictIdle(now time.Time) {
+	for key, limiter := range r.clients {
+		if limiter.TokensAt(now) >= float64(r.maxBurst) {
+			delete(r.clients, key)
+		}
+	}
+
+	r.lastSweep = now
+}
+
+// Checks whether the request is allowed by the rate limit of its tier for the given endpoint, writing an error
+// response if not. Requests with an API key are limited per key using its tier, otherwise per IP as anonymous.
+//
+// An invalid or revoked key is rejected outright rather than falling back to anonymous, so it doesn't go unnoticed.
+func (r *RateLimit) allow(w http.ResponseWriter, req *http.Request, endpoint string) bool {
+	tier, client := database.ApiTierAnonymous, r.ips.ClientIP(req)
+
+	var apiKey *database.ApiKey
+	if key := requestApiKey(req); key != "" {
+		if r.keys != nil {
+			apiKey = r.keys.Lookup(key)
+		}
+		if apiKey == nil {
+			http.Error(w, "Invalid or revoked API key", http.StatusUnauthorized)
+			return false
+		}
+
+		tier, client = apiKey.Tier, "key:"+apiKey.ID
+	}
+
+	w.Header().Set("X-RateLimit-Tier", string(tier))
+	if !r.clientLimiter(client, endpoint, TierRPM(tier, endpoint)).Allow() {
+		http.Error(w, "Rate Limit Exceeded", http.StatusTooManyRequests)
+		return false
+	}
+
+	if apiKey != nil {
+		r.keys.RecordUsage(apiKey.ID, endpoint)
+	}
+
+	return true
+}
@@ -19,6 +19,9 @@ import (
 	"time"
 )
 
+// How often the API reloads the stores the bot writes to, see StartStoreSync.
+const STORE_SYNC_INTERVAL = 30 * time.Second
+
 func Start() {
 	activeMapDB := database.TryInit(shared.ACTIVE_MAP)
 	auroraDB := database.TryInit(shared.SUPPORTED_MAPS.AURORA)
@@ -29,7 +32,14 @@ func Start() {
 		return
 	}
 
-	mux, err := NewMux(activeMapDB, auroraDB)
+	// Keys are shared across maps so they live in the active map's DB.
+	keys, err := NewApiKeys(activeMapDB)
+	if err != nil {
+		log.Fatalf("failed to start Custom API. failed to load API keys.\n%s", err)
+	}
+	keys.StartSync(API_KEYS_SYNC_INTERVAL)
+
+	mux, err := NewMux(keys, activeMapDB, auroraDB)
 	if err != nil {
 		log.Fatalf("failed to start Custom API. failed to init mux.\n%s", err)
 	}
@@ -48,6 +58,9 @@ func Start() {
 	if err := server.Shutdown(ctx); err != nil {
 		logutil.Logf(logutil.RED, "ERR | could not gracefully shut down Custom API: %v", err)
 	}
+	if err := keys.FlushUsage(); err != nil {
+		logutil.Logf(logutil.RED, "ERR | could not flush API key usage: %v", err)
+	}
 }
 
 // Serves the API using on localhost at port.
@@ -58,7 +71,7 @@ func Serve(mux *http.ServeMux, port uint) *http.Server {
 	// These are 443 if using HTTPS (need cert) or 80 if using HTTP.
 	s := &http.Server{
 		Addr:    fmt.Sprintf(":%d", port),
-		Handler: mux,
+		Handler: InstrumentMux(mux),
 	}
 
 	go func() {
@@ -71,16 +84,37 @@ func Serve(mux *http.ServeMux, port uint) *http.Server {
 	return s
 }
 
-func NewMux(mdbs ...*database.Database) (mux *http.ServeMux, err error) {
-	apiRL := NewRateLimit(true, 2)    // per IP, per endpoint
-	proxyRL := NewRateLimit(false, 3) // per IP
-	proxy := NewProxy(proxyRL, PROXY_RPM, []string{"earthmc.net", "map.earthmc.net", "api.earthmc.net"})
+// Creates the mux serving every endpoint for each map DB. Keys may be nil to only allow anonymous requests.
+func NewMux(keys *ApiKeys, mdbs ...*database.Database) (mux *http.ServeMux, err error) {
+	ips := ClientIPResolverFromEnv()             // shared so every endpoint agrees on who the client is
+	apiRL := NewRateLimit(true, 2, keys, ips)    // per IP or key, per endpoint
+	proxyRL := NewRateLimit(false, 3, keys, ips) // per IP or key
+	proxyCache, err := NewProxyCache(ProxyCacheOptionsFromEnv())
+	if err != nil {
+		return nil, err
+	}
+	proxy := NewProxy(proxyRL, proxyCache, []string{"earthmc.net", "map.earthmc.net", "api.earthmc.net"})
 
 	mux = http.NewServeMux()
 	ServeBase(mux)         // Welcome endpoint at domain base (also shown for unknown endpoints).
 	ServeTerms(mux)        // Legal jargon page including TOS and Privacy Policy. See TERMS.md file.
 	ServeBotInvite(mux)    // A redirect to invite the bot through Discord.
 	ServeProxy(mux, proxy) // Custom CORS proxy with auth. Client must specify X-Proxy-Key and SECRET_KEY must match.
+	ServeMetrics(mux)      // Prometheus metrics. Requires METRICS_TOKEN as a bearer token if set.
+
+	var mapNames []string
+	var healthDBs []*database.Database
+	for _, mdb := range mdbs {
+		if mdb != nil {
+			mapNames = append(mapNames, mdb.Name())
+			healthDBs = append(healthDBs, mdb)
+		}
+	}
+
+	ServeHealth(mux, healthDBs)                         // Data freshness at /healthz and /readyz for uptime monitors.
+	if err := ServeOpenAPI(mux, mapNames); err != nil { // OpenAPI spec at /openapi.json and docs generated from it at /docs.
+		return nil, err
+	}
 
 	for _, mdb := range mdbs {
 		if mdb == nil {
@@ -88,6 +122,10 @@ func NewMux(mdbs ...*database.Database) (mux *http.ServeMux, err error) {
 			continue
 		}
 
+		serverStore, err := database.GetStore(mdb, database.SERVER_STORE)
+		if err != nil {
+			return nil, err
+		}
 		fallingTownStore, err := database.GetStore(mdb, database.FALLING_TOWNS_STORE)
 		if err != nil {
 			return nil, err
@@ -116,22 +154,36 @@ func NewMux(mdbs ...*database.Database) (mux *http.ServeMux, err error) {
 		if err != nil {
 			return nil, err
 		}
+		historyStore, err := database.GetStore(mdb, database.STATS_HISTORY_STORE)
+		if err != nil {
+			return nil, err
+		}
+		streamStore, err := database.GetStore(mdb, database.STREAM_EVENTS_STORE)
+		if err != nil {
+			return nil, err
+		}
 
 		dbName := mdb.Name()
 
 		// Every interval, refresh the stores so they reflect their respective DB files (source of truth)
 		StartStoreSync(
-			30*time.Second, dbName,
+			STORE_SYNC_INTERVAL, dbName, serverStore,
 			fallingTownStore, townStore, nationStore, allianceStore,
 			entitiesStore, playersStore,
-			newsStore,
+			newsStore, historyStore,
 		)
 
+		ServeTowns(mux, apiRL, dbName, townStore, nationStore, fallingTownStore)
+		ServeNations(mux, apiRL, dbName, townStore, nationStore, fallingTownStore)
 		ServeFalling(mux, dbName, fallingTownStore)
 		ServeRuined(mux, dbName, townStore)
+		ServeOverclaim(mux, dbName, townStore, nationStore, fallingTownStore)
 		ServeAlliances(mux, apiRL, dbName, allianceStore, nationStore, entitiesStore)
 		ServePlayers(mux, apiRL, dbName, playersStore)
 		ServeNews(mux, apiRL, dbName, newsStore)
+		ServeBorders(mux, dbName, townStore, nationStore, allianceStore)
+		ServeHistory(mux, apiRL, dbName, historyStore, allianceStore)
+		ServeStream(mux, apiRL, dbName, streamStore) // Polls its own store much more often than StartStoreSync.
 	}
 
 	return mux, nil
@@ -139,6 +191,7 @@ func NewMux(mdbs ...*database.Database) (mux *http.ServeMux, err error) {
 
 func StartStoreSync(
 	interval time.Duration, mdbName string,
+	serverStore *store.Store[oapi.ServerInfo],
 	fallingTownStore *store.Store[database.FallingTown],
 	townStore *store.Store[oapi.TownInfo],
 	nationStore *store.Store[oapi.NationInfo],
@@ -146,11 +199,13 @@ func StartStoreSync(
 	entitiesStore *store.Store[oapi.EntityList],
 	playersStore *store.Store[database.BasicPlayer],
 	newsStore *store.Store[database.NewsEntry],
+	historyStore *store.Store[database.StatsHistory],
 ) {
 	go func() {
 		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
 
+		historyModTime := historyStore.ModTime()
 		for range ticker.C {
 			logutil.Logln(logutil.BLUE, "Syncing stores with data from underlying DB files for map: ", mdbName)
 
@@ -163,6 +218,16 @@ func StartStoreSync(
 			_ = entitiesStore.LoadFromFile()
 			_ = newsStore.LoadFromFile()
 			_ = playersStore.LoadFromFile()
+
+			// Stats history is large and only changes once an hour, so skip it unless the file was actually written.
+			if modTime := historyStore.ModTime(); !modTime.Equal(historyModTime) && historyStore.LoadFromFile() == nil {
+				historyModTime = modTime
+			}
+
+			// Falling and ruined towns are worked out using the new day clock, which only the bot fetches.
+			if serverStore.LoadFromFile() == nil {
+				database.SyncNewDayClock(serverStore)
+			}
 		}
 	}()
 }
@@ -176,19 +241,3 @@ func IsRunning(port uint) bool {
 	conn.Close()
 	return true
 }
-
-func getClientIP(r *http.Request) string {
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		// X-Forwarded-For can contain multiple IPs, we just need the first
-		ips := strings.Split(xff, ",")
-		return strings.TrimSpace(ips[0])
-	}
-
-	// Fallback to RemoteAddr and strip port
-	host, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		return r.RemoteAddr // unlikely, but just in case
-	}
-
-	return host
-}
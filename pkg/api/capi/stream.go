@@ -0,0 +1,260 @@
+package capi
+
+import (
+	"emcsrw/internal/database"
+	"emcsrw/internal/database/store"
+	"emcsrw/pkg/utils/logutil"
+	"emcsrw/pkg/utils/sets"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	STREAM_POLL_INTERVAL      = 2 * time.Second  // How often the stream store is checked for new events published by the bot.
+	STREAM_HEARTBEAT_INTERVAL = 25 * time.Second // Keeps idle connections from being closed by proxies.
+	STREAM_CLIENT_BUFFER      = 256              // Events queued per client before it is considered too slow and dropped.
+	STREAM_MAX_CLIENTS        = 500
+)
+
+type streamClient struct {
+	topics sets.Set[database.StreamTopic]
+	events chan database.StreamEvent
+	closed chan struct{} // Closed by the hub when the client can't keep up.
+}
+
+// Fans out events from the stream store to every connected client of a single map.
+//
+// Each client has its own buffered channel, so one slow client never holds up the others.
+// If a client's buffer fills up it is disconnected and can resume with Last-Event-ID.
+type StreamHub struct {
+	streamStore *store.Store[database.StreamEvent]
+	lastID      string
+
+	clients map[*streamClient]struct{}
+	mu      sync.RWMutex
+}
+
+func NewStreamHub(streamStore *store.Store[database.StreamEvent]) *StreamHub {
+	hub := &StreamHub{
+		streamStore: streamStore,
+		clients:     make(map[*streamClient]struct{}),
+	}
+
+	// Don't replay events from before we started, only new ones.
+	if latest := database.StreamEventsSince(streamStore.Values(), ""); len(latest) > 0 {
+		hub.lastID = latest[len(latest)-1].ID
+	}
+
+	return hub
+}
+
+// Starts polling the stream store for new events, broadcasting any it finds.
+func (h *StreamHub) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := h.streamStore.LoadFromFile(); err != nil {
+				continue // bot may not have published anything yet
+			}
+
+			h.broadcast(h.streamStore.Values())
+		}
+	}()
+}
+
+// Sends every event newer than the last broadcast one to the clients subscribed to its topic.
+func (h *StreamHub) broadcast(all []database.StreamEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	events := database.StreamEventsSince(all, h.lastID)
+	if len(events) == 0 {
+		return
+	}
+
+	h.lastID = events[len(events)-1].ID
+
+	for c := range h.clients {
+		for _, e := range events {
+			if !c.topics.Has(e.Topic) {
+				continue
+			}
+
+			select {
+			case c.events <- e:
+			default:
+				// Buffer full, the client isn't reading fast enough.
+				delete(h.clients, c)
+				close(c.closed)
+			}
+
+			if _, ok := h.clients[c]; !ok {
+				break
+			}
+		}
+	}
+}
+
+// Registers a new client, also returning the ID of the last event broadcast before it was added.
+// Anything after that ID will be received through the client's channel.
+func (h *StreamHub) add(topics sets.Set[database.StreamTopic]) (*streamClient, string, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.clients) >= STREAM_MAX_CLIENTS {
+		return nil, "", false
+	}
+
+	c := &streamClient{
+		topics: topics,
+		events: make(chan database.StreamEvent, STREAM_CLIENT_BUFFER),
+		closed: make(chan struct{}),
+	}
+
+	h.clients[c] = struct{}{}
+	return c, h.lastID, true
+}
+
+func (h *StreamHub) remove(c *streamClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.clients, c)
+}
+
+func (h *StreamHub) ClientCount() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return len(h.clients)
+}
+
+// Parses the comma separated "topics" query param. No topics means all of them.
+func parseStreamTopics(s string) (sets.Set[database.StreamTopic], error) {
+	topics := sets.New[database.StreamTopic]()
+	for _, t := range splitQueryList(s) {
+		topic, ok := database.ParseStreamTopic(t)
+		if !ok {
+			return nil, fmt.Errorf("unknown topic '%s'. expected one of: %v", t, database.STREAM_TOPICS)
+		}
+
+		topics.Add(topic)
+	}
+
+	if len(topics) == 0 {
+		for _, t := range database.STREAM_TOPICS {
+			topics.Add(t)
+		}
+	}
+
+	return topics, nil
+}
+
+func writeStreamEvent(w http.ResponseWriter, e database.StreamEvent) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", e.ID, e.Topic, data)
+	return err
+}
+
+// Serves a Server-Sent Events stream of events detected by the bot at /{map}/stream.
+//
+// Query params (all optional):
+//   - topics: Comma separated topics to receive. See database.STREAM_TOPICS. Defaults to all.
+//
+// Clients that reconnect with a Last-Event-ID header (sent automatically by EventSource)
+// are sent any events they missed, as long as they are still within STREAM_EVENT_RETENTION.
+//
+// Responses are not gzipped since each event needs flushing as soon as it is written.
+func ServeStream(
+	mux *http.ServeMux, rl *RateLimit, mdbName string,
+	streamStore *store.Store[database.StreamEvent],
+) *StreamHub {
+	hub := NewStreamHub(streamStore)
+	hub.Start(STREAM_POLL_INTERVAL)
+
+	streamEndpoint := fmt.Sprintf("/%s/stream", mdbName)
+	mux.HandleFunc(streamEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		topics, err := parseStreamTopics(r.URL.Query().Get("topics"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		if !rl.allow(w, r, ENDPOINT_STREAM) {
+			return
+		}
+
+		client, hubLastID, ok := hub.add(topics)
+		if !ok {
+			http.Error(w, "Too many stream clients, try again later", http.StatusServiceUnavailable)
+			return
+		}
+		defer hub.remove(client)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no") // stop nginx and co. from buffering events
+		w.WriteHeader(http.StatusOK)
+
+		// Replay anything missed since the client last connected. Events after hubLastID
+		// are skipped since the client will get them from the hub anyway.
+		if lastID := strings.TrimSpace(r.Header.Get("Last-Event-ID")); lastID != "" {
+			for _, e := range database.StreamEventsSince(streamStore.Values(), lastID) {
+				if e.ID > hubLastID {
+					break
+				}
+				if !topics.Has(e.Topic) {
+					continue
+				}
+				if err := writeStreamEvent(w, e); err != nil {
+					return
+				}
+			}
+		}
+
+		fmt.Fprint(w, ": connected\n\n")
+		flusher.Flush()
+
+		heartbeat := time.NewTicker(STREAM_HEARTBEAT_INTERVAL)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-client.closed:
+				logutil.Printf(logutil.YELLOW, "\nWARN | dropped slow stream client %s on %s\n", rl.ips.ClientIP(r), mdbName)
+				return
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+					return
+				}
+				flusher.Flush()
+			case e := <-client.events:
+				if err := writeStreamEvent(w, e); err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	})
+
+	return hub
+}
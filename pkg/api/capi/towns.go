@@ -0,0 +1,557 @@
+package capi
+
+import (
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"crypto/sha1"
+	"emcsrw/internal/database"
+	"emcsrw/internal/database/store"
+	"emcsrw/pkg/api/oapi"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+const (
+	DEFAULT_PAGE_LIMIT = 100
+	MAX_PAGE_LIMIT     = 500
+)
+
+// A single page of a filtered and sorted list. Pass NextCursor as the "cursor" query param to get the next page.
+type ListPage struct {
+	Total      int               `json:"total"` // Amount of items matching the filters across all pages.
+	Count      int               `json:"count"`
+	NextCursor *string           `json:"nextCursor"` // Nil when this is the last page.
+	Data       []json.RawMessage `json:"data"`
+}
+
+// A town as served by the towns endpoints, along with its overclaim risk. Overclaim is left out for ruined towns.
+type TownPayload struct {
+	oapi.TownInfo
+	Overclaim *database.OverclaimRisk `json:"overclaim,omitempty"`
+}
+
+// A nation as served by the nations endpoint, along with how many of its towns are at each overclaim risk level.
+// Towns at no risk are not counted.
+type NationPayload struct {
+	oapi.NationInfo
+	Overclaim map[database.OverclaimRiskLevel]int `json:"overclaim"`
+}
+
+// Overclaim risks only change when the stores are reloaded from their files, so they are worked out once per reload
+// (like stats history in StartStoreSync) instead of on every request. The town, nation and falling stores are all written
+// by the same bot update, so the town store's ModTime is enough to tell when that happened.
+type overclaimCache struct {
+	mu      sync.Mutex
+	modTime time.Time
+	risks   map[string]database.OverclaimRisk
+
+	townStore        *store.Store[oapi.TownInfo]
+	nationStore      *store.Store[oapi.NationInfo]
+	fallingTownStore *store.Store[database.FallingTown]
+}
+
+func newOverclaimCache(
+	townStore *store.Store[oapi.TownInfo],
+	nationStore *store.Store[oapi.NationInfo],
+	fallingTownStore *store.Store[database.FallingTown],
+) *overclaimCache {
+	return &overclaimCache{townStore: townStore, nationStore: nationStore, fallingTownStore: fallingTownStore}
+}
+
+// Returns the overclaim risk of every town keyed by UUID, only recomputing it if the town store file changed.
+// A store without a file (zero ModTime) has no way of telling us it changed, so it is always recomputed.
+func (c *overclaimCache) get() map[string]database.OverclaimRisk {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	modTime := c.townStore.ModTime()
+	if c.risks == nil || modTime.IsZero() || !modTime.Equal(c.modTime) {
+		c.risks = database.ComputeOverclaimRisks(c.townStore, c.nationStore, c.fallingTownStore)
+		c.modTime = modTime
+	}
+
+	return c.risks
+}
+
+// Options parsed from query params that are common to every list endpoint.
+type listQuery struct {
+	Sort   string
+	Fields []string
+	Limit  int
+	Offset int
+}
+
+func parseListQuery(q url.Values) (lq listQuery, err error) {
+	lq.Sort = q.Get("sort")
+	lq.Fields = splitQueryList(q.Get("fields"))
+	lq.Limit = DEFAULT_PAGE_LIMIT
+
+	if s := q.Get("limit"); s != "" {
+		lq.Limit, err = strconv.Atoi(s)
+		if err != nil || lq.Limit < 1 || lq.Limit > MAX_PAGE_LIMIT {
+			return lq, fmt.Errorf("limit must be a number between 1 and %d", MAX_PAGE_LIMIT)
+		}
+	}
+	if s := q.Get("cursor"); s != "" {
+		lq.Offset, err = decodeCursor(s)
+		if err != nil {
+			return lq, fmt.Errorf("invalid cursor")
+		}
+	}
+
+	return lq, nil
+}
+
+// Splits a comma separated query param, ignoring empty entries. "a, b,,c" -> [a b c]
+func splitQueryList(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	return lo.FilterMap(strings.Split(s, ","), func(v string, _ int) (string, bool) {
+		v = strings.TrimSpace(v)
+		return v, v != ""
+	})
+}
+
+// Cursors are opaque to clients so we are free to change how they work later.
+// For now they are just the offset of the next page.
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+
+	offset, err := strconv.Atoi(string(b))
+	if err != nil || offset < 0 {
+		return 0, fmt.Errorf("bad cursor offset")
+	}
+
+	return offset, nil
+}
+
+// Marshals v, only keeping the specified top-level JSON fields. All fields are kept if none are specified.
+func projectFields(v any, fields []string) (json.RawMessage, error) {
+	b, err := json.Marshal(v)
+	if err != nil || len(fields) == 0 {
+		return b, err
+	}
+
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(b, &obj); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(lo.PickByKeys(obj, fields))
+}
+
+// Builds the requested page from an already filtered and sorted list.
+func newListPage[T any](items []T, lq listQuery) (*ListPage, error) {
+	page := &ListPage{Total: len(items), Data: []json.RawMessage{}}
+
+	start := min(lq.Offset, len(items))
+	end := min(start+lq.Limit, len(items))
+	for _, item := range items[start:end] {
+		data, err := projectFields(item, lq.Fields)
+		if err != nil {
+			return nil, err
+		}
+
+		page.Data = append(page.Data, data)
+	}
+
+	page.Count = len(page.Data)
+	if end < len(items) {
+		next := encodeCursor(end)
+		page.NextCursor = &next
+	}
+
+	return page, nil
+}
+
+// Whether the request may end up as a 304, in which case the rate limit is left to writeETagJSON.
+// Only JSON responses have an ETag, so every other format can't be revalidated.
+func isRevalidating(r *http.Request, format ExportFormat) bool {
+	return format == FormatJSON && r.Header.Get("If-None-Match") != ""
+}
+
+// Applies the rate limit before the response is built, so clients over the limit don't cost us any work.
+// Revalidating requests are let through since they are only charged if they don't get a 304 (see writeETagJSON).
+func allowBeforeBuild(w http.ResponseWriter, r *http.Request, rl *RateLimit, endpoint string, format ExportFormat) bool {
+	return isRevalidating(r, format) || rl.allow(w, r, endpoint)
+}
+
+// Writes v as gzipped JSON with an ETag, following the same conventions as the news endpoint.
+// The rate limit only applies when actually serving data, not when the client already has it (304).
+// Requests without If-None-Match must have already been charged via allowBeforeBuild.
+func writeETagJSON(w http.ResponseWriter, r *http.Request, rl *RateLimit, endpoint string, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	etag := fmt.Sprintf(`"%x"`, sha1.Sum(b))
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if isRevalidating(r, FormatJSON) && !rl.allow(w, r, endpoint) {
+		return
+	}
+
+	var buf bytes.Buffer
+	gz, err := gzip.NewWriterLevel(&buf, 2)
+	if err != nil {
+		http.Error(w, "Gzip error: failed to create writer", http.StatusInternalServerError)
+		return
+	}
+	if _, err := gz.Write(b); err != nil {
+		http.Error(w, "Gzip error: failed to write", http.StatusInternalServerError)
+		return
+	}
+	gz.Close()
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Encoding", "gzip")
+	w.Header().Add("Vary", "Accept-Encoding") // Add since list endpoints also vary on Accept
+	w.Write(buf.Bytes())
+}
+
+// Writes every item of an already filtered and sorted list in a non-JSON format. Unlike JSON, these aren't paginated
+// since the point is to get everything in one go (like a spreadsheet), but "fields" still applies.
+// The request must have already been charged via allowBeforeBuild.
+func writeListExport[T any](w http.ResponseWriter, r *http.Request, format ExportFormat, items []T, lq listQuery) {
+	projected := make([]json.RawMessage, 0, len(items))
+	for _, item := range items {
+		data, err := projectFields(item, lq.Fields)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		projected = append(projected, data)
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	writeExport(w, r, format, projected)
+}
+
+// Looks up every filter key in filters, erroring on the first unknown one.
+func lookupFilters[T any](keys []string, filters map[string]func(T) bool, param string) ([]func(T) bool, error) {
+	out := make([]func(T) bool, 0, len(keys))
+	for _, k := range keys {
+		filter, ok := filters[k]
+		if !ok {
+			return nil, fmt.Errorf("unknown %s '%s'. expected one of: %s", param, k, strings.Join(sortedKeys(filters), ", "))
+		}
+
+		out = append(out, filter)
+	}
+
+	return out, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := lo.Keys(m)
+	slices.Sort(keys)
+	return keys
+}
+
+func matchesAll[T any](v T, filters []func(T) bool) bool {
+	for _, f := range filters {
+		if !f(v) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func parseMinResidents(q url.Values) (int, error) {
+	s := q.Get("minResidents")
+	if s == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("minResidents must be a positive number")
+	}
+
+	return n, nil
+}
+
+// Serves a paginated list of towns at /{map}/towns, and a single town at /{map}/towns/{uuid}.
+// Each town includes its overclaim risk. The falling town store may be nil, in which case falling mayors are not considered.
+//
+// Query params (all optional):
+//   - nation: Only towns in this nation (name or UUID). Use "none" for nationless towns.
+//   - status: Comma separated statuses the town must have. Same as the "status" option of /town list.
+//   - flags: Comma separated flags the town must have toggled on. Same as the "flags" option of /town list.
+//   - minResidents: Only towns with at least this many residents.
+//   - sort: Same keys as /town list. Defaults to residents -> size.
+//   - fields: Comma separated top-level fields to keep, e.g. "uuid,name,stats".
+//   - limit, cursor: Pagination. See ListPage.
+//   - format: json, csv or ndjson (or use the Accept header). Only JSON is paginated, the others include every matching town.
+func ServeTowns(
+	mux *http.ServeMux, rl *RateLimit, mdbName string,
+	townStore *store.Store[oapi.TownInfo],
+	nationStore *store.Store[oapi.NationInfo],
+	fallingTownStore *store.Store[database.FallingTown],
+) {
+	overclaim := newOverclaimCache(townStore, nationStore, fallingTownStore)
+
+	townsEndpoint := fmt.Sprintf("/%s/towns", mdbName)
+	mux.HandleFunc(townsEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		format, ok := requestFormat(w, r)
+		if !ok {
+			return
+		}
+
+		q := r.URL.Query()
+
+		lq, err := parseListQuery(q)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		sorter := database.SortTownsDefault
+		if lq.Sort != "" {
+			s, ok := database.TOWN_SORTS[lq.Sort]
+			if !ok {
+				http.Error(w, fmt.Sprintf("unknown sort '%s'. expected one of: %s", lq.Sort, strings.Join(sortedKeys(database.TOWN_SORTS), ", ")), http.StatusBadRequest)
+				return
+			}
+
+			sorter = s
+		}
+
+		statusFilters, err := lookupFilters(splitQueryList(q.Get("status")), database.TOWN_STATUS_FILTERS, "status")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		flagFilters, err := lookupFilters(splitQueryList(q.Get("flags")), database.TOWN_FLAG_FILTERS, "flag")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		minResidents, err := parseMinResidents(q)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		filters := slices.Concat(statusFilters, flagFilters)
+		filters = append(filters, func(t oapi.TownInfo) bool {
+			return int(t.NumResidents()) >= minResidents
+		})
+
+		if nationQuery := q.Get("nation"); nationQuery != "" {
+			if strings.EqualFold(nationQuery, "none") {
+				filters = append(filters, func(t oapi.TownInfo) bool { return t.Nation.UUID == nil })
+			} else {
+				nation, _ := nationStore.Find(func(n oapi.NationInfo) bool {
+					return n.UUID == nationQuery || strings.EqualFold(n.Name, nationQuery)
+				})
+				if nation == nil {
+					http.Error(w, fmt.Sprintf("nation '%s' does not exist", nationQuery), http.StatusNotFound)
+					return
+				}
+
+				filters = append(filters, func(t oapi.TownInfo) bool {
+					return t.Nation.UUID != nil && *t.Nation.UUID == nation.UUID
+				})
+			}
+		}
+
+		if !allowBeforeBuild(w, r, rl, ENDPOINT_TOWNS, format) {
+			return
+		}
+
+		towns := lo.Filter(townStore.Values(), func(t oapi.TownInfo, _ int) bool {
+			return matchesAll(t, filters)
+		})
+
+		// Store values come from a map, so order them by UUID first. Sorting the same input always
+		// produces the same output, which keeps the ETag and cursors stable between requests.
+		slices.SortFunc(towns, func(a, b oapi.TownInfo) int { return cmp.Compare(a.UUID, b.UUID) })
+		sorter(towns)
+
+		risks := overclaim.get()
+		payloads := lo.Map(towns, func(t oapi.TownInfo, _ int) TownPayload {
+			p := TownPayload{TownInfo: t}
+			if risk, ok := risks[t.UUID]; ok {
+				p.Overclaim = &risk
+			}
+
+			return p
+		})
+
+		if format != FormatJSON {
+			writeListExport(w, r, format, payloads, lq)
+			return
+		}
+
+		page, err := newListPage(payloads, lq)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Vary", "Accept")
+		writeETagJSON(w, r, rl, ENDPOINT_TOWNS, page)
+	})
+
+	townEndpoint := fmt.Sprintf("/%s/towns/{uuid}", mdbName)
+	mux.HandleFunc(townEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		town, err := townStore.Get(r.PathValue("uuid"))
+		if err != nil {
+			http.Error(w, "town not found", http.StatusNotFound)
+			return
+		}
+
+		if !allowBeforeBuild(w, r, rl, ENDPOINT_TOWNS, FormatJSON) {
+			return
+		}
+
+		payload := TownPayload{TownInfo: *town}
+		if risk, ok := overclaim.get()[town.UUID]; ok {
+			payload.Overclaim = &risk
+		}
+
+		data, err := projectFields(payload, splitQueryList(r.URL.Query().Get("fields")))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writeETagJSON(w, r, rl, ENDPOINT_TOWNS, data)
+	})
+}
+
+// Serves a paginated list of nations at /{map}/nations.
+// Each nation includes how many of its towns are at each overclaim risk level. The falling town store may be nil.
+//
+// Query params (all optional):
+//   - status: Comma separated statuses the nation must have (open, public, neutral).
+//   - minResidents: Only nations with at least this many residents.
+//   - sort: Same keys as /nation list. Defaults to residents -> towns -> size.
+//   - fields, limit, cursor, format: Same as the towns endpoint.
+func ServeNations(
+	mux *http.ServeMux, rl *RateLimit, mdbName string,
+	townStore *store.Store[oapi.TownInfo],
+	nationStore *store.Store[oapi.NationInfo],
+	fallingTownStore *store.Store[database.FallingTown],
+) {
+	overclaim := newOverclaimCache(townStore, nationStore, fallingTownStore)
+
+	nationsEndpoint := fmt.Sprintf("/%s/nations", mdbName)
+	mux.HandleFunc(nationsEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		format, ok := requestFormat(w, r)
+		if !ok {
+			return
+		}
+
+		q := r.URL.Query()
+
+		lq, err := parseListQuery(q)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		sorter := database.SortNationsDefault
+		if lq.Sort != "" {
+			s, ok := database.NATION_SORTS[lq.Sort]
+			if !ok {
+				http.Error(w, fmt.Sprintf("unknown sort '%s'. expected one of: %s", lq.Sort, strings.Join(sortedKeys(database.NATION_SORTS), ", ")), http.StatusBadRequest)
+				return
+			}
+
+			sorter = s
+		}
+
+		filters, err := lookupFilters(splitQueryList(q.Get("status")), database.NATION_STATUS_FILTERS, "status")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		minResidents, err := parseMinResidents(q)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		filters = append(filters, func(n oapi.NationInfo) bool {
+			return n.NumResidents() >= minResidents
+		})
+
+		if !allowBeforeBuild(w, r, rl, ENDPOINT_NATIONS, format) {
+			return
+		}
+
+		nations := lo.Filter(nationStore.Values(), func(n oapi.NationInfo, _ int) bool {
+			return matchesAll(n, filters)
+		})
+
+		// See towns endpoint for why this is done.
+		slices.SortFunc(nations, func(a, b oapi.NationInfo) int { return cmp.Compare(a.UUID, b.UUID) })
+		sorter(nations)
+
+		risks := overclaim.get()
+		riskCounts := make(map[string]map[database.OverclaimRiskLevel]int)
+		for _, t := range townStore.Values() {
+			risk, ok := risks[t.UUID]
+			if !ok || risk.Level == database.OverclaimRiskNone || t.Nation.UUID == nil {
+				continue
+			}
+
+			counts, ok := riskCounts[*t.Nation.UUID]
+			if !ok {
+				counts = make(map[database.OverclaimRiskLevel]int)
+				riskCounts[*t.Nation.UUID] = counts
+			}
+
+			counts[risk.Level]++
+		}
+
+		payloads := lo.Map(nations, func(n oapi.NationInfo, _ int) NationPayload {
+			return NationPayload{NationInfo: n, Overclaim: lo.CoalesceMapOrEmpty(riskCounts[n.UUID])}
+		})
+
+		if format != FormatJSON {
+			writeListExport(w, r, format, payloads, lq)
+			return
+		}
+
+		page, err := newListPage(payloads, lq)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Vary", "Accept")
+		writeETagJSON(w, r, rl, ENDPOINT_NATIONS, page)
+	})
+}
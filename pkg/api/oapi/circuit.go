@@ -0,0 +1,139 @@
+package oapi
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Consecutive failed requests before the circuit opens.
+const CIRCUIT_FAILURE_THRESHOLD = 5
+
+// How long an open circuit rejects requests before letting them through again to see if the API has recovered.
+const CIRCUIT_COOLDOWN = 30 * time.Second
+
+var ErrCircuitOpen = errors.New("official api circuit is open after repeated failures, not sending request")
+
+type CircuitState string
+
+const (
+	CircuitClosed   CircuitState = "closed"    // Requests are sent as normal.
+	CircuitOpen     CircuitState = "open"      // Requests fail immediately until the cooldown is over.
+	CircuitHalfOpen CircuitState = "half-open" // Cooldown is over, a single probe request decides whether we close or open again.
+)
+
+// Tracks whether the Official API is down, as reported by the health checks.
+// Once it fails CIRCUIT_FAILURE_THRESHOLD times in a row, bulk queries (see ExecuteConcurrent) fail fast with [ErrCircuitOpen]
+// for CIRCUIT_COOLDOWN so we don't keep burning tokens on it. Single queries are always sent and only feed the circuit.
+var Circuit = NewCircuitBreaker(CIRCUIT_FAILURE_THRESHOLD, CIRCUIT_COOLDOWN)
+
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+
+	failures    int // consecutive
+	openedAt    time.Time
+	probeAt     time.Time // When the half-open probe was let through. Zero if none is in flight.
+	lastSuccess time.Time
+	lastFailure time.Time
+	lastErr     string
+}
+
+// A snapshot of the circuit, safe to serialize.
+type CircuitStatus struct {
+	State               CircuitState `json:"state"`
+	ConsecutiveFailures int          `json:"consecutiveFailures"`
+	OpenedAt            int64        `json:"openedAt,omitempty"`    // Unix timestamp (ms)
+	LastSuccess         int64        `json:"lastSuccess,omitempty"` // Unix timestamp (ms)
+	LastFailure         int64        `json:"lastFailure,omitempty"` // Unix timestamp (ms)
+	LastError           string       `json:"lastError,omitempty"`
+}
+
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+func (cb *CircuitBreaker) state(now time.Time) CircuitState {
+	if cb.failures < cb.threshold {
+		return CircuitClosed
+	}
+	if now.Sub(cb.openedAt) < cb.cooldown {
+		return CircuitOpen
+	}
+
+	return CircuitHalfOpen
+}
+
+// Returns ErrCircuitOpen if requests shouldn't be sent right now.
+//
+// Once half-open, only the first caller is let through as a probe and everyone else is still rejected until it's recorded.
+// A probe that never gets recorded is given up on after another cooldown so the circuit can't get stuck.
+func (cb *CircuitBreaker) Allow() error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	now := time.Now()
+	switch cb.state(now) {
+	case CircuitOpen:
+		return ErrCircuitOpen
+	case CircuitHalfOpen:
+		if !cb.probeAt.IsZero() && now.Sub(cb.probeAt) < cb.cooldown {
+			return ErrCircuitOpen
+		}
+
+		cb.probeAt = now
+	}
+
+	return nil
+}
+
+// Records the result of a request. Any success closes the circuit.
+func (cb *CircuitBreaker) Record(err error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	now := time.Now()
+	cb.probeAt = time.Time{}
+
+	if err == nil {
+		cb.failures = 0
+		cb.lastSuccess = now
+		return
+	}
+
+	cb.failures++
+	cb.lastFailure = now
+	cb.lastErr = err.Error()
+
+	// Reached the threshold, or a request failed while half-open. Either way, (re)start the cooldown.
+	if cb.failures >= cb.threshold {
+		cb.openedAt = now
+	}
+}
+
+func (cb *CircuitBreaker) Status() CircuitStatus {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	unixMilli := func(t time.Time) int64 {
+		if t.IsZero() {
+			return 0
+		}
+
+		return t.UnixMilli()
+	}
+
+	status := CircuitStatus{
+		State:               cb.state(time.Now()),
+		ConsecutiveFailures: cb.failures,
+		LastSuccess:         unixMilli(cb.lastSuccess),
+		LastFailure:         unixMilli(cb.lastFailure),
+		LastError:           cb.lastErr,
+	}
+	if status.State != CircuitClosed {
+		status.OpenedAt = unixMilli(cb.openedAt)
+	}
+
+	return status
+}
@@ -0,0 +1,83 @@
+package oapi
+
+import (
+	"emcsrw/pkg/utils/metrics"
+	"strings"
+	"time"
+)
+
+var (
+	requestsTotal = metrics.NewCounterVec(
+		"emcs_oapi_requests_total", "Requests to the Official API by endpoint and result (ok, error, circuit_open).",
+		"endpoint", "result",
+	)
+	requestDuration = metrics.NewHistogramVec(
+		"emcs_oapi_request_duration_seconds", "How long Official API requests took, not including time spent waiting for a token.",
+		nil, "endpoint",
+	)
+
+	// Requests that have been queued but haven't got a token yet.
+	pendingRequests = metrics.NewGaugeVec(
+		"emcs_oapi_dispatcher_pending", "Requests waiting on the dispatcher for a token.",
+	).With()
+)
+
+func init() {
+	metrics.NewGaugeFunc(
+		"emcs_oapi_dispatcher_tokens", "Tokens currently available in the dispatcher bucket.",
+		nil, func(set func(v float64, labelValues ...string)) {
+			if Dispatcher != nil {
+				set(float64(len(Dispatcher.GetBucketTokens())))
+			}
+		},
+	)
+
+	metrics.NewGaugeFunc(
+		"emcs_oapi_circuit_open", "Whether the Official API circuit is open (1) or half-open (0.5) instead of closed (0).",
+		nil, func(set func(v float64, labelValues ...string)) {
+			switch Circuit.Status().State {
+			case CircuitOpen:
+				set(1)
+			case CircuitHalfOpen:
+				set(0.5)
+			default:
+				set(0)
+			}
+		},
+	)
+}
+
+// Checks the circuit before sending a request to endpoint, counting it if rejected.
+func allowRequest(endpoint Endpoint) error {
+	err := Circuit.Allow()
+	if err != nil {
+		requestsTotal.With(endpointLabel(endpoint), "circuit_open").Inc()
+	}
+
+	return err
+}
+
+// Records the outcome of a single request to endpoint which started at start.
+func observeRequest(endpoint Endpoint, start time.Time, err error) {
+	Circuit.Record(err)
+
+	label := endpointLabel(endpoint)
+	requestDuration.With(label).ObserveSince(start)
+
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+
+	requestsTotal.With(label, result).Inc()
+}
+
+// Strips the base so labels stay short, e.g. "/towns". The base itself (server info) becomes "/".
+func endpointLabel(endpoint Endpoint) string {
+	label := strings.TrimPrefix(endpoint, ENDPOINT_BASE)
+	if label == "" {
+		return "/"
+	}
+
+	return label
+}
@@ -3,6 +3,7 @@ package oapi
 import (
 	"emcsrw/pkg/utils/netutil"
 	"sync"
+	"time"
 
 	"github.com/samber/lo"
 )
@@ -46,7 +47,10 @@ func NewGetQuery[T any](endpoint Endpoint) *GetQuery[T] {
 func (q *GetQuery[T]) Execute() (T, error) {
 	resCh := make(chan RequestResult[T], 1)
 	Dispatcher.Enqueue(func() error {
+		start := time.Now()
 		res, err := netutil.JsonGet[T](q.endpoint)
+		observeRequest(q.endpoint, start, err)
+
 		resCh <- RequestResult[T]{res, err}
 		return err
 	})
@@ -88,7 +92,10 @@ func (q *PostQuery[T]) WithTemplate(template map[string]bool) *PostQuery[T] {
 func (q *PostQuery[T]) Execute() ([]T, error) {
 	resCh := make(chan RequestResult[[]T], 1)
 	Dispatcher.Enqueue(func() error {
+		start := time.Now()
 		results, err := netutil.JsonPost[[]T](q.endpoint, q.body)
+		observeRequest(q.endpoint, start, err)
+
 		resCh <- RequestResult[[]T]{results, err}
 		return err
 	})
@@ -97,6 +104,8 @@ func (q *PostQuery[T]) Execute() ([]T, error) {
 	return res.Result, res.Err
 }
 
+// Splits the query into chunks of QUERY_LIMIT, sending them all at once.
+// Used for bulk updates, so chunks fail fast with ErrCircuitOpen rather than spending tokens while the API is down.
 func (q *PostQuery[T]) ExecuteConcurrent() ([]T, []error, int) {
 	chunks := lo.Chunk(q.body.Query, QUERY_LIMIT)
 	chunkLen := len(chunks)
@@ -113,8 +122,15 @@ func (q *PostQuery[T]) ExecuteConcurrent() ([]T, []error, int) {
 		Dispatcher.EnqueueAsync(func() error {
 			defer wg.Done()
 
+			if err := allowRequest(q.endpoint); err != nil {
+				errCh <- err
+				return err
+			}
+
 			body := NewPostBody(chunkCopy, q.body.Template)
+			start := time.Now()
 			results, err := netutil.JsonPost[[]T](q.endpoint, body)
+			observeRequest(q.endpoint, start, err)
 			if err != nil {
 				errCh <- err
 				return err
@@ -95,7 +95,10 @@ func (d *RequestDispatcher) GetBucketTokens() chan Token {
 //
 // To make an async request, prefer EnqueueAsync or EnqueueAsyncErr for error logging.
 func (d *RequestDispatcher) Enqueue(req Request) error {
+	pendingRequests.Inc()
 	d.reqBucket.WaitForToken()
+	pendingRequests.Dec()
+
 	return req()
 }
 
@@ -87,6 +87,17 @@ func IntegerOption(name, description string, minVal, maxVal int, required bool)
 	}
 }
 
+// An option for picking a channel, limited to the given channel types (any if none are given).
+func ChannelOption(name, description string, required bool, channelTypes ...discordgo.ChannelType) *discordgo.ApplicationCommandOption {
+	return &discordgo.ApplicationCommandOption{
+		Type:         discordgo.ApplicationCommandOptionChannel,
+		Name:         name,
+		Description:  description,
+		ChannelTypes: channelTypes,
+		Required:     required,
+	}
+}
+
 func RequiredNumberOption(name, description string, minVal, maxVal float64) *discordgo.ApplicationCommandOption {
 	return &discordgo.ApplicationCommandOption{
 		Type:        discordgo.ApplicationCommandOptionNumber,
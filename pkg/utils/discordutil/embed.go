@@ -1,11 +1,16 @@
 package discordutil
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/bwmarrin/discordgo"
 )
 
 const EMBED_FIELD_VALUE_LIMIT = 1024
 const EMBED_DESCRIPTION_LIMIT = 4096
+const EMBED_TOTAL_LIMIT = 6000  // Combined length of every embed in a single message.
+const MESSAGE_EMBEDS_LIMIT = 10 // Max amount of embeds in a single message.
 
 var (
 	DEFAULT     = 0x000000
@@ -181,3 +186,113 @@ func (b *EmbedBuilder) Build() *discordgo.MessageEmbed {
 	e := discordgo.MessageEmbed(*b) // cast back to original embed
 	return &e
 }
+
+// The length Discord counts towards EMBED_TOTAL_LIMIT for this embed.
+func EmbedLength(e *discordgo.MessageEmbed) int {
+	length := len(e.Title) + len(e.Description)
+	for _, f := range e.Fields {
+		length += len(f.Name) + len(f.Value)
+	}
+	if e.Footer != nil {
+		length += len(e.Footer.Text)
+	}
+	if e.Author != nil {
+		length += len(e.Author.Name)
+	}
+
+	return length
+}
+
+// Splits lines into pages that each fit within limit once joined with sep.
+// A single line longer than limit gets a page to itself and is cut off with "...".
+func PaginateLines(lines []string, sep string, limit int) [][]string {
+	pages := [][]string{}
+
+	var page []string
+	pageLen := 0
+	for _, line := range lines {
+		if len(line) > limit {
+			line = strings.ToValidUTF8(line[:limit-3], "") + "..."
+		}
+
+		if len(page) > 0 && pageLen+len(sep)+len(line) > limit {
+			pages = append(pages, page)
+			page, pageLen = nil, 0
+		}
+
+		if len(page) > 0 {
+			pageLen += len(sep)
+		}
+
+		page = append(page, line)
+		pageLen += len(line)
+	}
+
+	if len(page) > 0 {
+		pages = append(pages, page)
+	}
+
+	return pages
+}
+
+// Groups embeds into as few messages as possible without going over
+// MESSAGE_EMBEDS_LIMIT or EMBED_TOTAL_LIMIT in any of them, keeping their order.
+func BatchEmbeds(embeds []*discordgo.MessageEmbed) [][]*discordgo.MessageEmbed {
+	batches := [][]*discordgo.MessageEmbed{}
+
+	var batch []*discordgo.MessageEmbed
+	batchLen := 0
+	for _, e := range embeds {
+		length := EmbedLength(e)
+		if len(batch) > 0 && (len(batch) >= MESSAGE_EMBEDS_LIMIT || batchLen+length > EMBED_TOTAL_LIMIT) {
+			batches = append(batches, batch)
+			batch, batchLen = nil, 0
+		}
+
+		batch = append(batch, e)
+		batchLen += length
+	}
+
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+
+	return batches
+}
+
+// Builds an embed per page of lines, numbering the titles when there is more than one.
+func PaginatedEmbeds(title string, colour int, lines []string, sep string) []*discordgo.MessageEmbed {
+	pages := PaginateLines(lines, sep, EMBED_DESCRIPTION_LIMIT)
+
+	embeds := make([]*discordgo.MessageEmbed, len(pages))
+	for i, page := range pages {
+		pageTitle := title
+		if len(pages) > 1 {
+			pageTitle = fmt.Sprintf("%s (%d/%d)", title, i+1, len(pages))
+		}
+
+		embeds[i] = &discordgo.MessageEmbed{
+			Title:       pageTitle,
+			Description: strings.Join(page, sep),
+			Color:       colour,
+		}
+	}
+
+	return embeds
+}
+
+// Joins up to max lines with sep, summarising the rest. Also stops early to stay within the char limit of an embed field.
+func JoinLimited(lines []string, max int, sep string) string {
+	var sb strings.Builder
+	for i, line := range lines {
+		more := fmt.Sprintf("...and %d more", len(lines)-i)
+		if i >= max || sb.Len()+len(line)+len(sep)+len(more) > EMBED_FIELD_VALUE_LIMIT {
+			sb.WriteString(more)
+			break
+		}
+
+		sb.WriteString(line + sep)
+	}
+
+	return strings.TrimSuffix(sb.String(), sep)
+}
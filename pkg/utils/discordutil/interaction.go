@@ -37,6 +37,14 @@ func DeferReply(s *discordgo.Session, i *discordgo.Interaction) error {
 	})
 }
 
+// Same as DeferReply, but the eventual response will only be visible to the interaction author.
+func DeferEphemeralReply(s *discordgo.Session, i *discordgo.Interaction) error {
+	return s.InteractionRespond(i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral},
+	})
+}
+
 // Sends an initial response to an interaction with the specified data if applicable.
 //
 // This must only be used if the interaction has NOT already been acknowledged.
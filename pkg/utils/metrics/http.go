@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"emcsrw/pkg/utils/config"
+	"net/http"
+	"strings"
+)
+
+const CONTENT_TYPE = "text/plain; version=0.0.4; charset=utf-8"
+
+// Serves every metric in the default registry in the Prometheus text format.
+//
+// If METRICS_TOKEN is set, scrapers must send it as a bearer token. Otherwise anyone who
+// can reach the endpoint can read it, which is fine when it's only bound to a private network.
+func Handler() http.Handler {
+	return Default.Handler(metricsToken())
+}
+
+// Same as [Handler] but for this registry, requiring token as a bearer token unless it is empty.
+func (reg *Registry) Handler(token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if token != "" {
+			given, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		// Buffer it so a slow scraper doesn't hold the collectors up.
+		var buf bytes.Buffer
+		reg.Write(&buf)
+
+		w.Header().Set("Content-Type", CONTENT_TYPE)
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(buf.Bytes())
+	})
+}
+
+func metricsToken() string {
+	token, _ := config.GetEnviroVar("METRICS_TOKEN")
+	return token
+}
@@ -0,0 +1,428 @@
+// A tiny Prometheus client that only knows how to count, gauge and bucket things and write them out
+// in the text exposition format. We don't need anything fancier than that, so no point pulling in the official client.
+//
+// See: https://prometheus.io/docs/instrumenting/exposition_formats/#text-based-format
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Buckets (in seconds) suited to most of our latencies, from cheap store lookups to slow OAPI batches.
+var DEFAULT_BUCKETS = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// Anything that can write its own samples in the text format.
+type collector interface {
+	write(w io.Writer)
+}
+
+// Holds every metric that should be exposed. Most code should just use the package level constructors
+// which register into the [Default] registry, a new registry is mainly useful for tests.
+type Registry struct {
+	mu         sync.RWMutex
+	collectors []collector
+}
+
+var Default = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (reg *Registry) register(c collector) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	reg.collectors = append(reg.collectors, c)
+}
+
+// Writes every registered metric to w in the Prometheus text format, in the order they were registered.
+func (reg *Registry) Write(w io.Writer) {
+	reg.mu.RLock()
+	collectors := slices.Clone(reg.collectors)
+	reg.mu.RUnlock()
+
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+//#region Vec (shared label handling)
+
+// A family of series under the same name, where each series is identified by its label values.
+type vec[T any] struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.RWMutex
+	series map[string]*T // joined label values -> series
+	values map[string][]string
+	newFn  func() *T
+}
+
+func newVec[T any](name, help string, labels []string, newFn func() *T) *vec[T] {
+	return &vec[T]{
+		name:   name,
+		help:   help,
+		labels: labels,
+		series: make(map[string]*T),
+		values: make(map[string][]string),
+		newFn:  newFn,
+	}
+}
+
+func (v *vec[T]) with(labelValues []string) *T {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", v.name, len(v.labels), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+
+	v.mu.RLock()
+	s, ok := v.series[key]
+	v.mu.RUnlock()
+	if ok {
+		return s
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if s, ok := v.series[key]; ok {
+		return s
+	}
+
+	s = v.newFn()
+	v.series[key] = s
+	v.values[key] = slices.Clone(labelValues)
+
+	return s
+}
+
+// Calls f for every series, sorted by label values so the output is stable between scrapes.
+func (v *vec[T]) each(f func(labelValues []string, s *T)) {
+	v.mu.RLock()
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	v.mu.RUnlock()
+
+	slices.Sort(keys)
+	for _, k := range keys {
+		v.mu.RLock()
+		s, values := v.series[k], v.values[k]
+		v.mu.RUnlock()
+
+		f(values, s)
+	}
+}
+
+func (v *vec[T]) writeHeader(w io.Writer, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", v.name, escapeHelp(v.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.name, kind)
+}
+
+//#endregion
+
+//#region Counter
+
+// A value that only ever goes up, like the amount of requests sent.
+type Counter struct {
+	mu sync.Mutex
+	v  float64
+}
+
+func (c *Counter) Inc() { c.Add(1) }
+
+// Adds n to the counter. Negative values are ignored since counters can't go down.
+func (c *Counter) Add(n float64) {
+	if n < 0 {
+		return
+	}
+
+	c.mu.Lock()
+	c.v += n
+	c.mu.Unlock()
+}
+
+func (c *Counter) Value() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.v
+}
+
+type CounterVec struct {
+	*vec[Counter]
+}
+
+// Creates a counter family and registers it in the default registry.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return Default.NewCounterVec(name, help, labels...)
+}
+
+func (reg *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{newVec(name, help, labels, func() *Counter { return &Counter{} })}
+	reg.register(c)
+
+	return c
+}
+
+// Gets (or creates) the series with the given label values, in the same order as the labels were declared.
+func (c *CounterVec) With(labelValues ...string) *Counter {
+	return c.with(labelValues)
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.writeHeader(w, "counter")
+	c.each(func(values []string, s *Counter) {
+		writeSample(w, c.name, c.labels, values, s.Value())
+	})
+}
+
+//#endregion
+
+//#region Gauge
+
+// A value that can go up and down, like the amount of pending requests.
+type Gauge struct {
+	mu sync.Mutex
+	v  float64
+}
+
+func (g *Gauge) Set(v float64) {
+	g.mu.Lock()
+	g.v = v
+	g.mu.Unlock()
+}
+
+func (g *Gauge) Add(n float64) {
+	g.mu.Lock()
+	g.v += n
+	g.mu.Unlock()
+}
+
+func (g *Gauge) Inc() { g.Add(1) }
+func (g *Gauge) Dec() { g.Add(-1) }
+
+// Sets the gauge to t as a unix timestamp (in seconds), which is how Prometheus likes its times.
+func (g *Gauge) SetTime(t time.Time) {
+	g.Set(float64(t.UnixMilli()) / 1000)
+}
+
+func (g *Gauge) Value() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.v
+}
+
+type GaugeVec struct {
+	*vec[Gauge]
+}
+
+// Creates a gauge family and registers it in the default registry.
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return Default.NewGaugeVec(name, help, labels...)
+}
+
+func (reg *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{newVec(name, help, labels, func() *Gauge { return &Gauge{} })}
+	reg.register(g)
+
+	return g
+}
+
+func (g *GaugeVec) With(labelValues ...string) *Gauge {
+	return g.with(labelValues)
+}
+
+func (g *GaugeVec) write(w io.Writer) {
+	g.writeHeader(w, "gauge")
+	g.each(func(values []string, s *Gauge) {
+		writeSample(w, g.name, g.labels, values, s.Value())
+	})
+}
+
+// A gauge whose values are computed at scrape time by calling collect, which should call
+// set once for every series. Handy for values that already live somewhere else, like store sizes.
+type GaugeFunc struct {
+	name    string
+	help    string
+	labels  []string
+	collect func(set func(v float64, labelValues ...string))
+}
+
+// Creates a gauge func and registers it in the default registry.
+func NewGaugeFunc(name, help string, labels []string, collect func(set func(v float64, labelValues ...string))) *GaugeFunc {
+	return Default.NewGaugeFunc(name, help, labels, collect)
+}
+
+func (reg *Registry) NewGaugeFunc(name, help string, labels []string, collect func(set func(v float64, labelValues ...string))) *GaugeFunc {
+	g := &GaugeFunc{name: name, help: help, labels: labels, collect: collect}
+	reg.register(g)
+
+	return g
+}
+
+func (g *GaugeFunc) write(w io.Writer) {
+	type sample struct {
+		values []string
+		v      float64
+	}
+
+	samples := []sample{}
+	g.collect(func(v float64, labelValues ...string) {
+		if len(labelValues) != len(g.labels) {
+			return // a bug at the call site, but not worth taking down a scrape over
+		}
+
+		samples = append(samples, sample{slices.Clone(labelValues), v})
+	})
+
+	slices.SortFunc(samples, func(a, b sample) int {
+		return slices.Compare(a.values, b.values)
+	})
+
+	fmt.Fprintf(w, "# HELP %s %s\n", g.name, escapeHelp(g.help))
+	fmt.Fprintf(w, "# TYPE %s gauge\n", g.name)
+	for _, s := range samples {
+		writeSample(w, g.name, g.labels, s.values, s.v)
+	}
+}
+
+//#endregion
+
+//#region Histogram
+
+// Counts observations (usually durations in seconds) into cumulative buckets.
+type Histogram struct {
+	mu      sync.Mutex
+	bounds  []float64
+	buckets []uint64 // not cumulative, summed up when written
+	sum     float64
+	count   uint64
+}
+
+func (h *Histogram) Observe(v float64) {
+	i, _ := slices.BinarySearch(h.bounds, v) // first bound >= v, or len(bounds) for +Inf
+
+	h.mu.Lock()
+	h.buckets[i]++
+	h.sum += v
+	h.count++
+	h.mu.Unlock()
+}
+
+// Observes the time elapsed since start in seconds.
+func (h *Histogram) ObserveSince(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+// The amount of observations so far.
+func (h *Histogram) Count() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.count
+}
+
+type HistogramVec struct {
+	*vec[Histogram]
+	bounds []float64
+}
+
+// Creates a histogram family and registers it in the default registry.
+// Uses [DEFAULT_BUCKETS] if buckets is nil.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return Default.NewHistogramVec(name, help, buckets, labels...)
+}
+
+func (reg *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DEFAULT_BUCKETS
+	}
+
+	bounds := slices.Clone(buckets)
+	slices.Sort(bounds)
+
+	h := &HistogramVec{bounds: bounds}
+	h.vec = newVec(name, help, labels, func() *Histogram {
+		return &Histogram{bounds: bounds, buckets: make([]uint64, len(bounds)+1)}
+	})
+
+	reg.register(h)
+	return h
+}
+
+func (h *HistogramVec) With(labelValues ...string) *Histogram {
+	return h.with(labelValues)
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.writeHeader(w, "histogram")
+	h.each(func(values []string, s *Histogram) {
+		s.mu.Lock()
+		buckets, sum, count := slices.Clone(s.buckets), s.sum, s.count
+		s.mu.Unlock()
+
+		labels := append(slices.Clone(h.labels), "le")
+		cumulative := uint64(0)
+		for i, bound := range h.bounds {
+			cumulative += buckets[i]
+			writeSample(w, h.name+"_bucket", labels, append(slices.Clone(values), formatFloat(bound)), float64(cumulative))
+		}
+
+		writeSample(w, h.name+"_bucket", labels, append(slices.Clone(values), "+Inf"), float64(count))
+		writeSample(w, h.name+"_sum", h.labels, values, sum)
+		writeSample(w, h.name+"_count", h.labels, values, float64(count))
+	})
+}
+
+//#endregion
+
+//#region Formatting
+
+func writeSample(w io.Writer, name string, labels, values []string, v float64) {
+	if len(labels) == 0 {
+		fmt.Fprintf(w, "%s %s\n", name, formatFloat(v))
+		return
+	}
+
+	pairs := make([]string, len(labels))
+	for i, l := range labels {
+		pairs[i] = fmt.Sprintf(`%s="%s"`, l, escapeLabel(values[i]))
+	}
+
+	fmt.Fprintf(w, "%s{%s} %s\n", name, strings.Join(pairs, ","), formatFloat(v))
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+
+//#endregion
@@ -0,0 +1,86 @@
+package render
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+)
+
+const CHART_WIDTH_PX = 720
+const CHART_HEIGHT_PX = 240
+const CHART_PADDING_PX = 12
+
+var GRID_COLOUR = color.RGBA{R: 63, G: 65, B: 71, A: 255}
+var BAR_COLOUR = color.RGBA{R: 88, G: 101, B: 242, A: 255} // Discord blurple
+var PEAK_BAR_COLOUR = color.RGBA{R: 254, G: 231, B: 92, A: 255}
+
+// Draws values as a bar chart (oldest first), scaled so the highest value reaches the top. The highest bar is highlighted.
+// There's no text since we have no fonts, so axes and labels should be described alongside the image.
+// Returns nil if there are no values.
+func DrawBarChart(values []float64) *image.RGBA {
+	if len(values) == 0 {
+		return nil
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, CHART_WIDTH_PX, CHART_HEIGHT_PX))
+	draw.Draw(img, img.Bounds(), &image.Uniform{BACKGROUND_COLOUR}, image.Point{}, draw.Src)
+
+	plotW := CHART_WIDTH_PX - CHART_PADDING_PX*2
+	plotH := CHART_HEIGHT_PX - CHART_PADDING_PX*2
+	bottom := CHART_HEIGHT_PX - CHART_PADDING_PX
+
+	// Quarter gridlines so the bars can at least be compared against each other.
+	for q := 0; q <= 4; q++ {
+		y := bottom - plotH*q/4
+		fillRect(img, CHART_PADDING_PX, y, CHART_PADDING_PX+plotW, y+1, GRID_COLOUR)
+	}
+
+	peak, peakIdx := 0.0, -1
+	for i, v := range values {
+		if v > peak {
+			peak, peakIdx = v, i
+		}
+	}
+	if peak <= 0 {
+		return img // all zero, just the grid
+	}
+
+	slot := float64(plotW) / float64(len(values))
+	gap := max(1, int(slot/5))
+	for i, v := range values {
+		if v <= 0 {
+			continue
+		}
+
+		x0 := CHART_PADDING_PX + int(float64(i)*slot)
+		x1 := CHART_PADDING_PX + int(float64(i+1)*slot) - gap
+		h := max(1, int(v/peak*float64(plotH)))
+
+		c := BAR_COLOUR
+		if i == peakIdx {
+			c = PEAK_BAR_COLOUR
+		}
+
+		fillRect(img, x0, bottom-h, max(x0+1, x1), bottom, c)
+	}
+
+	return img
+}
+
+// Draws the bar chart and encodes the result as PNG bytes.
+// A nil slice is returned with no error if there was nothing to draw.
+func RenderBarChartPNG(values []float64) ([]byte, error) {
+	img := DrawBarChart(values)
+	if img == nil {
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
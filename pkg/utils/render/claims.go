@@ -0,0 +1,176 @@
+package render
+
+import (
+	"bytes"
+	"emcsrw/pkg/utils"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+)
+
+// Max width or height (in pixels) of a rendered claim image. Large nations/alliances
+// are scaled down until they fit, small towns are scaled up to at most MAX_CHUNK_PX per chunk.
+// Anything spanning more chunks than this is downsampled, with each pixel covering several chunks.
+const MAX_IMAGE_PX = 1024
+const MAX_CHUNK_PX = 16
+const PADDING_CHUNKS = 2
+
+var BACKGROUND_COLOUR = color.RGBA{R: 30, G: 31, B: 34, A: 255}
+var SPAWN_COLOUR = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+
+// A group of chunks that share the same colours, such as a single town.
+// Outlines are drawn on any edge of this layer that does not touch another chunk of the same layer.
+type ClaimLayer struct {
+	Chunks    [][2]int    // Chunk coords (X, Z), NOT block coords.
+	Fill      color.NRGBA // Alpha is respected when blending with the background.
+	Outline   color.NRGBA
+	HomeBlock *[2]int     // Chunk coords of the home block, if it should be marked.
+	Spawn     *[2]float64 // Block coords (X, Z) of the spawn, if it should be marked.
+}
+
+// Parses a HEX colour string (# and 0x prefixes allowed) into a non-premultiplied colour with the given alpha.
+// Invalid input results in black, same as [utils.HexToInt].
+func HexToNRGBA(hex string, alpha uint8) color.NRGBA {
+	v := utils.HexToInt(hex)
+	return color.NRGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: alpha}
+}
+
+// Computes the chunk bounds (inclusive) of all layers combined.
+func chunkBounds(layers []ClaimLayer) (minX, minZ, maxX, maxZ int, ok bool) {
+	minX, minZ = math.MaxInt, math.MaxInt
+	maxX, maxZ = math.MinInt, math.MinInt
+
+	for _, l := range layers {
+		for _, c := range l.Chunks {
+			minX, maxX = min(minX, c[0]), max(maxX, c[0])
+			minZ, maxZ = min(minZ, c[1]), max(maxZ, c[1])
+			ok = true
+		}
+	}
+
+	return
+}
+
+// Draws every layer onto a new image and returns it. Layers are drawn in order, so later ones
+// will appear above earlier ones if they happen to overlap. Returns nil if there are no chunks at all.
+func DrawClaims(layers []ClaimLayer) *image.RGBA {
+	minX, minZ, maxX, maxZ, ok := chunkBounds(layers)
+	if !ok {
+		return nil
+	}
+
+	minX -= PADDING_CHUNKS
+	minZ -= PADDING_CHUNKS
+	maxX += PADDING_CHUNKS
+	maxZ += PADDING_CHUNKS
+
+	widthChunks := maxX - minX + 1
+	heightChunks := maxZ - minZ + 1
+
+	// Pick the biggest scale (px per chunk) that still fits. If even 1px per chunk is too big,
+	// downsample instead so that every pixel covers step x step chunks.
+	maxChunks := max(widthChunks, heightChunks)
+	scale, step := 1, 1
+	if maxChunks > MAX_IMAGE_PX {
+		step = (maxChunks + MAX_IMAGE_PX - 1) / MAX_IMAGE_PX
+	} else {
+		scale = min(MAX_CHUNK_PX, MAX_IMAGE_PX/maxChunks)
+	}
+
+	width := (widthChunks + step - 1) / step * scale
+	height := (heightChunks + step - 1) / step * scale
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{BACKGROUND_COLOUR}, image.Point{}, draw.Src)
+
+	toPx := func(cx, cz int) (int, int) {
+		return (cx - minX) / step * scale, (cz - minZ) / step * scale
+	}
+
+	for _, l := range layers {
+		claimed := make(map[[2]int]struct{}, len(l.Chunks))
+		for _, c := range l.Chunks {
+			claimed[c] = struct{}{}
+		}
+
+		// When downsampled, several chunks land on the same pixel. Only blend it once so the fill keeps its alpha.
+		fill := &image.Uniform{l.Fill}
+		filled := make(map[[2]int]struct{}, len(l.Chunks))
+		for _, c := range l.Chunks {
+			px, pz := toPx(c[0], c[1])
+			if _, ok := filled[[2]int{px, pz}]; ok {
+				continue
+			}
+
+			filled[[2]int{px, pz}] = struct{}{}
+			draw.Draw(img, image.Rect(px, pz, px+scale, pz+scale), fill, image.Point{}, draw.Over)
+		}
+
+		// Only draw edges that border unclaimed chunks (of this layer) so inner chunks stay clean.
+		// Chunks are too small to have outlines at 1-2px so we skip them entirely in that case.
+		if scale < 3 {
+			continue
+		}
+
+		for _, c := range l.Chunks {
+			px, pz := toPx(c[0], c[1])
+			if _, ok := claimed[[2]int{c[0], c[1] - 1}]; !ok {
+				fillRect(img, px, pz, px+scale, pz+1, l.Outline)
+			}
+			if _, ok := claimed[[2]int{c[0], c[1] + 1}]; !ok {
+				fillRect(img, px, pz+scale-1, px+scale, pz+scale, l.Outline)
+			}
+			if _, ok := claimed[[2]int{c[0] - 1, c[1]}]; !ok {
+				fillRect(img, px, pz, px+1, pz+scale, l.Outline)
+			}
+			if _, ok := claimed[[2]int{c[0] + 1, c[1]}]; !ok {
+				fillRect(img, px+scale-1, pz, px+scale, pz+scale, l.Outline)
+			}
+		}
+	}
+
+	// Markers go last so they are never covered by a neighbouring layer.
+	for _, l := range layers {
+		if hb := l.HomeBlock; hb != nil {
+			px, pz := toPx(hb[0], hb[1])
+			inset := scale / 4
+			fillRect(img, px+inset, pz+inset, px+scale-inset, pz+scale-inset, l.Outline)
+		}
+		if sp := l.Spawn; sp != nil {
+			cx := int(math.Floor((sp[0]/16 - float64(minX)) / float64(step) * float64(scale)))
+			cz := int(math.Floor((sp[1]/16 - float64(minZ)) / float64(step) * float64(scale)))
+			drawCross(img, cx, cz, max(2, scale/2), SPAWN_COLOUR)
+		}
+	}
+
+	return img
+}
+
+// Draws the layers and encodes the result as PNG bytes.
+// A nil slice is returned with no error if there was nothing to draw.
+func RenderClaimsPNG(layers []ClaimLayer) ([]byte, error) {
+	img := DrawClaims(layers)
+	if img == nil {
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func fillRect(img *image.RGBA, x0, y0, x1, y1 int, c color.Color) {
+	draw.Draw(img, image.Rect(x0, y0, x1, y1), &image.Uniform{c}, image.Point{}, draw.Src)
+}
+
+func drawCross(img *image.RGBA, x, y, radius int, c color.Color) {
+	for d := -radius; d <= radius; d++ {
+		img.Set(x+d, y, c)
+		img.Set(x, y+d, c)
+	}
+}
@@ -0,0 +1,47 @@
+package tests
+
+import (
+	"emcsrw/internal/database"
+	"emcsrw/pkg/api/oapi"
+	"testing"
+)
+
+func newTestTown(uuid, nationUUID string, blocks ...[]int) oapi.TownInfo {
+	t := oapi.TownInfo{}
+	t.UUID = uuid
+	t.Name = uuid
+	t.Coordinates.TownBlocks = blocks
+	if nationUUID != "" {
+		t.Nation.UUID = &nationUUID
+		t.Nation.Name = &nationUUID
+	}
+
+	return t
+}
+
+func TestBorderGraph(t *testing.T) {
+	towns := []oapi.TownInfo{
+		newTestTown("a", "n1", []int{0, 0}, []int{0, 1}),
+		newTestTown("b", "n2", []int{1, 0}, []int{1, 1}), // shares 2 edges with a
+		newTestTown("c", "n1", []int{5, 5}),              // isolated
+		newTestTown("d", "n2", []int{1, 2}, []int{2, 2}), // touches b only, diagonal to a
+	}
+
+	g := database.ComputeBorderGraph(towns)
+	if edges := g.Towns["a"]["b"]; edges != 2 {
+		t.Errorf("expected towns a and b to share 2 edges, got %d", edges)
+	}
+	if _, ok := g.Towns["a"]["d"]; ok {
+		t.Errorf("expected diagonal towns a and d to not be neighbours")
+	}
+
+	neighbours := g.NationNeighbours("n1")
+	if len(neighbours) != 1 || neighbours[0].UUID != "n2" || neighbours[0].BorderLength() != 32 {
+		t.Errorf("expected n1 to border only n2 with a length of 32, got %+v", neighbours)
+	}
+
+	contiguity := database.ComputeContiguity(towns)
+	if contiguity.Regions != 2 || contiguity.LargestTowns != 3 {
+		t.Errorf("expected 2 regions with the largest having 3 towns, got %+v", contiguity)
+	}
+}
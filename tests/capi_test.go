@@ -0,0 +1,346 @@
+package tests
+
+import (
+	"bufio"
+	"compress/gzip"
+	"emcsrw/internal/database"
+	"emcsrw/pkg/api/capi"
+	"emcsrw/pkg/api/oapi"
+	"emcsrw/pkg/utils/sets"
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func getListPage(t *testing.T, mux *http.ServeMux, url string) capi.ListPage {
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s: expected 200, got %d: %s", url, rec.Code, rec.Body.String())
+	}
+
+	gz, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var page capi.ListPage
+	if err := json.NewDecoder(gz).Decode(&page); err != nil {
+		t.Fatal(err)
+	}
+
+	return page
+}
+
+func TestTownsEndpoint(t *testing.T) {
+	mdb, _ := setupTest(t, testDB)
+	townStore := database.AssignStore(mdb, database.TOWNS_STORE)
+	nationStore := database.AssignStore(mdb, database.NATIONS_STORE)
+
+	for _, town := range []string{"a", "b", "c"} {
+		townStore.Set(town, newTestTown(town, "n1", []int{0, 0}))
+	}
+	townStore.Set("d", newTestTown("d", "", []int{5, 5}))
+
+	mux := http.NewServeMux()
+	capi.ServeTowns(mux, capi.NewRateLimit(true, 100, nil, nil), "test", townStore, nationStore, nil)
+
+	page := getListPage(t, mux, "/test/towns?sort=alphabetical&limit=2&fields=uuid")
+	if page.Total != 4 || page.Count != 2 || page.NextCursor == nil {
+		t.Fatalf("expected first page of 2/4 with a cursor, got %+v", page)
+	}
+	if string(page.Data[0]) != `{"uuid":"a"}` {
+		t.Errorf("expected projected first town to be a, got %s", page.Data[0])
+	}
+
+	page = getListPage(t, mux, "/test/towns?sort=alphabetical&limit=2&cursor="+*page.NextCursor)
+	if page.Count != 2 || page.NextCursor != nil {
+		t.Errorf("expected last page of 2 without a cursor, got %+v", page)
+	}
+
+	page = getListPage(t, mux, "/test/towns?nation=none")
+	if page.Total != 1 {
+		t.Errorf("expected 1 nationless town, got %d", page.Total)
+	}
+
+	var risk struct {
+		Overclaim *database.OverclaimRisk `json:"overclaim"`
+	}
+	if err := json.Unmarshal(page.Data[0], &risk); err != nil {
+		t.Fatal(err)
+	}
+	if risk.Overclaim == nil || risk.Overclaim.TownUUID != "d" {
+		t.Errorf("expected town d to include its overclaim risk, got %s", page.Data[0])
+	}
+}
+
+func TestStreamReplay(t *testing.T) {
+	mdb, _ := setupTest(t, testDB)
+	streamStore := database.AssignStore(mdb, database.STREAM_EVENTS_STORE)
+
+	database.PublishStreamEvents(mdb, database.StreamTopicNews, "published", "first")
+	database.PublishStreamEvents(mdb, database.StreamTopicTownFlow, "created", "second", "third")
+
+	events := database.StreamEventsSince(streamStore.Values(), "")
+	if len(events) != 3 {
+		t.Fatalf("expected 3 published events, got %d", len(events))
+	}
+
+	mux := http.NewServeMux()
+	capi.ServeStream(mux, capi.NewRateLimit(true, 100, nil, nil), "test", streamStore)
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	// Should only replay townflow events after the first one, then confirm the connection.
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/test/stream?topics=townflow", nil)
+	req.Header.Set("Last-Event-ID", events[0].ID)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	ids := []string{}
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == ": connected" {
+			break
+		}
+		if id, ok := strings.CutPrefix(line, "id: "); ok {
+			ids = append(ids, id)
+		}
+	}
+
+	if len(ids) != 2 || ids[0] != events[1].ID || ids[1] != events[2].ID {
+		t.Errorf("expected replay of the 2 townflow events, got %v", ids)
+	}
+}
+
+func TestStreamEventIDsInLargeBatch(t *testing.T) {
+	mdb, _ := setupTest(t, testDB)
+	database.AssignStore(mdb, database.STREAM_EVENTS_STORE)
+
+	// More events than the ID sequence has room for within a single ms.
+	data := make([]int, database.STREAM_SEQ_MAX+10)
+	events, err := database.PublishStreamEvents(mdb, database.StreamTopicNews, "published", data...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i < len(events); i++ {
+		if events[i].ID <= events[i-1].ID {
+			t.Fatalf("expected IDs to keep increasing, got %s after %s", events[i].ID, events[i-1].ID)
+		}
+	}
+
+	// Events published afterwards must still sort after the whole batch.
+	next, _ := database.PublishStreamEvents(mdb, database.StreamTopicNews, "published", 0)
+	if last := events[len(events)-1].ID; next[0].ID <= last {
+		t.Errorf("expected next event to sort after %s, got %s", last, next[0].ID)
+	}
+}
+
+func TestApiKeyTiers(t *testing.T) {
+	mdb, _ := setupTest(t, testDB)
+
+	keys, err := capi.NewApiKeys(mdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyStore, _ := database.OpenStore(mdb, database.API_KEYS_STORE)
+	key, apiKey, err := database.IssueApiKey(keyStore, "test", database.ApiTierPartner, "cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(apiKey.ID) != 8 || strings.Contains(key, apiKey.ID) {
+		t.Fatalf("expected an 8 character ID unrelated to the key, got %s", apiKey.ID)
+	}
+
+	// Issued by "another process", so the API only sees it after reloading.
+	if keys.Lookup(key) != nil {
+		t.Fatal("expected key to be unknown before reloading")
+	}
+
+	keys, _ = capi.NewApiKeys(mdb)
+	if keys.Lookup(key) == nil {
+		t.Fatal("expected key to be known after reloading")
+	}
+
+	mux := http.NewServeMux()
+	townStore := database.AssignStore(mdb, database.TOWNS_STORE)
+	nationStore := database.AssignStore(mdb, database.NATIONS_STORE)
+	capi.ServeTowns(mux, capi.NewRateLimit(true, 1, keys, nil), "test", townStore, nationStore, nil)
+
+	get := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/test/towns", nil)
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := get(database.API_KEY_PREFIX + "nope"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for an unknown key, got %d", rec.Code)
+	}
+
+	rec := get(key)
+	if rec.Code != http.StatusOK || rec.Header().Get("X-RateLimit-Tier") != string(database.ApiTierPartner) {
+		t.Fatalf("expected 200 with partner tier, got %d (%s)", rec.Code, rec.Header().Get("X-RateLimit-Tier"))
+	}
+
+	// Burst of 1 is used up for this key, but anonymous requests have their own limiter.
+	if rec := get(key); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("expected 429 after burst, got %d", rec.Code)
+	}
+
+	// Revalidating isn't charged, so a key over the limit can still find out it already has the latest data.
+	revalidate := httptest.NewRequest(http.MethodGet, "/test/towns", nil)
+	revalidate.Header.Set("Authorization", "Bearer "+key)
+	revalidate.Header.Set("If-None-Match", rec.Header().Get("ETag"))
+	revalidated := httptest.NewRecorder()
+	if mux.ServeHTTP(revalidated, revalidate); revalidated.Code != http.StatusNotModified {
+		t.Errorf("expected 304 when revalidating after burst, got %d", revalidated.Code)
+	}
+
+	if rec := get(""); rec.Code != http.StatusOK || rec.Header().Get("X-RateLimit-Tier") != string(database.ApiTierAnonymous) {
+		t.Errorf("expected anonymous request to be unaffected, got %d", rec.Code)
+	}
+
+	// Single towns share the towns limit, rather than each UUID getting a fresh burst.
+	townStore.Set("some-uuid", oapi.TownInfo{})
+	req := httptest.NewRequest(http.MethodGet, "/test/towns/some-uuid", nil)
+	req.Header.Set("Authorization", "Bearer "+key)
+	rec = httptest.NewRecorder()
+	if mux.ServeHTTP(rec, req); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("expected 429 for a single town after burst, got %d", rec.Code)
+	}
+
+	if err := keys.FlushUsage(); err != nil {
+		t.Fatal(err)
+	}
+	usageStore, _ := database.OpenStore(mdb, database.API_KEY_USAGE_STORE)
+	if usage, err := usageStore.Get(apiKey.ID); err != nil || usage.Total != 1 {
+		t.Errorf("expected 1 recorded request for key, got %+v (%v)", usage, err)
+	}
+
+	if _, err := database.RevokeApiKey(keyStore, apiKey.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, _ = capi.NewApiKeys(mdb)
+	if keys.Lookup(key) != nil {
+		t.Error("expected revoked key to no longer be valid")
+	}
+}
+
+// Finds the patterns passed to Handle and HandleFunc in the source files of each dir.
+// Per map patterns are built with fmt.Sprintf("/%s/...", mdbName), so those are found by their format string instead.
+func registeredRoutes(t *testing.T, dirs ...string) sets.Set[string] {
+	t.Helper()
+
+	routes := sets.New[string]()
+	fset := token.NewFileSet()
+	for _, dir := range dirs {
+		files, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+		for _, name := range files {
+			f, err := parser.ParseFile(fset, name, nil, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ast.Inspect(f, func(n ast.Node) bool {
+				call, ok := n.(*ast.CallExpr)
+				if !ok || len(call.Args) == 0 {
+					return true
+				}
+				fn, ok := call.Fun.(*ast.SelectorExpr)
+				if !ok {
+					return true
+				}
+				lit, ok := call.Args[0].(*ast.BasicLit)
+				if !ok || lit.Kind != token.STRING {
+					return true
+				}
+
+				pattern, _ := strconv.Unquote(lit.Value)
+				switch {
+				case fn.Sel.Name == "Handle" || fn.Sel.Name == "HandleFunc":
+					routes.Add(pattern)
+				case fn.Sel.Name == "Sprintf" && strings.HasPrefix(pattern, "/%s/"):
+					routes.Add(strings.Replace(pattern, "%s", "{map}", 1))
+				}
+
+				return true
+			})
+		}
+	}
+
+	return routes
+}
+
+func TestOpenAPIMatchesMux(t *testing.T) {
+	const mapName = "testopenapi"
+	t.Cleanup(func() { os.RemoveAll("./db/" + mapName) })
+
+	mux, err := capi.NewMux(nil, database.TryInit(mapName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every documented endpoint should be handled by something other than the welcome page.
+	for _, e := range capi.API_ENDPOINTS {
+		path := strings.NewReplacer("{map}", mapName, "{uuid}", "x", "{id}", "x").Replace(e.FullPath())
+		_, pattern := mux.Handler(httptest.NewRequest(http.MethodGet, path, nil))
+		if pattern == "/" {
+			t.Errorf("documented endpoint %s is not registered", e.FullPath())
+		}
+	}
+
+	// And every registered route should be in the spec. The welcome page is a catch-all so it's left out.
+	doc := capi.BuildOpenAPI([]string{mapName})
+	documented := sets.New[string]()
+	documented.Add(slices.Collect(maps.Keys(doc.Paths))...)
+	registered := registeredRoutes(t, "../pkg/api/capi", "../internal/health")
+	registered.Remove("/")
+	registered.Remove("/favicon.ico")
+
+	for path := range registered {
+		if !documented.Has(path) {
+			t.Errorf("route %s is registered but missing from the spec", path)
+		}
+	}
+	for path := range documented {
+		if !registered.Has(path) {
+			t.Errorf("spec documents %s but no route is registered for it", path)
+		}
+	}
+
+	// capi.Alliance is referenced before database types, so it should keep the plain name.
+	if _, ok := doc.Components.Schemas["Alliance"]; !ok {
+		t.Error("expected Alliance component schema")
+	}
+	if s := doc.Components.Schemas["FallingTown"]; s == nil || len(s.Properties) == 0 {
+		t.Errorf("expected FallingTown component with properties, got %+v", s)
+	}
+
+	if _, err := json.Marshal(doc); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,49 @@
+package tests
+
+import (
+	"emcsrw/pkg/api/capi"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIPResolver(t *testing.T) {
+	res, err := capi.NewClientIPResolver([]string{"10.0.0.0/8", "127.0.0.1"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		remote  string
+		headers map[string]string
+		want    string
+	}{
+		{"untrusted peer ignores headers", "203.0.113.9:1234", map[string]string{"X-Forwarded-For": "1.1.1.1"}, "203.0.113.9"},
+		{"trusted peer without headers", "127.0.0.1:1234", nil, "127.0.0.1"},
+		{"spoofed leftmost xff entry is skipped", "127.0.0.1:1234", map[string]string{"X-Forwarded-For": "6.6.6.6, 198.51.100.7, 10.1.2.3"}, "198.51.100.7"},
+		{"all hops trusted uses leftmost", "127.0.0.1:1234", map[string]string{"X-Forwarded-For": "10.0.0.2, 10.0.0.1"}, "10.0.0.2"},
+		{"garbage hop stops the walk", "127.0.0.1:1234", map[string]string{"X-Forwarded-For": "6.6.6.6, nonsense, 10.0.0.1"}, "10.0.0.1"},
+		{"forwarded header with ipv6 and port", "127.0.0.1:1234", map[string]string{"Forwarded": `for=6.6.6.6, for="[2001:db8::17]:4711";proto=https`}, "2001:db8::17"},
+		{"cf header ignored unless enabled", "127.0.0.1:1234", map[string]string{"CF-Connecting-IP": "6.6.6.6"}, "127.0.0.1"},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = c.remote
+		for k, v := range c.headers {
+			req.Header.Set(k, v)
+		}
+
+		if got := res.ClientIP(req); got != c.want {
+			t.Errorf("%s: expected %s, got %s", c.name, c.want, got)
+		}
+	}
+
+	cf, _ := capi.NewClientIPResolver([]string{"127.0.0.1"}, true)
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "127.0.0.1:1234"
+	req.Header.Set("CF-Connecting-IP", "198.51.100.7")
+	if got := cf.ClientIP(req); got != "198.51.100.7" {
+		t.Errorf("expected CF-Connecting-IP to be used when enabled, got %s", got)
+	}
+}
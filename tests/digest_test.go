@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"emcsrw/internal/database"
+	"emcsrw/pkg/api/oapi"
+	"testing"
+	"time"
+)
+
+func TestTownFlowLogPruning(t *testing.T) {
+	mdb, _ := setupTest(t, "testtownflowlog")
+	logStore := database.AssignStore(mdb, database.TOWN_FLOW_LOG_STORE)
+
+	old := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	now := old.Add(database.TOWN_FLOW_LOG_RETENTION + 24*time.Hour)
+
+	town := func(name string, at time.Time) database.DigestTown {
+		return database.DigestTown{Entity: oapi.Entity{Name: name, UUID: name}, At: at.UnixMilli()}
+	}
+
+	database.AppendTownFlowLog(logStore, old, []database.DigestTown{town("old", old)}, nil, nil)
+	database.AppendTownFlowLog(logStore, now, []database.DigestTown{town("a", now)}, nil, nil)
+	database.AppendTownFlowLog(logStore, now, nil, []database.DigestTown{town("b", now)}, nil)
+
+	if logStore.HasKey(old.Format(database.TOWN_FLOW_LOG_KEY_FORMAT)) {
+		t.Fatal("expected day older than the retention to be pruned")
+	}
+
+	day, err := logStore.Get(now.Format(database.TOWN_FLOW_LOG_KEY_FORMAT))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(day.Created) != 1 || len(day.Deleted) != 1 {
+		t.Fatalf("expected both appends to land on the same day, got %+v", day)
+	}
+}
+
+func TestComputeDigest(t *testing.T) {
+	mdb, _ := setupTest(t, "testdigest")
+	src := database.DigestSources{
+		TownFlowLog: database.AssignStore(mdb, database.TOWN_FLOW_LOG_STORE),
+		History:     database.AssignStore(mdb, database.STATS_HISTORY_STORE),
+		Nations:     database.AssignStore(mdb, database.NATIONS_STORE),
+		Alliances:   database.AssignStore(mdb, database.ALLIANCES_STORE),
+		News:        database.AssignStore(mdb, database.NEWS_STORE),
+	}
+
+	now := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+	from := now.Add(-24 * time.Hour)
+
+	town := func(name string, at time.Time) database.DigestTown {
+		return database.DigestTown{Entity: oapi.Entity{Name: name, UUID: name}, At: at.UnixMilli()}
+	}
+
+	// One just before the period (same day key as its start) and two within it.
+	database.AppendTownFlowLog(src.TownFlowLog, from.Add(-time.Minute), []database.DigestTown{town("early", from.Add(-time.Minute))}, nil, nil)
+	database.AppendTownFlowLog(src.TownFlowLog, now.Add(-time.Hour), []database.DigestTown{town("b", now.Add(-time.Hour))}, nil, nil)
+	database.AppendTownFlowLog(src.TownFlowLog, from.Add(time.Hour), []database.DigestTown{town("a", from.Add(time.Hour))}, nil, []database.DigestTown{town("c", from.Add(time.Hour))})
+
+	nation := func(uuid string, residents int) oapi.NationInfo {
+		n := oapi.NationInfo{}
+		n.UUID, n.Name = uuid, uuid
+		n.Stats.NumResidents = residents
+		return n
+	}
+
+	sample := func(residents int) database.StatsHistory {
+		return database.StatsHistory{Samples: []database.StatsSample{{Timestamp: from.Add(-time.Hour).UnixMilli(), Residents: residents}}}
+	}
+
+	src.History.Set(database.HistoryKey(database.HistoryKindNation, "up"), sample(10))
+	src.History.Set(database.HistoryKey(database.HistoryKindNation, "down"), sample(20))
+	src.History.Set(database.HistoryKey(database.HistoryKindNation, "same"), sample(5))
+	src.Nations.Set("up", nation("up", 15))
+	src.Nations.Set("down", nation("down", 12))
+	src.Nations.Set("same", nation("same", 5))
+	src.Nations.Set("new", nation("new", 2))
+
+	src.News.Set("1", database.NewsEntry{Headline: "Older", Timestamp: from.Add(time.Hour).UnixMilli()})
+	src.News.Set("2", database.NewsEntry{Headline: "Newer", Timestamp: now.Add(-time.Hour).UnixMilli()})
+	src.News.Set("3", database.NewsEntry{Headline: "Too old", Timestamp: from.Add(-time.Hour).UnixMilli()})
+
+	d := database.ComputeDigest(src, database.DigestDaily, now)
+
+	if len(d.Created) != 2 || d.Created[0].Name != "a" || d.Created[1].Name != "b" {
+		t.Fatalf("expected towns a and b created in the period, got %+v", d.Created)
+	}
+	if len(d.Ruined) != 1 || len(d.Deleted) != 0 {
+		t.Fatalf("expected 1 ruined and 0 deleted, got %d and %d", len(d.Ruined), len(d.Deleted))
+	}
+
+	if d.NetResidents != 5-8+2 {
+		t.Errorf("expected net residents of -1, got %d", d.NetResidents)
+	}
+	if len(d.Gainers) != 2 || d.Gainers[0].UUID != "up" || d.Gainers[1].UUID != "new" {
+		t.Errorf("expected gainers up then new, got %+v", d.Gainers)
+	}
+	if len(d.Losers) != 1 || d.Losers[0].UUID != "down" || d.Losers[0].Change() != -8 {
+		t.Errorf("expected down to lose 8, got %+v", d.Losers)
+	}
+
+	if len(d.News) != 2 || d.News[0].Headline != "Newer" {
+		t.Errorf("expected the 2 headlines in the period, newest first, got %+v", d.News)
+	}
+}
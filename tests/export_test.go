@@ -0,0 +1,150 @@
+package tests
+
+import (
+	"bufio"
+	"emcsrw/internal/database"
+	"emcsrw/pkg/api/capi"
+	"emcsrw/pkg/api/oapi"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFlattenJSON(t *testing.T) {
+	type inner struct {
+		Residents int      `json:"residents"`
+		Tags      []string `json:"tags"`
+	}
+	type item struct {
+		Name   string         `json:"name"`
+		Stats  inner          `json:"stats"`
+		Coords [][2]int       `json:"coords"`
+		Nation *string        `json:"nation"`
+		Extra  map[string]any `json:"extra,omitempty"`
+	}
+
+	fields, err := capi.FlattenJSON(item{
+		Name:   "Cool, Town",
+		Stats:  inner{Residents: 3, Tags: []string{"a", "b"}},
+		Coords: [][2]int{{1, 2}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []capi.FlatField{
+		{Key: "name", Value: "Cool, Town"},
+		{Key: "stats.residents", Value: "3"},
+		{Key: "stats.tags", Value: "a" + capi.CSV_LIST_SEPARATOR + "b"},
+		{Key: "coords", Value: "[[1,2]]"},
+		{Key: "nation", Value: ""},
+	}
+	if !slices.Equal(fields, expected) {
+		t.Fatalf("expected %v, got %v", expected, fields)
+	}
+}
+
+func TestListExportFormats(t *testing.T) {
+	const mapName = "testexport"
+	t.Cleanup(func() { os.RemoveAll("./db/" + mapName) })
+
+	mdb := database.TryInit(mapName)
+	playerStore, _ := database.GetStore(mdb, database.PLAYERS_STORE)
+	playerStore.Set("uuid-1", database.BasicPlayer{Entity: oapi.Entity{Name: "Fix"}, Town: &oapi.Entity{Name: "Spawn", UUID: "town-1"}})
+	playerStore.Set("uuid-2", database.BasicPlayer{Entity: oapi.Entity{Name: "Owen"}})
+
+	mux, err := capi.NewMux(nil, mdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(target string, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.RemoteAddr = "203.0.113.1:1234"
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// CSV via the Accept header
+	rec := get("/"+mapName+"/players", "text/csv")
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/csv") {
+		t.Fatalf("expected csv, got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected header and 2 rows, got %v", records)
+	}
+	if !slices.Contains(records[0], "town") || !slices.Contains(records[0], "name") {
+		t.Errorf("expected name and town columns, got %v", records[0])
+	}
+
+	// NDJSON via the query param, which wins over Accept.
+	rec = get("/"+mapName+"/players?format=ndjson", "text/csv")
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "application/x-ndjson") {
+		t.Fatalf("expected ndjson, got %s", rec.Header().Get("Content-Type"))
+	}
+
+	lines := 0
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		var p capi.BasicPlayer
+		if err := json.Unmarshal(scanner.Bytes(), &p); err != nil {
+			t.Fatalf("invalid ndjson line %q: %v", scanner.Text(), err)
+		}
+		lines++
+	}
+	if lines != 2 {
+		t.Errorf("expected 2 lines, got %d", lines)
+	}
+
+	if rec := get("/"+mapName+"/falling?format=xml", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for unknown format, got %d", rec.Code)
+	}
+}
+
+func TestCSVExportNeutralisesFormulas(t *testing.T) {
+	const mapName = "testexportformula"
+	t.Cleanup(func() { os.RemoveAll("./db/" + mapName) })
+
+	mdb := database.TryInit(mapName)
+	playerStore, _ := database.GetStore(mdb, database.PLAYERS_STORE)
+	playerStore.Set("uuid-1", database.BasicPlayer{Entity: oapi.Entity{Name: "=HYPERLINK(\"http://evil\")"}})
+	playerStore.Set("uuid-2", database.BasicPlayer{Entity: oapi.Entity{Name: "@SUM(A1)"}, Town: &oapi.Entity{Name: "-1+1", UUID: "town-1"}})
+
+	mux, err := capi.NewMux(nil, mdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/"+mapName+"/players?format=csv", nil)
+	req.RemoteAddr = "203.0.113.1:1234"
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"'=HYPERLINK(\"http://evil\")", "'@SUM(A1)", "'-1+1" + capi.CSV_LIST_SEPARATOR + "town-1"}
+	for _, cell := range expected {
+		if !slices.ContainsFunc(records[1:], func(r []string) bool { return slices.Contains(r, cell) }) {
+			t.Errorf("expected cell %q in %v", cell, records)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package tests
+
+import (
+	"emcsrw/internal/database"
+	"sync"
+	"testing"
+)
+
+func TestFeedSubscriptions(t *testing.T) {
+	mdb, _ := setupTest(t, "testguildsettings")
+	s := database.AssignStore(mdb, database.GUILD_SETTINGS_STORE)
+
+	filter := database.FeedFilter{Nations: []string{"n1"}}
+	database.SetFeedSubscription(s, "g2", database.FeedTownFlow, database.FeedSubscription{ChannelID: "c2"})
+	database.SetFeedSubscription(s, "g1", database.FeedTownFlow, database.FeedSubscription{ChannelID: "c1", Filter: filter})
+	database.SetFeedSubscription(s, "g1", database.FeedVoteParty, database.FeedSubscription{ChannelID: "c3"})
+
+	targets := database.FeedTargets(s, database.FeedTownFlow)
+	if len(targets) != 2 || targets[0].GuildID != "g1" || targets[1].ChannelID != "c2" {
+		t.Fatalf("unexpected townflow targets: %+v", targets)
+	}
+
+	nations := targets[0].Filter.NationSet(nil)
+	if !nations.Has("n1") || nations.Has("n2") {
+		t.Fatalf("expected filter to only let n1 through, got %v", nations.Keys())
+	}
+	if targets[1].Filter.NationSet(nil) != nil {
+		t.Fatal("expected an empty filter to let everything through")
+	}
+
+	if !database.RemoveFeedSubscription(s, "g1", database.FeedTownFlow) {
+		t.Fatal("expected g1 townflow subscription to be removed")
+	}
+	if database.RemoveFeedSubscription(s, "g1", database.FeedTownFlow) {
+		t.Fatal("expected removing a missing subscription to return false")
+	}
+
+	if len(database.FeedTargets(s, database.FeedVoteParty)) != 1 {
+		t.Fatal("expected g1 to still receive voteparty")
+	}
+
+	database.RemoveFeedSubscription(s, "g1", database.FeedVoteParty)
+	if s.HasKey("g1") {
+		t.Fatal("expected guild with no feeds left to be deleted")
+	}
+}
+
+// Run with -race. Changing a guild's feeds shouldn't touch the map that readers of the store already have.
+func TestFeedSubscriptionsConcurrent(t *testing.T) {
+	mdb, _ := setupTest(t, "testguildsettingsrace")
+	s := database.AssignStore(mdb, database.GUILD_SETTINGS_STORE)
+	database.SetFeedSubscription(s, "g1", database.FeedTownFlow, database.FeedSubscription{ChannelID: "c1"})
+
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		for range 2000 {
+			database.SetFeedSubscription(s, "g1", database.FeedVoteParty, database.FeedSubscription{ChannelID: "c2"})
+			database.RemoveFeedSubscription(s, "g1", database.FeedVoteParty)
+		}
+	})
+	wg.Go(func() {
+		for range 2000 {
+			database.FeedTargets(s, database.FeedTownFlow)
+		}
+	})
+	wg.Wait()
+
+	if targets := database.FeedTargets(s, database.FeedTownFlow); len(targets) != 1 {
+		t.Fatalf("expected g1 to still receive townflow, got %+v", targets)
+	}
+}
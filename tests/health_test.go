@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"emcsrw/internal/database"
+	"emcsrw/internal/health"
+	"emcsrw/pkg/api/oapi"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestHealthChecker(t *testing.T) {
+	mapName := "testhealth"
+	mdb := database.TryInit(mapName)
+	t.Cleanup(func() { os.RemoveAll("./db/" + mapName) })
+
+	runStore, _ := database.GetStore(mdb, database.TASK_RUNS_STORE)
+	townStore, _ := database.GetStore(mdb, database.TOWNS_STORE)
+
+	checker := &health.Checker{
+		Process:   "test",
+		StartedAt: time.Now(),
+		MaxAge:    10 * time.Minute,
+		Maps:      []*database.Database{mdb},
+		Active:    mapName,
+	}
+
+	// Nothing has run yet, but we only just started.
+	if status := checker.Check().Status; status != health.StatusStarting {
+		t.Fatalf("expected starting, got %s", status)
+	}
+
+	townStore.Set("uuid", oapi.TownInfo{})
+	now := time.Now()
+	for _, task := range health.FRESHNESS_TASKS {
+		database.RecordTaskRun(runStore, task, now, time.Second, nil)
+	}
+
+	assertStatus := func(handler http.HandlerFunc, code int) {
+		t.Helper()
+
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rec.Code != code {
+			t.Fatalf("expected %d, got %d: %s", code, rec.Code, rec.Body.String())
+		}
+	}
+
+	assertStatus(checker.Handler(false), http.StatusOK)
+	assertStatus(checker.Handler(true), http.StatusOK)
+
+	// A failed run doesn't make the data stale by itself, only once the last success is too old.
+	database.RecordTaskRun(runStore, "DataUpdate", now, time.Second, errors.New("oapi down"))
+	if status := checker.Check().Status; status != health.StatusOK {
+		t.Fatalf("expected ok after a single failure, got %s", status)
+	}
+
+	run, _ := runStore.Get("DataUpdate")
+	run.LastSuccess = now.Add(-time.Hour).UnixMilli()
+	runStore.Set("DataUpdate", *run)
+
+	report := checker.Check()
+	if report.Status != health.StatusStale || len(report.Problems) == 0 {
+		t.Fatalf("expected stale with problems, got %s %v", report.Status, report.Problems)
+	}
+
+	assertStatus(checker.Handler(false), http.StatusServiceUnavailable)
+	assertStatus(checker.Handler(true), http.StatusServiceUnavailable)
+}
+
+func TestTaskRunHistory(t *testing.T) {
+	mdb, _ := setupTest(t, "testtaskruns")
+	runStore, _ := database.OpenStore(mdb, database.TASK_RUNS_STORE)
+
+	start := time.Date(2025, time.March, 14, 10, 0, 0, 0, time.UTC)
+	for i := range database.TASK_HISTORY_MAX + 5 {
+		database.RecordTaskRun(runStore, "DataUpdate", start.Add(time.Duration(i)*time.Minute), time.Second, nil)
+	}
+
+	failedAt := start.Add(time.Hour * 24)
+	database.RecordTaskRun(runStore, "DataUpdate", failedAt, time.Second, errors.New("oapi down"))
+
+	run, _ := runStore.Get("DataUpdate")
+	if len(run.History) != database.TASK_HISTORY_MAX || run.ConsecutiveFailures != 1 {
+		t.Fatalf("expected %d runs in history with 1 failure in a row, got %d and %d", database.TASK_HISTORY_MAX, len(run.History), run.ConsecutiveFailures)
+	}
+	if run.LastSuccessSince(failedAt) != nil {
+		t.Error("expected no success since the failed run")
+	}
+	if last := run.LastSuccessSince(start); last == nil || last.Start != run.LastSuccess {
+		t.Errorf("expected the last success to be found, got %+v", last)
+	}
+}
+
+func TestCircuitHalfOpenProbe(t *testing.T) {
+	cb := oapi.NewCircuitBreaker(2, 50*time.Millisecond)
+	cb.Record(errors.New("oapi down"))
+	cb.Record(errors.New("oapi down"))
+
+	if err := cb.Allow(); !errors.Is(err, oapi.ErrCircuitOpen) {
+		t.Fatalf("expected open circuit to reject, got %v", err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if err := cb.Allow(); err != nil {
+		t.Fatalf("expected half-open circuit to let a probe through, got %v", err)
+	}
+	if err := cb.Allow(); !errors.Is(err, oapi.ErrCircuitOpen) {
+		t.Fatalf("expected only a single probe while half-open, got %v", err)
+	}
+
+	cb.Record(nil)
+	if state := cb.Status().State; state != oapi.CircuitClosed {
+		t.Fatalf("expected successful probe to close the circuit, got %s", state)
+	}
+	if err := cb.Allow(); err != nil {
+		t.Errorf("expected closed circuit to allow requests, got %v", err)
+	}
+}
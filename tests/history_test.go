@@ -0,0 +1,39 @@
+package tests
+
+import (
+	"emcsrw/internal/database"
+	"testing"
+	"time"
+)
+
+func TestStatsHistoryCompaction(t *testing.T) {
+	now := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	// Hourly samples over the last 5 days.
+	h := database.StatsHistory{}
+	for i := 5 * 24; i >= 0; i-- {
+		ts := now.Add(-time.Duration(i) * time.Hour)
+		h.Add(database.StatsSample{Timestamp: ts.UnixMilli(), Residents: i}, ts)
+	}
+
+	hourlyCutoff := now.Add(-database.HISTORY_HOURLY_WINDOW).UnixMilli()
+	perDay := map[int]int{}
+	for _, s := range h.Samples {
+		if s.Timestamp < hourlyCutoff {
+			perDay[time.UnixMilli(s.Timestamp).UTC().YearDay()]++
+		}
+	}
+	for day, count := range perDay {
+		if count != 1 {
+			t.Errorf("expected 1 sample for day %d outside the hourly window, got %d", day, count)
+		}
+	}
+
+	points := database.BucketHistory(h.Samples, now.Add(-24*time.Hour), now, 6*time.Hour)
+	if len(points) != 5 {
+		t.Fatalf("expected 5 buckets (4 full + the end), got %d", len(points))
+	}
+	if points[0].Residents != 19 {
+		t.Errorf("expected first bucket to use its latest sample (19), got %d", points[0].Residents)
+	}
+}
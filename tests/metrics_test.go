@@ -0,0 +1,79 @@
+package tests
+
+import (
+	"emcsrw/pkg/utils/metrics"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricsTextFormat(t *testing.T) {
+	reg := metrics.NewRegistry()
+
+	requests := reg.NewCounterVec("test_requests_total", "Requests by endpoint.", "endpoint", "status")
+	requests.With("/towns", "200").Add(2)
+	requests.With("/a\"b", "500").Inc()
+
+	latency := reg.NewHistogramVec("test_latency_seconds", "Latency.", []float64{0.1, 1}, "endpoint")
+	latency.With("/towns").Observe(0.05)
+	latency.With("/towns").Observe(0.5)
+	latency.With("/towns").Observe(5)
+
+	reg.NewGaugeFunc("test_entries", "Entries.", []string{"store"}, func(set func(v float64, labelValues ...string)) {
+		set(3, "towns")
+		set(1, "alliances")
+	})
+
+	var sb strings.Builder
+	reg.Write(&sb)
+	out := sb.String()
+
+	expected := []string{
+		"# TYPE test_requests_total counter",
+		`test_requests_total{endpoint="/a\"b",status="500"} 1`,
+		`test_requests_total{endpoint="/towns",status="200"} 2`,
+		"# TYPE test_latency_seconds histogram",
+		`test_latency_seconds_bucket{endpoint="/towns",le="0.1"} 1`,
+		`test_latency_seconds_bucket{endpoint="/towns",le="1"} 2`,
+		`test_latency_seconds_bucket{endpoint="/towns",le="+Inf"} 3`,
+		`test_latency_seconds_sum{endpoint="/towns"} 5.55`,
+		`test_latency_seconds_count{endpoint="/towns"} 3`,
+		"# TYPE test_entries gauge",
+		`test_entries{store="alliances"} 1`,
+		`test_entries{store="towns"} 3`,
+	}
+
+	for _, line := range expected {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("expected line %q in output:\n%s", line, out)
+		}
+	}
+
+	// Series are sorted, so alliances should always come before towns.
+	if strings.Index(out, `store="alliances"`) > strings.Index(out, `store="towns"`) {
+		t.Errorf("expected gauge func series to be sorted:\n%s", out)
+	}
+}
+
+func TestMetricsHandlerToken(t *testing.T) {
+	handler := metrics.NewRegistry().Handler("secret")
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without token, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 with token, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != metrics.CONTENT_TYPE {
+		t.Fatalf("unexpected content type: %s", ct)
+	}
+}
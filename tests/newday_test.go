@@ -0,0 +1,147 @@
+package tests
+
+import (
+	"emcsrw/internal/database"
+	"emcsrw/pkg/api/oapi"
+	"testing"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+func TestNewDayClock(t *testing.T) {
+	// Server is on UTC+1 (BST) and a few seconds ahead of us. New day at 11:00 its time is 10:00 UTC.
+	fetchedAt := time.Date(2025, time.June, 1, 14, 0, 0, 0, time.UTC)
+
+	var info oapi.ServerInfo
+	info.Timestamps.ServerTimeOfDay = int64((15*time.Hour + 7*time.Second) / time.Second)
+	info.Timestamps.NewDayTime = int64((11 * time.Hour) / time.Second)
+
+	if clock := database.NewDayClock(info, fetchedAt); clock != 10*time.Hour {
+		t.Fatalf("expected new day at 10h0m0s UTC, got %s", clock)
+	}
+
+	// Server just past midnight while we're still on the previous day.
+	fetchedAt = time.Date(2025, time.June, 1, 23, 30, 0, 0, time.UTC)
+	info.Timestamps.ServerTimeOfDay = int64((30 * time.Minute) / time.Second)
+	info.Timestamps.NewDayTime = int64((30 * time.Minute) / time.Second)
+
+	if clock := database.NewDayClock(info, fetchedAt); clock != 23*time.Hour+30*time.Minute {
+		t.Fatalf("expected new day at 23h30m0s UTC, got %s", clock)
+	}
+}
+
+func TestNextNewDayAt(t *testing.T) {
+	clock := 10 * time.Hour
+
+	cases := []struct {
+		from, expected time.Time
+	}{
+		{time.Date(2025, time.March, 14, 9, 59, 0, 0, time.UTC), time.Date(2025, time.March, 14, 10, 0, 0, 0, time.UTC)},
+		{time.Date(2025, time.March, 14, 10, 0, 0, 0, time.UTC), time.Date(2025, time.March, 15, 10, 0, 0, 0, time.UTC)},
+		{time.Date(2025, time.March, 31, 23, 0, 0, 0, time.UTC), time.Date(2025, time.April, 1, 10, 0, 0, 0, time.UTC)},
+	}
+
+	for _, c := range cases {
+		if next := database.NextNewDayAt(clock, c.from); !next.Equal(c.expected) {
+			t.Errorf("from %s: expected %s, got %s", c.from, c.expected, next)
+		}
+	}
+}
+
+func TestComputeNewDayReport(t *testing.T) {
+	newDay := time.Date(2025, time.March, 14, 10, 0, 0, 0, time.UTC)
+
+	town := func(name string, chunks uint32, ruined bool) database.NewDayTown {
+		return database.NewDayTown{Entity: oapi.Entity{Name: name, UUID: name}, Chunks: chunks, Ruined: ruined}
+	}
+
+	pre := database.NewDaySnapshot{
+		TakenAt: newDay.Add(-5 * time.Minute).UnixMilli(),
+		Towns: map[string]database.NewDayTown{
+			"a": town("a", 10, false),
+			"b": town("b", 50, false),
+			"c": town("c", 5, true),  // already ruined, deleted at this new day
+			"d": town("d", 20, true), // already ruined, still there
+			"e": town("e", 30, false),
+		},
+		Nations: map[string]database.NewDayNation{
+			"n1": {Entity: oapi.Entity{Name: "n1", UUID: "n1"}},
+			"n2": {Entity: oapi.Entity{Name: "n2", UUID: "n2"}},
+		},
+	}
+
+	post := database.NewDaySnapshot{
+		TakenAt: newDay.Add(2 * time.Minute).UnixMilli(),
+		Towns: map[string]database.NewDayTown{
+			"a": town("a", 10, true),
+			"b": town("b", 50, true),
+			"d": town("d", 20, true),
+			"e": town("e", 30, false),
+		},
+		Nations: map[string]database.NewDayNation{
+			"n1": {Entity: oapi.Entity{Name: "n1", UUID: "n1"}},
+		},
+	}
+
+	report := database.ComputeNewDayReport(newDay, pre, post)
+	if report.Empty() {
+		t.Fatal("expected a non-empty report")
+	}
+
+	if len(report.Ruined) != 2 || report.Ruined[0].Name != "b" || report.Ruined[1].Name != "a" {
+		t.Errorf("expected b and a to be ruined (biggest first), got %+v", report.Ruined)
+	}
+	if len(report.Deleted) != 1 || report.Deleted[0].Name != "c" {
+		t.Errorf("expected only c to be deleted, got %+v", report.Deleted)
+	}
+	if len(report.Dissolved) != 1 || report.Dissolved[0].Name != "n2" {
+		t.Errorf("expected only n2 to be dissolved, got %+v", report.Dissolved)
+	}
+}
+
+func TestSyncNewDayClock(t *testing.T) {
+	mdb, _ := setupTest(t, "testnewdayclock")
+
+	prev := database.CurrentNewDayClock()
+	t.Cleanup(func() { database.SetNewDayClock(prev) })
+
+	serverStore, _ := database.OpenStore(mdb, database.SERVER_STORE)
+	if database.SyncNewDayClock(serverStore) {
+		t.Fatal("expected no clock without server info")
+	}
+
+	// Server is on UTC+1 with new days at 11:00 its time, as if the bot just fetched it.
+	utc := time.Now().UTC()
+	utcClock := time.Duration(utc.Hour())*time.Hour + time.Duration(utc.Minute())*time.Minute
+
+	var info oapi.ServerInfo
+	info.Timestamps.ServerTimeOfDay = int64((utcClock + time.Hour) % (24 * time.Hour) / time.Second)
+	info.Timestamps.NewDayTime = int64((11 * time.Hour) / time.Second)
+
+	serverStore.Set("info", info)
+	if err := serverStore.WriteSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !database.SyncNewDayClock(serverStore) || database.CurrentNewDayClock() != 10*time.Hour {
+		t.Fatalf("expected new day at 10h0m0s UTC, got %s", database.CurrentNewDayClock())
+	}
+}
+
+func TestNewDaySnapshotWithoutNationName(t *testing.T) {
+	mdb, _ := setupTest(t, "testnewdaysnapshot")
+
+	townStore, _ := database.OpenStore(mdb, database.TOWNS_STORE)
+	nationStore, _ := database.OpenStore(mdb, database.NATIONS_STORE)
+
+	var town oapi.TownInfo
+	town.UUID = "town"
+	town.Nation.UUID = lo.ToPtr("nation") // name missing from the response
+	townStore.Set(town.UUID, town)
+
+	snapshot := database.TakeNewDaySnapshot(townStore, nationStore, time.Now())
+	if n := snapshot.Towns["town"].Nation; n.UUID != "nation" || n.Name != "" {
+		t.Fatalf("expected the nation UUID with an empty name, got %+v", n)
+	}
+}
@@ -0,0 +1,142 @@
+package tests
+
+import (
+	"emcsrw/internal/database"
+	"emcsrw/pkg/api/oapi"
+	"testing"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+// A town with just the stats the claim maths uses, built on newTestTown. Pass an empty nationUUID for a nationless town.
+func newClaimTown(uuid, nationUUID string, residents, size, maxSize uint32) oapi.TownInfo {
+	t := newTestTown(uuid, nationUUID)
+	t.Stats.NumResidents = residents
+	t.Stats.NumTownBlocks = size
+	t.Stats.MaxTownBlocks = maxSize
+
+	return t
+}
+
+// A nation with the bonus its residents would get from the default tiers, built on newFlowNation.
+func newClaimNation(uuid, capital string, residents int) oapi.NationInfo {
+	n := newFlowNation(uuid, "", capital)
+	n.Stats.NumResidents = residents
+	n.Stats.NationBonus = database.NationBonusForResidents(residents)
+
+	return n
+}
+
+// Both nil, or both set to the same value.
+func equalIntPtrs(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return *a == *b
+}
+
+func TestComputeOverclaimRisk(t *testing.T) {
+	ruinAt := time.Now().Add(24 * time.Hour)
+
+	// All use the default bonus tiers and 12 claims per resident.
+	cases := []struct {
+		name                       string
+		residents, size, maxSize   uint32
+		nationResidents            int // 0 for a nationless town
+		falling                    []database.FallingTown
+		level                      database.OverclaimRiskLevel
+		residentsToOverclaim       *int
+		spareIfLeaves              *int
+		spareIfJoins, spareFalling int
+	}{
+		{
+			name: "safe in nation", residents: 5, size: 20, maxSize: 5*12 + 20, nationResidents: 10,
+			level: database.OverclaimRiskNone, spareIfLeaves: lo.ToPtr(40), spareIfJoins: 50, spareFalling: 60,
+		},
+		{
+			name: "already overclaimed", residents: 2, size: 50, maxSize: 2*12 + 20, nationResidents: 10,
+			level: database.OverclaimRiskOverclaimed, residentsToOverclaim: lo.ToPtr(1), spareIfLeaves: lo.ToPtr(-26), spareIfJoins: -16, spareFalling: -6,
+		},
+		{
+			name: "nation drops a tier when one leaves", residents: 2, size: 40, maxSize: 2*12 + 20, nationResidents: 10,
+			level: database.OverclaimRiskHigh, residentsToOverclaim: lo.ToPtr(1), spareIfLeaves: lo.ToPtr(-16), spareIfJoins: -6, spareFalling: 4,
+		},
+		{
+			name: "two residents leaving", residents: 10, size: 140, maxSize: 10*12 + 40, nationResidents: 30,
+			level: database.OverclaimRiskMedium, residentsToOverclaim: lo.ToPtr(2), spareIfLeaves: lo.ToPtr(-20), spareIfJoins: 0, spareFalling: 20,
+		},
+		{
+			name: "only the nation bonus holds it", residents: 1, size: 30, maxSize: 12 + 40, nationResidents: 30,
+			level: database.OverclaimRiskLow, spareIfLeaves: lo.ToPtr(-18), spareIfJoins: -8, spareFalling: 22,
+		},
+		{
+			name: "nationless", residents: 3, size: 10, maxSize: 3 * 12,
+			level: database.OverclaimRiskNone, spareIfJoins: 36, spareFalling: 26,
+		},
+		{
+			name: "own mayor falling", residents: 3, size: 10, maxSize: 3 * 12,
+			falling: []database.FallingTown{{TownInfo: newClaimTown("town", "", 3, 0, 0), RuinAt: ruinAt}},
+			level:   database.OverclaimRiskHigh, spareIfJoins: 36, spareFalling: 26,
+		},
+		{
+			name: "falling towns shrink the nation", residents: 10, size: 141, maxSize: 10*12 + 40, nationResidents: 25,
+			falling: []database.FallingTown{
+				{TownInfo: newClaimTown("f1", "n1", 6, 0, 0), RuinAt: ruinAt},
+				{TownInfo: newClaimTown("f2", "n2", 20, 0, 0), RuinAt: ruinAt.Add(-time.Hour)}, // other nation, ignored
+			},
+			level: database.OverclaimRiskHigh, residentsToOverclaim: lo.ToPtr(2), spareIfLeaves: lo.ToPtr(-21), spareIfJoins: -1, spareFalling: -1,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var nation *oapi.NationInfo
+			if c.nationResidents > 0 {
+				nation = lo.ToPtr(newClaimNation("n1", "", c.nationResidents))
+			}
+
+			town := newClaimTown("town", lo.Ternary(nation != nil, "n1", ""), c.residents, c.size, c.maxSize)
+
+			risk := database.ComputeOverclaimRisk(town, nation, c.falling)
+			if risk.Level != c.level {
+				t.Errorf("expected level %s, got %s", c.level, risk.Level)
+			}
+			if !equalIntPtrs(risk.ResidentsToOverclaim, c.residentsToOverclaim) {
+				t.Errorf("expected %v residents to overclaim, got %v", lo.FromPtr(c.residentsToOverclaim), lo.FromPtr(risk.ResidentsToOverclaim))
+			}
+			if !equalIntPtrs(risk.SpareIfLeavesNation, c.spareIfLeaves) {
+				t.Errorf("expected %v spare after leaving, got %v", lo.FromPtr(c.spareIfLeaves), lo.FromPtr(risk.SpareIfLeavesNation))
+			}
+			if risk.SpareIfJoinsNation != c.spareIfJoins {
+				t.Errorf("expected %d spare after joining, got %d", c.spareIfJoins, risk.SpareIfJoinsNation)
+			}
+			if risk.SpareAfterFalling != c.spareFalling {
+				t.Errorf("expected %d spare after falling, got %d", c.spareFalling, risk.SpareAfterFalling)
+			}
+			if hasFalling := len(c.falling) > 0; (risk.OverclaimableAt != nil) != hasFalling {
+				t.Errorf("expected overclaimable time set: %v, got %v", hasFalling, risk.OverclaimableAt)
+			} else if hasFalling && !risk.OverclaimableAt.Equal(ruinAt) {
+				t.Errorf("expected overclaimable at %s, got %s", ruinAt, risk.OverclaimableAt)
+			}
+		})
+	}
+}
+
+func TestSpareIfJoins(t *testing.T) {
+	town := newClaimTown("town", "", 3, 10, 3*12)
+
+	// 8 + 3 residents moves the target up a tier, so the town gets 20 rather than the 10 it has now.
+	target := newClaimNation("n2", "", 8)
+	if spare := database.SpareIfJoins(town, nil, target); spare != 46 {
+		t.Errorf("expected 46 spare after joining, got %d", spare)
+	}
+
+	// Already in it, nothing changes.
+	current := newClaimNation("n1", "", 10)
+	inNation := newClaimTown("town", "n1", 3, 10, 3*12+20)
+	if spare := database.SpareIfJoins(inNation, &current, current); spare != 46 {
+		t.Errorf("expected the current 46 spare claims, got %d", spare)
+	}
+}
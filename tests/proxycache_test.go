@@ -0,0 +1,303 @@
+package tests
+
+import (
+	"emcsrw/internal/database"
+	"emcsrw/pkg/api/capi"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestProxyCache(t *testing.T) *capi.ProxyCache {
+	cache, err := capi.NewProxyCache(capi.ProxyCacheOptions{
+		MaxEntryBytes:  1024,
+		MaxMemoryBytes: 4096,
+		MaxDiskBytes:   4096,
+		Dir:            t.TempDir(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cache
+}
+
+// Serves a request for target through the cache, fetching from upstream with any conditional headers.
+func serveCached(cache *capi.ProxyCache, upstream *httptest.Server, ifNoneMatch string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/proxy", nil)
+	if ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", ifNoneMatch)
+	}
+
+	rec := httptest.NewRecorder()
+	cache.Serve(rec, req, upstream.URL, func(conditional http.Header) (*http.Response, error) {
+		upReq, _ := http.NewRequest(http.MethodGet, upstream.URL, nil)
+		for k, vv := range conditional {
+			upReq.Header[k] = vv
+		}
+		return http.DefaultClient.Do(upReq)
+	})
+
+	return rec
+}
+
+func TestProxyCacheHitAndRevalidate(t *testing.T) {
+	var hits, revalidations atomic.Int32
+	maxAge := "max-age=60"
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Cache-Control", maxAge)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			revalidations.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("hello"))
+	}))
+	defer upstream.Close()
+
+	cache := newTestProxyCache(t)
+
+	if rec := serveCached(cache, upstream, ""); rec.Header().Get("X-Cache") != capi.CACHE_MISS || rec.Body.String() != "hello" {
+		t.Fatalf("expected MISS with body, got %s %q", rec.Header().Get("X-Cache"), rec.Body.String())
+	}
+	if rec := serveCached(cache, upstream, ""); rec.Header().Get("X-Cache") != capi.CACHE_HIT || rec.Body.String() != "hello" {
+		t.Fatalf("expected HIT with body, got %s %q", rec.Header().Get("X-Cache"), rec.Body.String())
+	}
+	if rec := serveCached(cache, upstream, `"v1"`); rec.Code != http.StatusNotModified {
+		t.Errorf("expected 304 for client that already has the response, got %d", rec.Code)
+	}
+	if hits.Load() != 1 {
+		t.Errorf("expected 1 upstream request, got %d", hits.Load())
+	}
+
+	// Start over with responses that are immediately stale, so the cached copy has to be revalidated.
+	maxAge = "max-age=0"
+	cache = newTestProxyCache(t)
+	serveCached(cache, upstream, "")
+	if rec := serveCached(cache, upstream, ""); rec.Header().Get("X-Cache") != capi.CACHE_REVALIDATED || rec.Body.String() != "hello" {
+		t.Errorf("expected REVALIDATED with cached body, got %s %q", rec.Header().Get("X-Cache"), rec.Body.String())
+	}
+	if revalidations.Load() != 1 {
+		t.Errorf("expected 1 conditional upstream request, got %d", revalidations.Load())
+	}
+}
+
+func TestProxyCacheCollapsesConcurrentRequests(t *testing.T) {
+	var hits atomic.Int32
+	release := make(chan struct{})
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		<-release
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("slow"))
+	}))
+	defer upstream.Close()
+
+	cache := newTestProxyCache(t)
+
+	var wg sync.WaitGroup
+	results := make([]*httptest.ResponseRecorder, 5)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = serveCached(cache, upstream, "")
+		}()
+	}
+
+	time.Sleep(100 * time.Millisecond) // let every request join before upstream responds
+	close(release)
+	wg.Wait()
+
+	if hits.Load() != 1 {
+		t.Errorf("expected concurrent requests to collapse into 1 upstream request, got %d", hits.Load())
+	}
+	for _, rec := range results {
+		if rec.Body.String() != "slow" {
+			t.Errorf("expected every request to get the body, got %q (%s)", rec.Body.String(), rec.Header().Get("X-Cache"))
+		}
+	}
+
+	if entries, _ := cache.Stats(); entries != 1 {
+		t.Errorf("expected the shared response to be cached once, got %d entries", entries)
+	}
+}
+
+func TestProxyCacheBypassesCredentials(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("only for " + r.Header.Get("Authorization")))
+	}))
+	defer upstream.Close()
+
+	cache := newTestProxyCache(t)
+	for _, header := range []string{"Authorization", "Cookie"} {
+		req := httptest.NewRequest(http.MethodGet, "/proxy", nil)
+		req.Header.Set(header, "secret")
+
+		rec := httptest.NewRecorder()
+		cache.Serve(rec, req, upstream.URL, func(http.Header) (*http.Response, error) {
+			return http.Get(upstream.URL)
+		})
+
+		if rec.Header().Get("X-Cache") != capi.CACHE_BYPASS {
+			t.Errorf("expected request with %s to bypass the cache, got %s", header, rec.Header().Get("X-Cache"))
+		}
+	}
+
+	if entries, _ := cache.Stats(); entries != 0 {
+		t.Errorf("expected credentialed responses to not be cached, got %d entries", entries)
+	}
+}
+
+func TestProxyCacheSharesFailedFetch(t *testing.T) {
+	var fetches atomic.Int32
+	release := make(chan struct{})
+
+	cache := newTestProxyCache(t)
+
+	var wg sync.WaitGroup
+	results := make([]*httptest.ResponseRecorder, 5)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			results[i] = httptest.NewRecorder()
+			cache.Serve(results[i], httptest.NewRequest(http.MethodGet, "/proxy", nil), "http://upstream", func(http.Header) (*http.Response, error) {
+				fetches.Add(1)
+				<-release
+				return nil, errors.New("upstream down")
+			})
+		}()
+	}
+
+	time.Sleep(100 * time.Millisecond) // let every request join before the fetch fails
+	close(release)
+	wg.Wait()
+
+	if fetches.Load() != 1 {
+		t.Errorf("expected waiters to share the failed fetch instead of retrying, got %d fetches", fetches.Load())
+	}
+	for _, rec := range results {
+		if rec.Code != http.StatusBadGateway {
+			t.Errorf("expected every request to fail with 502, got %d", rec.Code)
+		}
+	}
+}
+
+func TestProxyStripsApiKeys(t *testing.T) {
+	mdb, _ := setupTest(t, testDB)
+	keyStore, _ := database.OpenStore(mdb, database.API_KEYS_STORE)
+	key, _, err := database.IssueApiKey(keyStore, "test", database.ApiTierPartner, "cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := capi.NewApiKeys(mdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var seen []http.Header
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen = append(seen, r.Header.Clone())
+		mu.Unlock()
+
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	// The proxy uses the default transport, which doesn't trust the test server's certificate.
+	defaultTransport := http.DefaultTransport
+	http.DefaultTransport = upstream.Client().Transport
+	t.Cleanup(func() { http.DefaultTransport = defaultTransport })
+
+	mux := http.NewServeMux()
+	proxy := capi.NewProxy(capi.NewRateLimit(false, 10, keys, nil), newTestProxyCache(t), []string{"127.0.0.1"})
+	capi.ServeProxy(mux, proxy)
+
+	get := func(header, value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/proxy?target="+url.QueryEscape(upstream.URL+"/data"), nil)
+		req.Header.Set(header, value)
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := get("X-API-Key", key); rec.Code != http.StatusOK || rec.Header().Get("X-Cache") != capi.CACHE_MISS {
+		t.Fatalf("expected keyed request to be fetched and cached, got %d (%s)", rec.Code, rec.Header().Get("X-Cache"))
+	}
+	if rec := get("Authorization", "Bearer "+key); rec.Header().Get("X-Cache") != capi.CACHE_HIT {
+		t.Errorf("expected keyed request to be served from cache, got %s", rec.Header().Get("X-Cache"))
+	}
+
+	// Skip the cache so the Authorization header actually goes upstream.
+	req := httptest.NewRequest(http.MethodGet, "/proxy?target="+url.QueryEscape(upstream.URL+"/other"), nil)
+	req.Header.Set("Authorization", "Bearer "+key)
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(seen) != 2 {
+		t.Fatalf("expected 2 upstream requests, got %d", len(seen))
+	}
+	for _, h := range seen {
+		if h.Get("X-API-Key") != "" || h.Get("Authorization") != "" {
+			t.Errorf("expected upstream to never see the API key, got %v", h)
+		}
+	}
+}
+
+func TestProxyCacheDoesNotShareUnstorable(t *testing.T) {
+	var fetches atomic.Int32
+	release := make(chan struct{})
+
+	cache := newTestProxyCache(t)
+
+	var wg sync.WaitGroup
+	results := make([]*httptest.ResponseRecorder, 5)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			results[i] = httptest.NewRecorder()
+			cache.Serve(results[i], httptest.NewRequest(http.MethodGet, "/proxy", nil), "http://upstream", func(http.Header) (*http.Response, error) {
+				fetches.Add(1)
+				<-release
+
+				rec := httptest.NewRecorder()
+				rec.Header().Set("Cache-Control", "no-store")
+				rec.WriteString("secret")
+				return rec.Result(), nil
+			})
+		}()
+	}
+
+	time.Sleep(100 * time.Millisecond) // let every request join before the fetch completes
+	close(release)
+	wg.Wait()
+
+	if fetches.Load() != int32(len(results)) {
+		t.Errorf("expected every request to fetch its own no-store response, got %d fetches", fetches.Load())
+	}
+	for _, rec := range results {
+		if rec.Header().Get("X-Cache") == capi.CACHE_COLLAPSED {
+			t.Errorf("expected no-store response to never be shared")
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package tests
+
+import (
+	"bytes"
+	"emcsrw/pkg/utils/render"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func TestDrawClaimsScalesUpSmallTowns(t *testing.T) {
+	fill := color.NRGBA{R: 200, A: 255}
+	img := render.DrawClaims([]render.ClaimLayer{{Chunks: [][2]int{{0, 0}}, Fill: fill, Outline: fill}})
+
+	// A single chunk plus padding on each side, at the max px per chunk.
+	size := (1 + 2*render.PADDING_CHUNKS) * render.MAX_CHUNK_PX
+	if b := img.Bounds(); b.Dx() != size || b.Dy() != size {
+		t.Fatalf("expected %dx%d image, got %dx%d", size, size, b.Dx(), b.Dy())
+	}
+
+	mid := render.PADDING_CHUNKS*render.MAX_CHUNK_PX + render.MAX_CHUNK_PX/2
+	if c := img.RGBAAt(mid, mid); c.R != 200 {
+		t.Errorf("expected the chunk to be filled, got %v", c)
+	}
+	if c := img.RGBAAt(0, 0); c != render.BACKGROUND_COLOUR {
+		t.Errorf("expected padding to be background, got %v", c)
+	}
+
+	if render.DrawClaims(nil) != nil {
+		t.Error("expected nothing to be drawn without chunks")
+	}
+}
+
+func TestDrawClaimsDownsamplesHugeClaims(t *testing.T) {
+	// Half transparent so blending the same pixel twice would show.
+	fill := color.NRGBA{R: 255, A: 128}
+	layer := render.ClaimLayer{
+		Chunks: [][2]int{{0, 0}, {1, 0}, {2, 0}, {7, 0}, {3000, 0}},
+		Fill:   fill, Outline: fill,
+	}
+
+	img := render.DrawClaims([]render.ClaimLayer{layer})
+	if b := img.Bounds(); b.Dx() > render.MAX_IMAGE_PX || b.Dy() > render.MAX_IMAGE_PX {
+		t.Fatalf("expected image within %dpx, got %dx%d", render.MAX_IMAGE_PX, b.Dx(), b.Dy())
+	}
+
+	// 3005 chunks wide with padding, so each pixel covers 3 chunks. Chunks 1 and 2 share pixel 1, chunk 7 has pixel 3 to itself.
+	shared, single := img.RGBAAt(1, 0), img.RGBAAt(3, 0)
+	if shared != single {
+		t.Errorf("expected a pixel covering two chunks to match one covering a single chunk, got %v and %v", shared, single)
+	}
+	if shared == render.BACKGROUND_COLOUR {
+		t.Error("expected downsampled chunks to be filled")
+	}
+	if c := img.RGBAAt(1000, 0); c != single {
+		t.Errorf("expected the far chunk to be drawn, got %v", c)
+	}
+
+	data, err := render.RenderClaimsPNG([]render.ClaimLayer{layer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg, err := png.DecodeConfig(bytes.NewReader(data)); err != nil || cfg.Width > render.MAX_IMAGE_PX {
+		t.Errorf("expected a PNG within %dpx, got %+v (%v)", render.MAX_IMAGE_PX, cfg, err)
+	}
+}
@@ -0,0 +1,170 @@
+package tests
+
+import (
+	"emcsrw/internal/bot/scheduler"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+func TestCronNext(t *testing.T) {
+	from := time.Date(2025, time.March, 14, 10, 30, 45, 0, time.UTC) // Friday
+
+	cases := []struct {
+		expr     string
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2025, time.March, 14, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2025, time.March, 14, 10, 45, 0, 0, time.UTC)},
+		{"2 10 * * *", time.Date(2025, time.March, 15, 10, 2, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2025, time.April, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2025, time.March, 17, 9, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2025, time.March, 16, 0, 0, 0, 0, time.UTC)},  // 7 is Sunday too
+		{"0 0 13 * 5", time.Date(2025, time.March, 21, 0, 0, 0, 0, time.UTC)}, // day of month OR day of week
+		{"5/20 11 * * *", time.Date(2025, time.March, 14, 11, 5, 0, 0, time.UTC)},
+		{"0,30 10,12 * * *", time.Date(2025, time.March, 14, 12, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 2 *", time.Time{}}, // never
+	}
+
+	for _, c := range cases {
+		cron, err := scheduler.ParseCron(c.expr)
+		if err != nil {
+			t.Errorf("%s: %v", c.expr, err)
+			continue
+		}
+
+		if next := cron.Next(from); !next.Equal(c.expected) {
+			t.Errorf("%s: expected %s, got %s", c.expr, c.expected, next)
+		}
+	}
+
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "@daily"} {
+		if _, err := scheduler.ParseCron(expr); err == nil {
+			t.Errorf("expected error parsing '%s'", expr)
+		}
+	}
+}
+
+func TestEarliestSpec(t *testing.T) {
+	from := time.Date(2025, time.March, 14, 10, 0, 30, 0, time.UTC)
+	once := time.Date(2025, time.March, 14, 10, 1, 0, 0, time.UTC)
+
+	// Fires once at a fixed time, then never again.
+	fixed := scheduler.SpecFunc(func(after time.Time) time.Time {
+		return lo.Ternary(after.Before(once), once, time.Time{})
+	})
+	spec := scheduler.Earliest(scheduler.Every(90*time.Second), fixed)
+
+	if next := spec.Next(from); !next.Equal(once) {
+		t.Errorf("expected fixed time to win, got %s", next)
+	}
+	if next := spec.Next(from.Add(time.Minute)); !next.Equal(from.Add(150 * time.Second)) {
+		t.Errorf("expected interval to win, got %s", next)
+	}
+}
+
+// Runs a slow task far more often than it can finish and counts how many runs actually happened.
+func runOverlapping(t *testing.T, overlap scheduler.Overlap) (runs int32, maxConcurrent int32) {
+	var running atomic.Int32
+	var total atomic.Int32
+	var peak atomic.Int32
+
+	s := scheduler.New()
+	s.ScheduleSpec("Slow", func() error {
+		cur := running.Add(1)
+		defer running.Add(-1)
+
+		for {
+			p := peak.Load()
+			if cur <= p || peak.CompareAndSwap(p, cur) {
+				break
+			}
+		}
+
+		total.Add(1)
+		time.Sleep(120 * time.Millisecond)
+		return nil
+	}, scheduler.Every(10*time.Millisecond), scheduler.Options{RunInitial: true, Overlap: overlap})
+
+	time.Sleep(300 * time.Millisecond)
+	if msg := s.Shutdown(2 * time.Second); msg != "All tasks finished" {
+		t.Fatalf("scheduler did not shut down: %s", msg)
+	}
+
+	return total.Load(), peak.Load()
+}
+
+func TestSchedulerOverlap(t *testing.T) {
+	skipped, peak := runOverlapping(t, scheduler.SkipIfRunning)
+	if peak != 1 {
+		t.Errorf("skip: task ran %d times concurrently", peak)
+	}
+	if skipped < 2 || skipped > 3 {
+		t.Errorf("skip: expected 2-3 runs in 300ms of a 120ms task, got %d", skipped)
+	}
+
+	queued, peak := runOverlapping(t, scheduler.QueueIfRunning)
+	if peak != 1 {
+		t.Errorf("queue: task ran %d times concurrently", peak)
+	}
+	if queued < 3 {
+		t.Errorf("queue: expected queued runs to follow on back to back, got %d runs", queued)
+	}
+}
+
+func TestSchedulerTaskControls(t *testing.T) {
+	var runs atomic.Int32
+	release := make(chan struct{})
+
+	s := scheduler.New()
+	defer s.Shutdown(time.Second)
+
+	s.ScheduleSpec("Blocking", func() error {
+		runs.Add(1)
+		<-release
+		return nil
+	}, scheduler.Every(time.Hour), scheduler.Options{Overlap: scheduler.SkipIfRunning})
+
+	if _, err := s.RunNow("Missing"); !errors.Is(err, scheduler.ErrTaskNotFound) {
+		t.Fatalf("expected ErrTaskNotFound, got %v", err)
+	}
+
+	if err := s.Pause("Blocking"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Manual runs go ahead even while paused.
+	if _, err := s.RunNow("Blocking"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.RunNow("Blocking"); !errors.Is(err, scheduler.ErrTaskRunning) {
+		t.Fatalf("expected ErrTaskRunning, got %v", err)
+	}
+
+	state, _ := s.Task("Blocking")
+	if !state.Paused || !state.Running || !state.NextRun.IsZero() {
+		t.Errorf("expected paused and running with no next run, got %+v", state)
+	}
+
+	release <- struct{}{}
+	time.Sleep(20 * time.Millisecond)
+
+	if err := s.Resume("Blocking"); err != nil {
+		t.Fatal(err)
+	}
+
+	state, _ = s.Task("Blocking")
+	if state.Paused || state.Running || state.Runs != 1 || state.NextRun.IsZero() {
+		t.Errorf("expected resumed with 1 run and a next run, got %+v", state)
+	}
+	if state.Schedule != "every 1h0m0s" {
+		t.Errorf("unexpected schedule description: %s", state.Schedule)
+	}
+	if runs.Load() != 1 {
+		t.Errorf("expected 1 run, got %d", runs.Load())
+	}
+}
@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"emcsrw/internal/database"
+	"emcsrw/pkg/api/oapi"
+	"emcsrw/pkg/utils/sets"
+	"testing"
+)
+
+func TestSimulateNation(t *testing.T) {
+	nation := newClaimNation("n1", "capital", 10)
+	nation.Stats.NumTowns = 2
+	nation.Stats.NumTownBlocks = 60
+
+	// 12 per resident + nation bonus of 20 (10 residents)
+	capital := newClaimTown("capital", "n1", 8, 40, 8*12+20)
+	small := newClaimTown("small", "n1", 2, 40, 2*12+20) // 4 spare
+
+	sim := database.SimulateNation(nation, []oapi.TownInfo{capital, small}, database.NationChanges{
+		RemoveTowns:   sets.New[string](),
+		ResidentDelta: -1, // drops nation below 10 residents, reducing bonus to 10
+	})
+
+	if bonus := sim.After.Bonus(); bonus != 10 {
+		t.Fatalf("expected simulated bonus of 10, got %d", bonus)
+	}
+
+	overclaimed := sim.NewlyOverclaimed()
+	if len(overclaimed) != 1 || overclaimed[0].UUID != "small" {
+		t.Errorf("expected only 'small' to become overclaimed, got %+v", overclaimed)
+	}
+
+	risk := database.ComputeOverclaimRisk(small, &nation, nil)
+	if risk.ResidentsToOverclaim == nil || *risk.ResidentsToOverclaim != 1 {
+		t.Errorf("expected 'small' to be overclaimed after 1 resident leaves, got %v", risk.ResidentsToOverclaim)
+	}
+}
+
+func TestSimulateNationClampsResidentDelta(t *testing.T) {
+	nation := newClaimNation("n1", "capital", 5)
+	nation.Stats.NumTowns = 2
+
+	capital := newClaimTown("capital", "n1", 3, 10, 3*12+10)
+	small := newClaimTown("small", "n1", 2, 10, 2*12+10)
+
+	// The capital keeps its mayor, so only 2 of the 10 residents can actually leave.
+	sim := database.SimulateNation(nation, []oapi.TownInfo{capital, small}, database.NationChanges{
+		RemoveTowns:   sets.New[string](),
+		ResidentDelta: -10,
+	})
+
+	if residents := sim.After.Stats.NumResidents; residents != 3 {
+		t.Errorf("expected nation to be left with 3 residents, got %d", residents)
+	}
+	if residents := sim.Towns[0].Residents; sim.Towns[0].UUID != "capital" || residents != 1 {
+		t.Errorf("expected capital to be left with 1 resident, got %+v", sim.Towns[0])
+	}
+}
+
+func TestParseNationBonusTiers(t *testing.T) {
+	tiers, err := database.ParseNationBonusTiers(" 0:10, 10:20,25:45 ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tiers) != 3 || tiers[2] != (database.NationBonusTier{MinResidents: 25, Bonus: 45}) {
+		t.Fatalf("expected 3 tiers ending in 25:45, got %+v", tiers)
+	}
+
+	for _, s := range []string{"", "10", "0:10,0:20", "10:20,5:10", "0:-5", "a:b"} {
+		if _, err := database.ParseNationBonusTiers(s); err == nil {
+			t.Errorf("expected '%s' to be rejected", s)
+		}
+	}
+}
@@ -3,10 +3,12 @@ package tests
 import (
 	"emcsrw/internal/database"
 	"emcsrw/internal/database/store"
+	"emcsrw/pkg/api/mapi"
 	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 const testDB = "testdb"
@@ -106,6 +108,34 @@ func TestSetGet(t *testing.T) {
 	}
 }
 
+func TestPlayerTrailRetention(t *testing.T) {
+	mdb, _ := setupTest(t, testDB)
+	s := database.AssignStore(mdb, database.PLAYER_TRAILS_STORE)
+
+	start := time.Now()
+	players := []mapi.MapPlayer{{UUID: "a", Name: "Fix"}, {UUID: "b", Name: "Owen"}}
+	database.UpdatePlayerTrails(s, players, start, time.Minute)
+
+	// Only one player is still visible, the other should be pruned once outside retention.
+	_, removed := database.UpdatePlayerTrails(s, players[:1], start.Add(2*time.Minute), time.Minute)
+	if removed != 1 {
+		t.Errorf("expected 1 trail to be removed, got %d", removed)
+	}
+
+	trail, err := database.FindPlayerTrail(s, "fix", start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trail.Points) != 1 {
+		t.Errorf("expected old points to be pruned leaving 1, got %d", len(trail.Points))
+	}
+
+	// Not pruned if tracking stops, so reading has to leave out what's past retention.
+	if _, err := database.FindPlayerTrail(s, "fix", start.Add(3*time.Minute)); err == nil {
+		t.Error("expected no trail once every point is older than since")
+	}
+}
+
 func BenchmarkSet(b *testing.B) {
 	_, s, _ := setupBench(b)
 	for i := 0; b.Loop(); i++ {
@@ -0,0 +1,161 @@
+package tests
+
+import (
+	"emcsrw/internal/bot/events"
+	"emcsrw/pkg/api/oapi"
+	"emcsrw/pkg/utils/discordutil"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/samber/lo"
+)
+
+func newFlowTown(uuid, name, mayor, nation string) oapi.TownInfo {
+	t := oapi.TownInfo{Entity: oapi.Entity{UUID: uuid, Name: name}}
+	t.Mayor = oapi.Entity{UUID: mayor, Name: mayor}
+	if nation != "" {
+		t.Nation = oapi.EntityNullableValues{UUID: &nation, Name: &nation}
+	}
+
+	return t
+}
+
+func TestDiffTowns(t *testing.T) {
+	stale := map[string]oapi.TownInfo{
+		"renamed":   newFlowTown("renamed", "Old", "a", ""),
+		"mayor":     newFlowTown("mayor", "Mayor", "a", "n1"),
+		"moved":     newFlowTown("moved", "Moved", "a", "n1"),
+		"left":      newFlowTown("left", "Left", "a", "n1"),
+		"capital":   newFlowTown("capital", "Capital", "a", "n1"),
+		"ruined":    newFlowTown("ruined", "Ruined", "a", "n1"),
+		"deleted":   newFlowTown("deleted", "Deleted", "a", ""),
+		"reclaim":   newFlowTown("reclaim", "Reclaim", "npc", ""),
+		"unchanged": newFlowTown("unchanged", "Same", "a", "n1"),
+	}
+	stale["reclaim"] = func() oapi.TownInfo { t := stale["reclaim"]; t.Status.Ruined = true; return t }()
+
+	fresh := map[string]oapi.TownInfo{
+		"created":   newFlowTown("created", "Created", "a", ""),
+		"renamed":   newFlowTown("renamed", "New", "a", ""),
+		"mayor":     newFlowTown("mayor", "Mayor", "b", "n1"),
+		"moved":     newFlowTown("moved", "Moved", "a", "n2"),
+		"left":      newFlowTown("left", "Left", "a", ""),
+		"capital":   newFlowTown("capital", "Capital", "a", "n1"),
+		"ruined":    newFlowTown("ruined", "Ruined", "npc", ""),
+		"reclaim":   newFlowTown("reclaim", "Reclaim", "b", ""),
+		"unchanged": newFlowTown("unchanged", "Same", "a", "n1"),
+	}
+	fresh["capital"] = func() oapi.TownInfo { t := fresh["capital"]; t.Status.Capital = true; return t }()
+	fresh["ruined"] = func() oapi.TownInfo { t := fresh["ruined"]; t.Status.Ruined = true; return t }()
+
+	got := []string{}
+	for _, e := range events.DiffTowns(fresh, stale) {
+		got = append(got, string(e.Type)+":"+e.Town.UUID)
+	}
+
+	// Ruin and reclaim swallow the mayor/nation changes that come with them.
+	expected := []string{
+		"created:created", "renamed:renamed", "mayor-changed:mayor",
+		"joined-nation:moved", "left-nation:left", "left-nation:moved",
+		"capital-changed:capital", "ruined:ruined", "reclaimed:reclaim", "deleted:deleted",
+	}
+
+	if strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Fatalf("expected:\n\t%v\ngot:\n\t%v", expected, got)
+	}
+}
+
+func TestPaginateLines(t *testing.T) {
+	lines := []string{strings.Repeat("a", 6), strings.Repeat("b", 6), strings.Repeat("c", 6), strings.Repeat("d", 20)}
+
+	pages := discordutil.PaginateLines(lines, "\n", 13)
+	if len(pages) != 3 {
+		t.Fatalf("expected 3 pages, got %d: %v", len(pages), pages)
+	}
+	if len(pages[0]) != 2 || len(pages[1]) != 1 {
+		t.Errorf("expected pages of 2 and 1 lines, got %v", pages)
+	}
+	if pages[2][0] != strings.Repeat("d", 10)+"..." {
+		t.Errorf("expected oversized line to be cut off, got %q", pages[2][0])
+	}
+}
+
+func TestBatchEmbeds(t *testing.T) {
+	embeds := []*discordgo.MessageEmbed{}
+	for range 12 {
+		embeds = append(embeds, &discordgo.MessageEmbed{Description: strings.Repeat("x", 100)})
+	}
+	embeds = append(embeds,
+		&discordgo.MessageEmbed{Description: strings.Repeat("x", discordutil.EMBED_DESCRIPTION_LIMIT)},
+		&discordgo.MessageEmbed{Description: strings.Repeat("x", discordutil.EMBED_DESCRIPTION_LIMIT)},
+	)
+
+	batches := discordutil.BatchEmbeds(embeds)
+
+	sizes := []int{}
+	for _, batch := range batches {
+		total := 0
+		for _, e := range batch {
+			total += discordutil.EmbedLength(e)
+		}
+		if total > discordutil.EMBED_TOTAL_LIMIT {
+			t.Errorf("batch over total limit: %d", total)
+		}
+
+		sizes = append(sizes, len(batch))
+	}
+
+	// 10 small, 2 small + 1 big, 1 big
+	if len(sizes) != 3 || sizes[0] != 10 || sizes[1] != 3 || sizes[2] != 1 {
+		t.Fatalf("unexpected batch sizes: %v", sizes)
+	}
+}
+
+func newFlowNation(uuid, king, capital string) oapi.NationInfo {
+	return oapi.NationInfo{
+		Entity:  oapi.Entity{UUID: uuid, Name: uuid},
+		King:    oapi.Entity{UUID: king, Name: king},
+		Capital: oapi.Entity{UUID: capital, Name: capital},
+	}
+}
+
+func TestDiffNations(t *testing.T) {
+	staleTowns := map[string]oapi.TownInfo{
+		"a1": newFlowTown("a1", "a1", "x", "a"), "a2": newFlowTown("a2", "a2", "x", "a"),
+		"b1": newFlowTown("b1", "b1", "x", "b"), "b2": newFlowTown("b2", "b2", "x", "b"), "b3": newFlowTown("b3", "b3", "x", "b"),
+		"c1": newFlowTown("c1", "c1", "x", "c"), "c2": newFlowTown("c2", "c2", "x", "c"),
+		"d1": newFlowTown("d1", "d1", "x", "d"),
+		"t1": newFlowTown("t1", "t1", "x", ""),
+	}
+	towns := map[string]oapi.TownInfo{
+		"a1": newFlowTown("a1", "a1", "x", "a"), "a2": newFlowTown("a2", "a2", "x", "a"),
+		"b1": newFlowTown("b1", "b1", "x", "a"), "b2": newFlowTown("b2", "b2", "x", "a"), "b3": newFlowTown("b3", "b3", "x", ""), // b merged into a
+		"c1": newFlowTown("c1", "c1", "x", "c"), "c2": newFlowTown("c2", "c2", "x", ""), // c2 left c
+		"d1": newFlowTown("d1", "d1", "x", ""),  // d deleted
+		"t1": newFlowTown("t1", "t1", "x", "e"), // e created with t1 as capital
+	}
+
+	staleNations := map[string]oapi.NationInfo{
+		"a": newFlowNation("a", "k1", "a1"), "b": newFlowNation("b", "k1", "b1"),
+		"c": newFlowNation("c", "k1", "c1"), "d": newFlowNation("d", "k1", "d1"),
+	}
+	nations := map[string]oapi.NationInfo{
+		"a": newFlowNation("a", "k2", "a1"), // king changed
+		"c": newFlowNation("c", "k1", "c1"),
+		"e": newFlowNation("e", "k1", "t1"),
+	}
+
+	got := []string{}
+	for _, e := range events.DiffNations(nations, staleNations, towns, staleTowns) {
+		got = append(got, string(e.Type)+":"+e.Nation.UUID+lo.Ternary(e.Town.Name != "", "/"+e.Town.Name, ""))
+		if e.Type == events.NationMerged && (e.MergedInto.UUID != "a" || strings.Join(e.MovedTowns, ",") != "b1,b2") {
+			t.Errorf("expected b1 and b2 to have moved into a, got %+v", e)
+		}
+	}
+
+	expected := []string{"created:e", "king-changed:a", "town-left:c/c2", "merged:b", "deleted:d"}
+	if strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Fatalf("expected:\n\t%v\ngot:\n\t%v", expected, got)
+	}
+}
@@ -0,0 +1,107 @@
+package tests
+
+import (
+	"emcsrw/internal/database"
+	"emcsrw/pkg/api/oapi"
+	"emcsrw/pkg/utils/render"
+	"math"
+	"slices"
+	"testing"
+	"time"
+)
+
+func recordVP(st *database.VotePartyState, remaining int, at time.Time) (*database.VotePartySample, bool) {
+	return st.Record(oapi.ServerVoteParty{Target: 5000, NumRemaining: remaining}, at)
+}
+
+func TestVotePartyRateAndCompletion(t *testing.T) {
+	st := database.VotePartyState{}
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	if prev, _ := recordVP(&st, 400, start); prev != nil {
+		t.Fatal("expected no previous sample on the first record")
+	}
+
+	// 10 votes a minute for 10 minutes.
+	for m := 1; m <= 10; m++ {
+		recordVP(&st, 400-m*10, start.Add(time.Duration(m)*time.Minute))
+	}
+
+	now := start.Add(10 * time.Minute)
+	if rate := st.Rate(now); math.Abs(rate-10) > 0.01 {
+		t.Fatalf("expected a rate of 10 votes/min, got %.2f", rate)
+	}
+	if eta := st.ETA(now); eta != 30*time.Minute {
+		t.Fatalf("expected an ETA of 30 mins for 300 votes, got %s", eta)
+	}
+
+	// Unchanged within the sample interval isn't recorded.
+	count := len(st.Samples)
+	recordVP(&st, 300, now.Add(10*time.Second))
+	if len(st.Samples) != count {
+		t.Fatal("expected an unchanged sample to be skipped")
+	}
+
+	// Went from 300 to 4990 without seeing 0.
+	prev, completed := recordVP(&st, 4990, now.Add(time.Minute))
+	if !completed || prev.Remaining != 300 || len(st.Completions) != 1 {
+		t.Fatalf("expected a completion, got completed: %v, completions: %d", completed, len(st.Completions))
+	}
+
+	hourly := st.HourlyVotes(now.Add(time.Minute), 2)
+	if hourly[0] != 0 || hourly[1] != 100+300+10 {
+		t.Fatalf("unexpected hourly votes: %v", hourly)
+	}
+
+	// Samples older than the retention are dropped.
+	recordVP(&st, 4000, now.Add(database.VP_SAMPLE_RETENTION+time.Hour))
+	if len(st.Samples) != 1 {
+		t.Fatalf("expected old samples to be pruned, got %d", len(st.Samples))
+	}
+}
+
+func TestVotePartyRecordLeavesCopiesAlone(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	stored := database.VotePartyState{}
+	for m := range 5 {
+		recordVP(&stored, 400-m*10, start.Add(time.Duration(m)*time.Minute))
+	}
+	before := slices.Clone(stored.Samples)
+
+	// Same as what a store hands out, a copy sharing the same slices.
+	copied := stored
+	recordVP(&copied, 4000, start.Add(database.VP_SAMPLE_RETENTION+time.Hour))
+
+	if !slices.Equal(stored.Samples, before) {
+		t.Errorf("expected the original samples to be untouched, got %+v", stored.Samples)
+	}
+	if len(copied.Samples) != 1 {
+		t.Errorf("expected the copy to only keep the new sample, got %d", len(copied.Samples))
+	}
+}
+
+func TestCrossedVotePartyThreshold(t *testing.T) {
+	thresholds := []int{500, 300, 150, 50}
+
+	if th, ok := database.CrossedVotePartyThreshold(thresholds, 510, 290); !ok || th != 300 {
+		t.Fatalf("expected lowest crossed threshold 300, got %d (%v)", th, ok)
+	}
+	if _, ok := database.CrossedVotePartyThreshold(thresholds, 300, 290); ok {
+		t.Fatal("expected already being at a threshold to not count as crossing it again")
+	}
+	if _, ok := database.CrossedVotePartyThreshold(thresholds, 40, 4990); ok {
+		t.Fatal("expected a reset to not cross anything")
+	}
+}
+
+func TestRenderBarChart(t *testing.T) {
+	if png, err := render.RenderBarChartPNG(nil); png != nil || err != nil {
+		t.Fatal("expected nothing to be drawn without values")
+	}
+
+	img := render.DrawBarChart([]float64{1, 5, 0, 2})
+	if img.Bounds().Dx() != render.CHART_WIDTH_PX || img.Bounds().Dy() != render.CHART_HEIGHT_PX {
+		t.Fatalf("unexpected chart size %v", img.Bounds())
+	}
+}
@@ -0,0 +1,88 @@
+package tests
+
+import (
+	"emcsrw/internal/database"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWatchlist(t *testing.T) {
+	mdb, _ := setupTest(t, "testwatchlist")
+	s := database.AssignStore(mdb, database.WATCHLISTS_STORE)
+
+	town := database.WatchedEntity{Kind: database.WatchTown, UUID: "t1", Name: "Town"}
+	if err := database.AddWatch(s, "u1", town); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.AddWatch(s, "u1", town); !errors.Is(err, database.ErrAlreadyWatching) {
+		t.Fatalf("expected ErrAlreadyWatching, got %v", err)
+	}
+	database.AddWatch(s, "u2", town)
+	database.AddWatch(s, "u2", database.WatchedEntity{Kind: database.WatchNation, UUID: "t1", Name: "Same UUID, different kind"})
+
+	for i := range database.WATCHLIST_MAX_ENTRIES {
+		database.AddWatch(s, "u3", database.WatchedEntity{Kind: database.WatchPlayer, UUID: string(rune('a' + i))})
+	}
+	if err := database.AddWatch(s, "u3", town); !errors.Is(err, database.ErrWatchlistFull) {
+		t.Fatalf("expected ErrWatchlistFull, got %v", err)
+	}
+
+	w, _ := s.Get("u2")
+	w.AlertsDisabled = true
+	s.Set("u2", *w)
+
+	index := database.WatchersIndex(s)
+	if watchers := index[database.WatchTown]["t1"]; len(watchers) != 1 || watchers[0] != "u1" {
+		t.Fatalf("expected only u1 watching town t1 (u2 opted out), got %v", watchers)
+	}
+
+	if !database.RemoveWatch(s, "u1", database.WatchTown, "t1") || database.RemoveWatch(s, "u1", database.WatchTown, "t1") {
+		t.Fatal("expected town to be removed exactly once")
+	}
+}
+
+func TestWatchlistRateLimit(t *testing.T) {
+	w := database.Watchlist{}
+	now := time.Now()
+
+	for i := range database.WATCH_ALERT_LIMIT {
+		if !w.TryAlert(now.Add(time.Duration(i)*time.Minute), 1) {
+			t.Fatalf("expected alert %d to be allowed", i)
+		}
+	}
+
+	if w.TryAlert(now.Add(10*time.Minute), 3) || w.Suppressed != 3 {
+		t.Fatalf("expected alert over the limit to be suppressed, suppressed: %d", w.Suppressed)
+	}
+
+	// The first alert has left the window.
+	if !w.TryAlert(now.Add(database.WATCH_ALERT_WINDOW+time.Second), 1) {
+		t.Fatal("expected alert to be allowed once the window has passed")
+	}
+}
+
+func TestWatchAlertKeepsChangesMadeDuringDM(t *testing.T) {
+	mdb, _ := setupTest(t, "testwatchalerts")
+	s := database.AssignStore(mdb, database.WATCHLISTS_STORE)
+	database.AddWatch(s, "u1", database.WatchedEntity{Kind: database.WatchTown, UUID: "t1"})
+
+	allowed, _ := database.ReserveWatchAlert(s, "u1", time.Now(), 2)
+	if !allowed {
+		t.Fatal("expected the first alert to be allowed")
+	}
+
+	// While the DM is being sent, the user turns alerts off and watches something else.
+	database.SetWatchAlerts(s, "u1", false)
+	database.AddWatch(s, "u1", database.WatchedEntity{Kind: database.WatchNation, UUID: "n1"})
+
+	database.FinishWatchAlert(s, "u1", false, false, 2, 0)
+
+	w, _ := s.Get("u1")
+	if !w.AlertsDisabled || len(w.Entries) != 2 || w.Suppressed != 2 {
+		t.Fatalf("expected the opt-out and new entry to be kept with 2 suppressed alerts, got %+v", w)
+	}
+	if allowed, _ := database.ReserveWatchAlert(s, "u1", time.Now(), 1); allowed {
+		t.Fatal("expected no alerts once the user opted out")
+	}
+}
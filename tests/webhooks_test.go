@@ -0,0 +1,200 @@
+package tests
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"emcsrw/internal/database"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhookSignature(t *testing.T) {
+	body := []byte(`{"id":"1","topic":"townflow"}`)
+	sig := database.SignWebhookPayload("whsec_test", 1700000000, body)
+
+	// What a receiver would do to verify it.
+	mac := hmac.New(sha256.New, []byte("whsec_test"))
+	mac.Write([]byte(fmt.Sprintf("%d.%s", 1700000000, body)))
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	if sig != expected {
+		t.Fatalf("expected signature %s, got %s", expected, sig)
+	}
+	if database.SignWebhookPayload("whsec_test", 1700000001, body) == sig {
+		t.Fatal("expected a different timestamp to change the signature")
+	}
+}
+
+func TestParseWebhookEvents(t *testing.T) {
+	events, err := database.ParseWebhookEvents(" TownFlow, nationflow.merged,,townflow ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0] != "townflow" || events[1] != "nationflow.merged" {
+		t.Fatalf("expected [townflow nationflow.merged], got %v", events)
+	}
+
+	if _, err := database.ParseWebhookEvents("news"); err == nil {
+		t.Fatal("expected news to be rejected since DataUpdate doesn't compute it")
+	}
+	if _, err := database.ParseWebhookEvents(" , "); err == nil {
+		t.Fatal("expected an error with no events")
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	if b := database.WebhookBackoff(1); b != database.WEBHOOK_BASE_BACKOFF {
+		t.Errorf("expected first backoff of %s, got %s", database.WEBHOOK_BASE_BACKOFF, b)
+	}
+	if b := database.WebhookBackoff(3); b != 4*database.WEBHOOK_BASE_BACKOFF {
+		t.Errorf("expected third backoff of %s, got %s", 4*database.WEBHOOK_BASE_BACKOFF, b)
+	}
+	if b := database.WebhookBackoff(50); b != database.WEBHOOK_MAX_BACKOFF {
+		t.Errorf("expected backoff to be capped at %s, got %s", database.WEBHOOK_MAX_BACKOFF, b)
+	}
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	mdb, _ := setupTest(t, "testwebhooks")
+
+	hookStore, err := database.OpenStore(mdb, database.WEBHOOKS_STORE)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := database.CreateWebhook(hookStore, "ftp://example.com", []string{"townflow"}, "test"); err == nil {
+		t.Fatal("expected a non HTTP(S) URL to be rejected")
+	}
+	for _, url := range []string{
+		"http://localhost:8080/hook", "http://127.0.0.1/hook", "http://[::1]/hook",
+		"http://10.0.0.5/hook", "http://192.168.1.1/hook", "http://169.254.169.254/latest", "http://0.0.0.0/hook",
+	} {
+		if _, err := database.CreateWebhook(hookStore, url, []string{"townflow"}, "test"); err == nil {
+			t.Errorf("expected %s to be rejected as non-public", url)
+		}
+	}
+
+	all, _ := database.CreateWebhook(hookStore, "https://example.com/all", []string{"townflow"}, "test")
+	ruins, _ := database.CreateWebhook(hookStore, "https://example.com/ruins", []string{"townflow.ruined"}, "test")
+	if len(all.ID) != 8 || strings.Contains(all.Secret, all.ID) {
+		t.Fatalf("expected an 8 character ID unrelated to the secret, got %s", all.ID)
+	}
+
+	events := []database.StreamEvent{
+		{ID: "0001", Topic: database.StreamTopicTownFlow, Type: "created"},
+		{ID: "0002", Topic: database.StreamTopicTownFlow, Type: "ruined"},
+	}
+	if err := database.QueueWebhookDeliveries(mdb, events); err != nil {
+		t.Fatal(err)
+	}
+
+	deliveryStore, _ := database.OpenStore(mdb, database.WEBHOOK_DELIVERIES_STORE)
+	now := time.Now()
+	due := database.DueWebhookDeliveries(deliveryStore, now)
+	if len(due) != 3 {
+		t.Fatalf("expected 2 deliveries to %s and 1 to %s, got %d", all.ID, ruins.ID, len(due))
+	}
+
+	// Deliver the first, then fail the ruin delivery to the ruins webhook until it's dead.
+	var failing string
+	for _, d := range due {
+		if d.WebhookID == ruins.ID {
+			failing = d.ID
+		}
+	}
+
+	database.ApplyWebhookDeliveryResults(mdb, []string{due[0].ID}, nil, now)
+	for range database.WEBHOOK_MAX_ATTEMPTS {
+		database.ApplyWebhookDeliveryResults(mdb, nil, map[string]string{failing: "received status 500"}, now)
+	}
+
+	deliveryStore, _ = database.OpenStore(mdb, database.WEBHOOK_DELIVERIES_STORE)
+	if deliveryStore.Count() != 2 {
+		t.Fatalf("expected 2 deliveries left after one succeeded, got %d", deliveryStore.Count())
+	}
+
+	dead := database.DeadWebhookDeliveries(deliveryStore, ruins.ID)
+	if len(dead) != 1 || dead[0].Attempts != database.WEBHOOK_MAX_ATTEMPTS || dead[0].LastError == "" {
+		t.Fatalf("expected the failing delivery to be dead after %d attempts, got %+v", database.WEBHOOK_MAX_ATTEMPTS, dead)
+	}
+
+	if n, err := database.RetryDeadWebhookDeliveries(mdb, "", now); err != nil || n != 1 {
+		t.Fatalf("expected 1 delivery to be requeued, got %d (%v)", n, err)
+	}
+
+	// Deleting a webhook drops its deliveries straight away.
+	if _, err := database.DeleteWebhook(mdb, hookStore, ruins.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	deliveryStore, _ = database.OpenStore(mdb, database.WEBHOOK_DELIVERIES_STORE)
+	if due := database.DueWebhookDeliveries(deliveryStore, now); len(due) != 1 || due[0].WebhookID != all.ID {
+		t.Fatalf("expected only the remaining delivery to %s, got %+v", all.ID, due)
+	}
+}
+
+func TestWebhookDeliveryOrder(t *testing.T) {
+	mdb, _ := setupTest(t, "testwebhookorder")
+
+	hookStore, _ := database.OpenStore(mdb, database.WEBHOOKS_STORE)
+	down, _ := database.CreateWebhook(hookStore, "https://example.com/down", []string{"townflow"}, "test")
+	up, _ := database.CreateWebhook(hookStore, "https://example.com/up", []string{"townflow"}, "test")
+
+	events := []database.StreamEvent{
+		{ID: "0001", Topic: database.StreamTopicTownFlow, Type: "created"},
+		{ID: "0002", Topic: database.StreamTopicTownFlow, Type: "ruined"},
+	}
+	if err := database.QueueWebhookDeliveries(mdb, events); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	deliveryStore, _ := database.OpenStore(mdb, database.WEBHOOK_DELIVERIES_STORE)
+	first := ""
+	for _, d := range database.DueWebhookDeliveries(deliveryStore, now) {
+		if d.WebhookID == down.ID {
+			first = d.ID
+			break
+		}
+	}
+
+	database.ApplyWebhookDeliveryResults(mdb, nil, map[string]string{first: "received status 503"}, now)
+
+	// The second event to the failing webhook waits for the first, the other webhook is unaffected.
+	deliveryStore, _ = database.OpenStore(mdb, database.WEBHOOK_DELIVERIES_STORE)
+	for _, d := range database.DueWebhookDeliveries(deliveryStore, now) {
+		if d.WebhookID == down.ID {
+			t.Fatalf("expected nothing due to %s while %s waits to be retried, got %s", down.ID, first, d.ID)
+		}
+	}
+	if due := database.DueWebhookDeliveries(deliveryStore, now); len(due) != 2 || due[0].WebhookID != up.ID {
+		t.Fatalf("expected both deliveries to %s to be due, got %+v", up.ID, due)
+	}
+
+	later := now.Add(database.WEBHOOK_BASE_BACKOFF)
+	due := database.DueWebhookDeliveries(deliveryStore, later)
+	if len(due) != 4 {
+		t.Fatalf("expected every delivery to be due once the retry is, got %+v", due)
+	}
+	for _, d := range due {
+		if d.WebhookID == down.ID {
+			if d.ID != first {
+				t.Fatalf("expected the retry to go out before %s", d.ID)
+			}
+			break
+		}
+	}
+
+	// Running out of attempts dead-letters the one behind it too, so it can't overtake.
+	for range database.WEBHOOK_MAX_ATTEMPTS {
+		database.ApplyWebhookDeliveryResults(mdb, nil, map[string]string{first: "received status 503"}, later)
+	}
+
+	deliveryStore, _ = database.OpenStore(mdb, database.WEBHOOK_DELIVERIES_STORE)
+	if dead := database.DeadWebhookDeliveries(deliveryStore, down.ID); len(dead) != 2 {
+		t.Fatalf("expected both deliveries to %s to be dead, got %+v", down.ID, dead)
+	}
+}